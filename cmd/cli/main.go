@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,11 +18,19 @@ import (
 	"golang.org/x/term"
 	"github.com/gdamore/tcell/v2"
 	"github.com/mattn/go-runewidth"
+	aicache "github.com/ArmyClaw/open-think-reflex/internal/ai/cache"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	aiprovider "github.com/ArmyClaw/open-think-reflex/internal/ai/provider"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/redact"
 	"github.com/ArmyClaw/open-think-reflex/internal/cli/commands"
 	"github.com/ArmyClaw/open-think-reflex/internal/config"
 	"github.com/ArmyClaw/open-think-reflex/internal/core/matcher"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/tagger"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/files"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/memory"
 	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
 	"github.com/ArmyClaw/open-think-reflex/internal/ui"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
 	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
 	"github.com/ArmyClaw/open-think-reflex/pkg/export"
 	"github.com/ArmyClaw/open-think-reflex/pkg/models"
@@ -46,11 +55,72 @@ func Run() error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	storage, err := initStorage(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to initialize storage: %w", err)
+	// Storage is opened before app.Run parses flags, so --ephemeral is
+	// looked up directly
+	ephemeral := ephemeralRequested(os.Args[1:])
+	var tree *files.Storage
+	switch {
+	case ephemeral:
+		// Nothing is opened; see below
+	case cfg.Storage.Type == "files":
+		// Commands work on SQLite, so the tree is checked out into an
+		// in-memory database and the changes are written back on exit
+		if tree, err = files.Open(cfg.Storage.Path); err != nil {
+			return fmt.Errorf("failed to open file storage: %w", err)
+		}
+		defer tree.Close()
+		cfg.Storage.Path = ":memory:"
+		cfg.Storage.AutoMigrate = true
+	case cfg.Storage.Type != "" && cfg.Storage.Type != "sqlite":
+		return fmt.Errorf("unknown storage type: %s", cfg.Storage.Type)
+	}
+
+	// --ephemeral runs on the in-memory backend; storage stays nil and
+	// commands needing the database refuse to run
+	var store contracts.Storage
+	var storage *sqlite.Storage
+	if ephemeral {
+		mem := memory.NewStorage()
+		if err := mem.InitDefaultSpaces(context.Background()); err != nil {
+			return fmt.Errorf("failed to init default spaces: %w", err)
+		}
+		store = mem
+	} else {
+		// otr db, backup and restore take the schema as they find it
+		prepare := tree != nil || !runsOnAnySchema(os.Args[1:])
+		if storage, err = initStorage(cfg, prepare); err != nil {
+			return fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		store = storage
+	}
+	defer store.Close()
+
+	// Scheduled snapshots of the on-disk database; a failure only warns
+	if storage != nil && tree == nil {
+		backup := cfg.Storage.Backup
+		interval := time.Duration(backup.Interval) * time.Hour
+		if _, err := storage.Database().AutoBackup(context.Background(), backup.Dir, interval, backup.Keep); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: automatic backup failed: %v\n", err)
+		}
+		// Watchers poll every second; a day of change log is plenty. An
+		// older schema may not have the change log yet
+		version, err := storage.Database().SchemaVersion(context.Background())
+		if err != nil {
+			return err
+		}
+		if version == sqlite.LatestSchemaVersion() {
+			if _, err := storage.PruneChanges(context.Background(), time.Now().Add(-24*time.Hour)); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to prune change log: %v\n", err)
+			}
+		}
+	}
+
+	var checkout *files.Checkout
+	if tree != nil {
+		if checkout, err = tree.Checkout(context.Background(), storage); err != nil {
+			return fmt.Errorf("failed to load %s: %w", tree.Root(), err)
+		}
 	}
-	defer storage.Close()
 
 	app := &cli.App{
 		Name:    "otr",
@@ -64,6 +134,8 @@ Quick Start:
   otr pattern list        List all patterns
   otr space list         List all spaces
   otr note create --title "My Note" --content "Note content"
+  otr chat                Chat with the AI using your patterns as context
+  otr --ephemeral interactive  Try things out without touching your database
 
 Examples:
   # Create a pattern with tags
@@ -77,7 +149,20 @@ Examples:
 
   # Share a pattern
   otr share create --id <pattern-id>`,
-	Commands: buildCommands(storage, cfg, loader),
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "ephemeral",
+				Usage: "Keep everything in memory; nothing is read from or saved to disk (commands needing the database are unavailable)",
+			},
+		},
+	Commands: buildCommands(store, cfg, loader),
+		// Help and version output don't need the passphrase
+		Before: func(c *cli.Context) error {
+			if storage == nil {
+				return nil
+			}
+			return unlockStorage(storage)
+		},
 		Action: func(c *cli.Context) error {
 			fmt.Println("Open-Think-Reflex v" + Version)
 			fmt.Println("\nUse 'otr --help' to see available commands")
@@ -86,7 +171,89 @@ Examples:
 		},
 	}
 
-	return app.Run(os.Args)
+	err = app.Run(os.Args)
+	if checkout != nil {
+		if cerr := checkout.Commit(context.Background()); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to save to %s: %w", tree.Root(), cerr)
+		}
+	}
+	return err
+}
+
+// ephemeralRequested reports whether --ephemeral appears among the global
+// flags, i.e. before the first command.
+func ephemeralRequested(args []string) bool {
+	for _, arg := range args {
+		switch {
+		case arg == "--ephemeral" || arg == "-ephemeral" || arg == "--ephemeral=true":
+			return true
+		case arg == "--":
+			return false
+		case !strings.HasPrefix(arg, "-"):
+			return false
+		}
+	}
+	return false
+}
+
+// runsOnAnySchema reports whether args run one of the commands that
+// startup must not migrate for and that work on an outdated schema: the
+// db commands migrating or inspecting it, backup and restore.
+func runsOnAnySchema(args []string) bool {
+	var words []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if words = append(words, arg); len(words) == 2 {
+			break
+		}
+	}
+	if len(words) > 0 && (words[0] == "backup" || words[0] == "restore") {
+		return true
+	}
+	if len(words) < 2 || words[0] != "db" {
+		return false
+	}
+	switch words[1] {
+	case "migrate", "status", "rollback":
+		return true
+	}
+	return false
+}
+
+// needsDatabase returns a Before hook refusing a command that uses
+// features only the SQLite backend has when otr runs on another one.
+// With persistent set it is also refused with storage.type files, where
+// the database is a throwaway copy of the tree and anything the command
+// keeps there besides spaces, patterns and notes would be lost.
+func needsDatabase(storage *sqlite.Storage, cfg *config.Config, persistent bool) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		what := "'" + c.Command.HelpName + "'"
+		switch {
+		case storage == nil:
+			return errNoDatabase(what)
+		case persistent && filesMode(cfg):
+			return errFilesMode(what)
+		}
+		return nil
+	}
+}
+
+// errNoDatabase reports that what needs the SQLite database.
+func errNoDatabase(what string) error {
+	return fmt.Errorf("%s is not available with --ephemeral; it needs the SQLite database", what)
+}
+
+// filesMode reports whether the data lives in a file tree, checked out
+// into an in-memory database for the duration of a command.
+func filesMode(cfg *config.Config) bool {
+	return cfg.Storage.Type == "files"
+}
+
+// errFilesMode reports that what keeps state the file tree doesn't hold.
+func errFilesMode(what string) error {
+	return fmt.Errorf("%s is not available with storage.type files; only spaces, patterns and notes are stored in the tree", what)
 }
 
 var configLoader *config.Loader
@@ -107,15 +274,26 @@ func loadConfig() (*config.Config, *config.Loader, error) {
 	return cfg, loader, nil
 }
 
-func initStorage(cfg *config.Config) (*sqlite.Storage, error) {
+// initStorage opens the database. With prepare set the schema is migrated
+// (when storage.auto_migrate is on, up to any pinned version) and must
+// then be current, and the default spaces are created.
+func initStorage(cfg *config.Config, prepare bool) (*sqlite.Storage, error) {
 	db, err := sqlite.NewDatabase(cfg.Storage.Path)
 	if err != nil {
 		return nil, err
 	}
+	if !prepare {
+		return sqlite.NewStorage(db), nil
+	}
 
 	ctx := context.Background()
-	if err := db.Migrate(ctx); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	if cfg.Storage.AutoMigrate {
+		if err := db.Migrate(ctx); err != nil {
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+	if err := db.CheckSchema(ctx); err != nil {
+		return nil, err
 	}
 
 	if err := db.InitDefaultSpaces(ctx); err != nil {
@@ -125,11 +303,60 @@ func initStorage(cfg *config.Config) (*sqlite.Storage, error) {
 	return sqlite.NewStorage(db), nil
 }
 
-func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.Loader) []*cli.Command {
+// unlockStorage unlocks encrypted spaces with OTR_PASSPHRASE, or by
+// prompting when running in a terminal. Without a passphrase encrypted
+// content shows as a placeholder and can't be changed.
+func unlockStorage(storage *sqlite.Storage) error {
+	return unlockWithPrompt(storage, "Passphrase: ")
+}
+
+// unlockWithPrompt is unlockStorage with a custom prompt.
+func unlockWithPrompt(storage *sqlite.Storage, prompt string) error {
+	ctx := context.Background()
+	enabled, err := storage.EncryptionEnabled(ctx)
+	if err != nil || !enabled {
+		return err
+	}
+	passphrase := os.Getenv("OTR_PASSPHRASE")
+	if passphrase == "" {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil
+		}
+		if passphrase, err = readPassphrase(prompt); err != nil {
+			return err
+		}
+	}
+	return storage.Unlock(ctx, passphrase)
+}
+
+// readPassphrase prompts for a passphrase without echoing it. When stdin
+// is not a terminal, a line is read from it instead.
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func buildCommands(store contracts.Storage, cfg *config.Config, loader *config.Loader) []*cli.Command {
+	// Commands using more than contracts.Storage need the SQLite backend;
+	// storage is nil on others and those commands are refused up front
+	storage, _ := store.(*sqlite.Storage)
+	sqliteOnly := needsDatabase(storage, cfg, false)
+	keepsState := needsDatabase(storage, cfg, true)
+
 	return []*cli.Command{
 		{
-			Name:  "thought",
-			Usage: "Manage thought sessions and export",
+			Name:   "thought",
+			Before: keepsState,
+			Usage:  "Manage thought sessions and export",
 			Subcommands: []*cli.Command{
 				{
 					Name:  "export",
@@ -166,7 +393,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 				},
 			},
 			Action: func(c *cli.Context) error {
-				return runInteractive(storage, c.Bool("force"))
+				return runInteractive(store, cfg, c.Bool("force"))
 			},
 		},
 		{
@@ -180,7 +407,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Flags: []cli.Flag{
 						&cli.StringFlag{
 							Name:  "tag",
-							Usage: "Filter by tag",
+							Usage: "Filter by tag (includes subtags)",
 						},
 						&cli.StringFlag{
 							Name:  "space",
@@ -188,7 +415,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return listPatterns(storage, c.String("tag"), c.String("space"))
+						return listPatterns(store, c.String("tag"), c.String("space"))
 					},
 				},
 				{
@@ -217,9 +444,13 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 							Aliases: []string{"tag"},
 							Usage: "Comma-separated tags",
 						},
+						&cli.BoolFlag{
+							Name:  "no-auto-tag",
+							Usage: "Don't suggest tags when none are given",
+						},
 					},
 					Action: func(c *cli.Context) error {
-						return createPattern(storage, c.String("trigger"), c.String("response"), c.String("project"), c.String("tags"))
+						return createPattern(store, c.String("trigger"), c.String("response"), c.String("project"), c.String("tags"), !c.Bool("no-auto-tag"))
 					},
 				},
 				{
@@ -227,7 +458,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Show pattern details",
 					ArgsUsage: "<pattern_id>",
 					Action: func(c *cli.Context) error {
-						return showPattern(storage, c.Args().First())
+						return showPattern(store, c.Args().First())
 					},
 				},
 				{
@@ -235,7 +466,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Delete a pattern",
 					ArgsUsage: "<pattern_id>",
 					Action: func(c *cli.Context) error {
-						return deletePattern(storage, c.Args().First())
+						return deletePattern(store, c.Args().First())
 					},
 				},
 				{
@@ -254,7 +485,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return movePattern(storage, c.String("id"), c.String("space"))
+						return movePattern(store, c.String("id"), c.String("space"))
 					},
 				},
 				{
@@ -293,7 +524,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return updatePattern(storage, c.String("id"), c.String("trigger"), c.String("response"), c.String("project"), c.String("tags"), c.Float64("strength"), c.Float64("threshold"))
+						return updatePattern(store, c.String("id"), c.String("trigger"), c.String("response"), c.String("project"), c.String("tags"), c.Float64("strength"), c.Float64("threshold"))
 					},
 				},
 				{
@@ -311,21 +542,65 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return reinforcePattern(storage, c.String("id"), c.Float64("amount"))
+						return reinforcePattern(store, c.String("id"), c.Float64("amount"))
 					},
 				},
 				{
 					Name:  "decay",
 					Usage: "Apply decay to all patterns",
 					Action: func(c *cli.Context) error {
-						return decayPatterns(storage)
+						return decayPatterns(store)
 					},
 				},
 				{
 					Name:  "stats",
 					Usage: "Show pattern statistics",
 					Action: func(c *cli.Context) error {
-						return showPatternStats(storage)
+						return showPatternStats(store)
+					},
+				},
+				{
+					Name:   "dedupe",
+					Before: keepsState,
+					Usage:  "Find near-duplicate patterns and merge them",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "space",
+							Usage: "Only look at one space",
+						},
+						&cli.Float64Flag{
+							Name:  "threshold",
+							Usage: "Minimum similarity 0-1 (default 0.75)",
+						},
+						&cli.BoolFlag{
+							Name:  "ai",
+							Usage: "Have the AI provider review each group",
+						},
+						&cli.BoolFlag{
+							Name:    "yes",
+							Aliases: []string{"y"},
+							Usage:   "Merge every group without asking",
+						},
+						&cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Only show the proposed merges",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var provider ai.Provider
+						if c.Bool("ai") {
+							p, err := newAIProvider(storage, cfg)
+							if err != nil {
+								return err
+							}
+							provider = p
+						}
+						return commands.Dedupe(storage, provider, commands.DedupeOptions{
+							SpaceID:   c.String("space"),
+							Threshold: c.Float64("threshold"),
+							Yes:       c.Bool("yes"),
+							DryRun:    c.Bool("dry-run"),
+						}, os.Stdin, os.Stdout)
 					},
 				},
 			},
@@ -339,7 +614,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage: "List all spaces",
 					Aliases: []string{"ls"},
 					Action: func(c *cli.Context) error {
-						return commands.ListSpaces(storage)
+						return commands.ListSpaces(store)
 					},
 				},
 				{
@@ -357,7 +632,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return commands.CreateSpace(storage, c.String("name"), c.String("description"))
+						return commands.CreateSpace(store, c.String("name"), c.String("description"))
 					},
 				},
 				{
@@ -365,7 +640,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Show space details",
 					ArgsUsage: "<space_id>",
 					Action: func(c *cli.Context) error {
-						return commands.ShowSpace(storage, c.Args().First())
+						return commands.ShowSpace(store, c.Args().First())
 					},
 				},
 				{
@@ -373,7 +648,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Delete a space",
 					ArgsUsage: "<space_id>",
 					Action: func(c *cli.Context) error {
-						return commands.DeleteSpace(storage, c.Args().First())
+						return commands.DeleteSpace(store, c.Args().First())
 					},
 				},
 				{
@@ -381,7 +656,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Switch to a space",
 					ArgsUsage: "<space_id>",
 					Action: func(c *cli.Context) error {
-						return commands.UseSpace(storage, cfg, loader, c.Args().First())
+						return commands.UseSpace(store, cfg, loader, c.Args().First())
 					},
 				},
 				{
@@ -389,14 +664,32 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Set a space as default",
 					ArgsUsage: "<space_id>",
 					Action: func(c *cli.Context) error {
-						return commands.SetDefaultSpace(storage, c.Args().First())
+						return commands.SetDefaultSpace(store, c.Args().First())
+					},
+				},
+				{
+					Name:      "encrypt",
+					Before:    keepsState,
+					Usage:     "Encrypt a space's responses and notes at rest (see 'otr db rekey')",
+					ArgsUsage: "<space_id>",
+					Action: func(c *cli.Context) error {
+						return commands.SpaceEncrypt(storage, c.Args().First(), true, os.Stdout)
+					},
+				},
+				{
+					Name:      "decrypt",
+					Before:    keepsState,
+					Usage:     "Store a space's content in plaintext again",
+					ArgsUsage: "<space_id>",
+					Action: func(c *cli.Context) error {
+						return commands.SpaceEncrypt(storage, c.Args().First(), false, os.Stdout)
 					},
 				},
 				{
 					Name:  "stats",
 					Usage: "Show space statistics",
 					Action: func(c *cli.Context) error {
-						return showSpaceStats(storage)
+						return showSpaceStats(store)
 					},
 				},
 				{
@@ -415,7 +708,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return exportSpace(storage, c.String("id"), c.String("output"))
+						return exportSpace(store, c.String("id"), c.String("output"))
 					},
 				},
 				{
@@ -433,7 +726,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return importSpace(storage, c.String("input"), c.Bool("force"))
+						return importSpace(store, c.String("input"), c.Bool("force"))
 					},
 				},
 			},
@@ -455,13 +748,17 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 							Name:  "category",
 							Usage: "Filter by category (thought/idea/todo/memory/question/note)",
 						},
+						&cli.StringFlag{
+							Name:  "tag",
+							Usage: "Filter by tag (includes subtags)",
+						},
 						&cli.BoolFlag{
 							Name:  "recent",
 							Usage: "Show only recent notes (last 10)",
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return listNotes(storage, c.String("space"), c.String("category"), c.Bool("recent"))
+						return listNotes(store, c.String("space"), c.String("category"), c.String("tag"), c.Bool("recent"))
 					},
 				},
 				{
@@ -489,9 +786,13 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 							Name:  "space",
 							Usage: "Space ID",
 						},
+						&cli.BoolFlag{
+							Name:  "no-auto-tag",
+							Usage: "Don't suggest tags and a category",
+						},
 					},
 					Action: func(c *cli.Context) error {
-						return createNote(storage, c.String("title"), c.String("content"), c.String("category"), c.String("space"))
+						return createNote(store, c.String("title"), c.String("content"), c.String("category"), c.String("space"), !c.Bool("no-auto-tag"))
 					},
 				},
 				{
@@ -499,7 +800,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Show note details",
 					ArgsUsage: "<note_id>",
 					Action: func(c *cli.Context) error {
-						return showNote(storage, c.Args().First())
+						return showNote(store, c.Args().First())
 					},
 				},
 				{
@@ -507,7 +808,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Usage:     "Delete a note",
 					ArgsUsage: "<note_id>",
 					Action: func(c *cli.Context) error {
-						return deleteNote(storage, c.Args().First())
+						return deleteNote(store, c.Args().First())
 					},
 				},
 				{
@@ -521,7 +822,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return searchNotes(storage, c.String("query"))
+						return searchNotes(store, c.String("query"))
 					},
 				},
 				{
@@ -540,7 +841,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return linkPatternToNote(storage, c.String("note"), c.String("pattern"))
+						return linkPatternToNote(store, c.String("note"), c.String("pattern"))
 					},
 				},
 				{
@@ -559,7 +860,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return unlinkPatternFromNote(storage, c.String("note"), c.String("pattern"))
+						return unlinkPatternFromNote(store, c.String("note"), c.String("pattern"))
 					},
 				},
 				{
@@ -585,7 +886,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return updateNote(storage, c.String("id"), c.String("title"), c.String("content"), c.String("category"))
+						return updateNote(store, c.String("id"), c.String("title"), c.String("content"), c.String("category"))
 					},
 				},
 			},
@@ -595,7 +896,51 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 			Usage: "Show overall statistics summary",
 			Aliases: []string{"s"},
 			Action: func(c *cli.Context) error {
-				return showSummary(storage)
+				return showSummary(store)
+			},
+		},
+		{
+			Name:   "digest",
+			Before: sqliteOnly,
+			Usage:  "Write a review of recent notes and reflex activity and save it as a note",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "since",
+					Value: "7d",
+					Usage: "Review period (e.g. 7d, 2w, 2024-01-01)",
+				},
+				&cli.StringFlag{
+					Name:  "space",
+					Usage: "Space to save the digest in (default: current space)",
+				},
+				&cli.BoolFlag{
+					Name:  "no-ai",
+					Usage: "Write a template-only report without calling the AI provider",
+				},
+				&cli.BoolFlag{
+					Name:  "no-save",
+					Usage: "Print the digest without saving it",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var provider ai.Provider
+				if !c.Bool("no-ai") {
+					p, err := newAIProvider(storage, cfg)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "AI not available (%v); writing a template-only report\n", err)
+					} else {
+						provider = p
+					}
+				}
+				spaceID := c.String("space")
+				if spaceID == "" {
+					spaceID = cfg.GetCurrentSpace()
+				}
+				return commands.Digest(storage, provider, commands.DigestOptions{
+					Since:   c.String("since"),
+					SpaceID: spaceID,
+					NoSave:  c.Bool("no-save"),
+				}, os.Stdout)
 			},
 		},
 		{
@@ -608,25 +953,172 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 		},
 		{
 			Name:  "backup",
-			Usage: "Backup data to a file",
+			Usage: "Snapshot the database, or export patterns to JSON/YAML",
 			Aliases: []string{"save"},
 			Flags: []cli.Flag{
 				&cli.StringFlag{
-					Name:     "output",
-					Required: true,
-					Usage:    "Output backup file path",
+					Name:  "output",
+					Usage: "Output file path (default: a new snapshot in storage.backup.dir)",
 				},
 				&cli.StringFlag{
 					Name:  "format",
-					Usage: "Backup format: json, yaml (default: json)",
+					Usage: "Backup format: db, json, yaml (default: from the output extension, else db)",
 				},
 				&cli.BoolFlag{
 					Name:  "include-notes",
-					Usage: "Include notes in backup",
+					Usage: "Also export notes (json and yaml; snapshots always include them)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				output, format := c.String("output"), c.String("format")
+				if format == "" {
+					format = backupFormat(output)
+				}
+				if format == "db" {
+					if storage == nil {
+						return errNoDatabase("A database snapshot")
+					}
+					if filesMode(cfg) {
+						return errFilesMode("A database snapshot")
+					}
+					return commands.BackupSnapshot(storage.Database(), cfg.Storage.Backup.Dir, output, cfg.Storage.Backup.Keep, os.Stdout)
+				}
+				return createBackup(store, output, format, c.Bool("include-notes"))
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name:    "list",
+					Before:  keepsState,
+					Usage:   "List database snapshots",
+					Aliases: []string{"ls"},
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "verify",
+							Usage: "Check each snapshot and count its contents",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return commands.BackupList(cfg.Storage.Backup.Dir, c.Bool("verify"), os.Stdout)
+					},
+				},
+			},
+		},
+		{
+			Name:      "restore",
+			Before:    keepsState,
+			Usage:     "Replace the database with a snapshot (the current database is backed up first)",
+			ArgsUsage: "<backup file>",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "yes",
+					Aliases: []string{"y"},
+					Usage:   "Do not ask for confirmation",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return commands.Restore(storage.Database(), cfg.Storage.Backup.Dir, c.Args().First(), cfg.Storage.Backup.Keep, c.Bool("yes"), os.Stdin, os.Stdout)
+			},
+		},
+		{
+			Name:      "sync",
+			Before:    keepsState,
+			Usage:     "Sync with another database, or through the hub database in a shared folder",
+			ArgsUsage: "<database file | sync folder>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "strategy",
+					Value: string(sqlite.SyncFieldMerge),
+					Usage: "Resolve records changed on both sides: field (merge field by field) or lww (last writer wins)",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Show what would change without writing",
+				},
+				&cli.StringFlag{
+					Name:  "report",
+					Usage: "Also write the conflict report to this JSON file",
+				},
+				&cli.BoolFlag{
+					Name:  "new-replica-id",
+					Usage: "Give this database a new sync identity (after copying it from another device)",
 				},
 			},
 			Action: func(c *cli.Context) error {
-				return createBackup(storage, c.String("output"), c.String("format"), c.Bool("include-notes"))
+				if c.Bool("new-replica-id") {
+					if err := commands.SyncResetID(storage, os.Stdout); err != nil {
+						return err
+					}
+					if c.Args().Len() == 0 {
+						return nil
+					}
+				}
+				strategy, err := sqlite.ParseSyncStrategy(c.String("strategy"))
+				if err != nil {
+					return err
+				}
+				peer, path, err := commands.OpenSyncPeer(c.Args().First())
+				if err != nil {
+					return err
+				}
+				defer peer.Close()
+				if err := unlockWithPrompt(peer, fmt.Sprintf("Passphrase for %s: ", path)); err != nil {
+					return err
+				}
+				opts := sqlite.SyncOptions{Strategy: strategy, DryRun: c.Bool("dry-run")}
+				return commands.Sync(storage, peer, path, opts, c.String("report"), os.Stdout)
+			},
+		},
+		{
+			Name:   "db",
+			Before: keepsState,
+			Usage:  "Manage the database schema",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "migrate",
+					Usage: "Apply pending schema migrations",
+					Flags: []cli.Flag{
+						&cli.IntFlag{
+							Name:  "to",
+							Usage: "Stop at this schema version and keep it on later startups (default: latest)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return commands.DBMigrate(storage.Database(), c.Int("to"), os.Stdout)
+					},
+				},
+				{
+					Name:  "status",
+					Usage: "Show the schema version and migrations",
+					Action: func(c *cli.Context) error {
+						return commands.DBStatus(storage.Database(), cfg.Version, os.Stdout)
+					},
+				},
+				{
+					Name:  "rollback",
+					Usage: "Revert the most recent migrations; other commands refuse to run until 'otr db migrate' (the database is backed up first)",
+					Flags: []cli.Flag{
+						&cli.IntFlag{
+							Name:  "steps",
+							Value: 1,
+							Usage: "Number of migrations to revert",
+						},
+						&cli.BoolFlag{
+							Name:    "yes",
+							Aliases: []string{"y"},
+							Usage:   "Do not ask for confirmation",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return commands.DBRollback(storage.Database(), c.Int("steps"), c.Bool("yes"), os.Stdin, os.Stdout)
+					},
+				},
+				{
+					Name:  "rekey",
+					Usage: "Set the encryption passphrase, or change it and rotate the key",
+					Action: func(c *cli.Context) error {
+						return commands.DBRekey(storage, readPassphrase, os.Stdout)
+					},
+				},
 			},
 		},
 		{
@@ -634,7 +1126,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 			Usage: "Run diagnostics and health checks",
 			Aliases: []string{"diag"},
 			Action: func(c *cli.Context) error {
-				return runDiagnostics(storage)
+				return runDiagnostics(store)
 			},
 		},
 		{
@@ -646,7 +1138,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 					Name:  "list",
 					Usage: "List all public patterns",
 					Action: func(c *cli.Context) error {
-						return listPublicPatterns(storage)
+						return listPublicPatterns(store)
 					},
 				},
 				{
@@ -660,7 +1152,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return sharePattern(storage, c.String("id"))
+						return sharePattern(store, c.String("id"))
 					},
 				},
 				{
@@ -674,7 +1166,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return importSharedPattern(storage, c.String("code"))
+						return importSharedPattern(store, c.String("code"))
 					},
 				},
 				{
@@ -688,7 +1180,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return shareSpace(storage, c.String("id"))
+						return shareSpace(store, c.String("id"))
 					},
 				},
 			},
@@ -709,17 +1201,333 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 				},
 			},
 			Action: func(c *cli.Context) error {
-				return runQuery(storage, c.String("query"), c.Float64("threshold"))
+				return runQuery(store, c.String("query"), c.Float64("threshold"))
+			},
+		},
+		{
+			Name:      "chat",
+			Before:    keepsState,
+			Usage:     "Chat with the AI, keeping matched patterns as context",
+			ArgsUsage: "[message]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "id",
+					Usage: "Continue the conversation with this ID",
+				},
+				&cli.BoolFlag{
+					Name:    "continue",
+					Aliases: []string{"c"},
+					Usage:   "Continue the most recent conversation",
+				},
+				&cli.StringFlag{
+					Name:  "space",
+					Usage: "Match patterns only in this space (default: current space)",
+				},
+				&cli.Float64Flag{
+					Name:  "threshold",
+					Usage: "Minimum confidence threshold (default 30)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "attach",
+					Usage: "Attach a file to the first message (repeatable)",
+				},
+				&cli.BoolFlag{
+					Name:  "list",
+					Usage: "List recent conversations",
+				},
+				&cli.BoolFlag{
+					Name:  "no-cache",
+					Usage: "Always call the AI provider instead of using cached responses",
+				},
+				&cli.BoolFlag{
+					Name:  "save",
+					Usage: "Save the answer as a new pattern (with a message)",
+				},
+				&cli.BoolFlag{
+					Name:  "replace",
+					Usage: "Replace the matched pattern's response with the answer (with a message)",
+				},
+				&cli.BoolFlag{
+					Name:  "no-tools",
+					Usage: "Don't let the AI search or change your patterns and notes",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("list") {
+					return commands.ListConversations(storage, 20)
+				}
+				provider, err := newAIProvider(storage, cfg)
+				if err != nil {
+					return err
+				}
+				spaceID := c.String("space")
+				if spaceID == "" {
+					spaceID = cfg.GetCurrentSpace()
+				}
+				builder, err := prompt.NewBuilderForSpace(cfg.AI.Prompts, spaceID)
+				if err != nil {
+					return err
+				}
+				return commands.Chat(storage, provider, commands.ChatOptions{
+					ConversationID: c.String("id"),
+					Continue:       c.Bool("continue"),
+					SpaceID:        spaceID,
+					Threshold:      c.Float64("threshold"),
+					Message:        strings.Join(c.Args().Slice(), " "),
+					Attachments:    c.StringSlice("attach"),
+					NoCache:        c.Bool("no-cache"),
+					Save:           c.Bool("save"),
+					Replace:        c.Bool("replace"),
+					NoTools:        c.Bool("no-tools"),
+					Builder:        builder,
+				}, os.Stdin, os.Stdout)
+			},
+		},
+		{
+			Name:   "prompt",
+			Before: sqliteOnly,
+			Usage:  "Inspect AI prompts",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "preview",
+					Usage:     "Render the prompt for a query without sending it",
+					ArgsUsage: "<query>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "space",
+							Usage: "Space to match patterns and pick templates in (default: current space)",
+						},
+						&cli.Float64Flag{
+							Name:  "threshold",
+							Usage: "Minimum confidence threshold (default 30)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						spaceID := c.String("space")
+						if spaceID == "" {
+							spaceID = cfg.GetCurrentSpace()
+						}
+						builder, err := prompt.NewBuilderForSpace(cfg.AI.Prompts, spaceID)
+						if err != nil {
+							return err
+						}
+						var r *redact.Redactor
+						if cfg.AI.Redact.Enabled {
+							if r, err = redact.New(cfg.AI.Redact); err != nil {
+								return err
+							}
+						}
+						return commands.PreviewPrompt(storage, builder, r, spaceID, c.Float64("threshold"),
+							strings.Join(c.Args().Slice(), " "), os.Stdout)
+					},
+				},
+			},
+		},
+		{
+			Name:   "usage",
+			Before: keepsState,
+			Usage:  "Show AI token usage and cost",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "by",
+					Value: "day",
+					Usage: "Group by: day, space or model",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Value: "30d",
+					Usage: "Report period (e.g. 7d, 2w, 2024-01-01)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return commands.ShowUsage(storage, cfg, c.String("by"), c.String("since"))
+			},
+		},
+		{
+			Name:  "redact",
+			Usage: "Preview secret redaction before data is sent to AI providers",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "check",
+					Usage:     "Show what would be redacted from text (reads stdin without arguments)",
+					ArgsUsage: "[text]",
+					Action: func(c *cli.Context) error {
+						r, err := redact.New(cfg.AI.Redact)
+						if err != nil {
+							return err
+						}
+						text := strings.Join(c.Args().Slice(), " ")
+						if text == "" {
+							data, err := io.ReadAll(os.Stdin)
+							if err != nil {
+								return fmt.Errorf("failed to read stdin: %w", err)
+							}
+							text = string(data)
+						}
+						return commands.RedactCheck(r, text, os.Stdout)
+					},
+				},
+				{
+					Name:  "scan",
+					Usage: "List stored patterns and notes containing values that would be redacted",
+					Action: func(c *cli.Context) error {
+						r, err := redact.New(cfg.AI.Redact)
+						if err != nil {
+							return err
+						}
+						if !cfg.AI.Redact.Enabled {
+							fmt.Println("Note: redaction is disabled (ai.redact.enabled)")
+						}
+						return commands.RedactScan(store, r, os.Stdout)
+					},
+				},
+			},
+		},
+		{
+			Name:  "tag",
+			Usage: "Manage tags",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "suggest",
+					Usage: "Suggest tags and note categories from the tags already in use",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "space",
+							Usage: "Only look at one space",
+						},
+						&cli.BoolFlag{
+							Name:  "patterns",
+							Usage: "Only patterns",
+						},
+						&cli.BoolFlag{
+							Name:  "notes",
+							Usage: "Only notes",
+						},
+						&cli.BoolFlag{
+							Name:  "all",
+							Usage: "Include items that already have tags",
+						},
+						&cli.Float64Flag{
+							Name:  "min-confidence",
+							Usage: "Minimum confidence 0-1 (default 0.3)",
+						},
+						&cli.BoolFlag{
+							Name:  "ai",
+							Usage: "Have the AI provider refine the suggestions",
+						},
+						&cli.BoolFlag{
+							Name:  "apply",
+							Usage: "Save the suggestions",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var provider ai.Provider
+						if c.Bool("ai") {
+							p, err := newAIProvider(storage, cfg)
+							if err != nil {
+								return err
+							}
+							provider = p
+						}
+						return commands.TagSuggest(store, provider, commands.TagSuggestOptions{
+							SpaceID:       c.String("space"),
+							Patterns:      c.Bool("patterns"),
+							Notes:         c.Bool("notes"),
+							All:           c.Bool("all"),
+							Apply:         c.Bool("apply"),
+							MinConfidence: c.Float64("min-confidence"),
+						}, os.Stdout)
+					},
+				},
+				{
+					Name:   "list",
+					Before: sqliteOnly,
+					Usage:  "List tags with pattern and note counts",
+					Action: func(c *cli.Context) error {
+						return commands.TagList(storage, os.Stdout)
+					},
+				},
+				{
+					Name:      "rename",
+					Before:    sqliteOnly,
+					Usage:     "Rename a tag and its subtags on all patterns and notes",
+					ArgsUsage: "<old> <new>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							return fmt.Errorf("usage: otr tag rename <old> <new>")
+						}
+						return commands.TagRename(storage, c.Args().Get(0), c.Args().Get(1), os.Stdout)
+					},
+				},
+				{
+					Name:      "merge",
+					Before:    sqliteOnly,
+					Usage:     "Merge tags into another tag on all patterns and notes",
+					ArgsUsage: "<tag>... <into>",
+					Action: func(c *cli.Context) error {
+						if c.NArg() < 2 {
+							return fmt.Errorf("usage: otr tag merge <tag>... <into>")
+						}
+						args := c.Args().Slice()
+						return commands.TagMerge(storage, args[:len(args)-1], args[len(args)-1], os.Stdout)
+					},
+				},
+				{
+					Name:      "delete",
+					Before:    sqliteOnly,
+					Usage:     "Remove a tag from all patterns and notes (subtags are kept)",
+					ArgsUsage: "<tag>",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "yes",
+							Aliases: []string{"y"},
+							Usage:   "Do not ask for confirmation",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("usage: otr tag delete <tag>")
+						}
+						return commands.TagDelete(storage, c.Args().First(), c.Bool("yes"), os.Stdin, os.Stdout)
+					},
+				},
+			},
+		},
+		{
+			Name:   "cache",
+			Before: keepsState,
+			Usage:  "Manage the AI response cache",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "stats",
+					Usage: "Show response cache statistics",
+					Action: func(c *cli.Context) error {
+						return commands.CacheStats(storage, cfg)
+					},
+				},
+				{
+					Name:  "clear",
+					Usage: "Delete cached responses",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "expired",
+							Usage: "Only delete expired entries",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return commands.CacheClear(storage, c.Bool("expired"))
+					},
+				},
 			},
 		},
 		{
 			Name:  "export",
-			Usage: "Export patterns to a JSON file",
+			Usage: "Export patterns to a JSON file, or everything to a .otrz archive",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "output",
 					Required: true,
-					Usage:    "Output file path",
+					Usage:    "Output file path (.otrz writes a full archive)",
 				},
 				&cli.StringFlag{
 					Name:  "project",
@@ -727,25 +1535,58 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 				},
 			},
 			Action: func(c *cli.Context) error {
-				return exportPatterns(storage, c.String("output"), c.String("project"))
+				if commands.IsArchivePath(c.String("output")) {
+					if c.String("project") != "" {
+						return fmt.Errorf("--project cannot be used with a .otrz archive")
+					}
+					if storage == nil {
+						return errNoDatabase("A .otrz archive")
+					}
+					return commands.ArchiveExport(storage, c.String("output"), os.Stdout)
+				}
+				return exportPatterns(store, c.String("output"), c.String("project"))
 			},
 		},
 		{
 			Name:  "import",
-			Usage: "Import patterns from a JSON file",
+			Usage: "Import patterns from a JSON file, or everything from a .otrz archive",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "input",
 					Required: true,
-					Usage:    "Input file path",
+					Usage:    "Input file path (.otrz reads a full archive)",
 				},
 				&cli.BoolFlag{
 					Name:  "force",
 					Usage: "Overwrite existing patterns with same ID",
 				},
+				&cli.BoolFlag{
+					Name:  "no-auto-tag",
+					Usage: "Don't suggest tags for untagged patterns",
+				},
+				&cli.BoolFlag{
+					Name:  "new-ids",
+					Usage: "Give every item from a .otrz archive a new ID",
+				},
+				&cli.BoolFlag{
+					Name:  "allow-plaintext",
+					Usage: "Import encrypted spaces from a .otrz archive unencrypted while the database is locked",
+				},
 			},
 			Action: func(c *cli.Context) error {
-				return importPatterns(storage, c.String("input"), c.Bool("force"))
+				if commands.IsArchivePath(c.String("input")) {
+					if c.Bool("force") {
+						return fmt.Errorf("--force cannot be used with a .otrz archive; existing items are never overwritten")
+					}
+					if storage == nil {
+						return errNoDatabase("A .otrz archive")
+					}
+					return commands.ArchiveImport(storage, c.String("input"), sqlite.ArchiveImportOptions{
+						NewIDs:         c.Bool("new-ids"),
+						AllowPlaintext: c.Bool("allow-plaintext"),
+					}, os.Stdout)
+				}
+				return importPatterns(store, c.String("input"), c.Bool("force"), !c.Bool("no-auto-tag"))
 			},
 		},
 		{
@@ -768,7 +1609,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return exportSkill(storage, c.String("id"), c.String("output"))
+						return exportSkill(store, c.String("id"), c.String("output"))
 					},
 				},
 				{
@@ -786,7 +1627,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 						},
 					},
 					Action: func(c *cli.Context) error {
-						return exportSkillsBatch(storage, c.String("output"), c.String("space"))
+						return exportSkillsBatch(store, c.String("output"), c.String("space"))
 					},
 				},
 			},
@@ -794,7 +1635,7 @@ func buildCommands(storage *sqlite.Storage, cfg *config.Config, loader *config.L
 	}
 }
 
-func listPatterns(storage *sqlite.Storage, tagFilter, spaceFilter string) error {
+func listPatterns(storage contracts.Storage, tagFilter, spaceFilter string) error {
 	ctx := context.Background()
 	
 	opts := contracts.ListOptions{Limit: 100}
@@ -810,20 +1651,6 @@ func listPatterns(storage *sqlite.Storage, tagFilter, spaceFilter string) error
 		return err
 	}
 
-	// Additional tag filtering if needed
-	if tagFilter != "" {
-		var filtered []*models.Pattern
-		for _, p := range patterns {
-			for _, t := range p.Tags {
-				if t == tagFilter {
-					filtered = append(filtered, p)
-					break
-				}
-			}
-		}
-		patterns = filtered
-	}
-
 	if len(patterns) == 0 {
 		fmt.Println("No patterns found")
 		return nil
@@ -841,7 +1668,7 @@ func listPatterns(storage *sqlite.Storage, tagFilter, spaceFilter string) error
 	return nil
 }
 
-func createPattern(storage *sqlite.Storage, trigger, response, project, tagsStr string) error {
+func createPattern(storage contracts.Storage, trigger, response, project, tagsStr string, autoTag bool) error {
 	ctx := context.Background()
 	pattern := models.NewPattern(trigger, response)
 	pattern.Project = project
@@ -855,15 +1682,29 @@ func createPattern(storage *sqlite.Storage, trigger, response, project, tagsStr
 		pattern.Tags = tags
 	}
 
+	var suggested []tagger.Suggestion
+	if autoTag && len(pattern.Tags) == 0 {
+		t, err := tagger.Load(ctx, storage)
+		if err != nil {
+			return err
+		}
+		if suggested, err = commands.AutoTagPattern(ctx, t, pattern); err != nil {
+			return err
+		}
+	}
+
 	if err := storage.SavePattern(ctx, pattern); err != nil {
 		return err
 	}
 
 	fmt.Printf("Pattern created: %s\n", pattern.ID)
+	if len(suggested) > 0 {
+		fmt.Printf("Auto-tagged: %s\n", commands.FormatSuggestions(suggested))
+	}
 	return nil
 }
 
-func showPattern(storage *sqlite.Storage, id string) error {
+func showPattern(storage contracts.Storage, id string) error {
 	if id == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -882,10 +1723,77 @@ func showPattern(storage *sqlite.Storage, id string) error {
 	fmt.Printf("  Created: %s\n", pattern.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("  Updated: %s\n", pattern.UpdatedAt.Format("2006-01-02 15:04:05"))
 
+	// Aliases and provenance are only recorded in the database
+	if db, ok := storage.(*sqlite.Storage); ok {
+		aliases, err := db.ListPatternAliases(ctx, pattern.ID)
+		if err != nil {
+			return err
+		}
+		if len(aliases) > 0 {
+			fmt.Printf("  Aliases: %s\n", strings.Join(aliases, ", "))
+		}
+
+		prov, err := db.GetPatternProvenance(ctx, pattern.ID)
+		if err != nil {
+			return err
+		}
+		if prov != nil {
+			fmt.Printf("  Source: %s (%s %s, %s)\n", prov.Source, prov.Provider, prov.Model, prov.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	notes, err := patternNotes(ctx, storage, pattern.ID)
+	if err != nil {
+		return err
+	}
+	if len(notes) > 0 {
+		fmt.Printf("  Linked notes:\n")
+		for _, n := range notes {
+			fmt.Printf("    %s  %s\n", n.ID[:min(8, len(n.ID))], n.Title)
+		}
+	}
+
 	return nil
 }
 
-func deletePattern(storage *sqlite.Storage, id string) error {
+// patternNotes returns the notes linked to a pattern.
+func patternNotes(ctx context.Context, storage contracts.Storage, patternID string) ([]*models.Note, error) {
+	if db, ok := storage.(*sqlite.Storage); ok {
+		return db.ListPatternNotes(ctx, patternID)
+	}
+	all, err := storage.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var notes []*models.Note
+	for _, n := range all {
+		for _, id := range n.PatternIDs {
+			if id == patternID {
+				notes = append(notes, n)
+				break
+			}
+		}
+	}
+	return notes, nil
+}
+
+// notePatterns returns the live patterns a note links to.
+func notePatterns(ctx context.Context, storage contracts.Storage, note *models.Note) ([]*models.Pattern, error) {
+	if db, ok := storage.(*sqlite.Storage); ok {
+		return db.ListNotePatterns(ctx, note.ID)
+	}
+	patterns := make([]*models.Pattern, 0, len(note.PatternIDs))
+	for _, id := range note.PatternIDs {
+		p, err := storage.GetPattern(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func deletePattern(storage contracts.Storage, id string) error {
 	if id == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -899,7 +1807,7 @@ func deletePattern(storage *sqlite.Storage, id string) error {
 	return nil
 }
 
-func movePattern(storage *sqlite.Storage, patternID, spaceID string) error {
+func movePattern(storage contracts.Storage, patternID, spaceID string) error {
 	if patternID == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -929,7 +1837,7 @@ func movePattern(storage *sqlite.Storage, patternID, spaceID string) error {
 	return nil
 }
 
-func updatePattern(storage *sqlite.Storage, id, trigger, response, project, tagsStr string, strength, threshold float64) error {
+func updatePattern(storage contracts.Storage, id, trigger, response, project, tagsStr string, strength, threshold float64) error {
 	if id == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -972,7 +1880,7 @@ func updatePattern(storage *sqlite.Storage, id, trigger, response, project, tags
 	return nil
 }
 
-func reinforcePattern(storage *sqlite.Storage, id string, amount float64) error {
+func reinforcePattern(storage contracts.Storage, id string, amount float64) error {
 	if id == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -1006,7 +1914,7 @@ func reinforcePattern(storage *sqlite.Storage, id string, amount float64) error
 	return nil
 }
 
-func decayPatterns(storage *sqlite.Storage) error {
+func decayPatterns(storage contracts.Storage) error {
 	ctx := context.Background()
 	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 1000})
 	if err != nil {
@@ -1051,7 +1959,7 @@ func decayPatterns(storage *sqlite.Storage) error {
 }
 
 // showPatternStats displays pattern statistics
-func showPatternStats(storage *sqlite.Storage) error {
+func showPatternStats(storage contracts.Storage) error {
 	ctx := context.Background()
 	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 10000})
 	if err != nil {
@@ -1132,7 +2040,7 @@ func showPatternStats(storage *sqlite.Storage) error {
 }
 
 // showSummary displays overall system summary
-func showSummary(storage *sqlite.Storage) error {
+func showSummary(storage contracts.Storage) error {
 	ctx := context.Background()
 
 	// Get patterns count
@@ -1186,7 +2094,7 @@ func showSummary(storage *sqlite.Storage) error {
 	return nil
 }
 
-func exportSpace(storage *sqlite.Storage, spaceID, outputPath string) error {
+func exportSpace(storage contracts.Storage, spaceID, outputPath string) error {
 	if spaceID == "" {
 		return fmt.Errorf("space ID required")
 	}
@@ -1218,7 +2126,7 @@ func exportSpace(storage *sqlite.Storage, spaceID, outputPath string) error {
 	return nil
 }
 
-func importSpace(storage *sqlite.Storage, inputPath string, force bool) error {
+func importSpace(storage contracts.Storage, inputPath string, force bool) error {
 	if inputPath == "" {
 		return fmt.Errorf("input path required")
 	}
@@ -1265,13 +2173,16 @@ func importSpace(storage *sqlite.Storage, inputPath string, force bool) error {
 	return nil
 }
 
-func listNotes(storage *sqlite.Storage, spaceID, category string, recent bool) error {
+func listNotes(storage contracts.Storage, spaceID, category, tag string, recent bool) error {
 	ctx := context.Background()
 
 	opts := contracts.ListOptions{
 		SpaceID: spaceID,
 		Limit:   10, // Default limit
 	}
+	if tag != "" {
+		opts.Tags = []string{tag}
+	}
 
 	notes, err := storage.ListNotes(ctx, opts)
 	if err != nil {
@@ -1311,7 +2222,7 @@ func listNotes(storage *sqlite.Storage, spaceID, category string, recent bool) e
 	return nil
 }
 
-func createNote(storage *sqlite.Storage, title, content, category, spaceID string) error {
+func createNote(storage contracts.Storage, title, content, category, spaceID string, autoTag bool) error {
 	ctx := context.Background()
 
 	note := &models.Note{
@@ -1328,15 +2239,32 @@ func createNote(storage *sqlite.Storage, title, content, category, spaceID strin
 		note.Category = "note"
 	}
 
+	var suggested *tagger.Result
+	if autoTag {
+		t, err := tagger.Load(ctx, storage)
+		if err != nil {
+			return err
+		}
+		if suggested, err = commands.AutoTagNote(ctx, t, note); err != nil {
+			return err
+		}
+	}
+
 	if err := storage.SaveNote(ctx, note); err != nil {
 		return fmt.Errorf("failed to create note: %w", err)
 	}
 
 	fmt.Printf("Note created: %s\n", note.ID)
+	if suggested != nil && len(suggested.Tags) > 0 {
+		fmt.Printf("Auto-tagged: %s\n", commands.FormatSuggestions(suggested.Tags))
+	}
+	if suggested != nil && suggested.Category != nil {
+		fmt.Printf("Category: %s\n", commands.FormatSuggestions([]tagger.Suggestion{*suggested.Category}))
+	}
 	return nil
 }
 
-func showNote(storage *sqlite.Storage, noteID string) error {
+func showNote(storage contracts.Storage, noteID string) error {
 	if noteID == "" {
 		return fmt.Errorf("note ID required")
 	}
@@ -1354,12 +2282,24 @@ func showNote(storage *sqlite.Storage, noteID string) error {
 	fmt.Printf("  Words: %d\n", note.WordCount)
 	fmt.Printf("  Created: %s\n", note.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("  Updated: %s\n", note.UpdatedAt.Format("2006-01-02 15:04:05"))
+
+	patterns, err := notePatterns(ctx, storage, note)
+	if err != nil {
+		return err
+	}
+	if len(patterns) > 0 {
+		fmt.Printf("  Linked patterns:\n")
+		for _, p := range patterns {
+			fmt.Printf("    %s  %s\n", p.ID[:min(8, len(p.ID))], p.Trigger)
+		}
+	}
+
 	fmt.Printf("\nContent:\n%s\n", note.Content)
 
 	return nil
 }
 
-func deleteNote(storage *sqlite.Storage, noteID string) error {
+func deleteNote(storage contracts.Storage, noteID string) error {
 	if noteID == "" {
 		return fmt.Errorf("note ID required")
 	}
@@ -1373,7 +2313,7 @@ func deleteNote(storage *sqlite.Storage, noteID string) error {
 	return nil
 }
 
-func searchNotes(storage *sqlite.Storage, query string) error {
+func searchNotes(storage contracts.Storage, query string) error {
 	if query == "" {
 		return fmt.Errorf("search query required")
 	}
@@ -1398,7 +2338,7 @@ func searchNotes(storage *sqlite.Storage, query string) error {
 }
 
 // updateNote updates an existing note
-func updateNote(storage *sqlite.Storage, noteID, title, content, category string) error {
+func updateNote(storage contracts.Storage, noteID, title, content, category string) error {
 	if noteID == "" {
 		return fmt.Errorf("note ID required")
 	}
@@ -1428,7 +2368,7 @@ func updateNote(storage *sqlite.Storage, noteID, title, content, category string
 	return nil
 }
 
-func linkPatternToNote(storage *sqlite.Storage, noteID, patternID string) error {
+func linkPatternToNote(storage contracts.Storage, noteID, patternID string) error {
 	if noteID == "" {
 		return fmt.Errorf("note ID required")
 	}
@@ -1460,7 +2400,7 @@ func linkPatternToNote(storage *sqlite.Storage, noteID, patternID string) error
 	return nil
 }
 
-func unlinkPatternFromNote(storage *sqlite.Storage, noteID, patternID string) error {
+func unlinkPatternFromNote(storage contracts.Storage, noteID, patternID string) error {
 	if noteID == "" {
 		return fmt.Errorf("note ID required")
 	}
@@ -1486,7 +2426,64 @@ func unlinkPatternFromNote(storage *sqlite.Storage, noteID, patternID string) er
 	return nil
 }
 
-func runQuery(storage *sqlite.Storage, query string, threshold float64) error {
+// newAIProvider builds the configured AI provider with usage tracking,
+// budget enforcement and response caching backed by storage.
+func newAIProvider(storage *sqlite.Storage, cfg *config.Config) (ai.Provider, error) {
+	provider, _, err := newAIProviderWithCache(storage, cfg)
+	return provider, err
+}
+
+// newAIProviderWithCache is newAIProvider that also returns the response
+// cache, nil when caching is disabled.
+func newAIProviderWithCache(storage *sqlite.Storage, cfg *config.Config) (ai.Provider, *aicache.Cache, error) {
+	if storage == nil {
+		return nil, nil, errNoDatabase("The AI provider")
+	}
+	if filesMode(cfg) {
+		// The ledger and cache would only fill the throwaway database
+		fmt.Fprintln(os.Stderr, "Warning: AI usage and cached responses are not kept with storage.type files; budgets are not tracked")
+		provider, err := aiprovider.New(cfg.AI)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create AI provider: %w", err)
+		}
+		return provider, nil, nil
+	}
+	opts := []aiprovider.Option{
+		aiprovider.WithLedger(storage),
+		aiprovider.WithBudgetWarning(func(s ai.BudgetStatus) {
+			fmt.Fprintf(os.Stderr, "Warning: %s AI budget at $%.2f of $%.2f\n", s.Period, s.Spent, s.Limit)
+		}),
+	}
+	var cache *aicache.Cache
+	if cfg.AI.Cache.Enabled {
+		cache = aicache.New(storage, aicache.Config{
+			TTL:           time.Duration(cfg.AI.Cache.TTL) * time.Second,
+			MaxEntries:    cfg.AI.Cache.MaxEntries,
+			MemoryEntries: cfg.AI.Cache.MemoryEntries,
+		})
+		opts = append(opts, aiprovider.WithCache(cache))
+	}
+	provider, err := aiprovider.New(cfg.AI, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create AI provider: %w", err)
+	}
+	return provider, cache, nil
+}
+
+// forgetChangedResponses drops responses other processes removed from the
+// shared cache (otr cache clear, pruning) from the in-memory front of
+// cache, until changes is closed.
+func forgetChangedResponses(changes <-chan sqlite.ChangeEvent, cache *aicache.Cache) {
+	for ev := range changes {
+		if ev.Reset {
+			cache.ForgetAll()
+		} else if keys, ok := ev.IDs(sqlite.ChangeAIResponse); ok {
+			cache.Forget(keys...)
+		}
+	}
+}
+
+func runQuery(storage contracts.Storage, query string, threshold float64) error {
 	if threshold <= 0 {
 		threshold = 30.0
 	}
@@ -1540,7 +2537,13 @@ func runQuery(storage *sqlite.Storage, query string, threshold float64) error {
 	return nil
 }
 
-func runInteractive(storage *sqlite.Storage, force bool) error {
+func runInteractive(store contracts.Storage, cfg *config.Config, force bool) error {
+	// The Windows console mode keeps its thought tree in the database
+	storage, _ := store.(*sqlite.Storage)
+	if runtime.GOOS == "windows" && storage == nil {
+		return errNoDatabase("Interactive mode on Windows")
+	}
+
 	// If TERM is not set, try to create a pseudo-TTY on Unix.
 	// On Windows, continue without script (tcell handles the console directly).
 	if os.Getenv("TERM") == "" && runtime.GOOS != "windows" {
@@ -1588,8 +2591,38 @@ func runInteractive(storage *sqlite.Storage, force bool) error {
 		return runANSIInteractive(storage)
 	}
 
-	app := ui.NewApp(storage)
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app := ui.NewApp(store)
+	app.SetPrompts(cfg.AI.Prompts, cfg.GetCurrentSpace())
+	if storage == nil {
+		// Nothing else writes to other backends, and AI features need the
+		// database for usage tracking
+		return app.Run(ctx)
+	}
+
+	if filesMode(cfg) {
+		// Other processes write to the tree, not to this process's copy
+		// of it, so there is nothing to watch
+		app.SetNotice("Live refresh is off with storage.type files; restart to see changes made elsewhere")
+		if provider, err := newAIProvider(storage, cfg); err == nil {
+			app.SetProvider(provider)
+		}
+		return app.Run(ctx)
+	}
+
+	// Follow changes made from other terminals, e.g. 'otr pattern create'
+	watcher := storage.NewWatcher(time.Second)
+	app.SetWatcher(watcher)
+	// Branch expansion is optional; the TUI works without a provider
+	if provider, cache, err := newAIProviderWithCache(storage, cfg); err == nil {
+		app.SetProvider(provider)
+		if cache != nil {
+			go forgetChangedResponses(watcher.Subscribe(), cache)
+		}
+	}
+	go watcher.Run(ctx)
 	return app.Run(ctx)
 }
 
@@ -2773,7 +3806,7 @@ func truncate(s string, maxLen int) string {
 }
 
 // exportPatterns exports patterns to a JSON file.
-func exportPatterns(storage *sqlite.Storage, outputPath, projectFilter string) error {
+func exportPatterns(storage contracts.Storage, outputPath, projectFilter string) error {
 	ctx := context.Background()
 
 	var patterns []*models.Pattern
@@ -2807,17 +3840,25 @@ func exportPatterns(storage *sqlite.Storage, outputPath, projectFilter string) e
 	return nil
 }
 
-// createBackup creates a full backup of all data
-func createBackup(storage *sqlite.Storage, outputPath, format string, includeNotes bool) error {
-	if outputPath == "" {
-		return fmt.Errorf("output path required")
+// backupFormat picks the backup format from the output file's extension.
+func backupFormat(outputPath string) string {
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
 	}
+	return "db"
+}
 
-	if format == "" {
-		format = "json"
+// createBackup exports patterns, and optionally notes, to JSON or YAML
+func createBackup(storage contracts.Storage, outputPath, format string, includeNotes bool) error {
+	if outputPath == "" {
+		return fmt.Errorf("output path required")
 	}
 
 	ctx := context.Background()
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
 
 	// Get all patterns
 	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 10000})
@@ -2847,7 +3888,7 @@ func createBackup(storage *sqlite.Storage, outputPath, format string, includeNot
 			}
 			filename := outputPath
 			if len(spaces) > 1 {
-				filename = fmt.Sprintf("%s_%s.yaml", outputPath[:len(outputPath)-5], space.ID)
+				filename = fmt.Sprintf("%s_%s.yaml", base, space.ID)
 			}
 			if err := exporter.ExportSpaceToYAML(ctx, space, spacePatterns, filename); err != nil {
 				fmt.Printf("Warning: failed to backup space %s: %v\n", space.Name, err)
@@ -2864,11 +3905,26 @@ func createBackup(storage *sqlite.Storage, outputPath, format string, includeNot
 		fmt.Printf("Backup completed: %s (%d patterns)\n", outputPath, len(patterns))
 	}
 
+	if includeNotes {
+		notes, err := storage.ListNotes(ctx, contracts.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list notes: %w", err)
+		}
+		notesPath, exportNotes := base+"_notes.json", exporter.ExportNotesToJSON
+		if format == "yaml" || format == "yml" {
+			notesPath, exportNotes = base+"_notes.yaml", exporter.ExportNotesToYAML
+		}
+		if err := exportNotes(ctx, notes, notesPath); err != nil {
+			return fmt.Errorf("failed to back up notes: %w", err)
+		}
+		fmt.Printf("Notes backed up: %s (%d notes)\n", notesPath, len(notes))
+	}
+
 	return nil
 }
 
 // listPublicPatterns lists all patterns (shareable ones)
-func listPublicPatterns(storage *sqlite.Storage) error {
+func listPublicPatterns(storage contracts.Storage) error {
 	ctx := context.Background()
 
 	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 100})
@@ -2895,7 +3951,7 @@ func listPublicPatterns(storage *sqlite.Storage) error {
 }
 
 // sharePattern generates a shareable code for a pattern
-func sharePattern(storage *sqlite.Storage, patternID string) error {
+func sharePattern(storage contracts.Storage, patternID string) error {
 	if patternID == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -2936,7 +3992,7 @@ func sharePattern(storage *sqlite.Storage, patternID string) error {
 }
 
 // importSharedPattern imports a pattern from a share code
-func importSharedPattern(storage *sqlite.Storage, code string) error {
+func importSharedPattern(storage contracts.Storage, code string) error {
 	if code == "" {
 		return fmt.Errorf("share code required")
 	}
@@ -2968,7 +4024,7 @@ func importSharedPattern(storage *sqlite.Storage, code string) error {
 }
 
 // importPatterns imports patterns from a JSON file.
-func importPatterns(storage *sqlite.Storage, inputPath string, force bool) error {
+func importPatterns(storage contracts.Storage, inputPath string, force, autoTag bool) error {
 	ctx := context.Background()
 
 	importer := export.NewImporter()
@@ -2977,10 +4033,35 @@ func importPatterns(storage *sqlite.Storage, inputPath string, force bool) error
 		return fmt.Errorf("failed to import: %w", err)
 	}
 
+	var t *tagger.Tagger
+	if autoTag {
+		// Learn from the existing patterns plus the tagged ones being imported
+		existing, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 10000})
+		if err != nil {
+			return fmt.Errorf("failed to list patterns: %w", err)
+		}
+		for i := range importData.Patterns {
+			existing = append(existing, &importData.Patterns[i])
+		}
+		t = tagger.New()
+		t.Learn(existing, nil)
+	}
+
 	imported := 0
 	skipped := 0
+	tagged := 0
 
 	for _, p := range importData.Patterns {
+		if t != nil {
+			suggested, err := commands.AutoTagPattern(ctx, t, &p)
+			if err != nil {
+				return err
+			}
+			if len(suggested) > 0 {
+				tagged++
+			}
+		}
+
 		// Check if pattern already exists
 		existing, err := storage.GetPattern(ctx, p.ID)
 		if err == nil && existing != nil {
@@ -3008,10 +4089,13 @@ func importPatterns(storage *sqlite.Storage, inputPath string, force bool) error
 	if skipped > 0 {
 		fmt.Printf("Skipped %d existing patterns\n", skipped)
 	}
+	if tagged > 0 {
+		fmt.Printf("Auto-tagged %d untagged patterns\n", tagged)
+	}
 	return nil
 }
 
-func exportSkill(storage *sqlite.Storage, patternID, outputPath string) error {
+func exportSkill(storage contracts.Storage, patternID, outputPath string) error {
 	if patternID == "" {
 		return fmt.Errorf("pattern ID required")
 	}
@@ -3060,7 +4144,7 @@ func exportSkill(storage *sqlite.Storage, patternID, outputPath string) error {
 	return nil
 }
 
-func exportSkillsBatch(storage *sqlite.Storage, outputDir, spaceID string) error {
+func exportSkillsBatch(storage contracts.Storage, outputDir, spaceID string) error {
 	if outputDir == "" {
 		return fmt.Errorf("output directory required")
 	}
@@ -3125,7 +4209,7 @@ func exportSkillsBatch(storage *sqlite.Storage, outputDir, spaceID string) error
 }
 
 // shareSpace shares an entire space with all its patterns
-func shareSpace(storage *sqlite.Storage, spaceID string) error {
+func shareSpace(storage contracts.Storage, spaceID string) error {
 	if spaceID == "" {
 		return fmt.Errorf("space ID required")
 	}
@@ -3173,7 +4257,7 @@ func shareSpace(storage *sqlite.Storage, spaceID string) error {
 }
 
 // runDiagnostics performs health checks on the database
-func runDiagnostics(storage *sqlite.Storage) error {
+func runDiagnostics(storage contracts.Storage) error {
 	ctx := context.Background()
 
 	fmt.Println("🔍 Running diagnostics...")
@@ -3234,7 +4318,7 @@ func runDiagnostics(storage *sqlite.Storage) error {
 }
 
 // showSpaceStats displays space statistics
-func showSpaceStats(storage *sqlite.Storage) error {
+func showSpaceStats(storage contracts.Storage) error {
 	ctx := context.Background()
 
 	spaces, err := storage.ListSpaces(ctx)
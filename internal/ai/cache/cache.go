@@ -0,0 +1,245 @@
+// Package cache caches AI responses so repeated questions against the same
+// matched patterns do not call the provider again.
+// Entries are persisted in SQLite with a TTL and a size limit; the
+// in-memory LRU from internal/data/cache serves as a front tier.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	datacache "github.com/ArmyClaw/open-think-reflex/internal/data/cache"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Store persists cache entries. Implemented by the SQLite storage.
+type Store interface {
+	// GetCachedResponse returns the live entry for key, or nil on a miss.
+	GetCachedResponse(ctx context.Context, key string, now time.Time) (*models.CachedResponse, error)
+
+	// PutCachedResponse stores an entry, keeping at most maxEntries.
+	PutCachedResponse(ctx context.Context, c *models.CachedResponse, maxEntries int) error
+
+	// SpaceEncrypted reports whether a space keeps its content encrypted.
+	SpaceEncrypted(ctx context.Context, spaceID string) (bool, error)
+}
+
+// Config controls cache limits. Zero values use the defaults.
+type Config struct {
+	TTL           time.Duration // Entry lifetime (default 24h)
+	MaxEntries    int           // Max persisted entries (default 1000, <0 = unlimited)
+	MemoryEntries int           // Max in-memory entries (default 100)
+}
+
+// Cache is a two-tier response cache. Safe for concurrent use.
+type Cache struct {
+	store Store
+	front *datacache.Cache
+	cfg   Config
+	now   func() time.Time
+}
+
+// New creates a cache backed by store.
+func New(store Store, cfg Config) *Cache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = 1000
+	}
+	if cfg.MemoryEntries <= 0 {
+		cfg.MemoryEntries = 100
+	}
+	return &Cache{
+		store: store,
+		front: datacache.New(cfg.MemoryEntries, cfg.TTL),
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Key returns the cache key for a request sent to provider: a hash of the
+// provider, model, system prompt, prompt (including conversation history)
+// and temperature.
+func Key(provider string, req *ai.Request) string {
+	data, _ := json.Marshal(struct {
+		Provider    string       `json:"provider"`
+		Model       string       `json:"model"`
+		System      string       `json:"system"`
+		Prompt      []ai.Message `json:"prompt"`
+		Temperature float64      `json:"temperature"`
+	}{provider, req.Model, req.System, req.Conversation(), req.Temperature})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached response for key, checking memory first.
+// Storage errors are treated as misses.
+func (c *Cache) Get(ctx context.Context, key string) (*ai.Response, bool) {
+	now := c.now()
+	if v, ok := c.front.Get(key); ok {
+		entry := v.(*models.CachedResponse)
+		if !entry.Expired(now) {
+			return toResponse(entry), true
+		}
+		c.front.Delete(key)
+	}
+
+	entry, err := c.store.GetCachedResponse(ctx, key, now)
+	if err != nil || entry == nil {
+		return nil, false
+	}
+	c.front.Set(key, entry)
+	return toResponse(entry), true
+}
+
+// Put stores resp under key in both tiers.
+func (c *Cache) Put(ctx context.Context, key, provider string, resp *ai.Response) error {
+	now := c.now()
+	entry := &models.CachedResponse{
+		Key:          key,
+		Provider:     provider,
+		Model:        resp.Model,
+		Content:      resp.Content,
+		FinishReason: resp.FinishReason,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(c.cfg.TTL),
+	}
+	if resp.Usage != nil {
+		entry.InputTokens = resp.Usage.InputTokens
+		entry.OutputTokens = resp.Usage.OutputTokens
+	}
+	c.front.Set(key, entry)
+	return c.store.PutCachedResponse(ctx, entry, c.cfg.MaxEntries)
+}
+
+// Forget drops keys from memory, after another process removed them from
+// the store.
+func (c *Cache) Forget(keys ...string) {
+	for _, key := range keys {
+		c.front.Delete(key)
+	}
+}
+
+// ForgetAll empties the memory tier; entries are reloaded from the store.
+func (c *Cache) ForgetAll() {
+	c.front.Clear()
+}
+
+func toResponse(entry *models.CachedResponse) *ai.Response {
+	resp := &ai.Response{
+		Content:      entry.Content,
+		Model:        entry.Model,
+		FinishReason: entry.FinishReason,
+	}
+	if entry.InputTokens > 0 || entry.OutputTokens > 0 {
+		resp.Usage = &ai.Usage{
+			InputTokens:  entry.InputTokens,
+			OutputTokens: entry.OutputTokens,
+			TotalTokens:  entry.InputTokens + entry.OutputTokens,
+		}
+	}
+	return resp
+}
+
+// ==================== Bypass ====================
+
+// bypassKey is the context key for skipping cache lookups.
+type bypassKey struct{}
+
+// WithBypass returns a context whose calls skip the cache lookup.
+// Fresh responses are still stored, replacing any stale entry.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// Bypassed reports whether ctx was created by WithBypass.
+func Bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// privateKey is the context key for requests that must not be cached.
+type privateKey struct{}
+
+// WithPrivate returns a context whose calls neither read nor store cache
+// entries, for requests carrying content from encrypted spaces: entries
+// are stored in plaintext.
+func WithPrivate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, privateKey{}, true)
+}
+
+// private reports whether calls in ctx must skip the cache: ctx was
+// created by WithPrivate or its space (see ai.WithSpace) is encrypted.
+// A failed lookup counts as private.
+func (c *Cache) private(ctx context.Context) bool {
+	if private, _ := ctx.Value(privateKey{}).(bool); private {
+		return true
+	}
+	encrypted, err := c.store.SpaceEncrypted(ctx, ai.SpaceFromContext(ctx))
+	return err != nil || encrypted
+}
+
+// ==================== Middleware ====================
+
+// Middleware returns an ai.Middleware serving Generate calls from the cache.
+// Streams, requests with tools and private requests are passed through
+// uncached. Place it
+// outermost so cache hits are neither billed nor counted against budgets.
+func (c *Cache) Middleware() ai.Middleware {
+	return func(next ai.Provider) ai.Provider {
+		return &cachedProvider{next: next, cache: c}
+	}
+}
+
+type cachedProvider struct {
+	next  ai.Provider
+	cache *Cache
+}
+
+func (p *cachedProvider) Name() string { return p.next.Name() }
+
+func (p *cachedProvider) DefaultModel() string { return ai.DefaultModel(p.next) }
+
+func (p *cachedProvider) Generate(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	if len(req.Tools) > 0 {
+		// Tool results depend on current data, so answers are not reusable
+		return p.next.Generate(ctx, req)
+	}
+	if p.cache.private(ctx) {
+		return p.next.Generate(ctx, req)
+	}
+	key := Key(p.next.Name(), req)
+	if !Bypassed(ctx) {
+		if resp, ok := p.cache.Get(ctx, key); ok {
+			return resp, nil
+		}
+	}
+
+	resp, err := p.next.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Content != "" {
+		// A failed write only costs a future miss
+		_ = p.cache.Put(context.WithoutCancel(ctx), key, p.next.Name(), resp)
+	}
+	return resp, nil
+}
+
+func (p *cachedProvider) GenerateStream(ctx context.Context, req *ai.Request) (io.ReadCloser, error) {
+	return p.next.GenerateStream(ctx, req)
+}
+
+func (p *cachedProvider) StreamEvents(ctx context.Context, req *ai.Request) (ai.EventStream, error) {
+	return ai.OpenStream(ctx, p.next, req)
+}
+
+func (p *cachedProvider) ValidateKey(ctx context.Context) error {
+	return p.next.ValidateKey(ctx)
+}
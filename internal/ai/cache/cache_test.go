@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// memStore is an in-memory Store for tests.
+type memStore struct {
+	mu        sync.Mutex
+	entries   map[string]*models.CachedResponse
+	gets      int
+	encrypted map[string]bool // Encrypted spaces
+}
+
+func newMemStore() *memStore {
+	return &memStore{entries: make(map[string]*models.CachedResponse)}
+}
+
+func (s *memStore) GetCachedResponse(ctx context.Context, key string, now time.Time) (*models.CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	c, ok := s.entries[key]
+	if !ok || c.Expired(now) {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func (s *memStore) PutCachedResponse(ctx context.Context, c *models.CachedResponse, maxEntries int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[c.Key] = c
+	return nil
+}
+
+func (s *memStore) SpaceEncrypted(ctx context.Context, spaceID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encrypted[spaceID], nil
+}
+
+func TestKey(t *testing.T) {
+	base := &ai.Request{Model: "m", System: "s", Prompt: "p", Temperature: 0.5}
+	key := Key("claude", base)
+	if key != Key("claude", &ai.Request{Model: "m", System: "s", Prompt: "p", Temperature: 0.5}) {
+		t.Error("equal requests should have equal keys")
+	}
+
+	variants := map[string]string{
+		"provider":    Key("openai", base),
+		"model":       Key("claude", &ai.Request{Model: "x", System: "s", Prompt: "p", Temperature: 0.5}),
+		"system":      Key("claude", &ai.Request{Model: "m", System: "x", Prompt: "p", Temperature: 0.5}),
+		"prompt":      Key("claude", &ai.Request{Model: "m", System: "s", Prompt: "x", Temperature: 0.5}),
+		"temperature": Key("claude", &ai.Request{Model: "m", System: "s", Prompt: "p", Temperature: 0.9}),
+		"history": Key("claude", &ai.Request{Model: "m", System: "s", Temperature: 0.5, Messages: []ai.Message{
+			{Role: ai.RoleUser, Content: "earlier"}, {Role: ai.RoleAssistant, Content: "reply"}, {Role: ai.RoleUser, Content: "p"},
+		}}),
+	}
+	for field, k := range variants {
+		if k == key {
+			t.Errorf("changing %s should change the key", field)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	fake := ai.NewFakeProvider(
+		ai.FakeStep{Content: "first", Usage: &ai.Usage{InputTokens: 3, OutputTokens: 2}},
+		ai.FakeStep{Content: "second"},
+	)
+	store := newMemStore()
+	c := New(store, Config{TTL: time.Hour})
+	p := ai.Chain(fake, c.Middleware())
+	ctx := context.Background()
+	req := &ai.Request{Prompt: "hello"}
+
+	resp, err := p.Generate(ctx, req)
+	if err != nil || resp.Content != "first" {
+		t.Fatalf("Generate = %v, %v", resp, err)
+	}
+	resp, err = p.Generate(ctx, req)
+	if err != nil || resp.Content != "first" {
+		t.Fatalf("cached Generate = %v, %v", resp, err)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 5 {
+		t.Errorf("cached usage = %+v", resp.Usage)
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Errorf("provider called %d times, want 1", n)
+	}
+	if store.gets != 1 {
+		t.Errorf("store read %d times, want 1 (second hit served from memory)", store.gets)
+	}
+
+	// A fresh cache over the same store serves the persisted entry
+	resp, _ = ai.Chain(fake, New(store, Config{TTL: time.Hour}).Middleware()).Generate(ctx, req)
+	if resp.Content != "first" || len(fake.Requests()) != 1 {
+		t.Errorf("persisted entry not served: %q", resp.Content)
+	}
+
+	// Bypass calls the provider and refreshes the entry
+	resp, _ = p.Generate(WithBypass(ctx), req)
+	if resp.Content != "second" || len(fake.Requests()) != 2 {
+		t.Errorf("bypass = %q after %d calls", resp.Content, len(fake.Requests()))
+	}
+	resp, _ = p.Generate(ctx, req)
+	if resp.Content != "second" {
+		t.Errorf("entry not refreshed: %q", resp.Content)
+	}
+}
+
+func TestMiddleware_Private(t *testing.T) {
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "a"}, ai.FakeStep{Content: "b"}, ai.FakeStep{Content: "c"})
+	store := newMemStore()
+	store.encrypted = map[string]bool{"work": true}
+	p := ai.Chain(fake, New(store, Config{TTL: time.Hour}).Middleware())
+	req := &ai.Request{Prompt: "q"}
+
+	// Encrypted spaces and private requests are neither served nor stored
+	for _, ctx := range []context.Context{
+		ai.WithSpace(context.Background(), "work"),
+		WithPrivate(context.Background()),
+	} {
+		p.Generate(ctx, req)
+	}
+	if len(store.entries) != 0 || store.gets != 0 {
+		t.Errorf("expected the store untouched, got %d entries and %d reads", len(store.entries), store.gets)
+	}
+	resp, _ := p.Generate(context.Background(), req)
+	if resp.Content != "c" {
+		t.Errorf("expected a fresh answer outside encrypted spaces, got %q", resp.Content)
+	}
+}
+
+func TestMiddleware_Expiry(t *testing.T) {
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "a"}, ai.FakeStep{Content: "b"})
+	c := New(newMemStore(), Config{TTL: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	p := ai.Chain(fake, c.Middleware())
+	req := &ai.Request{Prompt: "q"}
+
+	p.Generate(context.Background(), req)
+	now = now.Add(2 * time.Minute)
+	resp, _ := p.Generate(context.Background(), req)
+	if resp.Content != "b" {
+		t.Errorf("expired entry served: %q", resp.Content)
+	}
+}
+
+func TestForget(t *testing.T) {
+	store := newMemStore()
+	c := New(store, Config{TTL: time.Hour})
+	ctx := context.Background()
+	if err := c.Put(ctx, "k", "fake", &ai.Response{Content: "cached"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process cleared the store; memory must not keep serving it
+	delete(store.entries, "k")
+	if _, ok := c.Get(ctx, "k"); !ok {
+		t.Fatal("expected the memory tier to still hold the entry")
+	}
+	c.Forget("k")
+	if _, ok := c.Get(ctx, "k"); ok {
+		t.Error("expected a miss after Forget")
+	}
+
+	c.Put(ctx, "k", "fake", &ai.Response{Content: "again"})
+	delete(store.entries, "k")
+	c.ForgetAll()
+	if _, ok := c.Get(ctx, "k"); ok {
+		t.Error("expected a miss after ForgetAll")
+	}
+}
@@ -0,0 +1,138 @@
+package prompt
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Candidate is a pattern competing for space in the prompt context.
+type Candidate struct {
+	Pattern    *models.Pattern
+	Confidence float64 // Match confidence (0-100); 0 for carried-over context
+}
+
+// Candidates wraps patterns without match confidence.
+func Candidates(patterns []*models.Pattern) []Candidate {
+	cands := make([]Candidate, len(patterns))
+	for i, p := range patterns {
+		cands[i] = Candidate{Pattern: p}
+	}
+	return cands
+}
+
+// FitResult reports how patterns were fitted into the context budget.
+type FitResult struct {
+	Included  []*models.Pattern // Patterns in the prompt, best first
+	Truncated []string          // IDs of included patterns whose response was shortened
+	Dropped   []*models.Pattern // Patterns left out entirely
+	Tokens    int               // Estimated tokens used by the included patterns
+	Budget    int               // Token budget (0 = unlimited)
+}
+
+// minResponseTokens is the smallest useful truncated response; patterns
+// that cannot get this much room are dropped instead.
+const minResponseTokens = 32
+
+// truncatedMarker is appended to shortened responses.
+const truncatedMarker = " …[truncated]"
+
+// Fit ranks candidates by confidence, then strength, and fits them into the
+// builder's token budget. Each response is capped at half the budget so one
+// long pattern cannot crowd out the rest; responses that do not fit are
+// truncated at a sentence or word boundary, or dropped when too little room
+// is left. Included patterns are copies, so truncation never alters the
+// caller's patterns.
+func (b *Builder) Fit(candidates []Candidate) *FitResult {
+	ranked := make([]Candidate, len(candidates))
+	copy(ranked, candidates)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Confidence != ranked[j].Confidence {
+			return ranked[i].Confidence > ranked[j].Confidence
+		}
+		return ranked[i].Pattern.Strength > ranked[j].Pattern.Strength
+	})
+
+	result := &FitResult{Budget: b.maxTokens}
+	if b.maxTokens <= 0 {
+		for _, c := range ranked {
+			result.Included = append(result.Included, c.Pattern)
+			result.Tokens += patternTokens(c.Pattern)
+		}
+		return result
+	}
+
+	remaining := b.maxTokens - ai.EstimateTokens(patternsHeader)
+	perPattern := b.maxTokens / 2
+	for _, c := range ranked {
+		p := c.Pattern
+		overhead := patternTokens(p) - ai.EstimateTokens(p.Response)
+		room := remaining - overhead
+		if room > perPattern {
+			room = perPattern
+		}
+
+		if ai.EstimateTokens(p.Response) <= room {
+			result.Included = append(result.Included, p)
+			used := patternTokens(p)
+			result.Tokens += used
+			remaining -= used
+			continue
+		}
+		if room < minResponseTokens {
+			result.Dropped = append(result.Dropped, p)
+			continue
+		}
+
+		short := *p
+		short.Response = truncateTokens(p.Response, room)
+		result.Included = append(result.Included, &short)
+		result.Truncated = append(result.Truncated, p.ID)
+		used := patternTokens(&short)
+		result.Tokens += used
+		remaining -= used
+	}
+	return result
+}
+
+// patternTokens estimates the tokens a pattern takes in the
+// "Relevant Patterns" section.
+func patternTokens(p *models.Pattern) int {
+	var sb strings.Builder
+	writePattern(&sb, 1, p)
+	return ai.EstimateTokens(sb.String())
+}
+
+// truncateTokens shortens s to about n tokens, preferring to cut after a
+// sentence, then a line, then a word.
+func truncateTokens(s string, n int) string {
+	limit := n*4 - len(truncatedMarker)
+	if limit <= 0 {
+		return strings.TrimSpace(truncatedMarker)
+	}
+	if len(s) <= limit {
+		return s
+	}
+
+	cut := s[:limit]
+	// Only back off to a boundary if it keeps most of the text
+	minCut := limit * 2 / 3
+	for _, sep := range []string{". ", "。", "\n", " "} {
+		if i := strings.LastIndex(cut, sep); i >= minCut {
+			cut = cut[:i+len(sep)]
+			break
+		}
+	}
+	// Avoid splitting a multi-byte rune
+	for len(cut) > 0 && !utf8Start(s, len(cut)) {
+		cut = cut[:len(cut)-1]
+	}
+	return strings.TrimRight(cut, " \n") + truncatedMarker
+}
+
+// utf8Start reports whether s[i] starts a rune (or i is the end of s).
+func utf8Start(s string, i int) bool {
+	return i >= len(s) || s[i]&0xC0 != 0x80
+}
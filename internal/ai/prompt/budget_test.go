@@ -0,0 +1,102 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func pattern(id string, strength float64, responseLen int) *models.Pattern {
+	return &models.Pattern{
+		ID:       id,
+		Trigger:  id,
+		Response: strings.Repeat("word ", responseLen/5),
+		Strength: strength,
+	}
+}
+
+func TestBuilder_Fit_RanksByConfidenceThenStrength(t *testing.T) {
+	b := NewBuilder().WithOptions(WithMaxTokens(0))
+	fit := b.Fit([]Candidate{
+		{Pattern: pattern("weak", 10, 20), Confidence: 50},
+		{Pattern: pattern("carried", 90, 20)},
+		{Pattern: pattern("strong", 80, 20), Confidence: 50},
+		{Pattern: pattern("best", 10, 20), Confidence: 90},
+	})
+
+	var got []string
+	for _, p := range fit.Included {
+		got = append(got, p.ID)
+	}
+	if strings.Join(got, ",") != "best,strong,weak,carried" {
+		t.Errorf("unexpected order: %v", got)
+	}
+	if len(fit.Dropped) != 0 || len(fit.Truncated) != 0 {
+		t.Error("unlimited budget should keep everything intact")
+	}
+}
+
+func TestBuilder_Fit_TruncatesAndDrops(t *testing.T) {
+	b := NewBuilder().WithOptions(WithMaxTokens(300))
+	long := pattern("long", 50, 4000)
+	fit := b.Fit([]Candidate{
+		{Pattern: pattern("short", 50, 100), Confidence: 80},
+		{Pattern: long, Confidence: 70},
+		{Pattern: pattern("extra", 50, 2000), Confidence: 60},
+		{Pattern: pattern("tail", 50, 500), Confidence: 50},
+	})
+
+	var included []string
+	for _, p := range fit.Included {
+		included = append(included, p.ID)
+	}
+	if strings.Join(included, ",") != "short,long,extra" {
+		t.Fatalf("unexpected included patterns: %v", included)
+	}
+	// long is capped at half the budget, extra gets what is left
+	if strings.Join(fit.Truncated, ",") != "long,extra" {
+		t.Errorf("unexpected truncated patterns: %v", fit.Truncated)
+	}
+	if !strings.HasSuffix(fit.Included[1].Response, truncatedMarker) {
+		t.Error("truncated response should be marked")
+	}
+	if len(long.Response) != 4000 {
+		t.Error("Fit must not modify the caller's pattern")
+	}
+	if len(fit.Dropped) != 1 || fit.Dropped[0].ID != "tail" {
+		t.Errorf("expected tail to be dropped, got %v", fit.Dropped)
+	}
+	if fit.Tokens > fit.Budget {
+		t.Errorf("used %d tokens, over budget %d", fit.Tokens, fit.Budget)
+	}
+}
+
+func TestBuilder_BuildRequest_RespectsBudget(t *testing.T) {
+	b := NewBuilder().WithOptions(WithMaxTokens(200))
+	result := b.BuildRequest("question", []*models.Pattern{pattern("huge", 50, 10000)})
+	if len(result) > 2000 {
+		t.Errorf("prompt too long: %d bytes", len(result))
+	}
+	if !strings.Contains(result, truncatedMarker) {
+		t.Error("expected truncated pattern response")
+	}
+}
+
+func TestTruncateTokens(t *testing.T) {
+	s := "First sentence here. Second sentence is quite a bit longer than the first."
+	got := truncateTokens(s, 10)
+	if got != "First sentence here."+truncatedMarker {
+		t.Errorf("expected cut at sentence boundary, got %q", got)
+	}
+	if truncateTokens("short", 10) != "short" {
+		t.Error("short text should be unchanged")
+	}
+	if got := truncateTokens(strings.Repeat("思考", 100), 10); !strings.HasSuffix(got, truncatedMarker) || !utf8Valid(got) {
+		t.Errorf("bad multi-byte truncation: %q", got)
+	}
+}
+
+func utf8Valid(s string) bool {
+	return strings.ToValidUTF8(s, "?") == s
+}
@@ -3,6 +3,7 @@ package prompt
 import (
 	"fmt"
 	"strings"
+	"text/template"
 
 	"github.com/ArmyClaw/open-think-reflex/pkg/models"
 )
@@ -11,6 +12,8 @@ import (
 type Builder struct {
 	systemPrompt string
 	 maxTokens   int
+	systemTmpl   *template.Template // User-defined system prompt (nil = systemPrompt)
+	promptTmpl   *template.Template // User-defined prompt template (nil = built-in)
 }
 
 // NewBuilder creates a new prompt builder
@@ -39,13 +42,50 @@ func WithSystemPrompt(prompt string) Option {
 	}
 }
 
-// WithMaxTokens sets max tokens
+// WithMaxTokens sets the token budget for pattern context (0 = unlimited)
 func WithMaxTokens(tokens int) Option {
 	return func(b *Builder) {
 		b.maxTokens = tokens
 	}
 }
 
+// WithSystemTemplate sets a template rendering the system prompt
+func WithSystemTemplate(tmpl *template.Template) Option {
+	return func(b *Builder) {
+		b.systemTmpl = tmpl
+	}
+}
+
+// WithPromptTemplate sets a template rendering the user prompt
+func WithPromptTemplate(tmpl *template.Template) Option {
+	return func(b *Builder) {
+		b.promptTmpl = tmpl
+	}
+}
+
+// HasTemplates reports whether user-defined templates are configured
+func (b *Builder) HasTemplates() bool {
+	return b.systemTmpl != nil || b.promptTmpl != nil
+}
+
+// RenderSystem renders the system prompt for a chat turn.
+// Without a system template this is BuildChatSystemPrompt.
+func (b *Builder) RenderSystem(data *Data) (string, error) {
+	if b.systemTmpl == nil {
+		return b.BuildChatSystemPrompt(data.Patterns), nil
+	}
+	return execute(b.systemTmpl, data)
+}
+
+// RenderPrompt renders the user prompt for a chat turn.
+// Without a prompt template the query is sent as is.
+func (b *Builder) RenderPrompt(data *Data) (string, error) {
+	if b.promptTmpl == nil {
+		return data.Query, nil
+	}
+	return execute(b.promptTmpl, data)
+}
+
 // BuildRequest builds a prompt request from input and matched patterns
 func (b *Builder) BuildRequest(input string, matchedPatterns []*models.Pattern) string {
 	var sb strings.Builder
@@ -54,26 +94,9 @@ func (b *Builder) BuildRequest(input string, matchedPatterns []*models.Pattern)
 	sb.WriteString(b.systemPrompt)
 	sb.WriteString("\n\n")
 
-	// Add context from matched patterns
-	if len(matchedPatterns) > 0 {
-		sb.WriteString("## Relevant Patterns\n")
-		sb.WriteString("The following patterns are relevant to the user's input:\n\n")
-
-		for i, p := range matchedPatterns {
-			sb.WriteString(fmt.Sprintf("### Pattern %d\n", i+1))
-			sb.WriteString(fmt.Sprintf("**Trigger**: %s\n", p.Trigger))
-			sb.WriteString(fmt.Sprintf("**Response**: %s\n", p.Response))
-			
-			if len(p.Tags) > 0 {
-				sb.WriteString(fmt.Sprintf("**Tags**: %s\n", strings.Join(p.Tags, ", ")))
-			}
-			if p.Project != "" {
-				sb.WriteString(fmt.Sprintf("**Project**: %s\n", p.Project))
-			}
-			sb.WriteString(fmt.Sprintf("**Strength**: %.1f/100\n", p.Strength))
-			sb.WriteString("\n")
-		}
-
+	// Add context from matched patterns, within the token budget
+	if fitted := b.Fit(Candidates(matchedPatterns)).Included; len(fitted) > 0 {
+		writePatterns(&sb, fitted)
 		sb.WriteString("---\n\n")
 	}
 
@@ -84,6 +107,49 @@ func (b *Builder) BuildRequest(input string, matchedPatterns []*models.Pattern)
 	return sb.String()
 }
 
+// BuildChatSystemPrompt builds the system prompt for a multi-turn chat.
+// Patterns matched anywhere in the conversation are included as context,
+// since the user input itself travels as separate messages.
+// Patterns are used as given; callers fit them to the budget with Fit.
+func (b *Builder) BuildChatSystemPrompt(contextPatterns []*models.Pattern) string {
+	var sb strings.Builder
+	sb.WriteString(b.systemPrompt)
+
+	if len(contextPatterns) > 0 {
+		sb.WriteString("\n\n")
+		writePatterns(&sb, contextPatterns)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// patternsHeader introduces the "Relevant Patterns" section.
+const patternsHeader = "## Relevant Patterns\nThe following patterns are relevant to the user's input:\n\n"
+
+// writePatterns writes the "Relevant Patterns" section.
+func writePatterns(sb *strings.Builder, patterns []*models.Pattern) {
+	sb.WriteString(patternsHeader)
+	for i, p := range patterns {
+		writePattern(sb, i+1, p)
+	}
+}
+
+// writePattern writes pattern number n of the "Relevant Patterns" section.
+func writePattern(sb *strings.Builder, n int, p *models.Pattern) {
+	sb.WriteString(fmt.Sprintf("### Pattern %d\n", n))
+	sb.WriteString(fmt.Sprintf("**Trigger**: %s\n", p.Trigger))
+	sb.WriteString(fmt.Sprintf("**Response**: %s\n", p.Response))
+
+	if len(p.Tags) > 0 {
+		sb.WriteString(fmt.Sprintf("**Tags**: %s\n", strings.Join(p.Tags, ", ")))
+	}
+	if p.Project != "" {
+		sb.WriteString(fmt.Sprintf("**Project**: %s\n", p.Project))
+	}
+	sb.WriteString(fmt.Sprintf("**Strength**: %.1f/100\n", p.Strength))
+	sb.WriteString("\n")
+}
+
 // BuildSystemPrompt builds just the system prompt with optional context
 func (b *Builder) BuildSystemPrompt(userContext string) string {
 	var sb strings.Builder
@@ -97,39 +163,20 @@ func (b *Builder) BuildSystemPrompt(userContext string) string {
 	return sb.String()
 }
 
-// BuildReflexPrompt builds a prompt specifically for reflex generation
+// BuildReflexPrompt builds a prompt specifically for reflex generation,
+// using the prompt template if one is set
 func (b *Builder) BuildReflexPrompt(input string, patterns []*models.Pattern) string {
-	var sb strings.Builder
-
-	// System prompt for reflex generation
-	sb.WriteString(`You are Open-Think-Reflex, an AI input accelerator. 
-Your task is to help the user by generating relevant responses based on matched patterns.
-
-Guidelines:
-1. Use the provided patterns to generate contextually appropriate responses
-2. Be concise and helpful
-3. If no patterns match well, generate a reasonable response based on the input
-4. Consider the strength of each pattern (higher strength = more relevant)
-5. Combine multiple patterns if they are all relevant
-
-`)
-
-	// Add patterns if available
-	if len(patterns) > 0 {
-		sb.WriteString("## Available Patterns\n\n")
-		for i, p := range patterns {
-			sb.WriteString(fmt.Sprintf("%d. Trigger: \"%s\" | Response: \"%s\" | Strength: %.1f\n", 
-				i+1, p.Trigger, p.Response, p.Strength))
-		}
-		sb.WriteString("\n")
+	tmpl := b.promptTmpl
+	if tmpl == nil {
+		tmpl = defaultReflexTemplate
 	}
-
-	// Add user input
-	sb.WriteString("## Task\n")
-	sb.WriteString("Generate a response for the following input:\n\n")
-	sb.WriteString(input)
-
-	return sb.String()
+	data := &Data{Query: input, Patterns: b.Fit(Candidates(patterns)).Included}
+	result, err := execute(tmpl, data)
+	if err != nil {
+		// A broken user template must not block generation
+		result, _ = execute(defaultReflexTemplate, data)
+	}
+	return result
 }
 
 // defaultSystemPrompt is the default system prompt
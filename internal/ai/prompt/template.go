@@ -0,0 +1,126 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Data is the data available to prompt templates.
+//
+// Example template:
+//
+//	You help with {{if .Space}}{{.Space.Name}}{{else}}anything{{end}}.
+//	{{patterns .Patterns}}
+//	{{range .Notes}}- {{.Title}}: {{.Content}}
+//	{{end}}
+//	Question: {{.Query}}
+type Data struct {
+	Query    string            // User input
+	Patterns []*models.Pattern // Matched patterns, best first
+	Space    *models.Space     // Active space (nil if none)
+	Notes    []*models.Note    // Notes related to the query
+}
+
+// funcs are the helper functions available to templates.
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"inc":   func(i int) int { return i + 1 },
+	// patterns renders the standard "Relevant Patterns" section
+	"patterns": func(patterns []*models.Pattern) string {
+		if len(patterns) == 0 {
+			return ""
+		}
+		var sb strings.Builder
+		writePatterns(&sb, patterns)
+		return strings.TrimRight(sb.String(), "\n")
+	},
+}
+
+// ParseTemplate parses a prompt template with the prompt helper functions.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// LoadTemplate reads and parses a prompt template file.
+func LoadTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template: %w", err)
+	}
+	return ParseTemplate(filepath.Base(path), string(data))
+}
+
+// NewBuilderForSpace creates a builder using the system prompt and prompt
+// template configured for spaceID, falling back to the global ones and
+// then to the built-in prompts. Relative file names are resolved against
+// cfg.Dir. The context budget is cfg.ContextTokens.
+func NewBuilderForSpace(cfg config.PromptsConfig, spaceID string) (*Builder, error) {
+	system, tmpl := cfg.ForSpace(spaceID)
+	b := NewBuilder().WithOptions(WithMaxTokens(cfg.ContextTokens))
+
+	if system != "" {
+		t, err := LoadTemplate(resolve(cfg.Dir, system))
+		if err != nil {
+			return nil, err
+		}
+		b.systemTmpl = t
+	}
+	if tmpl != "" {
+		t, err := LoadTemplate(resolve(cfg.Dir, tmpl))
+		if err != nil {
+			return nil, err
+		}
+		b.promptTmpl = t
+	}
+	return b, nil
+}
+
+// resolve joins a relative template path with dir.
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) || dir == "" {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// execute renders tmpl with data.
+func execute(tmpl *template.Template, data *Data) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// defaultReflexTemplate is the built-in template used by BuildReflexPrompt.
+var defaultReflexTemplate = template.Must(ParseTemplate("reflex", `You are Open-Think-Reflex, an AI input accelerator. 
+Your task is to help the user by generating relevant responses based on matched patterns.
+
+Guidelines:
+1. Use the provided patterns to generate contextually appropriate responses
+2. Be concise and helpful
+3. If no patterns match well, generate a reasonable response based on the input
+4. Consider the strength of each pattern (higher strength = more relevant)
+5. Combine multiple patterns if they are all relevant
+
+{{if .Patterns}}## Available Patterns
+
+{{range $i, $p := .Patterns}}{{inc $i}}. Trigger: "{{$p.Trigger}}" | Response: "{{$p.Response}}" | Strength: {{printf "%.1f" $p.Strength}}
+{{end}}
+{{end}}## Task
+Generate a response for the following input:
+
+{{.Query}}`))
@@ -0,0 +1,111 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func TestBuilder_Templates(t *testing.T) {
+	system, err := ParseTemplate("system", `Space: {{.Space.Name}}
+{{patterns .Patterns}}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	user, err := ParseTemplate("user", `{{range .Notes}}[{{.Title}}] {{end}}Q: {{upper .Query}}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	b := NewBuilder().WithOptions(WithSystemTemplate(system), WithPromptTemplate(user))
+	if !b.HasTemplates() {
+		t.Error("expected HasTemplates")
+	}
+
+	data := &Data{
+		Query:    "deploy",
+		Patterns: []*models.Pattern{{Trigger: "deploy", Response: "make release"}},
+		Space:    &models.Space{Name: "Work"},
+		Notes:    []*models.Note{{Title: "runbook"}},
+	}
+	got, err := b.RenderSystem(data)
+	if err != nil {
+		t.Fatalf("RenderSystem failed: %v", err)
+	}
+	if !strings.HasPrefix(got, "Space: Work") || !strings.Contains(got, "make release") {
+		t.Errorf("unexpected system prompt: %q", got)
+	}
+	got, err = b.RenderPrompt(data)
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if got != "[runbook] Q: DEPLOY" {
+		t.Errorf("unexpected prompt: %q", got)
+	}
+}
+
+func TestBuilder_DefaultRendering(t *testing.T) {
+	b := NewBuilder()
+	data := &Data{Query: "hi", Patterns: []*models.Pattern{{Trigger: "hi", Response: "hello"}}}
+
+	system, _ := b.RenderSystem(data)
+	if system != b.BuildChatSystemPrompt(data.Patterns) {
+		t.Error("expected the built-in chat system prompt")
+	}
+	if user, _ := b.RenderPrompt(data); user != "hi" {
+		t.Errorf("expected the raw query, got %q", user)
+	}
+	if !strings.Contains(b.BuildReflexPrompt("hi", data.Patterns), `1. Trigger: "hi" | Response: "hello" | Strength: 0.0`) {
+		t.Error("expected patterns in the built-in reflex prompt")
+	}
+}
+
+func TestBuilder_TemplateError(t *testing.T) {
+	tmpl, _ := ParseTemplate("bad", `{{.Space.Name}}`)
+	b := NewBuilder().WithOptions(WithSystemTemplate(tmpl))
+	if _, err := b.RenderSystem(&Data{}); err == nil {
+		t.Error("expected error rendering nil space")
+	}
+	if _, err := ParseTemplate("broken", `{{.Query`); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestNewBuilderForSpace(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "work.tmpl"), []byte("Work mode. {{.Query}}"), 0644)
+	os.WriteFile(filepath.Join(dir, "system.tmpl"), []byte("Default system"), 0644)
+
+	cfg := config.PromptsConfig{
+		Dir:    dir,
+		System: "system.tmpl",
+		Spaces: map[string]config.SpacePromptConfig{"work": {Template: "work.tmpl"}},
+	}
+
+	b, err := NewBuilderForSpace(cfg, "work")
+	if err != nil {
+		t.Fatalf("NewBuilderForSpace failed: %v", err)
+	}
+	if got, _ := b.RenderPrompt(&Data{Query: "q"}); got != "Work mode. q" {
+		t.Errorf("unexpected prompt: %q", got)
+	}
+	if got, _ := b.RenderSystem(&Data{}); got != "Default system" {
+		t.Errorf("expected default system template, got %q", got)
+	}
+
+	b, err = NewBuilderForSpace(cfg, "personal")
+	if err != nil {
+		t.Fatalf("NewBuilderForSpace failed: %v", err)
+	}
+	if got, _ := b.RenderPrompt(&Data{Query: "q"}); got != "q" {
+		t.Errorf("expected built-in prompt outside work, got %q", got)
+	}
+
+	cfg.System = "missing.tmpl"
+	if _, err := NewBuilderForSpace(cfg, ""); err == nil {
+		t.Error("expected error for missing template")
+	}
+}
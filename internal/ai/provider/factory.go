@@ -0,0 +1,235 @@
+// Package provider builds ai.Provider instances from application config.
+// Each configured provider is wrapped in resilience middleware (timeout,
+// retry with backoff, circuit breaker) and, when fallbacks are configured,
+// combined into an ordered fallback chain. Secrets are redacted before
+// any of them see a request.
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/cache"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/redact"
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+)
+
+// Option is a functional option for New.
+type Option func(*options)
+
+type options struct {
+	ledger ai.UsageLedger
+	warn   func(ai.BudgetStatus)
+	cache  *cache.Cache
+}
+
+// WithLedger records every provider call in ledger and enforces the
+// budgets from config against it.
+func WithLedger(ledger ai.UsageLedger) Option {
+	return func(o *options) {
+		o.ledger = ledger
+	}
+}
+
+// WithBudgetWarning sets the callback invoked when spend approaches a budget.
+func WithBudgetWarning(warn func(ai.BudgetStatus)) Option {
+	return func(o *options) {
+		o.warn = warn
+	}
+}
+
+// WithCache serves repeated requests from c. Cache hits skip budgets and
+// are not recorded in the ledger.
+func WithCache(c *cache.Cache) Option {
+	return func(o *options) {
+		o.cache = c
+	}
+}
+
+// New creates the provider described by cfg.
+// The primary provider comes first, followed by cfg.Fallback in order;
+// duplicates are ignored. With a single provider no chain is created.
+//
+// Example:
+//
+//	p, err := provider.New(cfg.AI, provider.WithLedger(storage))
+//	resp, err := p.Generate(ctx, &ai.Request{Prompt: "..."})
+func New(cfg config.AIConfig, opts ...Option) (ai.Provider, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	names := providerNames(cfg)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no AI provider configured")
+	}
+
+	providers := make([]ai.Provider, 0, len(names))
+	for _, name := range names {
+		p, err := Build(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if name != "replay" {
+			// Replayed responses are deterministic; retrying a miss is pointless
+			p = Wrap(p, cfg)
+		}
+		if o.ledger != nil {
+			// Tracked per provider so the ledger shows who actually answered
+			p = ai.Chain(p, ai.TrackUsage(o.ledger))
+		}
+		providers = append(providers, p)
+	}
+
+	var p ai.Provider = providers[0]
+	if len(providers) > 1 {
+		p = ai.NewFallbackProvider(providers...)
+	}
+	if o.ledger != nil && (cfg.Budget.Daily > 0 || cfg.Budget.Monthly > 0) {
+		p = ai.Chain(p, ai.EnforceBudget(o.ledger, ai.BudgetLimits{
+			Daily:   cfg.Budget.Daily,
+			Monthly: cfg.Budget.Monthly,
+			WarnAt:  cfg.Budget.WarnAt,
+		}, o.warn))
+	}
+	if cfg.Redact.Enabled {
+		r, err := redact.New(cfg.Redact)
+		if err != nil {
+			return nil, err
+		}
+		p = ai.Chain(p, r.Middleware())
+	}
+	if o.cache != nil {
+		p = ai.Chain(p, o.cache.Middleware())
+	}
+	return p, nil
+}
+
+// Build creates a single, unwrapped provider by name.
+// Supported names: anthropic (alias claude), openai, local (alias ollama)
+// and replay, which serves responses from a cassette file.
+func Build(name string, cfg config.AIConfig) (ai.Provider, error) {
+	switch normalizeName(name) {
+	case "anthropic":
+		pc := cfg.Providers.Anthropic
+		if pc.APIKey == "" {
+			return nil, fmt.Errorf("anthropic API key not configured (set OTR_ANTHROPIC_API_KEY)")
+		}
+		model := pc.Model
+		if model == "" {
+			model = cfg.DefaultModel
+		}
+		opts := []ai.Option{ai.WithAPIKey(pc.APIKey), ai.WithMaxRetries(0)}
+		opts = appendCommon(opts, model, pc.APIURL, pc.MaxTokens, pc.Temperature)
+		return ai.NewClaudeProvider(opts...), nil
+
+	case "openai":
+		pc := cfg.Providers.OpenAI
+		if pc.APIKey == "" {
+			return nil, fmt.Errorf("openai API key not configured (set OTR_OPENAI_API_KEY)")
+		}
+		opts := []ai.Option{ai.WithAPIKey(pc.APIKey)}
+		opts = appendCommon(opts, pc.Model, pc.APIURL, pc.MaxTokens, pc.Temperature)
+		return ai.NewOpenAIProvider(opts...), nil
+
+	case "local":
+		pc := cfg.Providers.Local
+		opts := appendCommon(nil, pc.Model, pc.APIURL, 0, 0)
+		return ai.NewLocalProvider(opts...), nil
+
+	case "replay":
+		rc := cfg.Providers.Replay
+		if rc.Cassette == "" {
+			return nil, fmt.Errorf("replay cassette path not configured")
+		}
+		mode := ai.ReplayMode(strings.ToLower(rc.Mode))
+		var upstream ai.Provider
+		if mode == ai.ReplayRecord || mode == ai.ReplayAuto {
+			if normalizeName(rc.Upstream) == "replay" {
+				return nil, fmt.Errorf("replay upstream cannot be replay")
+			}
+			up, err := Build(rc.Upstream, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build replay upstream: %w", err)
+			}
+			upstream = Wrap(up, cfg)
+		}
+		return ai.NewReplayProvider(rc.Cassette, mode, upstream)
+
+	default:
+		return nil, fmt.Errorf("unknown AI provider: %s", name)
+	}
+}
+
+// Wrap applies the middleware configured in cfg to p.
+// Order (outermost first): circuit breaker, retry, per-attempt timeout.
+func Wrap(p ai.Provider, cfg config.AIConfig) ai.Provider {
+	var mws []ai.Middleware
+
+	if cfg.CircuitBreaker.Enabled {
+		mws = append(mws, ai.CircuitBreaker(ai.BreakerConfig{
+			FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+			Cooldown:         time.Duration(cfg.CircuitBreaker.Cooldown) * time.Second,
+		}))
+	}
+
+	if cfg.RetryMax > 0 {
+		policy := ai.DefaultRetryPolicy()
+		policy.MaxAttempts = cfg.RetryMax + 1
+		mws = append(mws, ai.Retry(policy))
+	}
+
+	if cfg.Timeout > 0 {
+		mws = append(mws, ai.Timeout(time.Duration(cfg.Timeout)*time.Second))
+	}
+
+	return ai.Chain(p, mws...)
+}
+
+// providerNames returns the primary provider followed by unique fallbacks.
+func providerNames(cfg config.AIConfig) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{cfg.Provider}, cfg.Fallback...) {
+		n := normalizeName(name)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		names = append(names, n)
+	}
+	return names
+}
+
+// normalizeName maps provider aliases to their canonical name.
+func normalizeName(name string) string {
+	n := strings.ToLower(strings.TrimSpace(name))
+	switch n {
+	case "claude":
+		return "anthropic"
+	case "ollama":
+		return "local"
+	}
+	return n
+}
+
+// appendCommon adds the options shared by all providers, skipping zero values
+// so provider defaults apply.
+func appendCommon(opts []ai.Option, model, endpoint string, maxTokens int, temp float64) []ai.Option {
+	if model != "" {
+		opts = append(opts, ai.WithModel(model))
+	}
+	if endpoint != "" {
+		opts = append(opts, ai.WithEndpoint(endpoint))
+	}
+	if maxTokens > 0 {
+		opts = append(opts, ai.WithMaxTokens(maxTokens))
+	}
+	if temp > 0 {
+		opts = append(opts, ai.WithTemperature(temp))
+	}
+	return opts
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+)
+
+func testConfig() config.AIConfig {
+	return config.AIConfig{
+		Provider: "anthropic",
+		Providers: config.ProvidersConfig{
+			Anthropic: config.AnthropicConfig{APIKey: "sk-test"},
+			Local:     config.LocalConfig{APIURL: "http://localhost:11434/v1", Model: "llama3"},
+		},
+		Timeout:  30,
+		RetryMax: 2,
+		CircuitBreaker: config.CircuitBreakerConfig{
+			Enabled:          true,
+			FailureThreshold: 3,
+			Cooldown:         10,
+		},
+	}
+}
+
+func TestNew_SingleProvider(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if p.Name() != "claude" {
+		t.Errorf("expected claude, got %s", p.Name())
+	}
+	if _, ok := p.(*ai.FallbackProvider); ok {
+		t.Error("single provider should not be wrapped in a fallback chain")
+	}
+}
+
+func TestNew_FallbackChain(t *testing.T) {
+	cfg := testConfig()
+	cfg.Fallback = []string{"local", "claude", "ollama"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	chain, ok := p.(*ai.FallbackProvider)
+	if !ok {
+		t.Fatalf("expected fallback chain, got %T", p)
+	}
+	if len(chain.Providers()) != 2 {
+		t.Errorf("expected duplicates to be dropped, got %d providers", len(chain.Providers()))
+	}
+	if chain.Name() != "fallback(claude,local)" {
+		t.Errorf("unexpected chain: %s", chain.Name())
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	cfg := testConfig()
+	cfg.Providers.Anthropic.APIKey = ""
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "API key") {
+		t.Errorf("expected missing key error, got %v", err)
+	}
+
+	cfg = testConfig()
+	cfg.Provider = "gemini"
+	if _, err := New(cfg); err == nil {
+		t.Error("expected unknown provider error")
+	}
+
+	cfg = testConfig()
+	cfg.Provider = ""
+	if _, err := New(cfg); err == nil {
+		t.Error("expected error when no provider is configured")
+	}
+}
+
+func TestBuild_Local(t *testing.T) {
+	p, err := Build("local", testConfig())
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if p.Name() != "local" {
+		t.Errorf("expected local, got %s", p.Name())
+	}
+}
+
+func TestBuild_Replay(t *testing.T) {
+	cfg := testConfig()
+	cfg.Provider = "replay"
+	cfg.Providers.Replay = config.ReplayConfig{
+		Cassette: filepath.Join(t.TempDir(), "demo.json"),
+		Mode:     "replay",
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, ok := p.(*ai.ReplayProvider); !ok {
+		t.Errorf("replay provider should not be wrapped, got %T", p)
+	}
+
+	cfg.Providers.Replay.Mode = "record"
+	cfg.Providers.Replay.Upstream = "replay"
+	if _, err := New(cfg); err == nil {
+		t.Error("expected error for replay upstream")
+	}
+}
@@ -0,0 +1,237 @@
+package redact
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+)
+
+// systemNote tells the model to keep placeholders intact so they can be
+// restored in its reply.
+const systemNote = "Some values in this conversation were replaced by placeholders like [REDACTED_EMAIL_1]. " +
+	"Repeat placeholders exactly as written when you refer to them."
+
+// maxPlaceholder bounds how much streamed text is held back while a
+// placeholder might still be arriving.
+const maxPlaceholder = 64
+
+// Middleware returns an ai.Middleware that redacts the system prompt,
+// prompt, messages, text attachments and tool results before they reach
+// the provider, and restores placeholders in replies and tool inputs.
+// Place it inside the cache so cassettes and providers only ever see
+// redacted data.
+func (r *Redactor) Middleware() ai.Middleware {
+	return func(next ai.Provider) ai.Provider {
+		return &redactedProvider{next: next, redactor: r}
+	}
+}
+
+type redactedProvider struct {
+	next     ai.Provider
+	redactor *Redactor
+}
+
+func (p *redactedProvider) Name() string { return p.next.Name() }
+
+func (p *redactedProvider) DefaultModel() string { return ai.DefaultModel(p.next) }
+
+func (p *redactedProvider) Generate(ctx context.Context, req *ai.Request) (*ai.Response, error) {
+	m := NewMapping()
+	resp, err := p.next.Generate(ctx, p.redactor.request(m, req))
+	if err != nil {
+		return nil, err
+	}
+	return restoreResponse(m, resp), nil
+}
+
+func (p *redactedProvider) GenerateStream(ctx context.Context, req *ai.Request) (io.ReadCloser, error) {
+	s, err := p.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return ai.NewSSEReader(s), nil
+}
+
+func (p *redactedProvider) StreamEvents(ctx context.Context, req *ai.Request) (ai.EventStream, error) {
+	m := NewMapping()
+	s, err := ai.OpenStream(ctx, p.next, p.redactor.request(m, req))
+	if err != nil {
+		return nil, err
+	}
+	return &restoringStream{stream: s, mapping: m}, nil
+}
+
+func (p *redactedProvider) ValidateKey(ctx context.Context) error {
+	return p.next.ValidateKey(ctx)
+}
+
+// request returns a redacted copy of req. Tools are wrapped so they see
+// the original values and return redacted results.
+func (r *Redactor) request(m *Mapping, req *ai.Request) *ai.Request {
+	out := *req
+	out.System = r.Redact(m, req.System)
+	out.Prompt = r.Redact(m, req.Prompt)
+
+	if len(req.Messages) > 0 {
+		out.Messages = make([]ai.Message, len(req.Messages))
+		for i, msg := range req.Messages {
+			msg.Content = r.Redact(m, msg.Content)
+			if len(msg.Attachments) > 0 {
+				attachments := make([]ai.Attachment, len(msg.Attachments))
+				for j, a := range msg.Attachments {
+					if !a.IsImage() {
+						a.Data = []byte(r.Redact(m, string(a.Data)))
+					}
+					attachments[j] = a
+				}
+				msg.Attachments = attachments
+			}
+			out.Messages[i] = msg
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		out.Tools = make([]ai.Tool, len(req.Tools))
+		for i, tool := range req.Tools {
+			run := tool.Run
+			tool.Run = func(ctx context.Context, input json.RawMessage) (string, error) {
+				output, err := run(ctx, restoreJSON(m, input))
+				return r.Redact(m, output), err
+			}
+			out.Tools[i] = tool
+		}
+	}
+
+	if len(m.Findings()) > 0 || len(out.Tools) > 0 {
+		// Tool results may introduce placeholders later in the turn
+		if out.System != "" {
+			out.System += "\n\n"
+		}
+		out.System += systemNote
+	}
+	return &out
+}
+
+// restoreResponse restores placeholders in the reply and its tool calls.
+func restoreResponse(m *Mapping, resp *ai.Response) *ai.Response {
+	if resp == nil {
+		return nil
+	}
+	out := *resp
+	out.Content = m.Restore(resp.Content)
+	if len(resp.ToolCalls) > 0 {
+		out.ToolCalls = make([]ai.ToolCall, len(resp.ToolCalls))
+		for i, call := range resp.ToolCalls {
+			call.Input = restoreJSON(m, call.Input)
+			call.Output = m.Restore(call.Output)
+			out.ToolCalls[i] = call
+		}
+	}
+	return &out
+}
+
+// restoreJSON restores placeholders inside a JSON document. Placeholders
+// contain no characters that need escaping, so a textual replace is safe.
+func restoreJSON(m *Mapping, data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return data
+	}
+	restored := m.Restore(string(data))
+	if !json.Valid([]byte(restored)) {
+		// An original value may need escaping; re-encode string by string
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return data
+		}
+		encoded, err := json.Marshal(restoreValue(m, v))
+		if err != nil {
+			return data
+		}
+		return encoded
+	}
+	return json.RawMessage(restored)
+}
+
+func restoreValue(m *Mapping, v any) any {
+	switch v := v.(type) {
+	case string:
+		return m.Restore(v)
+	case []any:
+		for i := range v {
+			v[i] = restoreValue(m, v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = restoreValue(m, v[k])
+		}
+	}
+	return v
+}
+
+// restoringStream restores placeholders in streamed text. A trailing "["
+// that may start a placeholder is held back until it is complete.
+type restoringStream struct {
+	stream  ai.EventStream
+	mapping *Mapping
+	pending string
+	queue   []ai.Event
+	cur     ai.Event
+}
+
+func (s *restoringStream) Next() bool {
+	for len(s.queue) == 0 {
+		if !s.stream.Next() {
+			if s.pending != "" && s.stream.Err() == nil {
+				s.queue = append(s.queue, s.text(s.pending))
+				s.pending = ""
+				continue
+			}
+			return false
+		}
+		s.push(s.stream.Event())
+	}
+	s.cur, s.queue = s.queue[0], s.queue[1:]
+	return true
+}
+
+// push queues the restored form of e.
+func (s *restoringStream) push(e ai.Event) {
+	switch e.Type {
+	case ai.EventText:
+		text := s.pending + e.Text
+		s.pending = ""
+		if i := strings.LastIndexByte(text, '['); i >= 0 && !strings.Contains(text[i:], "]") && len(text)-i < maxPlaceholder {
+			text, s.pending = text[:i], text[i:]
+		}
+		if text != "" {
+			s.queue = append(s.queue, s.text(text))
+		}
+	case ai.EventToolCall:
+		call := *e.ToolCall
+		call.Input = restoreJSON(s.mapping, call.Input)
+		e.ToolCall = &call
+		s.queue = append(s.queue, e)
+	case ai.EventDone:
+		if s.pending != "" {
+			s.queue = append(s.queue, s.text(s.pending))
+			s.pending = ""
+		}
+		e.Response = restoreResponse(s.mapping, e.Response)
+		s.queue = append(s.queue, e)
+	default:
+		s.queue = append(s.queue, e)
+	}
+}
+
+func (s *restoringStream) text(text string) ai.Event {
+	return ai.Event{Type: ai.EventText, Text: s.mapping.Restore(text)}
+}
+
+func (s *restoringStream) Event() ai.Event { return s.cur }
+
+func (s *restoringStream) Err() error { return s.stream.Err() }
+
+func (s *restoringStream) Close() error { return s.stream.Close() }
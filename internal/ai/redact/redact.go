@@ -0,0 +1,213 @@
+// Package redact replaces secrets with placeholders before requests are
+// sent to an AI provider and restores them in the reply.
+// Built-in detectors cover private keys, JWTs, common API key shapes,
+// password assignments and email addresses; more can be added as regular
+// expressions in config.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+)
+
+// Detector finds one kind of secret. When Pattern has a capture group only
+// the first group is redacted, so "password: hunter2" keeps its label.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// builtins are the built-in detectors, applied in order. Broad detectors
+// come last so specific ones name the secret first.
+var builtins = []Detector{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`)},
+	{"api_key", regexp.MustCompile(`\b(?:sk-(?:ant-)?[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})`)},
+	{"password", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key)\s*[:=]\s*["']?([^\s"',;]+)`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// Builtins returns the names of the built-in detectors.
+func Builtins() []string {
+	names := make([]string, len(builtins))
+	for i, d := range builtins {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// placeholderRe matches placeholders produced by Redact.
+var placeholderRe = regexp.MustCompile(`\[REDACTED_[A-Z0-9_]+_\d+\]`)
+
+// Redactor applies a set of detectors. Safe for concurrent use.
+type Redactor struct {
+	detectors []Detector
+}
+
+// New creates a redactor from cfg: the built-in detectors minus
+// cfg.Disable, followed by cfg.Patterns sorted by name.
+func New(cfg config.RedactConfig) (*Redactor, error) {
+	disabled := make(map[string]bool, len(cfg.Disable))
+	for _, name := range cfg.Disable {
+		disabled[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	r := &Redactor{}
+	for _, d := range builtins {
+		if !disabled[d.Name] {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Patterns))
+	for name := range cfg.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		re, err := regexp.Compile(cfg.Patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", name, err)
+		}
+		r.detectors = append(r.detectors, Detector{Name: name, Pattern: re})
+	}
+	return r, nil
+}
+
+// Detectors returns the names of the active detectors.
+func (r *Redactor) Detectors() []string {
+	names := make([]string, len(r.detectors))
+	for i, d := range r.detectors {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// Finding is one redacted value.
+type Finding struct {
+	Detector    string
+	Value       string
+	Placeholder string
+}
+
+// Masked returns the value with all but its first few characters hidden,
+// for showing findings without repeating the secret.
+func (f Finding) Masked() string {
+	r := []rune(f.Value)
+	if len(r) <= 8 {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:4]) + strings.Repeat("*", min(len(r)-4, 12))
+}
+
+// Mapping remembers the placeholders handed out for one request so the
+// same value always gets the same placeholder and replies can be restored.
+// Not safe for concurrent use.
+type Mapping struct {
+	byValue  map[string]string
+	byHolder map[string]string
+	counts   map[string]int
+	findings []Finding
+}
+
+// NewMapping creates an empty mapping.
+func NewMapping() *Mapping {
+	return &Mapping{
+		byValue:  make(map[string]string),
+		byHolder: make(map[string]string),
+		counts:   make(map[string]int),
+	}
+}
+
+// Findings returns the distinct values redacted so far, in order.
+func (m *Mapping) Findings() []Finding {
+	return m.findings
+}
+
+// Restore replaces known placeholders in text with the original values.
+// Unknown placeholders are left alone.
+func (m *Mapping) Restore(text string) string {
+	if len(m.byHolder) == 0 {
+		return text
+	}
+	return placeholderRe.ReplaceAllStringFunc(text, func(holder string) string {
+		if value, ok := m.byHolder[holder]; ok {
+			return value
+		}
+		return holder
+	})
+}
+
+// placeholder returns the placeholder for value, creating one if needed.
+func (m *Mapping) placeholder(detector, value string) string {
+	if holder, ok := m.byValue[value]; ok {
+		return holder
+	}
+	m.counts[detector]++
+	holder := fmt.Sprintf("[REDACTED_%s_%d]", placeholderName(detector), m.counts[detector])
+	m.byValue[value] = holder
+	m.byHolder[holder] = value
+	m.findings = append(m.findings, Finding{Detector: detector, Value: value, Placeholder: holder})
+	return holder
+}
+
+// placeholderName upper-cases a detector name and replaces anything that
+// can't appear in a placeholder.
+func placeholderName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Redact replaces every detected secret in text with a placeholder,
+// recording it in m.
+func (r *Redactor) Redact(m *Mapping, text string) string {
+	for _, d := range r.detectors {
+		text = redactWith(d, m, text)
+	}
+	return text
+}
+
+// Scan reports what Redact would replace in text, and the redacted text.
+func (r *Redactor) Scan(text string) (string, []Finding) {
+	m := NewMapping()
+	redacted := r.Redact(m, text)
+	return redacted, m.Findings()
+}
+
+func redactWith(d Detector, m *Mapping, text string) string {
+	matches := d.Pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, loc := range matches {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			// Only the first capture group is secret
+			start, end = loc[2], loc[3]
+		}
+		value := text[start:end]
+		if value == "" || start < last || placeholderRe.MatchString(value) {
+			// Already redacted by an earlier detector
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(m.placeholder(d.Name, value))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
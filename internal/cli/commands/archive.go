@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/export"
+)
+
+// IsArchivePath reports whether path names a .otrz archive.
+func IsArchivePath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), export.ArchiveExt)
+}
+
+// ArchiveExport writes the whole database to a .otrz archive.
+func ArchiveExport(storage *sqlite.Storage, path string, out io.Writer) error {
+	a, err := storage.ExportArchive(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := export.WriteArchiveFile(path, a); err != nil {
+		return err
+	}
+	m := a.Manifest.Counts
+	fmt.Fprintf(out, "Exported %d patterns, %d notes, %d spaces, %d thought sessions and %d events to %s\n",
+		m["patterns"], m["notes"], m["spaces"], m["thought_sessions"], m["events"], path)
+	return nil
+}
+
+// ArchiveImport adds the contents of a .otrz archive to the database.
+func ArchiveImport(storage *sqlite.Storage, path string, opts sqlite.ArchiveImportOptions, out io.Writer) error {
+	a, err := export.ReadArchiveFile(path)
+	if err != nil {
+		return err
+	}
+	result, err := storage.ImportArchive(context.Background(), a, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Imported %d patterns, %d notes, %d spaces, %d thought sessions and %d events from %s\n",
+		result.Patterns, result.Notes, result.Spaces, result.ThoughtSessions, result.Events, path)
+	if result.Remapped > 0 && !opts.NewIDs {
+		fmt.Fprintf(out, "%d items already existed and were given new IDs\n", result.Remapped)
+	}
+	for _, id := range result.Unencrypted {
+		fmt.Fprintf(out, "Warning: space %s is encrypted but was imported unencrypted; unlock and run 'otr space encrypt %s'\n", id, id)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+)
+
+// BackupSnapshot writes a verified snapshot of the database. Without an
+// output path it goes to dir, which is then rotated down to keep
+// snapshots.
+func BackupSnapshot(db *sqlite.Database, dir, output string, keep int, out io.Writer) error {
+	ctx := context.Background()
+	path := output
+	if path == "" {
+		path = sqlite.SnapshotPath(dir, time.Now())
+	}
+	info, err := db.Snapshot(ctx, path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Backed up %d patterns, %d notes and %d spaces to %s (%s)\n",
+		info.Patterns, info.Notes, info.Spaces, info.Path, formatBytes(info.Size))
+
+	if output == "" {
+		removed, err := sqlite.RotateBackups(dir, keep)
+		for _, path := range removed {
+			fmt.Fprintf(out, "Removed old backup %s\n", filepath.Base(path))
+		}
+		return err
+	}
+	return nil
+}
+
+// BackupList prints the snapshots in dir, newest first. With verify, each
+// one is checked and its contents counted.
+func BackupList(dir string, verify bool, out io.Writer) error {
+	backups, err := sqlite.ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Fprintf(out, "No backups in %s\n", dir)
+		return nil
+	}
+
+	fmt.Fprintf(out, "Backups in %s:\n\n", dir)
+	for _, b := range backups {
+		line := fmt.Sprintf("  %-24s %s  %8s", filepath.Base(b.Path), b.CreatedAt.Format("2006-01-02 15:04"), formatBytes(b.Size))
+		if verify {
+			info, err := sqlite.VerifyBackup(context.Background(), b.Path)
+			if err != nil {
+				line += "  INVALID: " + err.Error()
+			} else {
+				line += fmt.Sprintf("  v%d, %d patterns, %d notes", info.SchemaVersion, info.Patterns, info.Notes)
+			}
+		}
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
+
+// Restore replaces the database with a snapshot after verifying it and
+// asking for confirmation. path may also name a snapshot in dir. The
+// current database is snapshotted into dir first, keeping keep snapshots.
+func Restore(db *sqlite.Database, dir, path string, keep int, yes bool, in io.Reader, out io.Writer) error {
+	if path == "" {
+		return fmt.Errorf("backup file is required (see 'otr backup list')")
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) && filepath.Base(path) == path {
+		if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+			path = filepath.Join(dir, path)
+		}
+	}
+
+	ctx := context.Background()
+	info, err := sqlite.VerifyBackup(ctx, path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Backup %s: schema version %d, %d patterns, %d notes, %d spaces (%s)\n",
+		path, info.SchemaVersion, info.Patterns, info.Notes, info.Spaces, info.CreatedAt.Format("2006-01-02 15:04"))
+	if !yes && !confirm(bufio.NewScanner(in), out, "Replace the current database with this backup?") {
+		fmt.Fprintln(out, "Cancelled")
+		return nil
+	}
+
+	_, previous, err := db.Restore(ctx, path, dir, keep)
+	if previous != "" {
+		fmt.Fprintf(out, "Backed up the current database to %s\n", previous)
+	}
+	if err != nil {
+		return err
+	}
+	if info.SchemaVersion < sqlite.LatestSchemaVersion() {
+		if err := db.Migrate(ctx); err != nil {
+			return fmt.Errorf("restored, but failed to migrate: %w", err)
+		}
+		fmt.Fprintf(out, "Migrated from schema version %d\n", info.SchemaVersion)
+	}
+	fmt.Fprintln(out, "Restore complete")
+	return nil
+}
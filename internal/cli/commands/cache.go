@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+)
+
+// CacheStats prints statistics for the persistent AI response cache.
+func CacheStats(storage *sqlite.Storage, cfg *config.Config) error {
+	stats, err := storage.ResponseCacheStats(context.Background(), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to get cache stats: %w", err)
+	}
+
+	status := "enabled"
+	if !cfg.AI.Cache.Enabled {
+		status = "disabled"
+	}
+	fmt.Printf("AI response cache (%s, ttl %s, max %d entries)\n\n",
+		status, time.Duration(cfg.AI.Cache.TTL)*time.Second, cfg.AI.Cache.MaxEntries)
+	fmt.Printf("Entries:      %d (%d expired)\n", stats.Entries, stats.Expired)
+	fmt.Printf("Size:         %s\n", formatBytes(stats.Bytes))
+	fmt.Printf("Hits:         %d\n", stats.Hits)
+	fmt.Printf("Tokens saved: %d\n", stats.SavedTokens)
+	if stats.OldestEntry != nil {
+		fmt.Printf("Oldest:       %s\n", stats.OldestEntry.Format("2006-01-02 15:04"))
+		fmt.Printf("Newest:       %s\n", stats.NewestEntry.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// CacheClear deletes cached responses (only expired ones with expiredOnly).
+func CacheClear(storage *sqlite.Storage, expiredOnly bool) error {
+	n, err := storage.ClearResponseCache(context.Background(), expiredOnly, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	if expiredOnly {
+		fmt.Printf("Removed %d expired cache entries\n", n)
+	} else {
+		fmt.Printf("Removed %d cache entries\n", n)
+	}
+	return nil
+}
+
+// formatBytes formats a size in bytes for display.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/cache"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/capture"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/chat"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/tools"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ChatOptions configures the chat command.
+type ChatOptions struct {
+	ConversationID string          // Resume this conversation
+	Continue       bool            // Resume the most recent conversation
+	SpaceID        string          // Restrict pattern matching to a space
+	Threshold      float64         // Minimum match confidence (0 = default)
+	Message        string          // Send a single message and exit
+	Attachments    []string        // Files attached to the first message
+	NoCache        bool            // Skip cached responses
+	Save           bool            // Save the answer to Message as a new pattern
+	Replace        bool            // Replace the matched pattern's response with the answer
+	NoTools        bool            // Don't let the model query or change OTR data
+	Builder        *prompt.Builder // Prompt builder (nil = built-in prompts)
+}
+
+// Chat runs a conversation with the AI provider.
+// With opts.Message set it sends one turn and returns; otherwise it reads
+// turns from in until EOF or "exit".
+func Chat(storage *sqlite.Storage, provider ai.Provider, opts ChatOptions, in io.Reader, out io.Writer) error {
+	ctx := context.Background()
+	if opts.NoCache {
+		ctx = cache.WithBypass(ctx)
+	}
+
+	sessionOpts := []chat.Option{chat.WithSpace(opts.SpaceID)}
+	if opts.Threshold > 0 {
+		sessionOpts = append(sessionOpts, chat.WithThreshold(opts.Threshold))
+	}
+	if opts.Builder != nil {
+		sessionOpts = append(sessionOpts, chat.WithBuilder(opts.Builder))
+	}
+	scanner := bufio.NewScanner(in)
+	if !opts.NoTools {
+		set := tools.New(storage, tools.WithSpace(opts.SpaceID), tools.WithConfirm(func(action string) bool {
+			return confirm(scanner, out, fmt.Sprintf("The AI wants to %s. Allow?", action))
+		}))
+		sessionOpts = append(sessionOpts, chat.WithTools(set.Tools()))
+	}
+	session := chat.NewSession(storage, provider, sessionOpts...)
+
+	convID := opts.ConversationID
+	if convID == "" && opts.Continue {
+		latest, err := storage.GetLatestConversation(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get latest conversation: %w", err)
+		}
+		if latest == nil {
+			return fmt.Errorf("no conversation to continue")
+		}
+		convID = latest.ID
+	}
+	if convID != "" {
+		if err := session.Resume(ctx, convID); err != nil {
+			return fmt.Errorf("failed to resume conversation: %w", err)
+		}
+		fmt.Fprintf(out, "Continuing: %s (%d messages, %d context patterns)\n",
+			session.Conversation().Title, len(session.Messages()), len(session.ContextPatternIDs()))
+	}
+
+	attachments, err := readAttachments(opts.Attachments)
+	if err != nil {
+		return err
+	}
+
+	send := func(text string) error {
+		reply, err := session.Send(ctx, text, attachments)
+		if err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+		attachments = nil
+		fmt.Fprintf(out, "%s\n", reply.Content)
+		if calls := session.LastToolCalls(); len(calls) > 0 {
+			names := make([]string, len(calls))
+			for i, c := range calls {
+				names[i] = c.Name
+			}
+			fmt.Fprintf(out, "(tools used: %s)\n", strings.Join(names, ", "))
+		}
+		if fit := session.LastFit(); fit != nil && (len(fit.Truncated) > 0 || len(fit.Dropped) > 0) {
+			fmt.Fprintf(out, "(context budget: %d patterns truncated, %d dropped)\n", len(fit.Truncated), len(fit.Dropped))
+		}
+		return nil
+	}
+
+	if opts.Message != "" {
+		if err := send(opts.Message); err != nil {
+			return err
+		}
+		if opts.Save || opts.Replace {
+			if err := captureAnswer(ctx, storage, session, opts.Replace, out); err != nil {
+				return err
+			}
+		}
+		printSaved(session, out)
+		return nil
+	}
+
+	fmt.Fprintln(out, "Type your message (\"exit\" to quit, \"/save\" to keep the last answer as a pattern, \"/replace\" to use it as the matched pattern's response).")
+	for {
+		fmt.Fprint(out, "\nyou> ")
+		if !scanner.Scan() {
+			break
+		}
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if text == "exit" || text == "quit" {
+			break
+		}
+		if text == "/save" || text == "/replace" {
+			if err := captureAnswer(ctx, storage, session, text == "/replace", out); err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+			}
+			continue
+		}
+		fmt.Fprint(out, "ai> ")
+		if err := send(text); err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+	}
+	printSaved(session, out)
+	return scanner.Err()
+}
+
+// printSaved tells where the conversation was saved, or that its latest
+// turns weren't because they carry encrypted content.
+func printSaved(session *chat.Session, out io.Writer) {
+	if session.Private() {
+		fmt.Fprintln(out, "\nNot saved: the conversation uses content from an encrypted space")
+		return
+	}
+	if conv := session.Conversation(); conv != nil {
+		fmt.Fprintf(out, "\nConversation saved: %s\n", conv.ID)
+	}
+}
+
+// ListConversations prints recent conversations.
+func ListConversations(storage *sqlite.Storage, limit int) error {
+	ctx := context.Background()
+
+	convs, err := storage.ListConversations(ctx, limit)
+	if err != nil {
+		return fmt.Errorf("failed to list conversations: %w", err)
+	}
+	if len(convs) == 0 {
+		fmt.Println("No conversations found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d conversation(s):\n\n", len(convs))
+	for _, c := range convs {
+		fmt.Printf("  %s  %s  %s\n", c.ID, c.UpdatedAt.Format("2006-01-02 15:04"), c.Title)
+	}
+	fmt.Println("\nResume with: otr chat --id <conversation_id>")
+	return nil
+}
+
+// captureAnswer keeps the session's latest answer as a reflex: a new
+// pattern, or with replace the new response of the matched pattern.
+func captureAnswer(ctx context.Context, storage *sqlite.Storage, session *chat.Session, replace bool, out io.Writer) error {
+	gen := session.LastGeneration()
+	if gen == nil {
+		return fmt.Errorf("no answer to capture yet")
+	}
+	if replace {
+		pattern, err := capture.ReplaceResponse(ctx, storage, gen)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Replaced response of pattern %s (%s)\n", pattern.ID, pattern.Trigger)
+		return nil
+	}
+	pattern, err := capture.SaveAsPattern(ctx, storage, gen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Saved as pattern %s (trigger: %s)\n", pattern.ID, pattern.Trigger)
+	return nil
+}
+
+// confirm asks a yes/no question on out and reads the answer from scanner.
+// Anything but "y" or "yes" (including EOF) declines.
+func confirm(scanner *bufio.Scanner, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "\n%s [y/N] ", question)
+	if !scanner.Scan() {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// readAttachments loads files to attach to a message.
+func readAttachments(paths []string) ([]models.MessageAttachment, error) {
+	var attachments []models.MessageAttachment
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		mediaType := mime.TypeByExtension(filepath.Ext(path))
+		if mediaType == "" {
+			mediaType = http.DetectContentType(data)
+		}
+		if i := strings.Index(mediaType, ";"); i >= 0 {
+			mediaType = mediaType[:i]
+		}
+		attachments = append(attachments, models.MessageAttachment{
+			Name:      filepath.Base(path),
+			MediaType: mediaType,
+			Data:      data,
+		})
+	}
+	return attachments, nil
+}
@@ -5,6 +5,7 @@ package commands
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/ArmyClaw/open-think-reflex/internal/config"
@@ -263,7 +264,7 @@ func deletePattern(storage *sqlite.Storage, id string) error {
 }
 
 // ListSpaces retrieves and displays all spaces.
-func ListSpaces(storage *sqlite.Storage) error {
+func ListSpaces(storage contracts.Storage) error {
 	ctx := context.Background()
 	spaces, err := storage.ListSpaces(ctx)
 	if err != nil {
@@ -277,14 +278,18 @@ func ListSpaces(storage *sqlite.Storage) error {
 
 	fmt.Printf("Found %d spaces:\n\n", len(spaces))
 	for _, s := range spaces {
-		fmt.Printf("  %s  %s\n", s.ID[:min(8, len(s.ID))], s.Name)
+		marker := ""
+		if s.Encrypted {
+			marker = "  [encrypted]"
+		}
+		fmt.Printf("  %s  %s%s\n", s.ID[:min(8, len(s.ID))], s.Name, marker)
 	}
 
 	return nil
 }
 
 // CreateSpace creates a new space for organizing patterns.
-func CreateSpace(storage *sqlite.Storage, name, description string) error {
+func CreateSpace(storage contracts.Storage, name, description string) error {
 	ctx := context.Background()
 	space := &models.Space{
 		ID:          generateSpaceID(),
@@ -303,7 +308,7 @@ func CreateSpace(storage *sqlite.Storage, name, description string) error {
 }
 
 // ShowSpace displays details of a specific space.
-func ShowSpace(storage *sqlite.Storage, spaceID string) error {
+func ShowSpace(storage contracts.Storage, spaceID string) error {
 	if spaceID == "" {
 		return fmt.Errorf("space ID is required")
 	}
@@ -320,6 +325,7 @@ func ShowSpace(storage *sqlite.Storage, spaceID string) error {
 	fmt.Printf("  Description: %s\n", space.Description)
 	fmt.Printf("  Owner:       %s\n", space.Owner)
 	fmt.Printf("  Default:     %v\n", space.DefaultSpace)
+	fmt.Printf("  Encrypted:   %v\n", space.Encrypted)
 	fmt.Printf("  Pattern Limit: %d\n", space.PatternLimit)
 	fmt.Printf("  Pattern Count: %d\n", space.PatternCount)
 	fmt.Printf("  Created:     %s\n", space.CreatedAt.Format("2006-01-02 15:04:05"))
@@ -328,8 +334,27 @@ func ShowSpace(storage *sqlite.Storage, spaceID string) error {
 	return nil
 }
 
+// SpaceEncrypt turns encryption of a space on or off, encrypting or
+// decrypting what is already stored in it.
+func SpaceEncrypt(storage *sqlite.Storage, spaceID string, encrypted bool, out io.Writer) error {
+	if spaceID == "" {
+		return fmt.Errorf("space ID is required")
+	}
+
+	n, err := storage.SetSpaceEncrypted(context.Background(), spaceID, encrypted)
+	if err != nil {
+		return fmt.Errorf("failed to update space: %w", err)
+	}
+	if encrypted {
+		fmt.Fprintf(out, "Space %s is encrypted (%d values encrypted)\n", spaceID, n)
+	} else {
+		fmt.Fprintf(out, "Space %s is no longer encrypted (%d values decrypted)\n", spaceID, n)
+	}
+	return nil
+}
+
 // DeleteSpace deletes a space by ID.
-func DeleteSpace(storage *sqlite.Storage, spaceID string) error {
+func DeleteSpace(storage contracts.Storage, spaceID string) error {
 	if spaceID == "" {
 		return fmt.Errorf("space ID is required")
 	}
@@ -352,7 +377,7 @@ func DeleteSpace(storage *sqlite.Storage, spaceID string) error {
 }
 
 // UseSpace switches to a different space and saves to config if loader is provided.
-func UseSpace(storage *sqlite.Storage, cfg *config.Config, loader *config.Loader, spaceID string) error {
+func UseSpace(storage contracts.Storage, cfg *config.Config, loader *config.Loader, spaceID string) error {
 	if spaceID == "" {
 		return fmt.Errorf("space ID is required")
 	}
@@ -383,7 +408,7 @@ func UseSpace(storage *sqlite.Storage, cfg *config.Config, loader *config.Loader
 }
 
 // SetDefaultSpace sets a space as the default space.
-func SetDefaultSpace(storage *sqlite.Storage, spaceID string) error {
+func SetDefaultSpace(storage contracts.Storage, spaceID string) error {
 	if spaceID == "" {
 		return fmt.Errorf("space ID is required")
 	}
@@ -1,10 +1,19 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/redact"
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
 	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
 	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
 	"github.com/ArmyClaw/open-think-reflex/pkg/models"
 	"github.com/stretchr/testify/assert"
@@ -178,3 +187,447 @@ func TestBuildCommands(t *testing.T) {
 		t.Error("Expected some commands")
 	}
 }
+
+func TestChat_Interactive(t *testing.T) {
+	storage := setupTestStorage(t)
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "first reply"}, ai.FakeStep{Content: "second reply"})
+
+	var out bytes.Buffer
+	in := strings.NewReader("hello\n\nagain\nexit\n")
+	err := Chat(storage, fake, ChatOptions{}, in, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "first reply")
+	assert.Contains(t, out.String(), "second reply")
+	assert.Len(t, fake.Requests(), 2)
+
+	// Continue the same conversation in one-shot mode
+	fake = ai.NewFakeProvider(ai.FakeStep{Content: "third reply"})
+	out.Reset()
+	err = Chat(storage, fake, ChatOptions{Continue: true, Message: "more"}, nil, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "4 messages")
+	assert.Len(t, fake.Requests()[0].Messages, 5)
+}
+
+func TestChat_SaveAnswer(t *testing.T) {
+	storage := setupTestStorage(t)
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "use git bisect"})
+
+	var out bytes.Buffer
+	in := strings.NewReader("/save\nfind the bad commit\n/save\nexit\n")
+	require.NoError(t, Chat(storage, fake, ChatOptions{}, in, &out))
+	assert.Contains(t, out.String(), "no answer to capture yet")
+	assert.Contains(t, out.String(), "Saved as pattern")
+
+	p, err := storage.GetPatternByTrigger(context.Background(), "find the bad commit")
+	require.NoError(t, err)
+	assert.Equal(t, "use git bisect", p.Response)
+	prov, err := storage.GetPatternProvenance(context.Background(), p.ID)
+	require.NoError(t, err)
+	require.NotNil(t, prov)
+	assert.Equal(t, models.ProvenanceAI, prov.Source)
+
+	// Nothing matched, so there is no pattern to replace
+	err = Chat(storage, ai.NewFakeProvider(ai.FakeStep{Content: "x"}), ChatOptions{Message: "unrelated words", Replace: true}, nil, &out)
+	assert.Error(t, err)
+}
+
+func TestChat_Tools(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, storage.SavePattern(ctx, models.NewPattern("pagination", "Use keyset pagination")))
+
+	fake := ai.NewFakeProvider(
+		ai.FakeStep{ToolCalls: []ai.ToolCall{
+			{ID: "1", Name: "search_patterns", Input: json.RawMessage(`{"query":"pagination"}`)},
+			{ID: "2", Name: "create_note", Input: json.RawMessage(`{"title":"Pagination","content":"keyset"}`)},
+		}},
+		ai.FakeStep{Content: "You have one reflex: keyset pagination."},
+	)
+
+	var out bytes.Buffer
+	in := strings.NewReader("what reflexes do I have for pagination?\nn\nexit\n")
+	require.NoError(t, Chat(storage, fake, ChatOptions{}, in, &out))
+	assert.Contains(t, out.String(), "create note \"Pagination\". Allow?")
+	assert.Contains(t, out.String(), "(tools used: search_patterns, create_note)")
+	assert.Len(t, fake.Requests()[0].Tools, 5)
+
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, notes, "declined write must not create a note")
+
+	// --no-tools sends no tools
+	fake = ai.NewFakeProvider(ai.FakeStep{Content: "ok"})
+	require.NoError(t, Chat(storage, fake, ChatOptions{Message: "hi", NoTools: true}, nil, &out))
+	assert.Empty(t, fake.Requests()[0].Tools)
+}
+
+func TestChat_ContinueWithoutConversation(t *testing.T) {
+	storage := setupTestStorage(t)
+	err := Chat(storage, ai.NewFakeProvider(), ChatOptions{Continue: true, Message: "x"}, nil, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestListConversations_Empty(t *testing.T) {
+	storage := setupTestStorage(t)
+	assert.NoError(t, ListConversations(storage, 10))
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"7d", now.AddDate(0, 0, -7)},
+		{"2w", now.AddDate(0, 0, -14)},
+		{"1m", now.AddDate(0, -1, 0)},
+		{"12h", now.Add(-12 * time.Hour)},
+		{"", now.AddDate(0, 0, -30)},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.in, now)
+		require.NoError(t, err, tt.in)
+		assert.True(t, got.Equal(tt.want), "%s: got %v, want %v", tt.in, got, tt.want)
+	}
+
+	_, err := parseSince("yesterday", now)
+	assert.Error(t, err)
+}
+
+func TestShowUsage(t *testing.T) {
+	storage := setupTestStorage(t)
+	cfg := &config.Config{}
+	cfg.AI.Budget = config.BudgetConfig{Daily: 1, WarnAt: 0.8}
+
+	require.NoError(t, storage.RecordUsage(context.Background(), &models.UsageRecord{Provider: "claude", Model: "m", Cost: 0.9}))
+	assert.NoError(t, ShowUsage(storage, cfg, "model", "7d"))
+	assert.Error(t, ShowUsage(storage, cfg, "week", "7d"))
+}
+
+func TestCacheCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	cfg := &config.Config{}
+	cfg.AI.Cache = config.CacheConfig{Enabled: true, TTL: 3600, MaxEntries: 10}
+
+	now := time.Now()
+	require.NoError(t, storage.PutCachedResponse(context.Background(), &models.CachedResponse{
+		Key: "k", Provider: "claude", Content: "cached", CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}, 10))
+	assert.NoError(t, CacheStats(storage, cfg))
+	assert.NoError(t, CacheClear(storage, false))
+
+	stats, err := storage.ResponseCacheStats(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Entries)
+}
+
+func TestPreviewPrompt(t *testing.T) {
+	storage := setupTestStorage(t)
+	p := models.NewPattern("deploy", "Run make release")
+	p.Strength = 80
+	require.NoError(t, storage.SavePattern(context.Background(), p))
+
+	var out bytes.Buffer
+	require.NoError(t, PreviewPrompt(storage, prompt.NewBuilder(), nil, "", 0, "deploy steps", &out))
+	assert.Contains(t, out.String(), "Matched patterns: 1")
+	assert.Contains(t, out.String(), "Run make release")
+	assert.Contains(t, out.String(), "=== User ===\ndeploy steps")
+
+	assert.Error(t, PreviewPrompt(storage, prompt.NewBuilder(), nil, "", 0, "", &out))
+}
+
+func TestRedactScan(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	login := models.NewPattern("db login", "password: hunter2")
+	login.Strength = 80
+	require.NoError(t, storage.SavePattern(ctx, login))
+	require.NoError(t, storage.SavePattern(ctx, models.NewPattern("deploy", "make release")))
+	require.NoError(t, storage.SaveNote(ctx, models.NewNote("Oncall", "page ops@example.com")))
+
+	r, err := redact.New(config.RedactConfig{})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, RedactScan(storage, r, &out))
+	assert.Contains(t, out.String(), "pattern")
+	assert.Contains(t, out.String(), "[REDACTED_PASSWORD_1]")
+	assert.Contains(t, out.String(), "[REDACTED_EMAIL_1]")
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "deploy")
+	assert.Contains(t, out.String(), "2 of 3 items")
+
+	// The prompt preview shows the redacted prompt
+	out.Reset()
+	require.NoError(t, PreviewPrompt(storage, prompt.NewBuilder(), r, "", 0, "db login", &out))
+	assert.Contains(t, out.String(), "Redacted: 1 values")
+	assert.NotContains(t, out.String(), "hunter2")
+}
+
+func TestDedupe(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	keep := models.NewPattern("deploy to production", "Run make release")
+	keep.Strength = 80
+	dup := models.NewPattern("Deploy to production!", "run make release")
+	dup.Tags = []string{"ops"}
+	for _, p := range []*models.Pattern{keep, dup, models.NewPattern("write tests", "table-driven")} {
+		require.NoError(t, storage.SavePattern(ctx, p))
+	}
+
+	// Declining leaves everything in place
+	var out bytes.Buffer
+	require.NoError(t, Dedupe(storage, nil, DedupeOptions{}, strings.NewReader("n\n"), &out))
+	assert.Contains(t, out.String(), "2 similar patterns")
+	assert.Contains(t, out.String(), "No changes made")
+	count, err := storage.CountPatterns(ctx, contracts.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	out.Reset()
+	require.NoError(t, Dedupe(storage, nil, DedupeOptions{}, strings.NewReader("y\n"), &out))
+	assert.Contains(t, out.String(), "removed 1 patterns")
+
+	merged, err := storage.GetPattern(ctx, keep.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ops"}, merged.Tags)
+	byAlias, err := storage.GetPatternByTrigger(ctx, "Deploy to production!")
+	require.NoError(t, err)
+	assert.Equal(t, keep.ID, byAlias.ID)
+}
+
+func TestDigest(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, storage.SavePattern(ctx, models.NewPattern("paginate api", "Use cursors")))
+
+	var out bytes.Buffer
+	require.NoError(t, Digest(storage, nil, DigestOptions{SpaceID: "work"}, &out))
+	assert.Contains(t, out.String(), "## New patterns")
+	assert.Contains(t, out.String(), "Saved as note")
+
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, notes, 1)
+	assert.Equal(t, "work", notes[0].SpaceID)
+	assert.Equal(t, []string{"digest"}, notes[0].Tags)
+
+	assert.Error(t, Digest(storage, nil, DigestOptions{Since: "soon"}, &out))
+}
+
+func TestTagSuggest(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	for _, p := range []*models.Pattern{
+		{Trigger: "list users endpoint", Response: "GET /users with pagination", Tags: []string{"api"}},
+		{Trigger: "create user endpoint", Response: "POST /users returns 201", Tags: []string{"api"}},
+		{Trigger: "delete user endpoint", Response: "DELETE /users/:id"},
+	} {
+		pattern := models.NewPattern(p.Trigger, p.Response)
+		pattern.Tags = p.Tags
+		require.NoError(t, storage.SavePattern(ctx, pattern))
+	}
+	require.NoError(t, storage.SaveNote(ctx, models.NewNote("Release", "- [ ] publish")))
+
+	var out bytes.Buffer
+	require.NoError(t, TagSuggest(storage, nil, TagSuggestOptions{}, &out))
+	assert.Contains(t, out.String(), "delete user endpoint")
+	assert.Contains(t, out.String(), "tags:     api (")
+	assert.Contains(t, out.String(), "category: todo (80%)")
+	assert.Contains(t, out.String(), "use --apply")
+
+	out.Reset()
+	require.NoError(t, TagSuggest(storage, nil, TagSuggestOptions{Apply: true}, &out))
+	assert.Contains(t, out.String(), "Tagged 2 items")
+	p, err := storage.GetPatternByTrigger(ctx, "delete user endpoint")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api"}, p.Tags)
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, models.CategoryTodo, notes[0].Category)
+}
+
+func TestDBCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	db := storage.Database()
+
+	var out bytes.Buffer
+	require.NoError(t, DBMigrate(db, 0, &out))
+	assert.Contains(t, out.String(), "Schema is up to date")
+
+	out.Reset()
+	require.NoError(t, DBStatus(db, 1, &out))
+	assert.Contains(t, out.String(), "baseline")
+	assert.NotContains(t, out.String(), "pending")
+
+	// Declining the confirmation changes nothing
+	out.Reset()
+	require.NoError(t, DBRollback(db, 1, false, strings.NewReader("n\n"), &out))
+	assert.Contains(t, out.String(), "Cancelled")
+
+	// The baseline cannot be rolled back
+	assert.Error(t, DBRollback(db, sqlite.LatestSchemaVersion(), true, nil, &out))
+}
+
+func TestBackupCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	db := storage.Database()
+	ctx := context.Background()
+	dir := t.TempDir()
+	p := models.NewPattern("kept", "1")
+	require.NoError(t, storage.SavePattern(ctx, p))
+
+	var out bytes.Buffer
+	require.NoError(t, BackupSnapshot(db, dir, "", 5, &out))
+	assert.Contains(t, out.String(), "Backed up 1 patterns")
+
+	out.Reset()
+	require.NoError(t, BackupList(dir, true, &out))
+	assert.Contains(t, out.String(), "1 patterns")
+	backups, err := sqlite.ListBackups(dir)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+
+	require.NoError(t, storage.DeletePattern(ctx, p.ID))
+
+	// Declining changes nothing
+	out.Reset()
+	require.NoError(t, Restore(db, dir, backups[0].Path, 5, false, strings.NewReader("n\n"), &out))
+	assert.Contains(t, out.String(), "Cancelled")
+	_, err = storage.GetPattern(ctx, p.ID)
+	assert.Error(t, err)
+
+	// A bare file name is looked up in the backup directory
+	out.Reset()
+	require.NoError(t, Restore(db, dir, filepath.Base(backups[0].Path), 5, true, nil, &out))
+	assert.Contains(t, out.String(), "Restore complete")
+	_, err = storage.GetPattern(ctx, p.ID)
+	assert.NoError(t, err)
+
+	assert.Error(t, Restore(db, dir, filepath.Join(dir, "missing.db"), 5, true, nil, &out))
+}
+
+func TestEncryptionCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, storage.Database().InitDefaultSpaces(ctx))
+
+	var out bytes.Buffer
+	require.ErrorIs(t, SpaceEncrypt(storage, "personal", true, &out), sqlite.ErrNoEncryption)
+
+	answers := []string{"secret", "typo"}
+	read := func(string) (string, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	assert.Error(t, DBRekey(storage, read, &out), "mismatched passphrases are rejected")
+
+	answers = []string{"secret", "secret"}
+	require.NoError(t, DBRekey(storage, read, &out))
+	assert.Contains(t, out.String(), "Encryption set up")
+
+	p := models.NewPattern("vpn", "password")
+	p.SpaceID = "personal"
+	require.NoError(t, storage.SavePattern(ctx, p))
+	out.Reset()
+	require.NoError(t, SpaceEncrypt(storage, "personal", true, &out))
+	assert.Contains(t, out.String(), "1 values encrypted")
+
+	space, err := storage.GetSpace(ctx, "personal")
+	require.NoError(t, err)
+	assert.True(t, space.Encrypted)
+	got, err := storage.GetPattern(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "password", got.Response)
+}
+
+func TestTagCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	p := models.NewPattern("list users", "GET /users")
+	p.Tags = []string{"api/users", "backend"}
+	require.NoError(t, storage.SavePattern(ctx, p))
+
+	var out bytes.Buffer
+	require.NoError(t, TagList(storage, &out))
+	assert.Contains(t, out.String(), "api/users")
+
+	out.Reset()
+	require.NoError(t, TagRename(storage, "api", "rest", &out))
+	assert.Contains(t, out.String(), "on 1 items")
+	assert.Error(t, TagRename(storage, "missing", "other", &out))
+
+	require.NoError(t, TagMerge(storage, []string{"backend"}, "rest", &out))
+	require.NoError(t, TagDelete(storage, "rest", true, nil, &out))
+
+	got, err := storage.GetPattern(ctx, p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rest/users"}, got.Tags)
+
+	// Subtags are listed under their parent
+	got.Tags = append(got.Tags, "rest")
+	require.NoError(t, storage.UpdatePattern(ctx, got))
+	out.Reset()
+	require.NoError(t, TagList(storage, &out))
+	assert.Contains(t, out.String(), "\n  users ")
+}
+
+func TestArchiveCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	p := models.NewPattern("kept", "1")
+	require.NoError(t, storage.SavePattern(ctx, p))
+
+	path := filepath.Join(t.TempDir(), "all.otrz")
+	assert.True(t, IsArchivePath(path))
+	assert.False(t, IsArchivePath("patterns.json"))
+
+	var out bytes.Buffer
+	require.NoError(t, ArchiveExport(storage, path, &out))
+	assert.Contains(t, out.String(), "Exported 1 patterns")
+
+	// Importing back into the same database copies under new IDs
+	out.Reset()
+	require.NoError(t, ArchiveImport(storage, path, sqlite.ArchiveImportOptions{}, &out))
+	assert.Contains(t, out.String(), "Imported 1 patterns")
+	assert.Contains(t, out.String(), "given new IDs")
+	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, patterns, 2)
+
+	assert.Error(t, ArchiveImport(storage, filepath.Join(t.TempDir(), "missing.otrz"), sqlite.ArchiveImportOptions{}, &out))
+}
+
+func TestSyncCommands(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, storage.SavePattern(ctx, models.NewPattern("kept", "1")))
+
+	_, _, err := OpenSyncPeer(filepath.Join(t.TempDir(), "missing.db"))
+	assert.Error(t, err)
+
+	// A folder holds the hub database, created on first use
+	dir := t.TempDir()
+	peer, path, err := OpenSyncPeer(dir)
+	require.NoError(t, err)
+	defer peer.Close()
+	assert.Equal(t, filepath.Join(dir, SyncHubName), path)
+
+	var out bytes.Buffer
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, Sync(storage, peer, path, sqlite.SyncOptions{}, reportPath, &out))
+	assert.Contains(t, out.String(), "first sync")
+	assert.Contains(t, out.String(), "Pushed: 1 patterns")
+	assert.FileExists(t, reportPath)
+
+	patterns, err := peer.ListPatterns(ctx, contracts.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, patterns, 1)
+
+	out.Reset()
+	require.NoError(t, SyncResetID(storage, &out))
+	assert.Contains(t, out.String(), "New replica ID")
+}
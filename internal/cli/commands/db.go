@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+)
+
+// DBMigrate applies pending schema migrations up to version (0 = latest).
+// An older version is pinned, so startup doesn't migrate past it; other
+// commands then refuse to run until the schema is current.
+func DBMigrate(db *sqlite.Database, version int, out io.Writer) error {
+	ctx := context.Background()
+	results, err := db.MigrateTo(ctx, version)
+	printMigrationResults(out, "Applied", results)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		current, err := db.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema is up to date (version %d)\n", current)
+	}
+	return nil
+}
+
+// DBStatus prints the schema version and every migration's state.
+// configVersion is the version recorded in the config file.
+func DBStatus(db *sqlite.Database, configVersion int, out io.Writer) error {
+	ctx := context.Background()
+	states, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	pinned, err := db.PinnedVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Database:       %s\n", db.Path())
+	fmt.Fprintf(out, "Schema version: %d (latest %d)\n", current, sqlite.LatestSchemaVersion())
+	if pinned != 0 {
+		fmt.Fprintf(out, "Pinned at:      %d (other commands refuse to run; 'otr db migrate' removes the pin)\n", pinned)
+	}
+	fmt.Fprintf(out, "Config version: %d\n\n", configVersion)
+
+	pending := 0
+	fmt.Fprintf(out, "%-8s %-28s %-10s %s\n", "VERSION", "NAME", "STATUS", "APPLIED")
+	for _, s := range states {
+		status, applied := "pending", ""
+		switch {
+		case s.Unknown:
+			status = "unknown"
+		case s.Modified:
+			status = "modified"
+		case s.Applied:
+			status = "applied"
+		default:
+			pending++
+		}
+		if s.Applied {
+			applied = s.AppliedAt.Format("2006-01-02 15:04")
+		}
+		if !s.Reversible && !s.Unknown {
+			status += "*"
+		}
+		fmt.Fprintf(out, "%-8d %-28s %-10s %s\n", s.Version, truncateKey(s.Name, 28), status, applied)
+	}
+	fmt.Fprintln(out, "\n* cannot be rolled back")
+	if pending > 0 {
+		fmt.Fprintf(out, "%d pending migrations (run 'otr db migrate')\n", pending)
+	}
+	return nil
+}
+
+// DBRollback reverts the last steps migrations after confirmation.
+// The database file is backed up first. The older schema is pinned, and
+// other commands refuse to run until 'otr db migrate'.
+func DBRollback(db *sqlite.Database, steps int, yes bool, in io.Reader, out io.Writer) error {
+	ctx := context.Background()
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if !yes {
+		question := fmt.Sprintf("Roll back %d migrations from schema version %d?", steps, current)
+		if !confirm(bufio.NewScanner(in), out, question) {
+			fmt.Fprintln(out, "Cancelled")
+			return nil
+		}
+	}
+
+	results, err := db.Rollback(ctx, steps)
+	printMigrationResults(out, "Rolled back", results)
+	if len(results) > 0 {
+		fmt.Fprintln(out, "Other commands refuse to run on this schema until 'otr db migrate'")
+	}
+	return err
+}
+
+func printMigrationResults(out io.Writer, verb string, results []sqlite.MigrationResult) {
+	for _, r := range results {
+		if r.Backup != "" {
+			fmt.Fprintf(out, "Backed up database to %s\n", r.Backup)
+		}
+		fmt.Fprintf(out, "%s %d %s\n", verb, r.Version, r.Name)
+	}
+}
+
+// DBRekey sets the encryption passphrase, or changes it and rotates the
+// data key. readPassphrase prompts for the new passphrase, which is asked
+// twice.
+func DBRekey(storage *sqlite.Storage, readPassphrase func(prompt string) (string, error), out io.Writer) error {
+	ctx := context.Background()
+	enabled, err := storage.EncryptionEnabled(ctx)
+	if err != nil {
+		return err
+	}
+	if enabled && storage.Locked() {
+		return sqlite.ErrLocked
+	}
+
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return err
+	}
+	again, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return err
+	}
+	if passphrase != again {
+		return fmt.Errorf("passphrases do not match")
+	}
+
+	n, err := storage.Rekey(ctx, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to rekey: %w", err)
+	}
+	if !enabled {
+		fmt.Fprintln(out, "Encryption set up; encrypt a space with 'otr space encrypt <space_id>'")
+		return nil
+	}
+	fmt.Fprintf(out, "Passphrase changed; re-encrypted %d values with a new key\n", n)
+	return nil
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/core/dedupe"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// DedupeOptions configures Dedupe.
+type DedupeOptions struct {
+	SpaceID   string  // Only look at one space (empty = all)
+	Threshold float64 // Minimum similarity 0-1 (0 = default)
+	Yes       bool    // Apply every proposal without asking
+	DryRun    bool    // Only show proposals
+}
+
+// Dedupe finds near-duplicate patterns and merges the proposals the user
+// accepts, all in one transaction. With a provider each cluster is
+// reviewed by the AI first.
+func Dedupe(storage *sqlite.Storage, provider ai.Provider, opts DedupeOptions, in io.Reader, out io.Writer) error {
+	ctx := context.Background()
+	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{SpaceID: opts.SpaceID, Limit: 10000})
+	if err != nil {
+		return fmt.Errorf("failed to list patterns: %w", err)
+	}
+
+	finderOpts := []dedupe.Option{dedupe.WithThreshold(opts.Threshold)}
+	if provider != nil {
+		finderOpts = append(finderOpts, dedupe.WithProvider(provider))
+	}
+	proposals, err := dedupe.NewFinder(finderOpts...).Find(ctx, patterns)
+	if err != nil {
+		return err
+	}
+	if len(proposals) == 0 {
+		fmt.Fprintf(out, "No duplicates found among %d patterns\n", len(patterns))
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	var merges []*models.PatternMerge
+	for i, p := range proposals {
+		merge := p.Merge()
+		printProposal(out, i+1, len(proposals), p, merge)
+		if opts.DryRun {
+			continue
+		}
+		if opts.Yes || confirm(scanner, out, "Merge?") {
+			merges = append(merges, merge)
+		}
+	}
+	if opts.DryRun || len(merges) == 0 {
+		fmt.Fprintln(out, "\nNo changes made")
+		return nil
+	}
+
+	if err := storage.MergePatterns(ctx, merges); err != nil {
+		return fmt.Errorf("failed to merge patterns: %w", err)
+	}
+	removed := 0
+	for _, m := range merges {
+		removed += len(m.Merged)
+	}
+	fmt.Fprintf(out, "\nMerged %d groups, removed %d patterns\n", len(merges), removed)
+	return nil
+}
+
+// printProposal shows a cluster and the pattern it would become.
+func printProposal(out io.Writer, n, total int, p *dedupe.Proposal, m *models.PatternMerge) {
+	fmt.Fprintf(out, "\n[%d/%d] %d similar patterns (similarity %.0f%%)\n", n, total, len(p.Patterns), p.Score*100)
+	if p.Reason != "" {
+		fmt.Fprintf(out, "  AI: %s\n", p.Reason)
+	}
+	for i, pattern := range p.Patterns {
+		mark := "merge"
+		if i == 0 {
+			mark = "keep"
+		}
+		fmt.Fprintf(out, "  %-5s %s  %s -> %s (strength %.0f, used %d)\n", mark, shortID(pattern.ID),
+			pattern.Trigger, oneLine(pattern.Response, 40), pattern.Strength, pattern.ReinforceCnt)
+	}
+	fmt.Fprintf(out, "  result: strength %.0f, used %d", m.Keep.Strength, m.Keep.ReinforceCnt)
+	if len(m.Keep.Tags) > 0 {
+		fmt.Fprintf(out, ", tags %v", m.Keep.Tags)
+	}
+	if len(m.Aliases) > 0 {
+		fmt.Fprintf(out, ", aliases %q", m.Aliases)
+	}
+	fmt.Fprintln(out)
+}
+
+// oneLine flattens s to a single line of at most n runes.
+func oneLine(s string, n int) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/core/digest"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// DigestOptions configures Digest.
+type DigestOptions struct {
+	Since   string // Period start (e.g. 7d, 2w, 2006-01-02; default 7d)
+	SpaceID string // Space to save the digest note in (empty = global)
+	NoSave  bool   // Print the digest without saving it
+}
+
+// Digest reviews recent notes and reflex activity and saves the review as
+// a note. With a nil provider a template-only report is written.
+func Digest(storage *sqlite.Storage, provider ai.Provider, opts DigestOptions, out io.Writer) error {
+	ctx := context.Background()
+	if opts.Since == "" {
+		opts.Since = "7d"
+	}
+	now := time.Now()
+	since, err := parseSince(opts.Since, now)
+	if err != nil {
+		return err
+	}
+
+	var genOpts []digest.Option
+	if provider != nil {
+		genOpts = append(genOpts, digest.WithProvider(provider))
+	}
+	d, err := digest.New(storage, genOpts...).Generate(ctx, since, now)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, d.Markdown)
+
+	if opts.NoSave {
+		return nil
+	}
+	note := models.NewNote(d.Title, d.Markdown)
+	note.SpaceID = opts.SpaceID
+	if note.SpaceID == "" {
+		note.SpaceID = "global"
+	}
+	note.Category = models.CategoryMemory
+	note.Tags = []string{"digest"}
+	if err := storage.SaveNote(ctx, note); err != nil {
+		return fmt.Errorf("failed to save digest: %w", err)
+	}
+	fmt.Fprintf(out, "Saved as note %s in space %s\n", note.ID, note.SpaceID)
+	return nil
+}
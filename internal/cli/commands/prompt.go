@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/redact"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/chat"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+)
+
+// PreviewPrompt renders the system and user prompt that chat would send
+// for query, without calling the AI provider. With a redactor the prompts
+// are shown as sent, with secrets replaced by placeholders.
+func PreviewPrompt(storage *sqlite.Storage, builder *prompt.Builder, r *redact.Redactor, spaceID string, threshold float64, query string, out io.Writer) error {
+	if query == "" {
+		return fmt.Errorf("query required")
+	}
+
+	opts := []chat.Option{chat.WithSpace(spaceID), chat.WithBuilder(builder)}
+	if threshold > 0 {
+		opts = append(opts, chat.WithThreshold(threshold))
+	}
+	session := chat.NewSession(storage, nil, opts...)
+
+	data, fit, err := session.PromptData(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	system, err := builder.RenderSystem(data)
+	if err != nil {
+		return err
+	}
+	user, err := builder.RenderPrompt(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Matched patterns: %d", len(data.Patterns)+len(fit.Dropped))
+	if builder.HasTemplates() {
+		fmt.Fprintf(out, ", notes: %d", len(data.Notes))
+	}
+	fmt.Fprintln(out)
+	printFit(out, fit)
+	if r != nil {
+		m := redact.NewMapping()
+		system, user = r.Redact(m, system), r.Redact(m, user)
+		if findings := m.Findings(); len(findings) > 0 {
+			fmt.Fprintf(out, "Redacted: %d values\n", len(findings))
+			printFindings(out, findings)
+		}
+	}
+	fmt.Fprintf(out, "\n=== System ===\n%s\n", system)
+	fmt.Fprintf(out, "\n=== User ===\n%s\n", user)
+	return nil
+}
+
+// printFit reports which patterns made it into the context budget.
+func printFit(out io.Writer, fit *prompt.FitResult) {
+	if len(fit.Included) == 0 && len(fit.Dropped) == 0 {
+		return
+	}
+	budget := "unlimited"
+	if fit.Budget > 0 {
+		budget = fmt.Sprintf("%d", fit.Budget)
+	}
+	fmt.Fprintf(out, "Context: ~%d of %s tokens\n", fit.Tokens, budget)
+
+	truncated := make(map[string]bool, len(fit.Truncated))
+	for _, id := range fit.Truncated {
+		truncated[id] = true
+	}
+	for _, p := range fit.Included {
+		status := "included"
+		if truncated[p.ID] {
+			status = "truncated"
+		}
+		fmt.Fprintf(out, "  %-9s %s\n", status, p.Trigger)
+	}
+	for _, p := range fit.Dropped {
+		fmt.Fprintf(out, "  %-9s %s\n", "dropped", p.Trigger)
+	}
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/redact"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+)
+
+// RedactCheck shows what would be redacted from text before sending it to
+// an AI provider, followed by the redacted text.
+func RedactCheck(r *redact.Redactor, text string, out io.Writer) error {
+	redacted, findings := r.Scan(text)
+	if len(findings) == 0 {
+		fmt.Fprintln(out, "Nothing to redact")
+		return nil
+	}
+	printFindings(out, findings)
+	fmt.Fprintf(out, "\n=== Sent ===\n%s\n", redacted)
+	return nil
+}
+
+// RedactScan reports stored patterns and notes containing values that
+// would be redacted before they are sent to an AI provider.
+func RedactScan(storage contracts.Storage, r *redact.Redactor, out io.Writer) error {
+	ctx := context.Background()
+	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 10000})
+	if err != nil {
+		return fmt.Errorf("failed to list patterns: %w", err)
+	}
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{Limit: 10000})
+	if err != nil {
+		return fmt.Errorf("failed to list notes: %w", err)
+	}
+
+	items := 0
+	for _, p := range patterns {
+		_, findings := r.Scan(p.Trigger + "\n" + p.Response)
+		if len(findings) > 0 {
+			fmt.Fprintf(out, "pattern %s (%s)\n", shortID(p.ID), p.Trigger)
+			printFindings(out, findings)
+			items++
+		}
+	}
+	for _, n := range notes {
+		_, findings := r.Scan(n.Title + "\n" + n.Content)
+		if len(findings) > 0 {
+			fmt.Fprintf(out, "note %s (%s)\n", shortID(n.ID), n.Title)
+			printFindings(out, findings)
+			items++
+		}
+	}
+
+	if items == 0 {
+		fmt.Fprintf(out, "Nothing to redact in %d patterns and %d notes\n", len(patterns), len(notes))
+		return nil
+	}
+	fmt.Fprintf(out, "\n%d of %d items contain values that are redacted before sending\n", items, len(patterns)+len(notes))
+	return nil
+}
+
+// printFindings lists findings with their values masked.
+func printFindings(out io.Writer, findings []redact.Finding) {
+	for _, f := range findings {
+		fmt.Fprintf(out, "  %-12s %-24s %s\n", f.Detector, f.Placeholder, f.Masked())
+	}
+}
+
+// shortID abbreviates an ID for display.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+)
+
+// SyncHubName is the database kept in a shared sync folder. Every device
+// syncs with it, and so through it with each other.
+const SyncHubName = "otr-sync.db"
+
+// OpenSyncPeer opens the database at path for syncing, migrated to the
+// latest schema. If path is a directory, its hub database is used and
+// created if missing. It returns the path actually opened.
+func OpenSyncPeer(path string) (*sqlite.Storage, string, error) {
+	if path == "" {
+		return nil, "", fmt.Errorf("database file or sync folder is required")
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, SyncHubName)
+	} else if os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("%s does not exist", path)
+	}
+
+	db, err := sqlite.NewDatabase(path)
+	if err != nil {
+		return nil, "", err
+	}
+	ctx := context.Background()
+	version, err := db.SchemaVersion(ctx)
+	if err == nil && version > sqlite.LatestSchemaVersion() {
+		err = fmt.Errorf("%s has schema version %d, newer than this version of otr supports (%d)",
+			path, version, sqlite.LatestSchemaVersion())
+	}
+	if err == nil {
+		err = db.Migrate(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, "", err
+	}
+	return sqlite.NewStorage(db), path, nil
+}
+
+// Sync merges the local database with peer in both directions and prints
+// the conflict report. With reportPath the report is also written there
+// as JSON.
+func Sync(local, peer *sqlite.Storage, location string, opts sqlite.SyncOptions, reportPath string, out io.Writer) error {
+	opts.Location = location
+	report, err := local.Sync(context.Background(), peer, opts)
+	if err != nil {
+		return err
+	}
+
+	if report.LastSynced != nil {
+		fmt.Fprintf(out, "Synced with %s (last synced %s)\n", location, report.LastSynced.Format("2006-01-02 15:04"))
+	} else {
+		fmt.Fprintf(out, "Synced with %s (first sync)\n", location)
+	}
+	for _, side := range []struct {
+		name   string
+		counts sqlite.SyncCounts
+	}{{"Pulled", report.Pulled}, {"Pushed", report.Pushed}} {
+		fmt.Fprintf(out, "  %s: %d patterns, %d notes, %d spaces, %d deleted\n",
+			side.name, side.counts.Patterns, side.counts.Notes, side.counts.Spaces, side.counts.Deleted)
+	}
+
+	if len(report.Conflicts) == 0 {
+		fmt.Fprintln(out, "No conflicts")
+	} else {
+		fmt.Fprintf(out, "\nConflicts (%d, strategy %s):\n", len(report.Conflicts), report.Strategy)
+		for _, c := range report.Conflicts {
+			line := fmt.Sprintf("  %s %q (%s): %s", c.ItemType, c.Label, shortID(c.ItemID), c.Reason)
+			if len(c.Fields) > 0 {
+				line += fmt.Sprintf(" %v", c.Fields)
+			}
+			fmt.Fprintf(out, "%s; kept %s\n", line, c.Winner)
+		}
+	}
+	for _, id := range report.Unencrypted {
+		fmt.Fprintf(out, "Warning: space %s is encrypted on one side but was created unencrypted on the other, which has no passphrase\n", id)
+	}
+	if report.DryRun {
+		fmt.Fprintln(out, "Dry run: nothing was written")
+	}
+
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		if err := os.WriteFile(reportPath, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		fmt.Fprintf(out, "Report written to %s\n", reportPath)
+	}
+	return nil
+}
+
+// SyncResetID gives the database a new replica ID, for one copied from
+// another database.
+func SyncResetID(storage *sqlite.Storage, out io.Writer) error {
+	id, err := storage.ResetReplicaID(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "New replica ID %s; the next sync with each peer treats every difference as a conflict\n", id)
+	return nil
+}
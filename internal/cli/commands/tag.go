@@ -0,0 +1,256 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/core/tagger"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// AutoTagConfidence is the minimum confidence for tags added automatically
+// when patterns and notes are created or imported.
+const AutoTagConfidence = 0.5
+
+// TagSuggestOptions configures TagSuggest.
+type TagSuggestOptions struct {
+	SpaceID       string  // Only look at one space (empty = all)
+	Patterns      bool    // Include patterns
+	Notes         bool    // Include notes
+	All           bool    // Include items that already have tags and a category
+	Apply         bool    // Save the suggestions
+	MinConfidence float64 // Drop weaker suggestions (0 = default)
+}
+
+// TagSuggest suggests tags for patterns and notes, and categories for
+// notes, from the tags already in use. By default only untagged items
+// (and notes still in the default category) are considered. With a
+// provider the suggestions are refined by the AI.
+func TagSuggest(storage contracts.Storage, provider ai.Provider, opts TagSuggestOptions, out io.Writer) error {
+	ctx := context.Background()
+	if !opts.Patterns && !opts.Notes {
+		opts.Patterns, opts.Notes = true, true
+	}
+
+	tagOpts := []tagger.Option{tagger.WithMinConfidence(opts.MinConfidence)}
+	if provider != nil {
+		tagOpts = append(tagOpts, tagger.WithProvider(provider))
+	}
+	t, err := tagger.Load(ctx, storage, tagOpts...)
+	if err != nil {
+		return err
+	}
+
+	suggested, applied := 0, 0
+	if opts.Patterns {
+		patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{SpaceID: opts.SpaceID, Limit: 10000})
+		if err != nil {
+			return fmt.Errorf("failed to list patterns: %w", err)
+		}
+		for _, p := range patterns {
+			if len(p.Tags) > 0 && !opts.All {
+				continue
+			}
+			r, err := t.SuggestPattern(ctx, p)
+			if err != nil {
+				return err
+			}
+			if len(r.Tags) == 0 {
+				continue
+			}
+			suggested++
+			fmt.Fprintf(out, "pattern %s  %s\n", shortID(p.ID), p.Trigger)
+			printSuggestions(out, r)
+			if opts.Apply {
+				p.Tags = append(p.Tags, r.TagNames()...)
+				if err := storage.UpdatePattern(ctx, p); err != nil {
+					return fmt.Errorf("failed to update pattern %s: %w", p.ID, err)
+				}
+				applied++
+			}
+		}
+	}
+
+	if opts.Notes {
+		notes, err := storage.ListNotes(ctx, contracts.ListOptions{SpaceID: opts.SpaceID, Limit: 10000})
+		if err != nil {
+			return fmt.Errorf("failed to list notes: %w", err)
+		}
+		for _, n := range notes {
+			defaultCategory := n.Category == "" || n.Category == models.CategoryNote
+			if len(n.Tags) > 0 && !defaultCategory && !opts.All {
+				continue
+			}
+			r, err := t.SuggestNote(ctx, n)
+			if err != nil {
+				return err
+			}
+			if len(r.Tags) == 0 && r.Category == nil {
+				continue
+			}
+			suggested++
+			fmt.Fprintf(out, "note %s  %s\n", shortID(n.ID), n.Title)
+			printSuggestions(out, r)
+			if opts.Apply {
+				applyNoteSuggestions(n, r)
+				if err := storage.UpdateNote(ctx, n); err != nil {
+					return fmt.Errorf("failed to update note %s: %w", n.ID, err)
+				}
+				applied++
+			}
+		}
+	}
+
+	switch {
+	case suggested == 0:
+		fmt.Fprintln(out, "No suggestions")
+	case opts.Apply:
+		fmt.Fprintf(out, "\nTagged %d items\n", applied)
+	default:
+		fmt.Fprintf(out, "\n%d items have suggestions (use --apply to save them)\n", suggested)
+	}
+	return nil
+}
+
+// AutoTagPattern adds confident tag suggestions to an untagged pattern
+// before it is saved, and returns them.
+func AutoTagPattern(ctx context.Context, t *tagger.Tagger, p *models.Pattern) ([]tagger.Suggestion, error) {
+	if len(p.Tags) > 0 {
+		return nil, nil
+	}
+	r, err := t.SuggestPattern(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	r.Tags = confident(r.Tags)
+	p.Tags = r.TagNames()
+	return r.Tags, nil
+}
+
+// AutoTagNote adds confident tag and category suggestions to a note
+// before it is saved, and returns the result.
+func AutoTagNote(ctx context.Context, t *tagger.Tagger, n *models.Note) (*tagger.Result, error) {
+	r, err := t.SuggestNote(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(n.Tags) > 0 {
+		r.Tags = nil
+	}
+	r.Tags = confident(r.Tags)
+	if r.Category != nil && r.Category.Confidence < AutoTagConfidence {
+		r.Category = nil
+	}
+	applyNoteSuggestions(n, r)
+	return r, nil
+}
+
+// FormatSuggestions renders suggestions as "api (82%), ops (55%)".
+func FormatSuggestions(s []tagger.Suggestion) string {
+	parts := make([]string, len(s))
+	for i, sug := range s {
+		parts[i] = fmt.Sprintf("%s (%.0f%%)", sug.Name, sug.Confidence*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func confident(s []tagger.Suggestion) []tagger.Suggestion {
+	var out []tagger.Suggestion
+	for _, sug := range s {
+		if sug.Confidence >= AutoTagConfidence {
+			out = append(out, sug)
+		}
+	}
+	return out
+}
+
+func applyNoteSuggestions(n *models.Note, r *tagger.Result) {
+	n.Tags = append(n.Tags, r.TagNames()...)
+	if r.Category != nil {
+		n.Category = r.Category.Name
+	}
+}
+
+func printSuggestions(out io.Writer, r *tagger.Result) {
+	if len(r.Tags) > 0 {
+		fmt.Fprintf(out, "  tags:     %s\n", FormatSuggestions(r.Tags))
+	}
+	if r.Category != nil {
+		fmt.Fprintf(out, "  category: %s\n", FormatSuggestions([]tagger.Suggestion{*r.Category}))
+	}
+}
+
+// TagList prints the tags in use as a tree with pattern and note counts.
+func TagList(storage *sqlite.Storage, out io.Writer) error {
+	tags, err := storage.ListTags(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		fmt.Fprintln(out, "No tags")
+		return nil
+	}
+
+	// Subtags whose parent is listed show only their last level, indented
+	// under the parent; others show their full name
+	indent := make(map[string]int, len(tags))
+	fmt.Fprintf(out, "%-32s %8s %6s\n", "TAG", "PATTERNS", "NOTES")
+	for _, t := range tags {
+		name, level := t.Name, 0
+		if i := strings.LastIndex(t.Name, models.TagSeparator); i >= 0 {
+			if parent, ok := indent[strings.ToLower(t.Name[:i])]; ok {
+				level = parent + 1
+				name = strings.Repeat("  ", level) + t.Name[i+1:]
+			}
+		}
+		indent[strings.ToLower(t.Name)] = level
+		fmt.Fprintf(out, "%-32s %8d %6d\n", truncateKey(name, 32), t.Patterns, t.Notes)
+	}
+	return nil
+}
+
+// TagRename renames a tag and its subtags on all patterns and notes.
+func TagRename(storage *sqlite.Storage, oldName, newName string, out io.Writer) error {
+	n, err := storage.RenameTag(context.Background(), oldName, newName)
+	if err != nil {
+		return fmt.Errorf("failed to rename tag: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("tag not found: %s", oldName)
+	}
+	fmt.Fprintf(out, "Renamed %s to %s on %d items\n", oldName, newName, n)
+	return nil
+}
+
+// TagMerge merges tags and their subtags into another tag.
+func TagMerge(storage *sqlite.Storage, from []string, into string, out io.Writer) error {
+	n, err := storage.MergeTags(context.Background(), from, into)
+	if err != nil {
+		return fmt.Errorf("failed to merge tags: %w", err)
+	}
+	fmt.Fprintf(out, "Merged %s into %s on %d items\n", strings.Join(from, ", "), into, n)
+	return nil
+}
+
+// TagDelete removes a tag from all patterns and notes after confirmation.
+func TagDelete(storage *sqlite.Storage, name string, yes bool, in io.Reader, out io.Writer) error {
+	if !yes && !confirm(bufio.NewScanner(in), out, fmt.Sprintf("Remove tag %q from all patterns and notes?", name)) {
+		fmt.Fprintln(out, "Cancelled")
+		return nil
+	}
+	n, err := storage.DeleteTag(context.Background(), name)
+	if err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("tag not found: %s", name)
+	}
+	fmt.Fprintf(out, "Removed %s from %d items\n", name, n)
+	return nil
+}
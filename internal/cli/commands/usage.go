@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+)
+
+// ShowUsage prints AI token usage and cost grouped by day, space or model,
+// followed by the state of any configured budgets.
+func ShowUsage(storage *sqlite.Storage, cfg *config.Config, groupBy, since string) error {
+	ctx := context.Background()
+
+	start, err := parseSince(since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	summaries, err := storage.UsageSummary(ctx, groupBy, start)
+	if err != nil {
+		return fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	if groupBy == "" {
+		groupBy = sqlite.UsageByDay
+	}
+	fmt.Printf("AI usage by %s since %s\n\n", groupBy, start.Format("2006-01-02"))
+
+	if len(summaries) == 0 {
+		fmt.Println("No AI calls recorded.")
+	} else {
+		fmt.Printf("%-28s %6s %10s %10s %10s %9s\n", strings.ToUpper(groupBy), "CALLS", "INPUT", "OUTPUT", "COST", "LATENCY")
+		var calls, input, output int
+		var cost float64
+		for _, s := range summaries {
+			fmt.Printf("%-28s %6d %10d %10d %10s %9s\n",
+				truncateKey(s.Key, 28), s.Calls, s.InputTokens, s.OutputTokens,
+				formatCost(s.Cost), s.AvgLatency.Round(time.Millisecond))
+			calls += s.Calls
+			input += s.InputTokens
+			output += s.OutputTokens
+			cost += s.Cost
+		}
+		fmt.Printf("%-28s %6d %10d %10d %10s\n", "TOTAL", calls, input, output, formatCost(cost))
+	}
+
+	return printBudgets(ctx, storage, cfg.AI.Budget)
+}
+
+// printBudgets prints spend against the configured budgets.
+func printBudgets(ctx context.Context, storage *sqlite.Storage, budget config.BudgetConfig) error {
+	if budget.Daily <= 0 && budget.Monthly <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	y, m, d := now.Date()
+	periods := []struct {
+		name  string
+		limit float64
+		start time.Time
+	}{
+		{"Daily", budget.Daily, time.Date(y, m, d, 0, 0, 0, 0, now.Location())},
+		{"Monthly", budget.Monthly, time.Date(y, m, 1, 0, 0, 0, 0, now.Location())},
+	}
+
+	fmt.Println("\nBudgets:")
+	for _, p := range periods {
+		if p.limit <= 0 {
+			continue
+		}
+		spent, err := storage.UsageCostSince(ctx, p.start)
+		if err != nil {
+			return fmt.Errorf("failed to get spend: %w", err)
+		}
+		status := "ok"
+		switch {
+		case spent >= p.limit:
+			status = "EXCEEDED"
+		case budget.WarnAt > 0 && spent >= p.limit*budget.WarnAt:
+			status = "warning"
+		}
+		fmt.Printf("  %-8s %s / %s (%.0f%%) %s\n", p.name, formatCost(spent), formatCost(p.limit), spent/p.limit*100, status)
+	}
+	return nil
+}
+
+// parseSince parses a relative duration ("7d", "2w", "12h") or a date
+// ("2006-01-02") into a start time. An empty string means 30 days.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		s = "30d"
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+
+	if len(s) >= 2 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err == nil && n >= 0 {
+			switch s[len(s)-1] {
+			case 'd':
+				return now.AddDate(0, 0, -n), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), nil
+			case 'm':
+				return now.AddDate(0, -n, 0), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value: %s (use e.g. 7d, 2w, 12h or 2006-01-02)", s)
+}
+
+// formatCost formats a USD amount.
+func formatCost(cost float64) string {
+	if cost > 0 && cost < 0.01 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// truncateKey shortens a report key to fit its column.
+func truncateKey(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -48,13 +48,23 @@ type AppConfig struct {
 
 // StorageConfig contains storage backend settings.
 type StorageConfig struct {
-	Type            string `mapstructure:"type"`             // Storage type (sqlite, etc.)
+	Type            string `mapstructure:"type"`             // Storage type (sqlite or files)
 	Path            string `mapstructure:"path"`             // Database file path
 	CacheSize       int    `mapstructure:"cache_size"`       // LRU cache capacity
 	MaxOpenConns    int    `mapstructure:"max_open_conns"`   // Max open connections
 	MaxIdleConns    int    `mapstructure:"max_idle_conns"`   // Max idle connections
 	ConnMaxLifetime int    `mapstructure:"conn_max_lifetime"` // Connection max lifetime (seconds)
 	ConnMaxIdleTime int    `mapstructure:"conn_max_idle_time"` // Connection max idle time (seconds)
+	AutoMigrate     bool   `mapstructure:"auto_migrate"`     // Apply schema migrations on startup
+	Backup          BackupConfig `mapstructure:"backup"`     // Database snapshots
+}
+
+// BackupConfig controls database snapshots taken by 'otr backup' and
+// automatically on startup.
+type BackupConfig struct {
+	Dir      string `mapstructure:"dir"`      // Snapshot directory
+	Interval int    `mapstructure:"interval"` // Hours between automatic snapshots (0 = off)
+	Keep     int    `mapstructure:"keep"`     // Snapshots kept when rotating (0 = all)
 }
 
 // AIConfig contains AI provider configuration.
@@ -62,8 +72,75 @@ type AIConfig struct {
 	Provider     string         `mapstructure:"provider"`      // Primary provider (anthropic, openai, local)
 	Providers    ProvidersConfig `mapstructure:"providers"`   // Per-provider settings
 	DefaultModel string         `mapstructure:"default_model"` // Default model name
-	Timeout      int            `mapstructure:"timeout"`       // Request timeout (seconds)
+	Timeout      int            `mapstructure:"timeout"`       // Per-attempt request timeout (seconds); streams only until they start
 	RetryMax     int            `mapstructure:"retry_max"`    // Max retry attempts
+	Fallback     []string       `mapstructure:"fallback"`      // Providers tried in order when the primary fails
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"` // Per-provider circuit breaker
+	Budget       BudgetConfig   `mapstructure:"budget"`        // Spending limits
+	Cache        CacheConfig    `mapstructure:"cache"`         // Response cache
+	Prompts      PromptsConfig  `mapstructure:"prompts"`       // Prompt templates
+	Redact       RedactConfig   `mapstructure:"redact"`        // Secret redaction before sending
+}
+
+// RedactConfig controls which secrets are replaced by placeholders before
+// a request is sent to a provider.
+type RedactConfig struct {
+	Enabled  bool              `mapstructure:"enabled"`  // Redact requests
+	Disable  []string          `mapstructure:"disable"`  // Built-in detectors to turn off (e.g. email)
+	Patterns map[string]string `mapstructure:"patterns"` // Extra detectors: name -> regular expression
+}
+
+// PromptsConfig selects prompt templates (Go text/template files).
+// File names are relative to Dir; empty names use the built-in prompts.
+type PromptsConfig struct {
+	Dir           string                       `mapstructure:"dir"`            // Template directory
+	System        string                       `mapstructure:"system"`         // Default system prompt template
+	Template      string                       `mapstructure:"template"`       // Default user prompt template
+	ContextTokens int                          `mapstructure:"context_tokens"` // Token budget for pattern context (0 = unlimited)
+	Spaces        map[string]SpacePromptConfig `mapstructure:"spaces"`         // Per-space overrides, keyed by space ID
+}
+
+// SpacePromptConfig overrides the prompt templates for one space.
+type SpacePromptConfig struct {
+	System   string `mapstructure:"system"`   // System prompt template
+	Template string `mapstructure:"template"` // User prompt template
+}
+
+// ForSpace returns the system and prompt template files for spaceID,
+// falling back to the defaults for anything the space does not set.
+func (c PromptsConfig) ForSpace(spaceID string) (system, template string) {
+	system, template = c.System, c.Template
+	if sc, ok := c.Spaces[spaceID]; ok {
+		if sc.System != "" {
+			system = sc.System
+		}
+		if sc.Template != "" {
+			template = sc.Template
+		}
+	}
+	return system, template
+}
+
+// CacheConfig controls the persistent AI response cache.
+type CacheConfig struct {
+	Enabled       bool `mapstructure:"enabled"`        // Enable response caching
+	TTL           int  `mapstructure:"ttl"`            // Entry lifetime (seconds)
+	MaxEntries    int  `mapstructure:"max_entries"`    // Max persisted entries
+	MemoryEntries int  `mapstructure:"memory_entries"` // Max entries in the in-memory tier
+}
+
+// BudgetConfig contains AI spending limits in USD (0 = unlimited).
+type BudgetConfig struct {
+	Daily   float64 `mapstructure:"daily"`   // Limit per day
+	Monthly float64 `mapstructure:"monthly"` // Limit per month
+	WarnAt  float64 `mapstructure:"warn_at"` // Warn at this fraction of a limit (0-1)
+}
+
+// CircuitBreakerConfig controls when a failing provider is skipped.
+type CircuitBreakerConfig struct {
+	Enabled          bool `mapstructure:"enabled"`           // Enable circuit breaking
+	FailureThreshold int  `mapstructure:"failure_threshold"` // Consecutive failures before opening
+	Cooldown         int  `mapstructure:"cooldown"`          // Seconds before a trial request
 }
 
 // ProvidersConfig contains per-provider settings.
@@ -71,6 +148,7 @@ type ProvidersConfig struct {
 	Anthropic AnthropicConfig `mapstructure:"anthropic"` // Anthropic Claude settings
 	OpenAI    OpenAIConfig    `mapstructure:"openai"`    // OpenAI settings
 	Local     LocalConfig     `mapstructure:"local"`     // Local model settings
+	Replay    ReplayConfig    `mapstructure:"replay"`    // Record/replay settings
 }
 
 // AnthropicConfig contains Anthropic Claude-specific settings.
@@ -98,6 +176,14 @@ type LocalConfig struct {
 	Model  string `mapstructure:"model"`   // Model name
 }
 
+// ReplayConfig contains settings for the record/replay provider.
+// Selecting ai.provider: replay lets demos and CI run without an API key.
+type ReplayConfig struct {
+	Cassette string `mapstructure:"cassette"` // Cassette file path
+	Mode     string `mapstructure:"mode"`     // replay, record or auto
+	Upstream string `mapstructure:"upstream"` // Provider used when recording
+}
+
 // UIConfig contains terminal UI configuration.
 type UIConfig struct {
 	Theme      string      `mapstructure:"theme"`       // Theme name (dark, light)
@@ -226,12 +312,30 @@ func (l *Loader) setDefaults() {
 	l.v.SetDefault("storage.max_idle_conns", 1)
 	l.v.SetDefault("storage.conn_max_lifetime", 3600)  // 1 hour
 	l.v.SetDefault("storage.conn_max_idle_time", 300)  // 5 minutes
+	l.v.SetDefault("storage.auto_migrate", true)
+	l.v.SetDefault("storage.backup.dir", "$HOME/.otr/backups")
+	l.v.SetDefault("storage.backup.interval", 24)
+	l.v.SetDefault("storage.backup.keep", 7)
 
 	// AI defaults
 	l.v.SetDefault("ai.provider", "anthropic")
 	l.v.SetDefault("ai.default_model", "claude-sonnet-4-20250514")
 	l.v.SetDefault("ai.timeout", 30)
 	l.v.SetDefault("ai.retry_max", 3)
+	l.v.SetDefault("ai.fallback", []string{})
+	l.v.SetDefault("ai.circuit_breaker.enabled", true)
+	l.v.SetDefault("ai.circuit_breaker.failure_threshold", 5)
+	l.v.SetDefault("ai.circuit_breaker.cooldown", 30)
+	l.v.SetDefault("ai.budget.daily", 0)
+	l.v.SetDefault("ai.budget.monthly", 0)
+	l.v.SetDefault("ai.budget.warn_at", 0.8)
+	l.v.SetDefault("ai.cache.enabled", true)
+	l.v.SetDefault("ai.cache.ttl", 86400)
+	l.v.SetDefault("ai.cache.max_entries", 1000)
+	l.v.SetDefault("ai.cache.memory_entries", 100)
+	l.v.SetDefault("ai.prompts.dir", "$HOME/.otr/prompts")
+	l.v.SetDefault("ai.prompts.context_tokens", 2048)
+	l.v.SetDefault("ai.redact.enabled", true)
 
 	// AI Providers defaults
 	l.v.SetDefault("ai.providers.anthropic.api_url", "https://api.anthropic.com/v1")
@@ -246,6 +350,10 @@ func (l *Loader) setDefaults() {
 	l.v.SetDefault("ai.providers.local.api_url", "http://localhost:11434/v1")
 	l.v.SetDefault("ai.providers.local.model", "llama2")
 
+	l.v.SetDefault("ai.providers.replay.cassette", "$HOME/.otr/cassettes/default.json")
+	l.v.SetDefault("ai.providers.replay.mode", "replay")
+	l.v.SetDefault("ai.providers.replay.upstream", "anthropic")
+
 	// UI defaults
 	l.v.SetDefault("ui.theme", "dark")
 	l.v.SetDefault("ui.output_mode", "terminal")
@@ -306,6 +414,30 @@ func (l *Loader) resolvePaths(cfg *Config) {
 		cfg.Storage.Path = filepath.Join(home, trimHomePrefix(cfg.Storage.Path))
 	}
 
+	// Resolve backup directory
+	if strings.HasPrefix(cfg.Storage.Backup.Dir, "$HOME") {
+		cfg.Storage.Backup.Dir = strings.Replace(cfg.Storage.Backup.Dir, "$HOME", home, 1)
+	}
+	if strings.HasPrefix(cfg.Storage.Backup.Dir, "~") {
+		cfg.Storage.Backup.Dir = filepath.Join(home, trimHomePrefix(cfg.Storage.Backup.Dir))
+	}
+
+	// Resolve replay cassette path
+	if strings.HasPrefix(cfg.AI.Providers.Replay.Cassette, "$HOME") {
+		cfg.AI.Providers.Replay.Cassette = strings.Replace(cfg.AI.Providers.Replay.Cassette, "$HOME", home, 1)
+	}
+	if strings.HasPrefix(cfg.AI.Providers.Replay.Cassette, "~") {
+		cfg.AI.Providers.Replay.Cassette = filepath.Join(home, trimHomePrefix(cfg.AI.Providers.Replay.Cassette))
+	}
+
+	// Resolve prompt template directory
+	if strings.HasPrefix(cfg.AI.Prompts.Dir, "$HOME") {
+		cfg.AI.Prompts.Dir = strings.Replace(cfg.AI.Prompts.Dir, "$HOME", home, 1)
+	}
+	if strings.HasPrefix(cfg.AI.Prompts.Dir, "~") {
+		cfg.AI.Prompts.Dir = filepath.Join(home, trimHomePrefix(cfg.AI.Prompts.Dir))
+	}
+
 	// Resolve audit log path
 	if strings.HasPrefix(cfg.Security.AuditLog.Path, "$HOME") {
 		cfg.Security.AuditLog.Path = strings.Replace(cfg.Security.AuditLog.Path, "$HOME", home, 1)
@@ -93,6 +93,12 @@ func TestLoader_LoadDefaults(t *testing.T) {
 	if cfg.UI.Theme != "dark" {
 		t.Errorf("expected dark, got %s", cfg.UI.Theme)
 	}
+	if !cfg.AI.CircuitBreaker.Enabled || cfg.AI.CircuitBreaker.FailureThreshold != 5 {
+		t.Errorf("unexpected circuit breaker defaults: %+v", cfg.AI.CircuitBreaker)
+	}
+	if len(cfg.AI.Fallback) != 0 {
+		t.Errorf("expected no fallback providers, got %v", cfg.AI.Fallback)
+	}
 }
 
 func TestLoader_LoadWithEnvOverride(t *testing.T) {
@@ -0,0 +1,196 @@
+// Package branch expands thought chain branches with AI.
+// The path from the user's query to the selected branch is sent to the
+// provider, which answers with scored sub-ideas. Each sub-idea becomes a
+// child branch, persisted as a thought node under the selected one.
+package branch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/response"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Branch is an AI-generated child branch.
+type Branch struct {
+	Thought string  // Short sub-idea shown in the tree
+	Action  string  // Suggested next step (may be empty)
+	Score   float64 // How promising the branch is (0-100)
+	NodeID  string  // Thought node the branch is persisted as
+}
+
+// Label returns the text stored in the branch's thought node.
+func (b *Branch) Label() string {
+	return fmt.Sprintf("%s (%.0f%%)", b.Thought, b.Score)
+}
+
+// Expander generates and persists child branches.
+// Safe for concurrent use if the provider is.
+type Expander struct {
+	storage     *sqlite.Storage
+	provider    ai.Provider
+	parser      *response.Parser
+	maxBranches int
+}
+
+// Option is a functional option for Expander.
+type Option func(*Expander)
+
+// WithMaxBranches sets the maximum number of children per expansion (default 4).
+func WithMaxBranches(n int) Option {
+	return func(e *Expander) {
+		e.maxBranches = n
+	}
+}
+
+// NewExpander creates an expander.
+func NewExpander(storage *sqlite.Storage, provider ai.Provider, opts ...Option) *Expander {
+	e := &Expander{
+		storage:     storage,
+		provider:    provider,
+		parser:      response.NewParser(response.WithFormat(response.FormatJSON)),
+		maxBranches: 4,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Begin starts a thought session for query, with query as the root node.
+func (e *Expander) Begin(ctx context.Context, query string) (*models.ThoughtSession, *models.ThoughtNode, error) {
+	session := models.NewThoughtSession(query)
+	if err := e.storage.CreateThoughtSession(ctx, session); err != nil {
+		return nil, nil, fmt.Errorf("failed to create thought session: %w", err)
+	}
+	root, err := e.AddNode(ctx, session.ID, "", query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, root, nil
+}
+
+// AddNode persists a thought node.
+func (e *Expander) AddNode(ctx context.Context, sessionID, parentID, text string) (*models.ThoughtNode, error) {
+	node := models.NewThoughtNode(sessionID, parentID, text)
+	if err := e.storage.AddThoughtNode(ctx, node); err != nil {
+		return nil, fmt.Errorf("failed to save thought node: %w", err)
+	}
+	return node, nil
+}
+
+// Expand asks the provider for children of the last element of path
+// (path[0] is the user's query) and saves them under parentID.
+// Branches are returned best first.
+func (e *Expander) Expand(ctx context.Context, sessionID, parentID string, path []string) ([]*Branch, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty branch path")
+	}
+
+	resp, err := e.provider.Generate(ctx, &ai.Request{
+		System: fmt.Sprintf(systemPrompt, e.maxBranches),
+		Prompt: buildPrompt(path),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := e.parse(resp)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		node, err := e.AddNode(ctx, sessionID, parentID, b.Label())
+		if err != nil {
+			return nil, err
+		}
+		b.NodeID = node.ID
+	}
+	return branches, nil
+}
+
+// parse extracts scored branches from a response. JSON is expected, but
+// bullet lists and Thought:/Action: blocks are accepted too (with no score).
+func (e *Expander) parse(resp *ai.Response) ([]*Branch, error) {
+	clean := *resp
+	clean.Content = stripFences(resp.Content)
+
+	result, err := e.parser.Parse(&clean)
+	if err != nil || len(result.ThoughtSteps) == 0 {
+		result, err = response.NewParser(response.WithFormat(response.FormatThoughtChain)).Parse(&clean)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse branches: %w", err)
+		}
+	}
+
+	var branches []*Branch
+	for _, step := range result.ThoughtSteps {
+		thought := strings.TrimSpace(step.Thought)
+		if thought == "" {
+			continue
+		}
+		score := step.Score
+		if score <= 1 {
+			score *= 100 // Scores are requested as 0-1
+		}
+		if score > 100 {
+			score = 100
+		}
+		branches = append(branches, &Branch{Thought: thought, Action: strings.TrimSpace(step.Action), Score: score})
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no branches in response")
+	}
+
+	sort.SliceStable(branches, func(i, j int) bool {
+		return branches[i].Score > branches[j].Score
+	})
+	if len(branches) > e.maxBranches {
+		branches = branches[:e.maxBranches]
+	}
+	return branches, nil
+}
+
+// buildPrompt describes the path from the query to the branch to expand.
+func buildPrompt(path []string) string {
+	var sb strings.Builder
+	sb.WriteString("Question: ")
+	sb.WriteString(path[0])
+	sb.WriteString("\n")
+	if len(path) > 1 {
+		sb.WriteString("\nPath so far:\n")
+		for i, p := range path[1:] {
+			sb.WriteString(fmt.Sprintf("%s- %s\n", strings.Repeat("  ", i), p))
+		}
+	}
+	sb.WriteString("\nExpand the last idea into sub-ideas.")
+	return sb.String()
+}
+
+// stripFences removes a surrounding Markdown code fence.
+func stripFences(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:] // Drop the language tag
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
+
+// systemPrompt asks for JSON thought steps the response parser understands.
+const systemPrompt = `You are Open-Think-Reflex, expanding a tree of thoughts.
+Given a question and the path to the current idea, propose up to %d distinct
+sub-ideas that go one level deeper than the last idea.
+
+Reply with JSON only, in this form:
+{"thoughts": [{"thought": "short sub-idea", "action": "concrete next step", "score": 0.8}]}
+
+score is how promising the sub-idea is, from 0 to 1.`
@@ -0,0 +1,112 @@
+package branch
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+)
+
+func setupTestStorage(t *testing.T) *sqlite.Storage {
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return sqlite.NewStorage(db)
+}
+
+func TestExpand(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	provider := ai.NewFakeProvider(ai.FakeStep{Content: "```json\n" + `{"thoughts": [
+		{"thought": "Check the logs", "action": "tail -f app.log", "score": 0.6},
+		{"thought": "Roll back", "action": "git revert HEAD", "score": 0.9},
+		{"thought": "Ask on-call", "score": 0.2}
+	]}` + "\n```"})
+	e := NewExpander(storage, provider, WithMaxBranches(2))
+
+	session, root, err := e.Begin(ctx, "deploy failed")
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	branches, err := e.Expand(ctx, session.ID, root.ID, []string{"deploy failed", "Investigate"})
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+
+	if len(branches) != 2 {
+		t.Fatalf("expected 2 branches, got %d", len(branches))
+	}
+	if branches[0].Thought != "Roll back" || branches[0].Score != 90 {
+		t.Errorf("expected best branch first, got %+v", branches[0])
+	}
+	if branches[0].Action != "git revert HEAD" {
+		t.Errorf("unexpected action: %q", branches[0].Action)
+	}
+
+	reqs := provider.Requests()
+	if len(reqs) != 1 || !strings.Contains(reqs[0].Prompt, "- Investigate") {
+		t.Errorf("expected path in prompt, got %+v", reqs)
+	}
+
+	nodes, err := storage.ListThoughtNodesBySession(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("ListThoughtNodesBySession failed: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected root and 2 branch nodes, got %d", len(nodes))
+	}
+	for _, b := range branches {
+		found := false
+		for _, n := range nodes {
+			if n.ID == b.NodeID {
+				found = true
+				if n.ParentID != root.ID || n.Text != b.Label() {
+					t.Errorf("unexpected node %+v for branch %+v", n, b)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("branch %q not persisted", b.Thought)
+		}
+	}
+}
+
+func TestExpand_PlainList(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	provider := ai.NewFakeProvider(ai.FakeStep{Content: "- Check the logs\n- Roll back"})
+	e := NewExpander(storage, provider)
+
+	session, root, err := e.Begin(ctx, "deploy failed")
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	branches, err := e.Expand(ctx, session.ID, root.ID, []string{"deploy failed"})
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if len(branches) != 2 || branches[0].Thought != "Check the logs" {
+		t.Errorf("unexpected branches: %+v", branches)
+	}
+}
+
+func TestExpand_Errors(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	e := NewExpander(storage, ai.NewFakeProvider(ai.FakeStep{Content: ""}))
+	if _, err := e.Expand(ctx, "s", "", nil); err == nil {
+		t.Error("expected error for empty path")
+	}
+	if _, err := e.Expand(ctx, "s", "", []string{"q"}); err == nil {
+		t.Error("expected error for empty response")
+	}
+}
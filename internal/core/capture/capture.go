@@ -0,0 +1,91 @@
+// Package capture turns AI output into reflexes.
+// A generated answer can be kept as a new pattern, pre-filled from the query
+// and the pattern it matched, or used to replace the matched pattern's
+// response. Either way a provenance record marks the response as AI-made.
+package capture
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Generation is one AI answer that can be captured.
+type Generation struct {
+	Query            string // User input that produced the answer
+	Response         string // Generated answer
+	Provider         string // Provider that answered
+	Model            string // Model that answered
+	SpaceID          string // Space the query ran in ("" = none)
+	MatchedPatternID string // Best matching pattern, if any
+	ConversationID   string // Conversation holding the answer, if any
+	MessageID        string // Assistant message holding the answer, if any
+}
+
+// provenance builds the provenance record for a pattern captured from g.
+func (g *Generation) provenance(patternID string) *models.PatternProvenance {
+	return &models.PatternProvenance{
+		PatternID:       patternID,
+		Source:          models.ProvenanceAI,
+		Provider:        g.Provider,
+		Model:           g.Model,
+		Query:           g.Query,
+		ConversationID:  g.ConversationID,
+		MessageID:       g.MessageID,
+		SourcePatternID: g.MatchedPatternID,
+	}
+}
+
+// SaveAsPattern stores g as a new pattern. The query becomes the trigger;
+// tags, project and space are copied from the matched pattern, falling back
+// to g.SpaceID when nothing matched.
+func SaveAsPattern(ctx context.Context, storage *sqlite.Storage, g *Generation) (*models.Pattern, error) {
+	if g.Query == "" || g.Response == "" {
+		return nil, fmt.Errorf("nothing to capture: query and response are required")
+	}
+
+	pattern := models.NewPattern(g.Query, g.Response)
+	pattern.SpaceID = g.SpaceID
+	if g.MatchedPatternID != "" {
+		matched, err := storage.GetPattern(ctx, g.MatchedPatternID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get matched pattern: %w", err)
+		}
+		pattern.Tags = append([]string(nil), matched.Tags...)
+		pattern.Project = matched.Project
+		pattern.SpaceID = matched.SpaceID
+	}
+
+	if err := storage.SavePattern(ctx, pattern); err != nil {
+		return nil, fmt.Errorf("failed to save pattern: %w", err)
+	}
+	if err := storage.SavePatternProvenance(ctx, g.provenance(pattern.ID)); err != nil {
+		return nil, fmt.Errorf("failed to save provenance: %w", err)
+	}
+	return pattern, nil
+}
+
+// ReplaceResponse replaces the matched pattern's response with g.Response.
+func ReplaceResponse(ctx context.Context, storage *sqlite.Storage, g *Generation) (*models.Pattern, error) {
+	if g.MatchedPatternID == "" {
+		return nil, fmt.Errorf("no matched pattern to replace")
+	}
+	if g.Response == "" {
+		return nil, fmt.Errorf("nothing to capture: response is empty")
+	}
+
+	pattern, err := storage.GetPattern(ctx, g.MatchedPatternID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matched pattern: %w", err)
+	}
+	pattern.Response = g.Response
+	if err := storage.UpdatePattern(ctx, pattern); err != nil {
+		return nil, fmt.Errorf("failed to update pattern: %w", err)
+	}
+	if err := storage.SavePatternProvenance(ctx, g.provenance(pattern.ID)); err != nil {
+		return nil, fmt.Errorf("failed to save provenance: %w", err)
+	}
+	return pattern, nil
+}
@@ -0,0 +1,105 @@
+package capture
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func setupTestStorage(t *testing.T) *sqlite.Storage {
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return sqlite.NewStorage(db)
+}
+
+func addMatched(t *testing.T, storage *sqlite.Storage) *models.Pattern {
+	p := models.NewPattern("deploy", "Run make release")
+	p.Tags = []string{"ops", "release"}
+	p.Project = "infra"
+	p.SpaceID = "work"
+	if err := storage.SavePattern(context.Background(), p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	return p
+}
+
+func TestSaveAsPattern(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	matched := addMatched(t, storage)
+
+	gen := &Generation{
+		Query:            "deploy to staging",
+		Response:         "Run make release ENV=staging",
+		Provider:         "claude",
+		Model:            "claude-sonnet-4",
+		MatchedPatternID: matched.ID,
+	}
+	p, err := SaveAsPattern(ctx, storage, gen)
+	if err != nil {
+		t.Fatalf("SaveAsPattern failed: %v", err)
+	}
+
+	saved, err := storage.GetPattern(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetPattern failed: %v", err)
+	}
+	if saved.Trigger != gen.Query || saved.Response != gen.Response {
+		t.Errorf("unexpected pattern: %s -> %s", saved.Trigger, saved.Response)
+	}
+	if saved.SpaceID != "work" || saved.Project != "infra" || len(saved.Tags) != 2 {
+		t.Errorf("expected space, project and tags from matched pattern, got %s %s %v", saved.SpaceID, saved.Project, saved.Tags)
+	}
+
+	prov, err := storage.GetPatternProvenance(ctx, p.ID)
+	if err != nil || prov == nil {
+		t.Fatalf("GetPatternProvenance = %v, %v", prov, err)
+	}
+	if prov.Source != models.ProvenanceAI || prov.Model != gen.Model || prov.SourcePatternID != matched.ID {
+		t.Errorf("unexpected provenance: %+v", prov)
+	}
+
+	if _, err := SaveAsPattern(ctx, storage, &Generation{Query: "q"}); err == nil {
+		t.Error("expected error for empty response")
+	}
+}
+
+func TestSaveAsPattern_NoMatch(t *testing.T) {
+	storage := setupTestStorage(t)
+	p, err := SaveAsPattern(context.Background(), storage, &Generation{Query: "q", Response: "a", SpaceID: "home"})
+	if err != nil {
+		t.Fatalf("SaveAsPattern failed: %v", err)
+	}
+	if p.SpaceID != "home" || len(p.Tags) != 0 {
+		t.Errorf("unexpected pattern: %+v", p)
+	}
+}
+
+func TestReplaceResponse(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	matched := addMatched(t, storage)
+
+	if _, err := ReplaceResponse(ctx, storage, &Generation{Response: "x"}); err == nil {
+		t.Error("expected error without a matched pattern")
+	}
+
+	_, err := ReplaceResponse(ctx, storage, &Generation{Query: "deploy", Response: "Use the pipeline", MatchedPatternID: matched.ID})
+	if err != nil {
+		t.Fatalf("ReplaceResponse failed: %v", err)
+	}
+	updated, _ := storage.GetPattern(ctx, matched.ID)
+	if updated.Response != "Use the pipeline" || updated.Trigger != "deploy" {
+		t.Errorf("unexpected pattern: %s -> %s", updated.Trigger, updated.Response)
+	}
+	if prov, _ := storage.GetPatternProvenance(ctx, matched.ID); prov == nil || prov.Source != models.ProvenanceAI {
+		t.Errorf("expected AI provenance, got %+v", prov)
+	}
+}
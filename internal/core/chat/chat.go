@@ -0,0 +1,464 @@
+// Package chat implements multi-turn AI conversations.
+// A conversation keeps every pattern matched by earlier turns as context,
+// so follow-up questions are answered with the same reflexes in mind.
+// Conversations are persisted in SQLite and linked to a thought session,
+// except turns carrying content from encrypted spaces, which are kept in
+// memory only.
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/cache"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/capture"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/matcher"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Session is an active conversation with an AI provider.
+// Not safe for concurrent use.
+type Session struct {
+	storage   *sqlite.Storage
+	provider  ai.Provider
+	builder   *prompt.Builder
+	engine    *matcher.Engine
+	threshold float64 // Minimum match confidence (0-100)
+	spaceID   string  // Space to match patterns in ("" = all)
+	tools     []ai.Tool
+
+	conv       *models.Conversation
+	messages   []*models.ConversationMessage
+	lastNodeID string // Latest thought node, parent of the next one
+	last       *capture.Generation
+	lastFit    *prompt.FitResult
+	lastCalls  []ai.ToolCall
+	private    bool // Carries encrypted content; no longer persisted
+}
+
+// Option is a functional option for Session.
+type Option func(*Session)
+
+// WithThreshold sets the minimum match confidence (default 30).
+func WithThreshold(threshold float64) Option {
+	return func(s *Session) {
+		s.threshold = threshold
+	}
+}
+
+// WithSpace restricts pattern matching to a space.
+func WithSpace(spaceID string) Option {
+	return func(s *Session) {
+		s.spaceID = spaceID
+	}
+}
+
+// WithBuilder sets the prompt builder used for the system prompt.
+func WithBuilder(builder *prompt.Builder) Option {
+	return func(s *Session) {
+		s.builder = builder
+	}
+}
+
+// WithTools lets the model call tools while answering.
+func WithTools(tools []ai.Tool) Option {
+	return func(s *Session) {
+		s.tools = tools
+	}
+}
+
+// NewSession creates a session. The conversation is created lazily on the
+// first Send unless Resume is called.
+func NewSession(storage *sqlite.Storage, provider ai.Provider, opts ...Option) *Session {
+	s := &Session{
+		storage:   storage,
+		provider:  provider,
+		builder:   prompt.NewBuilder(),
+		engine:    matcher.NewEngine(),
+		threshold: 30.0,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Resume loads an existing conversation and its history.
+func (s *Session) Resume(ctx context.Context, conversationID string) error {
+	conv, err := s.storage.GetConversation(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	msgs, err := s.storage.ListConversationMessages(ctx, conv.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+	if conv.SpaceID != "" && s.spaceID == "" {
+		s.spaceID = conv.SpaceID
+	}
+	s.conv = conv
+	s.messages = msgs
+
+	if conv.SessionID != "" {
+		nodes, err := s.storage.ListThoughtNodesBySession(ctx, conv.SessionID)
+		if err == nil && len(nodes) > 0 {
+			s.lastNodeID = nodes[len(nodes)-1].ID
+		}
+	}
+	return nil
+}
+
+// Conversation returns the current conversation, or nil before the first turn.
+func (s *Session) Conversation() *models.Conversation {
+	return s.conv
+}
+
+// Messages returns the conversation history, oldest first.
+func (s *Session) Messages() []*models.ConversationMessage {
+	return s.messages
+}
+
+// ContextPatternIDs returns the IDs of all patterns matched so far, in the
+// order they were first matched.
+func (s *Session) ContextPatternIDs() []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, m := range s.messages {
+		for _, id := range m.PatternIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// Private reports whether the session has carried content from an
+// encrypted space. Such turns, and every turn after them, are not saved:
+// chat history and the response cache are stored in plaintext.
+func (s *Session) Private() bool {
+	return s.private
+}
+
+// LastGeneration returns the latest answer in a form that can be captured
+// as a pattern, or nil before the first successful turn.
+func (s *Session) LastGeneration() *capture.Generation {
+	return s.last
+}
+
+// Send sends a user turn and returns the assistant reply.
+// Both turns are persisted only after the provider succeeds, so a failed
+// turn can simply be retried.
+func (s *Session) Send(ctx context.Context, text string, attachments []models.MessageAttachment) (*models.ConversationMessage, error) {
+	matched, confidence, err := s.match(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	contextIDs := s.ContextPatternIDs()
+	seen := make(map[string]bool, len(contextIDs))
+	for _, id := range contextIDs {
+		seen[id] = true
+	}
+	for _, id := range matched {
+		if !seen[id] {
+			contextIDs = append(contextIDs, id)
+		}
+	}
+
+	fit, err := s.fit(ctx, contextIDs, confidence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load context patterns: %w", err)
+	}
+	s.lastFit = fit
+	if !s.private {
+		if s.private, err = s.readsEncrypted(ctx, fit.Included); err != nil {
+			return nil, err
+		}
+	}
+
+	data := s.promptData(ctx, text, fit.Included)
+	system, err := s.builder.RenderSystem(data)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := s.builder.RenderPrompt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]ai.Message, 0, len(s.messages)+1)
+	for _, m := range s.messages {
+		history = append(history, toAIMessage(m))
+	}
+	user := models.NewConversationMessage("", models.RoleUser, text)
+	user.Attachments = attachments
+	user.PatternIDs = matched
+	// Only the outgoing turn is templated; history keeps what the user typed
+	turn := toAIMessage(user)
+	turn.Content = rendered
+	history = append(history, turn)
+
+	genCtx := ai.WithSpace(ctx, s.spaceID)
+	if s.private {
+		genCtx = cache.WithPrivate(genCtx)
+	}
+	resp, err := s.provider.Generate(genCtx, &ai.Request{
+		System:   system,
+		Messages: history,
+		Tools:    s.tools,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.lastCalls = resp.ToolCalls
+
+	reply := models.NewConversationMessage("", models.RoleAssistant, resp.Content)
+	if s.private {
+		s.messages = append(s.messages, user, reply)
+	} else if err := s.save(ctx, text, user, reply); err != nil {
+		return nil, err
+	}
+
+	s.last = &capture.Generation{
+		Query:          text,
+		Response:       resp.Content,
+		Provider:       s.provider.Name(),
+		Model:          resp.Model,
+		SpaceID:        s.spaceID,
+		ConversationID: reply.ConversationID,
+	}
+	if reply.ConversationID != "" {
+		s.last.MessageID = reply.ID
+	}
+	if len(matched) > 0 {
+		s.last.MatchedPatternID = matched[0]
+	}
+	return reply, nil
+}
+
+// LastToolCalls returns the tools the model ran during the latest turn.
+func (s *Session) LastToolCalls() []ai.ToolCall {
+	return s.lastCalls
+}
+
+// PromptData returns the template data for text as the first turn of a
+// conversation would build it, without sending anything, along with how
+// the matched patterns fit the context budget. Used to preview prompts.
+func (s *Session) PromptData(ctx context.Context, text string) (*prompt.Data, *prompt.FitResult, error) {
+	matched, confidence, err := s.match(ctx, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	fit, err := s.fit(ctx, matched, confidence)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load matched patterns: %w", err)
+	}
+	return s.promptData(ctx, text, fit.Included), fit, nil
+}
+
+// LastFit reports which patterns the latest turn included, truncated or
+// dropped to fit the context budget, or nil before the first turn.
+func (s *Session) LastFit() *prompt.FitResult {
+	return s.lastFit
+}
+
+// fit loads the patterns for ids and fits them into the builder's budget.
+// Patterns without a confidence (carried over from earlier turns) rank last.
+func (s *Session) fit(ctx context.Context, ids []string, confidence map[string]float64) (*prompt.FitResult, error) {
+	patterns, err := s.loadPatterns(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	cands := make([]prompt.Candidate, len(patterns))
+	for i, p := range patterns {
+		cands[i] = prompt.Candidate{Pattern: p, Confidence: confidence[p.ID]}
+	}
+	return s.builder.Fit(cands), nil
+}
+
+// loadPatterns loads patterns by ID, keeping the order of ids.
+func (s *Session) loadPatterns(ctx context.Context, ids []string) ([]*models.Pattern, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	loaded, err := s.storage.BatchGetPatterns(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Pattern, len(loaded))
+	for _, p := range loaded {
+		byID[p.ID] = p
+	}
+	patterns := make([]*models.Pattern, 0, len(loaded))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, nil
+}
+
+// promptData collects the space and related notes for prompt templates.
+// They are only looked up when templates are configured.
+func (s *Session) promptData(ctx context.Context, text string, patterns []*models.Pattern) *prompt.Data {
+	data := &prompt.Data{Query: text, Patterns: patterns}
+	if !s.builder.HasTemplates() {
+		return data
+	}
+	if s.spaceID != "" {
+		if space, err := s.storage.GetSpace(ctx, s.spaceID); err == nil {
+			data.Space = space
+		}
+	}
+	if notes, err := s.storage.SearchNotes(ctx, text, contracts.ListOptions{SpaceID: s.spaceID, Limit: 5}); err == nil {
+		data.Notes = notes
+	}
+	return data
+}
+
+// match returns the IDs of active patterns matching text, best first,
+// and their match confidence.
+func (s *Session) match(ctx context.Context, text string) ([]string, map[string]float64, error) {
+	all, err := s.storage.ListPatterns(ctx, contracts.ListOptions{SpaceID: s.spaceID, Limit: 1000})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list patterns: %w", err)
+	}
+
+	var active []*models.Pattern
+	for _, p := range all {
+		if p.Strength >= p.Threshold {
+			active = append(active, p)
+		}
+	}
+
+	results := s.engine.Match(ctx, text, active, contracts.MatchOptions{
+		Threshold:  s.threshold,
+		Limit:      5,
+		ExactFirst: true,
+	})
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Confidence > results[j].Confidence
+	})
+
+	ids := make([]string, 0, len(results))
+	confidence := make(map[string]float64, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Pattern.ID)
+		confidence[r.Pattern.ID] = r.Confidence
+	}
+	return ids, confidence, nil
+}
+
+// save stores a turn and appends it to the history. The turn is saved
+// whole or not at all; on failure the history stays as it was, so a
+// retried Send doesn't repeat the question.
+func (s *Session) save(ctx context.Context, text string, user, reply *models.ConversationMessage) error {
+	if err := s.ensureConversation(ctx, text); err != nil {
+		return err
+	}
+	user.ConversationID = s.conv.ID
+	reply.ConversationID = s.conv.ID
+	if err := s.storage.AddConversationMessages(ctx, user, reply); err != nil {
+		user.ConversationID, reply.ConversationID = "", ""
+		return fmt.Errorf("failed to save messages: %w", err)
+	}
+	for _, m := range []*models.ConversationMessage{user, reply} {
+		s.messages = append(s.messages, m)
+		s.addThoughtNode(ctx, m)
+	}
+	return nil
+}
+
+// readsEncrypted reports whether a turn carries content from an encrypted
+// space: the session's space is encrypted, or any space when the session
+// isn't limited to one (tools can read them all), or the space of a
+// pattern included as context.
+func (s *Session) readsEncrypted(ctx context.Context, included []*models.Pattern) (bool, error) {
+	spaces, err := s.storage.ListSpaces(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list spaces: %w", err)
+	}
+	encrypted := make(map[string]bool, len(spaces))
+	for _, sp := range spaces {
+		if sp.Encrypted {
+			if s.spaceID == "" {
+				return true, nil
+			}
+			encrypted[sp.ID] = true
+		}
+	}
+	if encrypted[s.spaceID] {
+		return true, nil
+	}
+	for _, p := range included {
+		// Patterns without a space belong to global
+		spaceID := p.SpaceID
+		if spaceID == "" {
+			spaceID = "global"
+		}
+		if encrypted[spaceID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ensureConversation creates the conversation and its thought session on
+// the first turn.
+func (s *Session) ensureConversation(ctx context.Context, firstMessage string) error {
+	if s.conv != nil {
+		return nil
+	}
+	title := truncate(firstMessage, 60)
+	session := models.NewThoughtSession(title)
+	if err := s.storage.CreateThoughtSession(ctx, session); err != nil {
+		return fmt.Errorf("failed to create thought session: %w", err)
+	}
+	conv := models.NewConversation(session.ID, title, s.spaceID)
+	if err := s.storage.CreateConversation(ctx, conv); err != nil {
+		return fmt.Errorf("failed to create conversation: %w", err)
+	}
+	s.conv = conv
+	return nil
+}
+
+// addThoughtNode mirrors a turn into the linked thought session.
+// Failures are ignored: the conversation itself is already saved.
+func (s *Session) addThoughtNode(ctx context.Context, m *models.ConversationMessage) {
+	if s.conv.SessionID == "" {
+		return
+	}
+	node := models.NewThoughtNode(s.conv.SessionID, s.lastNodeID, m.Role+": "+m.Content)
+	if err := s.storage.AddThoughtNode(ctx, node); err == nil {
+		s.lastNodeID = node.ID
+	}
+}
+
+// toAIMessage converts a stored message into a provider message.
+func toAIMessage(m *models.ConversationMessage) ai.Message {
+	msg := ai.Message{Role: ai.Role(m.Role), Content: m.Content}
+	for _, a := range m.Attachments {
+		msg.Attachments = append(msg.Attachments, ai.Attachment{
+			Name:      a.Name,
+			MediaType: a.MediaType,
+			Data:      a.Data,
+		})
+	}
+	return msg
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
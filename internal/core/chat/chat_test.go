@@ -0,0 +1,294 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/cache"
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func setupTestStorage(t *testing.T) *sqlite.Storage {
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return sqlite.NewStorage(db)
+}
+
+func addPattern(t *testing.T, storage *sqlite.Storage, trigger, response string) *models.Pattern {
+	p := models.NewPattern(trigger, response)
+	p.Strength = 80
+	if err := storage.SavePattern(context.Background(), p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	return p
+}
+
+func TestSession_KeepsMatchedPatternsAsContext(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	deploy := addPattern(t, storage, "deploy", "Run make release, then tag the commit")
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "Use make release."}, ai.FakeStep{Content: "Yes, tag it."})
+	s := NewSession(storage, fake)
+
+	if _, err := s.Send(ctx, "deploy steps", nil); err != nil {
+		t.Fatalf("first Send failed: %v", err)
+	}
+	reply, err := s.Send(ctx, "and after that?", nil)
+	if err != nil {
+		t.Fatalf("second Send failed: %v", err)
+	}
+	if reply.Content != "Yes, tag it." {
+		t.Errorf("unexpected reply: %s", reply.Content)
+	}
+
+	reqs := fake.Requests()
+	second := reqs[1]
+	if len(second.Messages) != 3 {
+		t.Fatalf("expected 3 messages in second request, got %d", len(second.Messages))
+	}
+	if second.Messages[1].Role != ai.RoleAssistant || second.Messages[2].Content != "and after that?" {
+		t.Errorf("unexpected history: %+v", second.Messages)
+	}
+	// The follow-up does not mention deploy but keeps it as context
+	if !strings.Contains(second.System, deploy.Response) {
+		t.Error("expected earlier matched pattern in system prompt")
+	}
+	if ids := s.ContextPatternIDs(); len(ids) != 1 || ids[0] != deploy.ID {
+		t.Errorf("unexpected context patterns: %v", ids)
+	}
+}
+
+func TestSession_PersistsAndResumes(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	s := NewSession(storage, ai.NewFakeProvider(ai.FakeStep{Content: "hi"}))
+	if _, err := s.Send(ctx, "hello", []models.MessageAttachment{{Name: "n.txt", MediaType: "text/plain", Data: []byte("note")}}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	conv := s.Conversation()
+	if conv == nil || conv.SessionID == "" {
+		t.Fatalf("expected conversation linked to a thought session, got %+v", conv)
+	}
+
+	nodes, err := storage.ListThoughtNodesBySession(ctx, conv.SessionID)
+	if err != nil || len(nodes) != 2 || nodes[1].ParentID != nodes[0].ID {
+		t.Errorf("expected chained thought nodes, got %+v, %v", nodes, err)
+	}
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "again"})
+	resumed := NewSession(storage, fake)
+	if err := resumed.Resume(ctx, conv.ID); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if _, err := resumed.Send(ctx, "second", nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	req := fake.Requests()[0]
+	if len(req.Messages) != 3 || string(req.Messages[0].Attachments[0].Data) != "note" {
+		t.Errorf("expected resumed history with attachment, got %+v", req.Messages)
+	}
+}
+
+func TestSession_FailedTurnNotSaved(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	s := NewSession(storage, ai.NewFakeProvider(ai.FakeStep{Err: errors.New("offline")}))
+	if _, err := s.Send(ctx, "hello", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if s.Conversation() != nil || len(s.Messages()) != 0 {
+		t.Error("failed turn should not create a conversation")
+	}
+}
+
+func TestSession_UnsavedTurnKeepsHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	storage := sqlite.NewStorage(db)
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "hi"}, ai.FakeStep{Content: "lost"}, ai.FakeStep{Content: "again"})
+	s := NewSession(storage, fake)
+	if _, err := s.Send(ctx, "hello", nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if _, err := db.DB().Exec(`
+		CREATE TRIGGER no_reply BEFORE INSERT ON conversation_messages
+		WHEN NEW.role = 'assistant' BEGIN SELECT RAISE(ABORT, 'read only'); END
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send(ctx, "second", nil); err == nil {
+		t.Fatal("expected the failed save to be returned")
+	}
+	if len(s.Messages()) != 2 {
+		t.Errorf("expected the unsaved turn left out of the history, got %d messages", len(s.Messages()))
+	}
+	if msgs, _ := storage.ListConversationMessages(ctx, s.Conversation().ID); len(msgs) != 2 {
+		t.Errorf("expected the question rolled back with the answer, got %d stored messages", len(msgs))
+	}
+
+	if _, err := db.DB().Exec(`DROP TRIGGER no_reply`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Send(ctx, "second", nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if req := fake.Requests()[2]; len(req.Messages) != 3 {
+		t.Errorf("expected the retry to send 3 messages, got %d", len(req.Messages))
+	}
+}
+
+func TestSession_EncryptedSpaceLeavesNoPlaintext(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := sqlite.NewDatabase(filepath.Join(dir, "otr.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	storage := sqlite.NewStorage(db)
+	if err := storage.CreateSpace(ctx, &models.Space{ID: "work", Name: "Work"}); err != nil {
+		t.Fatalf("CreateSpace failed: %v", err)
+	}
+	if _, err := storage.Rekey(ctx, "secret"); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if _, err := storage.SetSpaceEncrypted(ctx, "work", true); err != nil {
+		t.Fatalf("SetSpaceEncrypted failed: %v", err)
+	}
+	vpn := models.NewPattern("vpn", "password: hunter2")
+	vpn.SpaceID = "work"
+	vpn.Strength = 80
+	if err := storage.SavePattern(ctx, vpn); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "It is hunter2."}, ai.FakeStep{Content: "Still hunter2."})
+	provider := ai.Chain(fake, cache.New(storage, cache.Config{TTL: time.Hour}).Middleware())
+	s := NewSession(storage, provider, WithSpace("work"))
+	for i := 0; i < 2; i++ {
+		if _, err := s.Send(ctx, "vpn hunter2 password", nil); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	if !s.Private() || s.Conversation() != nil || len(s.Messages()) != 4 {
+		t.Errorf("expected an unsaved private session with 4 messages, got private=%v, %d messages", s.Private(), len(s.Messages()))
+	}
+	if len(fake.Requests()) != 2 {
+		t.Errorf("expected the repeated question not to be served from the cache, got %d calls", len(fake.Requests()))
+	}
+	if gen := s.LastGeneration(); gen == nil || gen.Response != "Still hunter2." || gen.MessageID != "" {
+		t.Errorf("expected the answer capturable without a stored message, got %+v", gen)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "otr.db*"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("hunter2")) {
+			t.Errorf("found plaintext in %s", filepath.Base(f))
+		}
+	}
+}
+
+func TestSession_LastGeneration(t *testing.T) {
+	storage := setupTestStorage(t)
+	deploy := addPattern(t, storage, "deploy", "Run make release")
+
+	s := NewSession(storage, ai.NewFakeProvider(ai.FakeStep{Content: "Use make release."}))
+	if s.LastGeneration() != nil {
+		t.Error("expected no generation before the first turn")
+	}
+	reply, err := s.Send(context.Background(), "deploy steps", nil)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	gen := s.LastGeneration()
+	if gen == nil {
+		t.Fatal("expected a generation")
+	}
+	if gen.Query != "deploy steps" || gen.Response != reply.Content || gen.MessageID != reply.ID {
+		t.Errorf("unexpected generation: %+v", gen)
+	}
+	if gen.MatchedPatternID != deploy.ID || gen.Provider != "fake" {
+		t.Errorf("unexpected match or provider: %+v", gen)
+	}
+}
+
+func TestSession_PromptTemplates(t *testing.T) {
+	storage := setupTestStorage(t)
+	addPattern(t, storage, "deploy", "Run make release")
+
+	system, _ := prompt.ParseTemplate("system", "Reflexes:\n{{range .Patterns}}{{.Trigger}}={{.Response}}\n{{end}}")
+	user, _ := prompt.ParseTemplate("user", "Question: {{.Query}}")
+	builder := prompt.NewBuilder().WithOptions(prompt.WithSystemTemplate(system), prompt.WithPromptTemplate(user))
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "ok"})
+	s := NewSession(storage, fake, WithBuilder(builder))
+	if _, err := s.Send(context.Background(), "deploy steps", nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	req := fake.Requests()[0]
+	if req.System != "Reflexes:\ndeploy=Run make release" {
+		t.Errorf("unexpected system prompt: %q", req.System)
+	}
+	if got := req.Messages[0].Content; got != "Question: deploy steps" {
+		t.Errorf("unexpected user turn: %q", got)
+	}
+	// History keeps the text as typed
+	if got := s.Messages()[0].Content; got != "deploy steps" {
+		t.Errorf("unexpected stored message: %q", got)
+	}
+}
+
+func TestSession_ContextBudget(t *testing.T) {
+	storage := setupTestStorage(t)
+	addPattern(t, storage, "deploy", strings.Repeat("Run make release. ", 200))
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "ok"})
+	s := NewSession(storage, fake, WithBuilder(prompt.NewBuilder().WithOptions(prompt.WithMaxTokens(200))))
+	if _, err := s.Send(context.Background(), "deploy steps", nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	fit := s.LastFit()
+	if fit == nil || len(fit.Included) != 1 || len(fit.Truncated) != 1 {
+		t.Fatalf("expected one truncated pattern, got %+v", fit)
+	}
+	if len(fake.Requests()[0].System) > 1500 {
+		t.Errorf("system prompt exceeds budget: %d bytes", len(fake.Requests()[0].System))
+	}
+}
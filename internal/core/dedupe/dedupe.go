@@ -0,0 +1,399 @@
+// Package dedupe finds near-duplicate patterns and proposes merges.
+// Patterns are compared offline by trigger and response similarity and
+// grouped into clusters; an AI provider can optionally review each
+// cluster, splitting off patterns that only look alike.
+package dedupe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// DefaultThreshold is the minimum similarity for two patterns to be
+// considered duplicates.
+const DefaultThreshold = 0.75
+
+// Trigger similarity dominates: near-identical triggers with different
+// wording in the response are still the same reflex.
+const (
+	triggerWeight  = 0.7
+	responseWeight = 0.3
+)
+
+// Proposal is a suggested merge of a cluster of similar patterns.
+type Proposal struct {
+	Patterns []*models.Pattern // The cluster, the pattern to keep first
+	Score    float64           // Lowest pairwise similarity that joined the cluster (0-1)
+	Reason   string            // Why the AI reviewer agreed (empty offline)
+}
+
+// Keep returns the pattern the others are merged into.
+func (p *Proposal) Keep() *models.Pattern {
+	return p.Patterns[0]
+}
+
+// Merge returns the combined pattern. The kept pattern's trigger and
+// response win; tags and connections are unioned, strength is the
+// highest, usage counts are summed and the latest use is kept. The other
+// triggers become aliases.
+func (p *Proposal) Merge() *models.PatternMerge {
+	keep := *p.Keep()
+	merge := &models.PatternMerge{Keep: &keep}
+
+	merged := make(map[string]bool)
+	for _, other := range p.Patterns[1:] {
+		merged[other.ID] = true
+		merge.Merged = append(merge.Merged, other.ID)
+	}
+
+	seenAlias := map[string]bool{keep.Trigger: true}
+	keep.Tags = append([]string(nil), keep.Tags...)
+	keep.Connections = nil
+	for i, other := range p.Patterns {
+		if i > 0 {
+			keep.Tags = union(keep.Tags, other.Tags)
+			keep.Strength = max(keep.Strength, other.Strength)
+			keep.ReinforceCnt += other.ReinforceCnt
+			if other.LastUsedAt != nil && (keep.LastUsedAt == nil || other.LastUsedAt.After(*keep.LastUsedAt)) {
+				keep.LastUsedAt = other.LastUsedAt
+			}
+			if !seenAlias[other.Trigger] {
+				// Exact triggers, so lookups by the old trigger keep working
+				seenAlias[other.Trigger] = true
+				merge.Aliases = append(merge.Aliases, other.Trigger)
+			}
+		}
+		for _, id := range other.Connections {
+			if id != keep.ID && !merged[id] {
+				keep.Connections = union(keep.Connections, []string{id})
+			}
+		}
+	}
+	return merge
+}
+
+// Finder clusters similar patterns.
+type Finder struct {
+	threshold float64
+	provider  ai.Provider
+}
+
+// Option is a functional option for Finder.
+type Option func(*Finder)
+
+// WithThreshold sets the minimum similarity (0-1, default DefaultThreshold).
+func WithThreshold(t float64) Option {
+	return func(f *Finder) {
+		if t > 0 {
+			f.threshold = t
+		}
+	}
+}
+
+// WithProvider lets an AI provider review each cluster before it is
+// proposed.
+func WithProvider(p ai.Provider) Option {
+	return func(f *Finder) {
+		f.provider = p
+	}
+}
+
+// NewFinder creates a finder.
+func NewFinder(opts ...Option) *Finder {
+	f := &Finder{threshold: DefaultThreshold}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Find returns merge proposals for patterns, largest clusters first.
+// Patterns are only compared within their space.
+func (f *Finder) Find(ctx context.Context, patterns []*models.Pattern) ([]*Proposal, error) {
+	proposals := f.cluster(patterns)
+	if f.provider == nil {
+		return proposals, nil
+	}
+
+	var reviewed []*Proposal
+	for _, p := range proposals {
+		r, err := f.review(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			reviewed = append(reviewed, r)
+		}
+	}
+	return reviewed, nil
+}
+
+// cluster groups patterns whose similarity reaches the threshold.
+func (f *Finder) cluster(patterns []*models.Pattern) []*Proposal {
+	parent := make([]int, len(patterns))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	scores := make(map[int]float64)
+	for i := 0; i < len(patterns); i++ {
+		for j := i + 1; j < len(patterns); j++ {
+			if patterns[i].SpaceID != patterns[j].SpaceID {
+				continue
+			}
+			score := Similarity(patterns[i], patterns[j])
+			if score < f.threshold {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			low := score
+			for _, r := range []int{ri, rj} {
+				if s, ok := scores[r]; ok {
+					low = min(low, s)
+				}
+			}
+			parent[rj] = ri
+			delete(scores, rj)
+			scores[ri] = low
+		}
+	}
+
+	groups := make(map[int][]*models.Pattern)
+	for i, p := range patterns {
+		r := find(i)
+		groups[r] = append(groups[r], p)
+	}
+
+	var proposals []*Proposal
+	for r, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sortKeepFirst(group)
+		proposals = append(proposals, &Proposal{Patterns: group, Score: scores[r]})
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if len(proposals[i].Patterns) != len(proposals[j].Patterns) {
+			return len(proposals[i].Patterns) > len(proposals[j].Patterns)
+		}
+		return proposals[i].Score > proposals[j].Score
+	})
+	return proposals
+}
+
+// sortKeepFirst orders a cluster so the pattern to keep comes first: the
+// strongest, then the most used, then the oldest.
+func sortKeepFirst(group []*models.Pattern) {
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := group[i], group[j]
+		if a.Strength != b.Strength {
+			return a.Strength > b.Strength
+		}
+		if a.ReinforceCnt != b.ReinforceCnt {
+			return a.ReinforceCnt > b.ReinforceCnt
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+}
+
+// ==================== AI review ====================
+
+// review asks the provider which patterns in p are really duplicates of
+// the kept one. It returns nil if none are.
+func (f *Finder) review(ctx context.Context, p *Proposal) (*Proposal, error) {
+	resp, err := f.provider.Generate(ctx, &ai.Request{
+		System: reviewPrompt,
+		Prompt: buildReviewPrompt(p),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to review cluster: %w", err)
+	}
+
+	var verdict struct {
+		Duplicates []int  `json:"duplicates"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(stripFences(resp.Content)), &verdict); err != nil {
+		return nil, fmt.Errorf("failed to parse review: %w", err)
+	}
+
+	kept := []*models.Pattern{p.Keep()}
+	for _, n := range verdict.Duplicates {
+		// Numbers are 1-based and 1 is the kept pattern
+		if n >= 2 && n <= len(p.Patterns) && !contains(kept, p.Patterns[n-1]) {
+			kept = append(kept, p.Patterns[n-1])
+		}
+	}
+	if len(kept) < 2 {
+		return nil, nil
+	}
+	return &Proposal{Patterns: kept, Score: p.Score, Reason: strings.TrimSpace(verdict.Reason)}, nil
+}
+
+func buildReviewPrompt(p *Proposal) string {
+	var sb strings.Builder
+	for i, pattern := range p.Patterns {
+		fmt.Fprintf(&sb, "%d. Trigger: %s\n   Response: %s\n", i+1, pattern.Trigger, truncate(pattern.Response, 300))
+	}
+	sb.WriteString("\nWhich patterns are duplicates of pattern 1?")
+	return sb.String()
+}
+
+// stripFences removes a surrounding Markdown code fence.
+func stripFences(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:] // Drop the language tag
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
+
+// reviewPrompt asks for the numbers of real duplicates as JSON.
+const reviewPrompt = `You are Open-Think-Reflex, cleaning up a user's reflex patterns
+(trigger -> response pairs). You are shown a numbered group of patterns that
+look similar. Decide which of them mean the same thing as pattern 1, so that
+merging them into pattern 1 loses nothing.
+
+Reply with JSON only, in this form:
+{"duplicates": [2, 3], "reason": "one short sentence"}
+
+Use an empty list if none of them are duplicates.`
+
+// ==================== Similarity ====================
+
+// Similarity scores how alike two patterns are, from 0 to 1.
+func Similarity(a, b *models.Pattern) float64 {
+	return triggerWeight*textSimilarity(a.Trigger, b.Trigger) +
+		responseWeight*textSimilarity(a.Response, b.Response)
+}
+
+// textSimilarity is the better of word overlap (Jaccard) and character
+// bigram overlap (Dice), so both reordered words and small spelling
+// differences count, and text without spaces (e.g. Chinese) works.
+func textSimilarity(a, b string) float64 {
+	a, b = normalize(a), normalize(b)
+	if a == b {
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+	return max(jaccard(strings.Fields(a), strings.Fields(b)), dice(bigrams(a), bigrams(b)))
+}
+
+// normalize lower-cases s and reduces punctuation to spaces.
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func jaccard(a, b []string) float64 {
+	set := make(map[string]bool, len(a))
+	for _, w := range a {
+		set[w] = true
+	}
+	inter, union := 0, len(set)
+	seen := make(map[string]bool, len(b))
+	for _, w := range b {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		if set[w] {
+			inter++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+func bigrams(s string) map[string]int {
+	r := []rune(strings.ReplaceAll(s, " ", ""))
+	grams := make(map[string]int)
+	if len(r) == 1 {
+		grams[string(r)]++
+	}
+	for i := 0; i+1 < len(r); i++ {
+		grams[string(r[i:i+2])]++
+	}
+	return grams
+}
+
+func dice(a, b map[string]int) float64 {
+	total, inter := 0, 0
+	for g, n := range a {
+		total += n
+		inter += min(n, b[g])
+	}
+	for _, n := range b {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(inter) / float64(total)
+}
+
+// ==================== Helpers ====================
+
+// union appends the items of b missing from a.
+func union(a, b []string) []string {
+	for _, item := range b {
+		found := false
+		for _, existing := range a {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, item)
+		}
+	}
+	return a
+}
+
+func contains(patterns []*models.Pattern, p *models.Pattern) bool {
+	for _, existing := range patterns {
+		if existing.ID == p.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,84 @@
+package dedupe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func pattern(trigger, response string, strength float64) *models.Pattern {
+	p := models.NewPattern(trigger, response)
+	p.Strength = strength
+	return p
+}
+
+func TestFind_Offline(t *testing.T) {
+	a := pattern("deploy to production", "Run make release", 40)
+	b := pattern("Deploy to production!", "run `make release`", 80)
+	c := pattern("deploy production", "make release then tag", 10)
+	other := pattern("write unit tests", "Use table-driven tests", 50)
+	elsewhere := pattern("deploy to production", "Run make release", 50)
+	elsewhere.SpaceID = "work"
+
+	proposals, err := NewFinder().Find(context.Background(), []*models.Pattern{a, b, c, other, elsewhere})
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if len(proposals) != 1 {
+		t.Fatalf("expected 1 proposal, got %d", len(proposals))
+	}
+	if got := proposals[0]; len(got.Patterns) != 3 || got.Keep() != b {
+		t.Errorf("expected cluster of 3 keeping the strongest, got %+v", got.Patterns)
+	}
+}
+
+func TestProposal_Merge(t *testing.T) {
+	used := time.Now()
+	keep := pattern("deploy", "make release", 80)
+	keep.Tags = []string{"ops"}
+	keep.ReinforceCnt = 2
+	dup := pattern("Deploy!", "make release", 30)
+	dup.Tags = []string{"ops", "release"}
+	dup.ReinforceCnt = 5
+	dup.LastUsedAt = &used
+	dup.Connections = []string{keep.ID, "other"}
+	typo := pattern("depoly", "make release", 20)
+
+	m := (&Proposal{Patterns: []*models.Pattern{keep, dup, typo}}).Merge()
+	if m.Keep.ID != keep.ID || m.Keep.Strength != 80 || m.Keep.ReinforceCnt != 7 {
+		t.Errorf("unexpected merged pattern: %+v", m.Keep)
+	}
+	if len(m.Keep.Tags) != 2 || m.Keep.LastUsedAt != &used {
+		t.Errorf("expected tags and last use combined: %+v", m.Keep)
+	}
+	if len(m.Keep.Connections) != 1 || m.Keep.Connections[0] != "other" {
+		t.Errorf("unexpected connections: %v", m.Keep.Connections)
+	}
+	if len(m.Aliases) != 2 || m.Aliases[0] != "Deploy!" || m.Aliases[1] != "depoly" {
+		t.Errorf("unexpected aliases: %v", m.Aliases)
+	}
+	if len(m.Merged) != 2 || len(keep.Tags) != 1 {
+		t.Errorf("unexpected merge: %+v (original tags %v)", m.Merged, keep.Tags)
+	}
+}
+
+func TestFind_AIReview(t *testing.T) {
+	a := pattern("deploy to production", "Run make release", 80)
+	b := pattern("deploy to production", "Run make release now", 40)
+	c := pattern("deploy to staging", "Run make release", 10)
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "```json\n{\"duplicates\": [2], \"reason\": \"same target\"}\n```"})
+	proposals, err := NewFinder(WithThreshold(0.6), WithProvider(fake)).Find(context.Background(), []*models.Pattern{a, b, c})
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if len(proposals) != 1 || len(proposals[0].Patterns) != 2 || proposals[0].Patterns[1] != b {
+		t.Fatalf("expected the reviewer to drop staging, got %+v", proposals)
+	}
+	if proposals[0].Reason != "same target" {
+		t.Errorf("unexpected reason: %q", proposals[0].Reason)
+	}
+}
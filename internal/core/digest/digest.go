@@ -0,0 +1,255 @@
+// Package digest reviews recent activity: new notes, new and reinforced
+// patterns, patterns that are fading and thought sessions.
+// With an AI provider the review is written by the model; without one a
+// template-only Markdown report is produced from the same data.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// maxItems caps each section of the digest.
+const maxItems = 20
+
+// Activity is what happened in a time window.
+type Activity struct {
+	Since      time.Time
+	Until      time.Time
+	Notes      []*models.Note           // Notes created in the window
+	Learned    []*models.Pattern        // Patterns created in the window
+	Reinforced []*models.Pattern        // Older patterns used in the window, most used first
+	Fading     []*models.Pattern        // Decayed below threshold and unused in the window, weakest first
+	Sessions   []*models.ThoughtSession // Thought sessions active in the window
+}
+
+// Empty reports whether nothing happened in the window.
+func (a *Activity) Empty() bool {
+	return len(a.Notes) == 0 && len(a.Learned) == 0 && len(a.Reinforced) == 0 &&
+		len(a.Fading) == 0 && len(a.Sessions) == 0
+}
+
+// Digest is a finished review.
+type Digest struct {
+	Title    string
+	Markdown string
+	Activity *Activity
+	AI       bool // Written by the AI provider
+}
+
+// Generator collects activity and writes digests.
+type Generator struct {
+	storage  *sqlite.Storage
+	provider ai.Provider
+}
+
+// Option is a functional option for Generator.
+type Option func(*Generator)
+
+// WithProvider has the AI provider write the review.
+func WithProvider(p ai.Provider) Option {
+	return func(g *Generator) {
+		g.provider = p
+	}
+}
+
+// New creates a generator.
+func New(storage *sqlite.Storage, opts ...Option) *Generator {
+	g := &Generator{storage: storage}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Collect gathers the activity between since and until.
+func (g *Generator) Collect(ctx context.Context, since, until time.Time) (*Activity, error) {
+	a := &Activity{Since: since, Until: until}
+
+	notes, err := g.storage.ListNotes(ctx, contracts.ListOptions{Limit: 10000})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	for _, n := range notes {
+		if inWindow(n.CreatedAt, since, until) {
+			a.Notes = append(a.Notes, n)
+		}
+	}
+
+	patterns, err := g.storage.ListPatterns(ctx, contracts.ListOptions{Limit: 10000})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list patterns: %w", err)
+	}
+	for _, p := range patterns {
+		switch {
+		case inWindow(p.CreatedAt, since, until):
+			a.Learned = append(a.Learned, p)
+		case p.LastUsedAt != nil && inWindow(*p.LastUsedAt, since, until):
+			a.Reinforced = append(a.Reinforced, p)
+		case fading(p, since):
+			a.Fading = append(a.Fading, p)
+		}
+	}
+	sort.SliceStable(a.Reinforced, func(i, j int) bool {
+		return a.Reinforced[i].ReinforceCnt > a.Reinforced[j].ReinforceCnt
+	})
+	sort.SliceStable(a.Fading, func(i, j int) bool {
+		return a.Fading[i].Strength < a.Fading[j].Strength
+	})
+
+	sessions, err := g.storage.ListThoughtSessionsSince(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list thought sessions: %w", err)
+	}
+	for _, s := range sessions {
+		if !s.UpdatedAt.After(until) {
+			a.Sessions = append(a.Sessions, s)
+		}
+	}
+
+	a.Notes = limit(a.Notes)
+	a.Learned = limit(a.Learned)
+	a.Reinforced = limit(a.Reinforced)
+	a.Fading = limit(a.Fading)
+	a.Sessions = limit(a.Sessions)
+	return a, nil
+}
+
+// Generate collects the activity between since and until and writes the
+// review, with the AI provider if one is set.
+func (g *Generator) Generate(ctx context.Context, since, until time.Time) (*Digest, error) {
+	a, err := g.Collect(ctx, since, until)
+	if err != nil {
+		return nil, err
+	}
+	d := &Digest{Title: Title(since, until), Activity: a}
+	report := Report(a)
+	if g.provider == nil || a.Empty() {
+		d.Markdown = report
+		return d, nil
+	}
+
+	resp, err := g.provider.Generate(ctx, &ai.Request{
+		System: systemPrompt,
+		Prompt: report,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write digest: %w", err)
+	}
+	d.Markdown = strings.TrimSpace(resp.Content) + "\n"
+	d.AI = true
+	return d, nil
+}
+
+// Title names the digest note.
+func Title(since, until time.Time) string {
+	return fmt.Sprintf("Digest %s – %s", since.Format("2006-01-02"), until.Format("2006-01-02"))
+}
+
+// Report renders a as a template-only Markdown report.
+func Report(a *Activity) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", Title(a.Since, a.Until))
+	fmt.Fprintf(&sb, "- %d new notes\n- %d new patterns\n- %d reinforced patterns\n- %d fading patterns\n- %d thought sessions\n",
+		len(a.Notes), len(a.Learned), len(a.Reinforced), len(a.Fading), len(a.Sessions))
+	if a.Empty() {
+		sb.WriteString("\nNothing happened in this period.\n")
+		return sb.String()
+	}
+
+	if len(a.Notes) > 0 {
+		sb.WriteString("\n## New notes\n\n")
+		for _, n := range a.Notes {
+			fmt.Fprintf(&sb, "- **%s**", n.Title)
+			if excerpt := excerpt(n.Content, 120); excerpt != "" {
+				fmt.Fprintf(&sb, ": %s", excerpt)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	if len(a.Learned) > 0 {
+		sb.WriteString("\n## New patterns\n\n")
+		for _, p := range a.Learned {
+			fmt.Fprintf(&sb, "- `%s` → %s\n", p.Trigger, excerpt(p.Response, 120))
+		}
+	}
+	if len(a.Reinforced) > 0 {
+		sb.WriteString("\n## Reinforced\n\n")
+		for _, p := range a.Reinforced {
+			fmt.Fprintf(&sb, "- `%s` (used %d times, strength %.0f)\n", p.Trigger, p.ReinforceCnt, p.Strength)
+		}
+	}
+	if len(a.Fading) > 0 {
+		sb.WriteString("\n## Fading\n\n")
+		for _, p := range a.Fading {
+			fmt.Fprintf(&sb, "- `%s` (strength %.0f of %.0f, %s)\n", p.Trigger, p.Strength, p.Threshold, lastUsed(p))
+		}
+	}
+	if len(a.Sessions) > 0 {
+		sb.WriteString("\n## Thought sessions\n\n")
+		for _, s := range a.Sessions {
+			fmt.Fprintf(&sb, "- %s (%s)\n", s.Title, s.UpdatedAt.Format("2006-01-02"))
+		}
+	}
+	return sb.String()
+}
+
+// fading reports whether p has decayed below its threshold and was not
+// used since the start of the window.
+func fading(p *models.Pattern, since time.Time) bool {
+	return p.DecayEnabled && p.DecayCnt > 0 && p.Strength < p.Threshold &&
+		(p.LastUsedAt == nil || p.LastUsedAt.Before(since))
+}
+
+func lastUsed(p *models.Pattern) string {
+	if p.LastUsedAt == nil {
+		return "never used"
+	}
+	return "last used " + p.LastUsedAt.Format("2006-01-02")
+}
+
+func inWindow(t, since, until time.Time) bool {
+	return !t.Before(since) && !t.After(until)
+}
+
+func limit[T any](items []T) []T {
+	if len(items) > maxItems {
+		return items[:maxItems]
+	}
+	return items
+}
+
+// excerpt flattens s to one line of at most n runes.
+func excerpt(s string, n int) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// systemPrompt asks for the review sections in Markdown.
+const systemPrompt = `You are Open-Think-Reflex, writing a periodic review of the user's notes
+and reflex patterns (trigger -> response pairs). You are given a report of
+the period's activity.
+
+Write the review in Markdown, starting with a "# " title, with these sections:
+
+## What you learned
+Themes across the new notes, new patterns and thought sessions.
+
+## What is fading
+Which fading patterns are worth reinforcing and which can go.
+
+## Suggested new reflexes
+Up to 5 new patterns worth creating, as "- ` + "`trigger`" + ` → response".
+
+Be concise and specific. Only refer to items in the report.`
@@ -0,0 +1,101 @@
+package digest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func setupTestStorage(t *testing.T) *sqlite.Storage {
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return sqlite.NewStorage(db)
+}
+
+// seed stores one item of each kind and returns the digest window.
+func seed(t *testing.T, storage *sqlite.Storage) (time.Time, time.Time) {
+	ctx := context.Background()
+	now := time.Now()
+	old := now.AddDate(0, -1, 0)
+	recent := now.Add(-time.Hour)
+
+	learned := models.NewPattern("paginate api", "Use cursors")
+	reinforced := models.NewPattern("deploy", "make release")
+	reinforced.CreatedAt = old
+	reinforced.LastUsedAt = &recent
+	reinforced.ReinforceCnt = 4
+	faded := models.NewPattern("old vpn", "connect to vpn.example")
+	faded.CreatedAt = old
+	faded.Strength = 10
+	faded.DecayCnt = 3
+	for _, p := range []*models.Pattern{learned, reinforced, faded} {
+		if err := storage.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	if err := storage.SaveNote(ctx, models.NewNote("Standup", "Talked about\npagination")); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	if err := storage.CreateThoughtSession(ctx, models.NewThoughtSession("API design")); err != nil {
+		t.Fatalf("CreateThoughtSession failed: %v", err)
+	}
+	return now.AddDate(0, 0, -7), now.Add(time.Minute)
+}
+
+func TestGenerate_Template(t *testing.T) {
+	storage := setupTestStorage(t)
+	since, until := seed(t, storage)
+
+	d, err := New(storage).Generate(context.Background(), since, until)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if d.AI {
+		t.Error("expected template report without a provider")
+	}
+	a := d.Activity
+	if len(a.Notes) != 1 || len(a.Learned) != 1 || len(a.Reinforced) != 1 || len(a.Fading) != 1 || len(a.Sessions) != 1 {
+		t.Fatalf("unexpected activity: %+v", a)
+	}
+	for _, want := range []string{"## New notes", "**Standup**: Talked about pagination", "`paginate api`", "used 4 times", "## Fading", "`old vpn` (strength 10 of 50, never used)", "API design"} {
+		if !strings.Contains(d.Markdown, want) {
+			t.Errorf("expected %q in report:\n%s", want, d.Markdown)
+		}
+	}
+}
+
+func TestGenerate_AI(t *testing.T) {
+	storage := setupTestStorage(t)
+	since, until := seed(t, storage)
+
+	fake := ai.NewFakeProvider(ai.FakeStep{Content: "# Review\n\n## What you learned\nPagination.\n"})
+	d, err := New(storage, WithProvider(fake)).Generate(context.Background(), since, until)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !d.AI || !strings.HasPrefix(d.Markdown, "# Review") {
+		t.Errorf("unexpected digest: %+v", d)
+	}
+	if req := fake.Requests()[0]; !strings.Contains(req.Prompt, "`old vpn`") {
+		t.Errorf("expected activity report in prompt, got %q", req.Prompt)
+	}
+
+	// Without activity the provider isn't called
+	d, err = New(setupTestStorage(t), WithProvider(fake)).Generate(context.Background(), since, until)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if d.AI || len(fake.Requests()) != 1 || !strings.Contains(d.Markdown, "Nothing happened") {
+		t.Errorf("expected template report for empty window, got %+v", d)
+	}
+}
@@ -0,0 +1,560 @@
+// Package tagger suggests tags for patterns and notes, and categories for
+// notes, from the vocabulary already in use.
+// Suggestions come from local keyword statistics: each tag (and category)
+// is described by the terms of the items that carry it, and new items are
+// compared against those descriptions. An AI provider can optionally
+// refine the suggestions, still choosing only from the known vocabulary.
+package tagger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// DefaultMinConfidence is the lowest confidence returned by default.
+const DefaultMinConfidence = 0.3
+
+// Suggestion sources
+const (
+	SourceKeywords = "keywords" // Local keyword statistics
+	SourceAI       = "ai"       // AI refinement
+)
+
+// mentionConfidence is the confidence given to a tag whose name appears
+// in the item itself.
+const mentionConfidence = 0.9
+
+// Suggestion is a proposed tag or category.
+type Suggestion struct {
+	Name       string
+	Confidence float64 // 0-1
+	Source     string  // SourceKeywords or SourceAI
+}
+
+// Result holds the suggestions for one item, best first.
+type Result struct {
+	Tags     []Suggestion
+	Category *Suggestion // Notes only; nil if nothing is confident enough
+}
+
+// TagNames returns the names of the suggested tags.
+func (r *Result) TagNames() []string {
+	names := make([]string, len(r.Tags))
+	for i, s := range r.Tags {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Tagger suggests tags and categories. Call Learn (or use Load) before
+// asking for suggestions.
+type Tagger struct {
+	tags          *model
+	categories    *model
+	provider      ai.Provider
+	minConfidence float64
+	maxTags       int
+}
+
+// Option is a functional option for Tagger.
+type Option func(*Tagger)
+
+// WithProvider lets an AI provider refine the suggestions.
+func WithProvider(p ai.Provider) Option {
+	return func(t *Tagger) {
+		t.provider = p
+	}
+}
+
+// WithMinConfidence drops suggestions below c (default DefaultMinConfidence).
+func WithMinConfidence(c float64) Option {
+	return func(t *Tagger) {
+		if c > 0 {
+			t.minConfidence = c
+		}
+	}
+}
+
+// WithMaxTags caps the number of suggested tags per item (default 3).
+func WithMaxTags(n int) Option {
+	return func(t *Tagger) {
+		if n > 0 {
+			t.maxTags = n
+		}
+	}
+}
+
+// New creates a tagger with an empty vocabulary.
+func New(opts ...Option) *Tagger {
+	t := &Tagger{
+		tags:          newModel(),
+		categories:    newModel(),
+		minConfidence: DefaultMinConfidence,
+		maxTags:       3,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Load creates a tagger that has learned from every pattern and note in
+// storage.
+func Load(ctx context.Context, storage contracts.Storage, opts ...Option) (*Tagger, error) {
+	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Limit: 10000})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list patterns: %w", err)
+	}
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{Limit: 10000})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	t := New(opts...)
+	t.Learn(patterns, notes)
+	return t, nil
+}
+
+// Learn adds the tags and categories of patterns and notes to the
+// vocabulary. The default "note" category carries no information and is
+// skipped.
+func (t *Tagger) Learn(patterns []*models.Pattern, notes []*models.Note) {
+	for _, p := range patterns {
+		t.tags.add(terms(patternText(p)), p.Tags)
+	}
+	for _, n := range notes {
+		words := terms(noteText(n))
+		t.tags.add(words, n.Tags)
+		if n.Category != "" && n.Category != models.CategoryNote {
+			t.categories.add(words, []string{n.Category})
+		}
+	}
+	t.tags.finish()
+	t.categories.finish()
+}
+
+// Tags returns the known tags, sorted.
+func (t *Tagger) Tags() []string {
+	return t.tags.labels()
+}
+
+// SuggestPattern suggests tags for p that it doesn't have yet.
+func (t *Tagger) SuggestPattern(ctx context.Context, p *models.Pattern) (*Result, error) {
+	text := patternText(p)
+	r := &Result{Tags: t.suggestTags(text, p.Tags)}
+	if t.provider != nil {
+		if err := t.refine(ctx, text, p.Tags, r, false); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// SuggestNote suggests tags for n that it doesn't have yet, and a
+// category if n still has the default one.
+func (t *Tagger) SuggestNote(ctx context.Context, n *models.Note) (*Result, error) {
+	text := noteText(n)
+	r := &Result{Tags: t.suggestTags(text, n.Tags)}
+	wantCategory := n.Category == "" || n.Category == models.CategoryNote
+	if wantCategory {
+		r.Category = t.suggestCategory(n)
+	}
+	if t.provider != nil {
+		if err := t.refine(ctx, text, n.Tags, r, wantCategory); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (t *Tagger) suggestTags(text string, existing []string) []Suggestion {
+	words := terms(text)
+	scores := t.tags.score(words)
+
+	has := make(map[string]bool, len(existing))
+	for _, tag := range existing {
+		has[strings.ToLower(tag)] = true
+	}
+	wordSet := make(map[string]bool, len(words))
+	for _, w := range words {
+		wordSet[w] = true
+	}
+
+	var out []Suggestion
+	for _, tag := range t.tags.labels() {
+		if has[strings.ToLower(tag)] {
+			continue
+		}
+		conf := scores[tag]
+		if wordSet[strings.ToLower(tag)] {
+			conf = math.Max(conf, mentionConfidence)
+		}
+		if conf >= t.minConfidence {
+			out = append(out, Suggestion{Name: tag, Confidence: conf, Source: SourceKeywords})
+		}
+	}
+	return t.best(out)
+}
+
+// categoryRules recognise categories from the wording of a note.
+var categoryRules = []struct {
+	category   string
+	confidence float64
+	match      func(title, content string) bool
+}{
+	{models.CategoryTodo, 0.8, func(title, content string) bool {
+		text := strings.ToLower(title + "\n" + content)
+		return strings.Contains(text, "- [ ]") || strings.Contains(text, "todo") || strings.Contains(text, "待办")
+	}},
+	{models.CategoryQuestion, 0.8, func(title, content string) bool {
+		title = strings.TrimSpace(title)
+		return strings.HasSuffix(title, "?") || strings.HasSuffix(title, "？")
+	}},
+	{models.CategoryIdea, 0.7, func(title, content string) bool {
+		text := strings.ToLower(strings.TrimSpace(title + " " + content))
+		return strings.HasPrefix(text, "idea") || strings.HasPrefix(text, "what if") || strings.Contains(text, "想法")
+	}},
+}
+
+func (t *Tagger) suggestCategory(n *models.Note) *Suggestion {
+	var best *Suggestion
+	consider := func(s Suggestion) {
+		if s.Confidence >= t.minConfidence && (best == nil || s.Confidence > best.Confidence) {
+			best = &s
+		}
+	}
+	for _, rule := range categoryRules {
+		if rule.match(n.Title, n.Content) {
+			consider(Suggestion{Name: rule.category, Confidence: rule.confidence, Source: SourceKeywords})
+		}
+	}
+	for category, conf := range t.categories.score(terms(noteText(n))) {
+		consider(Suggestion{Name: category, Confidence: conf, Source: SourceKeywords})
+	}
+	return best
+}
+
+// best sorts suggestions by confidence and keeps the top maxTags.
+func (t *Tagger) best(s []Suggestion) []Suggestion {
+	sort.SliceStable(s, func(i, j int) bool {
+		if s[i].Confidence != s[j].Confidence {
+			return s[i].Confidence > s[j].Confidence
+		}
+		return s[i].Name < s[j].Name
+	})
+	if len(s) > t.maxTags {
+		s = s[:t.maxTags]
+	}
+	return s
+}
+
+// ==================== AI refinement ====================
+
+// refine asks the provider to pick tags (and a category) from the
+// vocabulary, replacing the local suggestions. Answers outside the
+// vocabulary are ignored.
+func (t *Tagger) refine(ctx context.Context, text string, existing []string, r *Result, wantCategory bool) error {
+	vocab := t.tags.labels()
+	if len(vocab) == 0 && !wantCategory {
+		return nil
+	}
+
+	resp, err := t.provider.Generate(ctx, &ai.Request{
+		System: systemPrompt,
+		Prompt: buildPrompt(text, vocab, existing, r, wantCategory),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refine tags: %w", err)
+	}
+
+	var answer struct {
+		Tags []struct {
+			Tag        string  `json:"tag"`
+			Confidence float64 `json:"confidence"`
+		} `json:"tags"`
+		Category *struct {
+			Name       string  `json:"name"`
+			Confidence float64 `json:"confidence"`
+		} `json:"category"`
+	}
+	if err := json.Unmarshal([]byte(stripFences(resp.Content)), &answer); err != nil {
+		return fmt.Errorf("failed to parse tag suggestions: %w", err)
+	}
+
+	known := make(map[string]string, len(vocab))
+	for _, tag := range vocab {
+		known[strings.ToLower(tag)] = tag
+	}
+	has := make(map[string]bool, len(existing))
+	for _, tag := range existing {
+		has[strings.ToLower(tag)] = true
+	}
+	var tags []Suggestion
+	seen := make(map[string]bool)
+	for _, a := range answer.Tags {
+		key := strings.ToLower(strings.TrimSpace(a.Tag))
+		tag, ok := known[key]
+		if !ok || has[key] || seen[key] || clamp(a.Confidence) < t.minConfidence {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, Suggestion{Name: tag, Confidence: clamp(a.Confidence), Source: SourceAI})
+	}
+	r.Tags = t.best(tags)
+
+	if wantCategory {
+		r.Category = nil
+		if c := answer.Category; c != nil && isCategory(c.Name) && c.Name != models.CategoryNote && clamp(c.Confidence) >= t.minConfidence {
+			r.Category = &Suggestion{Name: c.Name, Confidence: clamp(c.Confidence), Source: SourceAI}
+		}
+	}
+	return nil
+}
+
+func buildPrompt(text string, vocab, existing []string, r *Result, wantCategory bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Item:\n%s\n\n", text)
+	fmt.Fprintf(&sb, "Known tags: %s\n", strings.Join(vocab, ", "))
+	if len(existing) > 0 {
+		fmt.Fprintf(&sb, "Already tagged: %s\n", strings.Join(existing, ", "))
+	}
+	if len(r.Tags) > 0 {
+		sb.WriteString("Keyword suggestions:")
+		for _, s := range r.Tags {
+			fmt.Fprintf(&sb, " %s (%.2f)", s.Name, s.Confidence)
+		}
+		sb.WriteString("\n")
+	}
+	if wantCategory {
+		fmt.Fprintf(&sb, "Categories: %s\n", strings.Join(categories, ", "))
+	} else {
+		sb.WriteString("No category is needed; omit it.\n")
+	}
+	return sb.String()
+}
+
+// categories are the note categories the model may choose from.
+var categories = []string{
+	models.CategoryThought, models.CategoryIdea, models.CategoryTodo,
+	models.CategoryMemory, models.CategoryQuestion, models.CategoryNote,
+}
+
+func isCategory(name string) bool {
+	for _, c := range categories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// systemPrompt asks for tags from the known vocabulary as JSON.
+const systemPrompt = `You are Open-Think-Reflex, tagging the user's notes and reflex patterns.
+Choose up to 3 tags for the item from the known tags only; never invent
+new tags. Skip tags it already has. When categories are listed, also choose
+the best one.
+
+Reply with JSON only, in this form:
+{"tags": [{"tag": "api", "confidence": 0.8}], "category": {"name": "idea", "confidence": 0.7}}
+
+confidence is from 0 to 1.`
+
+// stripFences removes a surrounding Markdown code fence.
+func stripFences(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:] // Drop the language tag
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
+
+func clamp(c float64) float64 {
+	return math.Max(0, math.Min(1, c))
+}
+
+// ==================== Keyword statistics ====================
+
+// model describes each label (tag or category) by the terms of the items
+// that carry it. An item's confidence for a label is the cosine
+// similarity between its idf-weighted terms and the label's centroid.
+type model struct {
+	docs      int                       // Items seen
+	df        map[string]int            // Items containing each term
+	counts    map[string]int            // Items carrying each label
+	termDocs  map[string]map[string]int // label -> term -> items with both
+	centroids map[string]map[string]float64
+	norms     map[string]float64
+}
+
+func newModel() *model {
+	return &model{
+		df:       make(map[string]int),
+		counts:   make(map[string]int),
+		termDocs: make(map[string]map[string]int),
+	}
+}
+
+func (m *model) add(words []string, labels []string) {
+	if len(words) == 0 {
+		return
+	}
+	m.docs++
+	uniq := unique(words)
+	for _, w := range uniq {
+		m.df[w]++
+	}
+	for _, label := range unique(labels) {
+		if label == "" {
+			continue
+		}
+		m.counts[label]++
+		if m.termDocs[label] == nil {
+			m.termDocs[label] = make(map[string]int)
+		}
+		for _, w := range uniq {
+			m.termDocs[label][w]++
+		}
+	}
+}
+
+// finish computes the label centroids.
+func (m *model) finish() {
+	m.centroids = make(map[string]map[string]float64, len(m.counts))
+	m.norms = make(map[string]float64, len(m.counts))
+	for label, terms := range m.termDocs {
+		centroid := make(map[string]float64, len(terms))
+		var norm float64
+		for w, n := range terms {
+			v := float64(n) / float64(m.counts[label]) * m.idf(w)
+			centroid[w] = v
+			norm += v * v
+		}
+		m.centroids[label] = centroid
+		m.norms[label] = math.Sqrt(norm)
+	}
+}
+
+func (m *model) idf(w string) float64 {
+	return math.Log(1 + float64(m.docs)/float64(1+m.df[w]))
+}
+
+// score returns the confidence of every label for an item with words.
+func (m *model) score(words []string) map[string]float64 {
+	scores := make(map[string]float64, len(m.centroids))
+	uniq := unique(words)
+	var norm float64
+	for _, w := range uniq {
+		v := m.idf(w)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return scores
+	}
+	for label, centroid := range m.centroids {
+		if m.norms[label] == 0 {
+			continue
+		}
+		var dot float64
+		for _, w := range uniq {
+			dot += m.idf(w) * centroid[w]
+		}
+		scores[label] = dot / (norm * m.norms[label])
+	}
+	return scores
+}
+
+func (m *model) labels() []string {
+	labels := make([]string, 0, len(m.counts))
+	for label := range m.counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// ==================== Text ====================
+
+func patternText(p *models.Pattern) string {
+	return p.Trigger + "\n" + p.Response
+}
+
+func noteText(n *models.Note) string {
+	return n.Title + "\n" + n.Content
+}
+
+// stopwords are common English words that say nothing about a topic.
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"are": true, "was": true, "you": true, "your": true, "from": true, "into": true,
+	"use": true, "not": true, "but": true, "have": true, "has": true, "can": true,
+	"will": true, "all": true, "any": true, "how": true, "what": true, "when": true,
+	"then": true, "than": true, "its": true, "our": true, "out": true, "about": true,
+}
+
+// terms splits text into lower-case words of at least two letters, minus
+// stopwords. Runs of Han characters, which have no spaces, are split into
+// overlapping pairs.
+func terms(text string) []string {
+	var out []string
+	var word, han []rune
+	flushWord := func() {
+		if len(word) >= 2 {
+			if w := string(word); !stopwords[w] {
+				out = append(out, w)
+			}
+		}
+		word = word[:0]
+	}
+	flushHan := func() {
+		switch {
+		case len(han) == 1:
+			out = append(out, string(han))
+		case len(han) > 1:
+			for i := 0; i+1 < len(han); i++ {
+				out = append(out, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			flushHan()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return out
+}
+
+func unique(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			out = append(out, item)
+		}
+	}
+	return out
+}
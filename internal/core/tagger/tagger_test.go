@@ -0,0 +1,97 @@
+package tagger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func tagged(trigger, response string, tags ...string) *models.Pattern {
+	p := models.NewPattern(trigger, response)
+	p.Tags = tags
+	return p
+}
+
+func newTagger(opts ...Option) *Tagger {
+	t := New(opts...)
+	idea := models.NewNote("Plugin marketplace", "a marketplace for community plugins")
+	idea.Category = models.CategoryIdea
+	t.Learn([]*models.Pattern{
+		tagged("list users endpoint", "GET /users with pagination", "api"),
+		tagged("create user endpoint", "POST /users returns 201", "api"),
+		tagged("button styles", "use the primary css button class", "frontend"),
+		tagged("modal component", "react modal with css transitions", "frontend"),
+		tagged("deploy", "make release"),
+	}, []*models.Note{idea})
+	return t
+}
+
+func TestSuggestPattern(t *testing.T) {
+	tg := newTagger()
+	r, err := tg.SuggestPattern(context.Background(), models.NewPattern("delete user endpoint", "DELETE /users/:id"))
+	if err != nil {
+		t.Fatalf("SuggestPattern failed: %v", err)
+	}
+	if len(r.Tags) == 0 || r.Tags[0].Name != "api" || r.Tags[0].Source != SourceKeywords {
+		t.Fatalf("expected api suggestion, got %+v", r.Tags)
+	}
+	for _, s := range r.Tags {
+		if s.Name == "frontend" {
+			t.Errorf("unexpected frontend suggestion: %+v", s)
+		}
+	}
+
+	// Existing tags aren't suggested again
+	p := models.NewPattern("delete user endpoint", "DELETE /users/:id")
+	p.Tags = []string{"api"}
+	if r, _ := tg.SuggestPattern(context.Background(), p); len(r.Tags) != 0 {
+		t.Errorf("expected no new tags, got %+v", r.Tags)
+	}
+
+	// A tag named in the text is suggested with high confidence
+	r, _ = tg.SuggestPattern(context.Background(), models.NewPattern("frontend lint", "run eslint"))
+	if len(r.Tags) == 0 || r.Tags[0].Name != "frontend" || r.Tags[0].Confidence < mentionConfidence {
+		t.Errorf("expected mentioned tag, got %+v", r.Tags)
+	}
+}
+
+func TestSuggestNote_Category(t *testing.T) {
+	tg := newTagger()
+	ctx := context.Background()
+
+	r, _ := tg.SuggestNote(ctx, models.NewNote("Release checklist", "- [ ] tag\n- [ ] publish"))
+	if r.Category == nil || r.Category.Name != models.CategoryTodo {
+		t.Errorf("expected todo category, got %+v", r.Category)
+	}
+	r, _ = tg.SuggestNote(ctx, models.NewNote("Theme marketplace", "community marketplace for themes"))
+	if r.Category == nil || r.Category.Name != models.CategoryIdea {
+		t.Errorf("expected learned idea category, got %+v", r.Category)
+	}
+
+	// Notes with a category of their own keep it
+	n := models.NewNote("Why is CI slow?", "")
+	n.Category = models.CategoryMemory
+	if r, _ := tg.SuggestNote(ctx, n); r.Category != nil {
+		t.Errorf("expected no category suggestion, got %+v", r.Category)
+	}
+}
+
+func TestSuggest_AIRefinement(t *testing.T) {
+	fake := ai.NewFakeProvider(ai.FakeStep{
+		Content: `{"tags": [{"tag": "Frontend", "confidence": 0.7}, {"tag": "made-up", "confidence": 0.9}], "category": {"name": "question", "confidence": 0.6}}`,
+	})
+	tg := newTagger(WithProvider(fake))
+
+	r, err := tg.SuggestNote(context.Background(), models.NewNote("Modal focus", "how do we trap focus?"))
+	if err != nil {
+		t.Fatalf("SuggestNote failed: %v", err)
+	}
+	if len(r.Tags) != 1 || r.Tags[0].Name != "frontend" || r.Tags[0].Source != SourceAI {
+		t.Errorf("expected only known tags from the AI, got %+v", r.Tags)
+	}
+	if r.Category == nil || r.Category.Name != models.CategoryQuestion || r.Category.Confidence != 0.6 {
+		t.Errorf("unexpected category: %+v", r.Category)
+	}
+}
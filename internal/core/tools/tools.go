@@ -0,0 +1,283 @@
+// Package tools exposes OTR data to AI providers as callable tools.
+// Read tools (searching patterns and notes, reading a note) run freely;
+// write tools (creating a note, proposing a pattern) only run after the
+// user confirms them.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Tool names
+const (
+	SearchPatterns = "search_patterns"
+	SearchNotes    = "search_notes"
+	ReadNote       = "read_note"
+	CreateNote     = "create_note"
+	ProposePattern = "propose_pattern"
+)
+
+// maxResults caps how many items a search returns to the model.
+const maxResults = 10
+
+// ConfirmFunc asks the user to allow a write. action describes it,
+// e.g. `create note "Standup"`.
+type ConfirmFunc func(action string) bool
+
+// Set builds the tools for one storage.
+type Set struct {
+	storage *sqlite.Storage
+	spaceID string
+	confirm ConfirmFunc
+}
+
+// Option is a functional option for Set.
+type Option func(*Set)
+
+// WithSpace scopes searches and new items to a space.
+func WithSpace(spaceID string) Option {
+	return func(s *Set) {
+		s.spaceID = spaceID
+	}
+}
+
+// WithConfirm sets how writes are confirmed. Without it every write is
+// declined.
+func WithConfirm(confirm ConfirmFunc) Option {
+	return func(s *Set) {
+		s.confirm = confirm
+	}
+}
+
+// New creates a tool set.
+func New(storage *sqlite.Storage, opts ...Option) *Set {
+	s := &Set{storage: storage}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Tools returns the tools to attach to an ai.Request.
+func (s *Set) Tools() []ai.Tool {
+	return []ai.Tool{
+		{
+			Name:        SearchPatterns,
+			Description: "Search the user's reflex patterns (trigger -> response pairs) by keyword. Use this to answer questions about which reflexes the user has.",
+			Properties: map[string]any{
+				"query": map[string]any{"type": "string", "description": "Keyword matched against triggers and responses"},
+			},
+			Required: []string{"query"},
+			Run:      s.searchPatterns,
+		},
+		{
+			Name:        SearchNotes,
+			Description: "Search the user's notes by keyword. Returns note IDs and titles.",
+			Properties: map[string]any{
+				"query": map[string]any{"type": "string", "description": "Keyword matched against titles and content"},
+			},
+			Required: []string{"query"},
+			Run:      s.searchNotes,
+		},
+		{
+			Name:        ReadNote,
+			Description: "Read the full content of a note by ID.",
+			Properties: map[string]any{
+				"id": map[string]any{"type": "string", "description": "Note ID"},
+			},
+			Required: []string{"id"},
+			Run:      s.readNote,
+		},
+		{
+			Name:        CreateNote,
+			Description: "Create a note. The user is asked to confirm first.",
+			Properties: map[string]any{
+				"title":   map[string]any{"type": "string"},
+				"content": map[string]any{"type": "string", "description": "Markdown content"},
+				"tags":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			Required: []string{"title", "content"},
+			Run:      s.createNote,
+		},
+		{
+			Name:        ProposePattern,
+			Description: "Propose a new reflex pattern. It is saved only if the user confirms.",
+			Properties: map[string]any{
+				"trigger":  map[string]any{"type": "string", "description": "Input that should trigger the reflex"},
+				"response": map[string]any{"type": "string", "description": "Response to give"},
+				"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			Required: []string{"trigger", "response"},
+			Run:      s.proposePattern,
+		},
+	}
+}
+
+func (s *Set) searchPatterns(ctx context.Context, input json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := decode(input, &in); err != nil {
+		return "", err
+	}
+
+	patterns, err := s.storage.SearchPatterns(ctx, in.Query, contracts.ListOptions{Limit: maxResults})
+	if err != nil {
+		return "", fmt.Errorf("failed to search patterns: %w", err)
+	}
+	type result struct {
+		ID       string   `json:"id"`
+		Trigger  string   `json:"trigger"`
+		Response string   `json:"response"`
+		Strength float64  `json:"strength"`
+		Tags     []string `json:"tags,omitempty"`
+	}
+	results := make([]result, 0, len(patterns))
+	for _, p := range patterns {
+		results = append(results, result{p.ID, p.Trigger, p.Response, p.Strength, p.Tags})
+	}
+	return encode(results)
+}
+
+func (s *Set) searchNotes(ctx context.Context, input json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := decode(input, &in); err != nil {
+		return "", err
+	}
+
+	notes, err := s.storage.SearchNotes(ctx, in.Query, contracts.ListOptions{SpaceID: s.spaceID, Limit: maxResults})
+	if err != nil {
+		return "", fmt.Errorf("failed to search notes: %w", err)
+	}
+	type result struct {
+		ID    string   `json:"id"`
+		Title string   `json:"title"`
+		Tags  []string `json:"tags,omitempty"`
+	}
+	results := make([]result, 0, len(notes))
+	for _, n := range notes {
+		results = append(results, result{n.ID, n.Title, n.Tags})
+	}
+	return encode(results)
+}
+
+func (s *Set) readNote(ctx context.Context, input json.RawMessage) (string, error) {
+	var in struct {
+		ID string `json:"id"`
+	}
+	if err := decode(input, &in); err != nil {
+		return "", err
+	}
+
+	note, err := s.storage.GetNote(ctx, in.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read note: %w", err)
+	}
+	return encode(struct {
+		ID      string   `json:"id"`
+		Title   string   `json:"title"`
+		Content string   `json:"content"`
+		Tags    []string `json:"tags,omitempty"`
+	}{note.ID, note.Title, note.Content, note.Tags})
+}
+
+func (s *Set) createNote(ctx context.Context, input json.RawMessage) (string, error) {
+	var in struct {
+		Title   string   `json:"title"`
+		Content string   `json:"content"`
+		Tags    []string `json:"tags"`
+	}
+	if err := decode(input, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Title) == "" {
+		return "", fmt.Errorf("title is required")
+	}
+	if !s.allow(fmt.Sprintf("create note %q", in.Title)) {
+		return "The user declined to create the note.", nil
+	}
+
+	note := models.NewNote(in.Title, in.Content)
+	note.SpaceID = s.spaceID
+	note.Tags = in.Tags
+	if err := s.storage.SaveNote(ctx, note); err != nil {
+		return "", fmt.Errorf("failed to save note: %w", err)
+	}
+	return fmt.Sprintf("Created note %s.", note.ID), nil
+}
+
+func (s *Set) proposePattern(ctx context.Context, input json.RawMessage) (string, error) {
+	var in struct {
+		Trigger  string   `json:"trigger"`
+		Response string   `json:"response"`
+		Tags     []string `json:"tags"`
+	}
+	if err := decode(input, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Trigger) == "" || strings.TrimSpace(in.Response) == "" {
+		return "", fmt.Errorf("trigger and response are required")
+	}
+	if !s.allow(fmt.Sprintf("save pattern %q -> %q", in.Trigger, truncate(in.Response, 60))) {
+		return "The user declined the proposed pattern.", nil
+	}
+
+	pattern := models.NewPattern(in.Trigger, in.Response)
+	pattern.SpaceID = s.spaceID
+	pattern.Tags = in.Tags
+	if err := s.storage.SavePattern(ctx, pattern); err != nil {
+		return "", fmt.Errorf("failed to save pattern: %w", err)
+	}
+	if err := s.storage.SavePatternProvenance(ctx, &models.PatternProvenance{
+		PatternID: pattern.ID,
+		Source:    models.ProvenanceAI,
+		Query:     in.Trigger,
+	}); err != nil {
+		return "", fmt.Errorf("failed to save provenance: %w", err)
+	}
+	return fmt.Sprintf("Saved pattern %s.", pattern.ID), nil
+}
+
+// allow asks the user to confirm a write.
+func (s *Set) allow(action string) bool {
+	return s.confirm != nil && s.confirm(action)
+}
+
+// decode parses tool input.
+func decode(input json.RawMessage, v any) error {
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(input, v); err != nil {
+		return fmt.Errorf("invalid input: %w", err)
+	}
+	return nil
+}
+
+// encode formats a tool result for the model.
+func encode(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func setupTestStorage(t *testing.T) *sqlite.Storage {
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return sqlite.NewStorage(db)
+}
+
+// run calls the named tool with input.
+func run(t *testing.T, set *Set, name, input string) ai.ToolCall {
+	call := ai.ToolCall{Name: name, Input: json.RawMessage(input)}
+	ai.RunTool(context.Background(), set.Tools(), &call)
+	return call
+}
+
+func TestSearchPatterns(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+	for _, p := range []*models.Pattern{
+		models.NewPattern("pagination in SQL", "Use keyset pagination"),
+		models.NewPattern("deploy", "make release"),
+	} {
+		if err := storage.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+
+	call := run(t, New(storage), SearchPatterns, `{"query":"pagination"}`)
+	if call.IsError {
+		t.Fatalf("search failed: %s", call.Output)
+	}
+	if !strings.Contains(call.Output, "keyset") || strings.Contains(call.Output, "make release") {
+		t.Errorf("unexpected search result: %s", call.Output)
+	}
+}
+
+func TestReadNote(t *testing.T) {
+	storage := setupTestStorage(t)
+	note := models.NewNote("Standup", "Talk about pagination")
+	if err := storage.SaveNote(context.Background(), note); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	set := New(storage)
+
+	call := run(t, set, SearchNotes, `{"query":"pagination"}`)
+	if !strings.Contains(call.Output, note.ID) {
+		t.Errorf("expected note in search result, got %s", call.Output)
+	}
+	call = run(t, set, ReadNote, `{"id":"`+note.ID+`"}`)
+	if !strings.Contains(call.Output, "Talk about pagination") {
+		t.Errorf("unexpected note content: %s", call.Output)
+	}
+	if call = run(t, set, ReadNote, `{"id":"missing"}`); !call.IsError {
+		t.Error("expected error for missing note")
+	}
+}
+
+func TestWritesRequireConfirmation(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	// Without a confirm function writes are declined
+	call := run(t, New(storage), CreateNote, `{"title":"Todo","content":"x"}`)
+	if call.IsError || !strings.Contains(call.Output, "declined") {
+		t.Errorf("expected declined write, got %+v", call)
+	}
+	notes, _ := storage.ListNotes(ctx, contracts.ListOptions{})
+	if len(notes) != 0 {
+		t.Fatalf("expected no notes, got %d", len(notes))
+	}
+
+	var asked []string
+	set := New(storage, WithSpace("work"), WithConfirm(func(action string) bool {
+		asked = append(asked, action)
+		return true
+	}))
+	if call := run(t, set, CreateNote, `{"title":"Todo","content":"x","tags":["a"]}`); call.IsError {
+		t.Fatalf("create note failed: %s", call.Output)
+	}
+	if call := run(t, set, ProposePattern, `{"trigger":"paginate api","response":"Use cursors"}`); call.IsError {
+		t.Fatalf("propose pattern failed: %s", call.Output)
+	}
+	if len(asked) != 2 {
+		t.Errorf("expected 2 confirmations, got %v", asked)
+	}
+
+	notes, _ = storage.ListNotes(ctx, contracts.ListOptions{})
+	if len(notes) != 1 || notes[0].SpaceID != "work" {
+		t.Errorf("unexpected notes: %+v", notes)
+	}
+	p, err := storage.GetPatternByTrigger(ctx, "paginate api")
+	if err != nil {
+		t.Fatalf("GetPatternByTrigger failed: %v", err)
+	}
+	prov, err := storage.GetPatternProvenance(ctx, p.ID)
+	if err != nil || prov == nil || prov.Source != models.ProvenanceAI {
+		t.Errorf("expected AI provenance, got %+v (%v)", prov, err)
+	}
+}
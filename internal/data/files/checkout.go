@@ -0,0 +1,186 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Checkout is a copy of the tree in another storage, typically a working
+// SQLite database for tools that need one. Commit writes back what changed
+// in the copy since the checkout; files edited in the meantime are only
+// overwritten if the copy changed the same item.
+type Checkout struct {
+	tree     *Storage
+	dst      contracts.Storage
+	patterns map[string]*models.Pattern
+	spaces   map[string]*models.Space
+	notes    map[string]*models.Note
+}
+
+// Checkout copies the tree's spaces, patterns and notes into dst, keeping
+// their IDs.
+func (s *Storage) Checkout(ctx context.Context, dst contracts.Storage) (*Checkout, error) {
+	c := &Checkout{
+		tree:     s,
+		dst:      dst,
+		patterns: make(map[string]*models.Pattern),
+		spaces:   make(map[string]*models.Space),
+		notes:    make(map[string]*models.Note),
+	}
+
+	spaces, err := s.ListSpaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, space := range spaces {
+		c.spaces[space.ID] = space
+		copied := *space
+		if err := dst.CreateSpace(ctx, &copied); err != nil {
+			return nil, fmt.Errorf("failed to copy space %s: %w", space.ID, err)
+		}
+	}
+	patterns, err := s.ListPatterns(ctx, contracts.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patterns {
+		c.patterns[p.ID] = p
+		copied := *p
+		if err := dst.SavePattern(ctx, &copied); err != nil {
+			return nil, fmt.Errorf("failed to copy pattern %s: %w", p.ID, err)
+		}
+	}
+	notes, err := s.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		c.notes[n.ID] = n
+		copied := *n
+		if err := dst.SaveNote(ctx, &copied); err != nil {
+			return nil, fmt.Errorf("failed to copy note %s: %w", n.ID, err)
+		}
+	}
+	return c, nil
+}
+
+// Commit writes the items created, changed or deleted in the copy back to
+// the tree. Items whose content is unchanged are left alone, so their
+// files and timestamps stay as they are.
+func (c *Checkout) Commit(ctx context.Context) error {
+	spaces, err := c.dst.ListSpaces(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, space := range spaces {
+		seen[space.ID] = true
+		if old, ok := c.spaces[space.ID]; ok && sameSpace(old, space) {
+			continue
+		}
+		if err := c.tree.CreateSpace(ctx, space); err != nil {
+			return fmt.Errorf("failed to write space %s: %w", space.ID, err)
+		}
+	}
+	for id := range c.spaces {
+		if !seen[id] {
+			if err := c.tree.DeleteSpace(ctx, id); err != nil {
+				return fmt.Errorf("failed to delete space %s: %w", id, err)
+			}
+		}
+	}
+
+	patterns, err := c.dst.ListPatterns(ctx, contracts.ListOptions{})
+	if err != nil {
+		return err
+	}
+	seen = make(map[string]bool)
+	var changed []*models.Pattern
+	for _, p := range patterns {
+		seen[p.ID] = true
+		if old, ok := c.patterns[p.ID]; ok && samePattern(old, p) {
+			continue
+		}
+		changed = append(changed, p)
+	}
+	if err := c.tree.SavePatternsBatch(ctx, changed); err != nil {
+		return fmt.Errorf("failed to write patterns: %w", err)
+	}
+	var deleted []string
+	for id := range c.patterns {
+		if !seen[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	if err := c.tree.DeletePatternsBatch(ctx, deleted); err != nil {
+		return fmt.Errorf("failed to delete patterns: %w", err)
+	}
+
+	notes, err := c.dst.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil {
+		return err
+	}
+	seen = make(map[string]bool)
+	for _, n := range notes {
+		seen[n.ID] = true
+		if old, ok := c.notes[n.ID]; ok && sameNote(old, n) {
+			continue
+		}
+		if err := c.tree.SaveNote(ctx, n); err != nil {
+			return fmt.Errorf("failed to write note %s: %w", n.ID, err)
+		}
+	}
+	for id := range c.notes {
+		if !seen[id] {
+			if err := c.tree.DeleteNote(ctx, id); err != nil {
+				return fmt.Errorf("failed to delete note %s: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// samePattern compares patterns as they are written to files, ignoring
+// the timestamps a copy resets.
+func samePattern(a, b *models.Pattern) bool {
+	x, y := *a, *b
+	for _, p := range []*models.Pattern{&x, &y} {
+		p.CreatedAt, p.UpdatedAt = time.Time{}, time.Time{}
+		p.LastUsedAt = stampPtr(p.LastUsedAt)
+		p.Tags = nilIfEmpty(p.Tags)
+		p.Connections = nilIfEmpty(p.Connections)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func sameNote(a, b *models.Note) bool {
+	x, y := *a, *b
+	for _, n := range []*models.Note{&x, &y} {
+		n.CreatedAt, n.UpdatedAt = time.Time{}, time.Time{}
+		n.LastViewed = stampPtr(n.LastViewed)
+		n.Tags = nilIfEmpty(n.Tags)
+		n.PatternIDs = nilIfEmpty(n.PatternIDs)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func sameSpace(a, b *models.Space) bool {
+	x, y := *a, *b
+	for _, space := range []*models.Space{&x, &y} {
+		space.CreatedAt, space.UpdatedAt = time.Time{}, time.Time{}
+		space.PatternCount = 0
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
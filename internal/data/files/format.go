@@ -0,0 +1,259 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// File formats. Fields are written in a fixed order, empty fields are
+// left out and timestamps are written in UTC to the second, so saving an
+// unchanged item produces the same bytes and diffs only show real edits.
+// The space of an item is the directory it lives in, so moving a file
+// between space directories moves the item.
+
+// patternFile is the YAML form of a pattern.
+type patternFile struct {
+	ID           string     `yaml:"id"`
+	Trigger      string     `yaml:"trigger"`
+	Response     string     `yaml:"response"`
+	Tags         []string   `yaml:"tags,omitempty"`
+	Project      string     `yaml:"project,omitempty"`
+	Strength     float64    `yaml:"strength"`
+	Threshold    float64    `yaml:"threshold"`
+	DecayRate    float64    `yaml:"decay_rate"`
+	DecayEnabled bool       `yaml:"decay_enabled"`
+	ReinforceCnt int        `yaml:"reinforcement_count,omitempty"`
+	DecayCnt     int        `yaml:"decay_count,omitempty"`
+	Connections  []string   `yaml:"connections,omitempty"`
+	UserID       string     `yaml:"user_id,omitempty"`
+	LastUsedAt   *time.Time `yaml:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `yaml:"created_at"`
+	UpdatedAt    time.Time  `yaml:"updated_at"`
+}
+
+// noteFront is the YAML front matter of a note; the Markdown body after
+// it is the note's content.
+type noteFront struct {
+	ID         string     `yaml:"id"`
+	Title      string     `yaml:"title"`
+	Category   string     `yaml:"category,omitempty"`
+	Tags       []string   `yaml:"tags,omitempty"`
+	Pinned     bool       `yaml:"pinned,omitempty"`
+	Patterns   []string   `yaml:"patterns,omitempty"`
+	LastViewed *time.Time `yaml:"last_viewed_at,omitempty"`
+	CreatedAt  time.Time  `yaml:"created_at"`
+	UpdatedAt  time.Time  `yaml:"updated_at"`
+}
+
+// spaceFile is the YAML form of a space.
+type spaceFile struct {
+	Name         string    `yaml:"name"`
+	Description  string    `yaml:"description,omitempty"`
+	Owner        string    `yaml:"owner,omitempty"`
+	Default      bool      `yaml:"default,omitempty"`
+	PatternLimit int       `yaml:"pattern_limit,omitempty"`
+	CreatedAt    time.Time `yaml:"created_at"`
+	UpdatedAt    time.Time `yaml:"updated_at"`
+}
+
+const frontMatterDelim = "---\n"
+
+func encodePattern(p *models.Pattern) ([]byte, error) {
+	return marshal(patternFile{
+		ID:           p.ID,
+		Trigger:      p.Trigger,
+		Response:     p.Response,
+		Tags:         p.Tags,
+		Project:      p.Project,
+		Strength:     p.Strength,
+		Threshold:    p.Threshold,
+		DecayRate:    p.DecayRate,
+		DecayEnabled: p.DecayEnabled,
+		ReinforceCnt: p.ReinforceCnt,
+		DecayCnt:     p.DecayCnt,
+		Connections:  p.Connections,
+		UserID:       p.UserID,
+		LastUsedAt:   stampPtr(p.LastUsedAt),
+		CreatedAt:    stamp(p.CreatedAt),
+		UpdatedAt:    stamp(p.UpdatedAt),
+	})
+}
+
+// decodePattern parses a pattern file. Fields left out of a hand-written
+// file take the defaults of a new pattern; the ID defaults to fallbackID
+// (the file name) and the timestamps to modTime.
+func decodePattern(data []byte, spaceID, fallbackID string, modTime time.Time) (*models.Pattern, error) {
+	def := models.NewPattern("", "")
+	pf := patternFile{
+		Strength:     def.Strength,
+		Threshold:    def.Threshold,
+		DecayRate:    def.DecayRate,
+		DecayEnabled: def.DecayEnabled,
+	}
+	if err := yaml.Unmarshal(data, &pf); err != nil {
+		return nil, err
+	}
+	if pf.ID == "" {
+		pf.ID = fallbackID
+	}
+	p := &models.Pattern{
+		ID:           pf.ID,
+		Trigger:      pf.Trigger,
+		Response:     pf.Response,
+		SpaceID:      spaceID,
+		Tags:         models.NormalizeTags(pf.Tags),
+		Project:      pf.Project,
+		Strength:     pf.Strength,
+		Threshold:    pf.Threshold,
+		DecayRate:    pf.DecayRate,
+		DecayEnabled: pf.DecayEnabled,
+		ReinforceCnt: pf.ReinforceCnt,
+		DecayCnt:     pf.DecayCnt,
+		Connections:  pf.Connections,
+		UserID:       pf.UserID,
+		LastUsedAt:   pf.LastUsedAt,
+		CreatedAt:    orTime(pf.CreatedAt, modTime),
+		UpdatedAt:    orTime(pf.UpdatedAt, modTime),
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func encodeNote(n *models.Note) ([]byte, error) {
+	front, err := marshal(noteFront{
+		ID:         n.ID,
+		Title:      n.Title,
+		Category:   n.Category,
+		Tags:       n.Tags,
+		Pinned:     n.IsPinned,
+		Patterns:   n.PatternIDs,
+		LastViewed: stampPtr(n.LastViewed),
+		CreatedAt:  stamp(n.CreatedAt),
+		UpdatedAt:  stamp(n.UpdatedAt),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(frontMatterDelim)
+	buf.Write(front)
+	buf.WriteString(frontMatterDelim)
+	// Files end with a newline; decodeNote strips it again
+	buf.WriteString(n.Content)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// decodeNote parses a note file. A Markdown file without front matter is
+// taken as a note titled after fallbackID (the file name).
+func decodeNote(data []byte, spaceID, fallbackID string, modTime time.Time) (*models.Note, error) {
+	var front noteFront
+	content := string(data)
+	if rest, ok := strings.CutPrefix(content, frontMatterDelim); ok {
+		head, body, found := strings.Cut(rest, "\n"+frontMatterDelim)
+		if !found {
+			return nil, fmt.Errorf("unterminated front matter")
+		}
+		if err := yaml.Unmarshal([]byte(head), &front); err != nil {
+			return nil, err
+		}
+		content = body
+	} else {
+		front.Title = fallbackID
+	}
+	content = strings.TrimSuffix(content, "\n")
+	if front.ID == "" {
+		front.ID = fallbackID
+	}
+
+	n := &models.Note{
+		ID:         front.ID,
+		Title:      front.Title,
+		Content:    content,
+		SpaceID:    spaceID,
+		Tags:       models.NormalizeTags(front.Tags),
+		IsPinned:   front.Pinned,
+		Category:   front.Category,
+		LastViewed: front.LastViewed,
+		PatternIDs: front.Patterns,
+		CreatedAt:  orTime(front.CreatedAt, modTime),
+		UpdatedAt:  orTime(front.UpdatedAt, modTime),
+	}
+	n.CalculateStats()
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func encodeSpace(space *models.Space) ([]byte, error) {
+	return marshal(spaceFile{
+		Name:         space.Name,
+		Description:  space.Description,
+		Owner:        space.Owner,
+		Default:      space.DefaultSpace,
+		PatternLimit: space.PatternLimit,
+		CreatedAt:    stamp(space.CreatedAt),
+		UpdatedAt:    stamp(space.UpdatedAt),
+	})
+}
+
+func decodeSpace(data []byte, id string, modTime time.Time) (*models.Space, error) {
+	var sf spaceFile
+	if err := yaml.Unmarshal(data, &sf); err != nil {
+		return nil, err
+	}
+	if sf.Name == "" {
+		sf.Name = id
+	}
+	return &models.Space{
+		ID:           id,
+		Name:         sf.Name,
+		Description:  sf.Description,
+		Owner:        sf.Owner,
+		DefaultSpace: sf.Default,
+		PatternLimit: sf.PatternLimit,
+		CreatedAt:    orTime(sf.CreatedAt, modTime),
+		UpdatedAt:    orTime(sf.UpdatedAt, modTime),
+	}, nil
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stamp returns t as written to files: UTC, to the second.
+func stamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+func stampPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	s := stamp(*t)
+	return &s
+}
+
+func orTime(t, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t
+}
@@ -0,0 +1,675 @@
+// Package files implements contracts.Storage as a tree of plain files,
+// so patterns and notes can live in a Git repository and be reviewed like
+// code:
+//
+//	<root>/<space>/space.yaml          space settings
+//	<root>/<space>/patterns/<id>.yaml  one pattern per file
+//	<root>/<space>/notes/<id>.md       one note per file, YAML front matter
+//
+// Queries run against an in-memory index. Before every operation the tree
+// is checked for external edits (files added, removed or changed since the
+// last look) and the index is reloaded if there are any. Writes are atomic
+// and only touch the files of items that changed. Deleted patterns are
+// removed from the tree; Git keeps their history.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/memory"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Layout names
+const (
+	spaceFileName = "space.yaml"
+	patternsDir   = "patterns"
+	notesDir      = "notes"
+	patternExt    = ".yaml"
+	noteExt       = ".md"
+
+	// defaultSpaceID holds notes saved without a space
+	defaultSpaceID = "global"
+)
+
+// Storage is a contracts.Storage backed by a file tree.
+type Storage struct {
+	root  string
+	mu    sync.Mutex
+	index *memory.Storage
+
+	// stats records the files seen by the last scan, to spot external edits
+	stats map[string]fileStat
+	// rendered holds a hash of what each managed file should contain, to
+	// write only the files whose item changed
+	rendered map[string][sha256.Size]byte
+	// paths maps items ("pattern <id>", "note <id>") to their files, so
+	// files named by hand keep their names
+	paths map[string]string
+}
+
+type fileStat struct {
+	size    int64
+	modTime time.Time
+}
+
+var _ contracts.Storage = (*Storage)(nil)
+
+// Open opens the file tree rooted at dir, creating the directory if needed,
+// and loads it into the index.
+func Open(dir string) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	s := &Storage{root: dir, index: memory.NewStorage()}
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Root returns the directory of the tree.
+func (s *Storage) Root() string {
+	return s.root
+}
+
+// InitDefaultSpaces adds the default spaces if they don't exist.
+func (s *Storage) InitDefaultSpaces(ctx context.Context) error {
+	return s.write(func() error {
+		return s.index.InitDefaultSpaces(ctx)
+	})
+}
+
+// ==================== Pattern Operations ====================
+
+func (s *Storage) SavePattern(ctx context.Context, p *models.Pattern) error {
+	if err := checkNames(p.ID, p.SpaceID); err != nil {
+		return err
+	}
+	return s.write(func() error {
+		return s.index.SavePattern(ctx, p)
+	})
+}
+
+func (s *Storage) GetPattern(ctx context.Context, id string) (*models.Pattern, error) {
+	return read(s, func() (*models.Pattern, error) {
+		return s.index.GetPattern(ctx, id)
+	})
+}
+
+func (s *Storage) ListPatterns(ctx context.Context, opts contracts.ListOptions) ([]*models.Pattern, error) {
+	return read(s, func() ([]*models.Pattern, error) {
+		return s.index.ListPatterns(ctx, opts)
+	})
+}
+
+func (s *Storage) DeletePattern(ctx context.Context, id string) error {
+	return s.write(func() error {
+		return s.index.DeletePattern(ctx, id)
+	})
+}
+
+func (s *Storage) MovePatternToSpace(ctx context.Context, patternID, newSpaceID string) error {
+	if err := checkNames(newSpaceID); err != nil {
+		return err
+	}
+	return s.write(func() error {
+		return s.index.MovePatternToSpace(ctx, patternID, newSpaceID)
+	})
+}
+
+func (s *Storage) UpdatePattern(ctx context.Context, p *models.Pattern) error {
+	return s.write(func() error {
+		return s.index.UpdatePattern(ctx, p)
+	})
+}
+
+func (s *Storage) GetPatternByTrigger(ctx context.Context, trigger string) (*models.Pattern, error) {
+	return read(s, func() (*models.Pattern, error) {
+		return s.index.GetPatternByTrigger(ctx, trigger)
+	})
+}
+
+func (s *Storage) CountPatterns(ctx context.Context, opts contracts.ListOptions) (int, error) {
+	return read(s, func() (int, error) {
+		return s.index.CountPatterns(ctx, opts)
+	})
+}
+
+func (s *Storage) GetRecentlyUsedPatterns(ctx context.Context, limit int) ([]*models.Pattern, error) {
+	return read(s, func() ([]*models.Pattern, error) {
+		return s.index.GetRecentlyUsedPatterns(ctx, limit)
+	})
+}
+
+func (s *Storage) SearchPatterns(ctx context.Context, query string, opts contracts.ListOptions) ([]*models.Pattern, error) {
+	return read(s, func() ([]*models.Pattern, error) {
+		return s.index.SearchPatterns(ctx, query, opts)
+	})
+}
+
+func (s *Storage) GetTopPatterns(ctx context.Context, limit int) ([]*models.Pattern, error) {
+	return read(s, func() ([]*models.Pattern, error) {
+		return s.index.GetTopPatterns(ctx, limit)
+	})
+}
+
+// ==================== Batch Operations ====================
+
+func (s *Storage) SavePatternsBatch(ctx context.Context, patterns []*models.Pattern) error {
+	for _, p := range patterns {
+		if err := checkNames(p.ID, p.SpaceID); err != nil {
+			return err
+		}
+	}
+	return s.write(func() error {
+		return s.index.SavePatternsBatch(ctx, patterns)
+	})
+}
+
+func (s *Storage) DeletePatternsBatch(ctx context.Context, ids []string) error {
+	return s.write(func() error {
+		return s.index.DeletePatternsBatch(ctx, ids)
+	})
+}
+
+func (s *Storage) UpdatePatternsBatch(ctx context.Context, patterns []*models.Pattern) error {
+	return s.write(func() error {
+		return s.index.UpdatePatternsBatch(ctx, patterns)
+	})
+}
+
+// ==================== Space Operations ====================
+
+func (s *Storage) CreateSpace(ctx context.Context, space *models.Space) error {
+	if err := checkNames(space.ID); err != nil {
+		return err
+	}
+	return s.write(func() error {
+		return s.index.CreateSpace(ctx, space)
+	})
+}
+
+func (s *Storage) GetSpace(ctx context.Context, id string) (*models.Space, error) {
+	return read(s, func() (*models.Space, error) {
+		return s.index.GetSpace(ctx, id)
+	})
+}
+
+func (s *Storage) ListSpaces(ctx context.Context) ([]*models.Space, error) {
+	return read(s, func() ([]*models.Space, error) {
+		return s.index.ListSpaces(ctx)
+	})
+}
+
+func (s *Storage) UpdateSpace(ctx context.Context, space *models.Space) error {
+	return s.write(func() error {
+		return s.index.UpdateSpace(ctx, space)
+	})
+}
+
+// DeleteSpace removes a space's settings. Its patterns and notes stay in
+// the space directory, as they stay in the space in SQLite.
+func (s *Storage) DeleteSpace(ctx context.Context, id string) error {
+	return s.write(func() error {
+		return s.index.DeleteSpace(ctx, id)
+	})
+}
+
+func (s *Storage) SetDefaultSpace(ctx context.Context, id string) error {
+	return s.write(func() error {
+		return s.index.SetDefaultSpace(ctx, id)
+	})
+}
+
+func (s *Storage) GetDefaultSpace(ctx context.Context) (*models.Space, error) {
+	return read(s, func() (*models.Space, error) {
+		return s.index.GetDefaultSpace(ctx)
+	})
+}
+
+// ==================== Note Operations ====================
+
+// SaveNote creates or replaces a note. Notes without a space are kept in
+// the global space.
+func (s *Storage) SaveNote(ctx context.Context, note *models.Note) error {
+	if note.SpaceID == "" {
+		note.SpaceID = defaultSpaceID
+	}
+	if err := checkNames(note.ID, note.SpaceID); err != nil {
+		return err
+	}
+	return s.write(func() error {
+		return s.index.SaveNote(ctx, note)
+	})
+}
+
+func (s *Storage) GetNote(ctx context.Context, id string) (*models.Note, error) {
+	return read(s, func() (*models.Note, error) {
+		return s.index.GetNote(ctx, id)
+	})
+}
+
+func (s *Storage) ListNotes(ctx context.Context, opts contracts.ListOptions) ([]*models.Note, error) {
+	return read(s, func() ([]*models.Note, error) {
+		return s.index.ListNotes(ctx, opts)
+	})
+}
+
+func (s *Storage) DeleteNote(ctx context.Context, id string) error {
+	return s.write(func() error {
+		return s.index.DeleteNote(ctx, id)
+	})
+}
+
+func (s *Storage) UpdateNote(ctx context.Context, note *models.Note) error {
+	if note.SpaceID == "" {
+		note.SpaceID = defaultSpaceID
+	}
+	if err := checkNames(note.SpaceID); err != nil {
+		return err
+	}
+	return s.write(func() error {
+		return s.index.UpdateNote(ctx, note)
+	})
+}
+
+func (s *Storage) SearchNotes(ctx context.Context, query string, opts contracts.ListOptions) ([]*models.Note, error) {
+	return read(s, func() ([]*models.Note, error) {
+		return s.index.SearchNotes(ctx, query, opts)
+	})
+}
+
+// ==================== Transaction Support ====================
+
+// BeginTx starts a transaction on the index. It holds the storage until it
+// ends; the files are written once, on Commit or Rollback.
+func (s *Storage) BeginTx(ctx context.Context) (contracts.Transaction, error) {
+	s.mu.Lock()
+	if err := s.refresh(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	tx, err := s.index.BeginTx(ctx)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return &transaction{storage: s, tx: tx}, nil
+}
+
+// Close releases the storage. Every write is already on disk.
+func (s *Storage) Close() error {
+	return s.index.Close()
+}
+
+// transaction wraps an index transaction and holds storage.mu.
+type transaction struct {
+	storage *Storage
+	tx      contracts.Transaction
+}
+
+func (t *transaction) SavePattern(ctx context.Context, p *models.Pattern) error {
+	if err := checkNames(p.ID, p.SpaceID); err != nil {
+		return err
+	}
+	return t.tx.SavePattern(ctx, p)
+}
+
+func (t *transaction) DeletePattern(ctx context.Context, id string) error {
+	return t.tx.DeletePattern(ctx, id)
+}
+
+func (t *transaction) SaveNote(ctx context.Context, note *models.Note) error {
+	if note.SpaceID == "" {
+		note.SpaceID = defaultSpaceID
+	}
+	if err := checkNames(note.ID, note.SpaceID); err != nil {
+		return err
+	}
+	return t.tx.SaveNote(ctx, note)
+}
+
+func (t *transaction) DeleteNote(ctx context.Context, id string) error {
+	return t.tx.DeleteNote(ctx, id)
+}
+
+func (t *transaction) Commit() error {
+	return t.end(t.tx.Commit)
+}
+
+func (t *transaction) Rollback() error {
+	return t.end(t.tx.Rollback)
+}
+
+// end ends the index transaction and writes the files that changed.
+func (t *transaction) end(fn func() error) error {
+	if err := fn(); err != nil {
+		return err
+	}
+	defer t.storage.mu.Unlock()
+	return t.storage.flush()
+}
+
+// ==================== Sync with the tree ====================
+
+// read runs a query against the index once it is up to date.
+func read[T any](s *Storage, fn func() (T, error)) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return fn()
+}
+
+// write runs a change against the up-to-date index and writes it out.
+func (s *Storage) write(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// refresh reloads the index if files were added, removed or changed since
+// the last scan.
+func (s *Storage) refresh() error {
+	stats, err := s.scan()
+	if err != nil {
+		return err
+	}
+	if s.stats != nil && sameStats(stats, s.stats) {
+		return nil
+	}
+	return s.load(stats)
+}
+
+// scan stats every file of the layout under the root. Hidden files and
+// directories (such as .git and temporary files) are skipped.
+func (s *Storage) scan() (map[string]fileStat, error) {
+	stats := make(map[string]fileStat)
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.root, path)
+		if rel != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || kindOf(rel) == "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats[rel] = fileStat{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", s.root, err)
+	}
+	return stats, nil
+}
+
+// load parses every file in stats into the index.
+func (s *Storage) load(stats map[string]fileStat) error {
+	var (
+		patterns []*models.Pattern
+		spaces   []*models.Space
+		notes    []*models.Note
+		paths    = make(map[string]string)
+		rendered = make(map[string][sha256.Size]byte, len(stats))
+	)
+	files := make([]string, 0, len(stats))
+	for path := range stats {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(s.root, rel))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		spaceID, name := parts[0], parts[len(parts)-1]
+		modTime := stats[rel].modTime
+
+		var key string
+		var render []byte
+		switch kindOf(rel) {
+		case spaceFileName:
+			space, err := decodeSpace(data, spaceID, modTime)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", rel, err)
+			}
+			spaces = append(spaces, space)
+			render, err = encodeSpace(space)
+			if err != nil {
+				return err
+			}
+		case patternsDir:
+			p, err := decodePattern(data, spaceID, strings.TrimSuffix(name, patternExt), modTime)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", rel, err)
+			}
+			key = "pattern " + p.ID
+			patterns = append(patterns, p)
+			render, err = encodePattern(p)
+			if err != nil {
+				return err
+			}
+		case notesDir:
+			n, err := decodeNote(data, spaceID, strings.TrimSuffix(name, noteExt), modTime)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", rel, err)
+			}
+			key = "note " + n.ID
+			notes = append(notes, n)
+			render, err = encodeNote(n)
+			if err != nil {
+				return err
+			}
+		}
+		if key != "" {
+			if other, ok := paths[key]; ok {
+				return fmt.Errorf("duplicate %s in %s and %s", key, other, rel)
+			}
+			paths[key] = rel
+		}
+		// Items are written back only when they change, so hand-written
+		// files keep their formatting until edited through otr
+		rendered[rel] = sha256.Sum256(render)
+	}
+
+	s.index.Replace(patterns, spaces, notes)
+	s.stats = stats
+	s.rendered = rendered
+	s.paths = paths
+	return nil
+}
+
+// itemPath returns the file of an item: the one it was loaded from if it
+// is still in the item's space, or <space>/<dir>/<id><ext>.
+func (s *Storage) itemPath(key, spaceID, dir, id, ext string) string {
+	if rel, ok := s.paths[key]; ok && strings.Split(filepath.ToSlash(rel), "/")[0] == spaceID {
+		return rel
+	}
+	rel := filepath.Join(spaceID, dir, id+ext)
+	s.paths[key] = rel
+	return rel
+}
+
+// flush writes the files of items that changed and removes the files of
+// items that are gone.
+func (s *Storage) flush() error {
+	ctx := context.Background()
+	desired := make(map[string][]byte)
+
+	spaces, err := s.index.ListSpaces(ctx)
+	if err != nil {
+		return err
+	}
+	for _, space := range spaces {
+		data, err := encodeSpace(space)
+		if err != nil {
+			return err
+		}
+		desired[filepath.Join(space.ID, spaceFileName)] = data
+	}
+	patterns, err := s.index.ListPatterns(ctx, contracts.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		data, err := encodePattern(p)
+		if err != nil {
+			return err
+		}
+		desired[s.itemPath("pattern "+p.ID, p.SpaceID, patternsDir, p.ID, patternExt)] = data
+	}
+	notes, err := s.index.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, n := range notes {
+		data, err := encodeNote(n)
+		if err != nil {
+			return err
+		}
+		desired[s.itemPath("note "+n.ID, n.SpaceID, notesDir, n.ID, noteExt)] = data
+	}
+
+	// Remove stale files first, so a moved item can take over the name of
+	// a file that is going away
+	for rel := range s.rendered {
+		if _, ok := desired[rel]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.root, rel)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", rel, err)
+		}
+		delete(s.rendered, rel)
+		delete(s.stats, rel)
+		s.removeEmptyDirs(filepath.Dir(rel))
+	}
+
+	for rel, data := range desired {
+		sum := sha256.Sum256(data)
+		if old, ok := s.rendered[rel]; ok && old == sum {
+			continue
+		}
+		path := filepath.Join(s.root, rel)
+		if err := writeFileAtomic(path, data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		s.rendered[rel] = sum
+		s.stats[rel] = fileStat{size: info.Size(), modTime: info.ModTime()}
+	}
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents up to the root while they
+// are empty.
+func (s *Storage) removeEmptyDirs(dir string) {
+	for dir != "." && dir != "" {
+		if os.Remove(filepath.Join(s.root, dir)) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// kindOf returns what the file at rel holds in the layout: spaceFileName,
+// patternsDir or notesDir, or "" for files outside the layout.
+func kindOf(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	switch {
+	case len(parts) == 2 && parts[1] == spaceFileName:
+		return spaceFileName
+	case len(parts) == 3 && parts[1] == patternsDir && strings.HasSuffix(parts[2], patternExt):
+		return patternsDir
+	case len(parts) == 3 && parts[1] == notesDir && strings.HasSuffix(parts[2], noteExt):
+		return notesDir
+	}
+	return ""
+}
+
+// checkNames rejects IDs that can't be used as file or directory names.
+// Empty IDs are allowed; they are generated or defaulted later.
+func checkNames(names ...string) error {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("invalid name for file storage: %q", name)
+		}
+	}
+	return nil
+}
+
+func sameStats(a, b map[string]fileStat) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, st := range a {
+		if other, ok := b[path]; !ok || other.size != st.size || !other.modTime.Equal(st.modTime) {
+			return false
+		}
+	}
+	return true
+}
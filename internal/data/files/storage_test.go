@@ -0,0 +1,283 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/memory"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/storagetest"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func openTestStorage(t *testing.T, dir string) *Storage {
+	t.Helper()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) contracts.Storage {
+		return openTestStorage(t, t.TempDir())
+	})
+}
+
+func TestStorage_Layout(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStorage(t, dir)
+	ctx := context.Background()
+
+	if err := s.CreateSpace(ctx, &models.Space{ID: "work", Name: "Work"}); err != nil {
+		t.Fatalf("CreateSpace failed: %v", err)
+	}
+	p := models.NewPattern("deploy", "make release\nmake publish")
+	p.SpaceID = "work"
+	p.Tags = []string{"ops"}
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	n := models.NewNote("Release notes", "# v1\n\n- first")
+	n.AddPattern(p.ID)
+	if err := s.SaveNote(ctx, n); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "work", "space.yaml")); !strings.Contains(got, "name: Work\n") {
+		t.Errorf("unexpected space file:\n%s", got)
+	}
+	pattern := readFile(t, filepath.Join(dir, "work", "patterns", p.ID+".yaml"))
+	for _, want := range []string{"trigger: deploy\n", "response: |-\n  make release\n  make publish\n", "tags:\n  - ops\n"} {
+		if !strings.Contains(pattern, want) {
+			t.Errorf("pattern file misses %q:\n%s", want, pattern)
+		}
+	}
+	note := readFile(t, filepath.Join(dir, "global", "notes", n.ID+".md"))
+	if !strings.HasPrefix(note, "---\nid: "+n.ID+"\n") || !strings.HasSuffix(note, "---\n# v1\n\n- first\n") {
+		t.Errorf("unexpected note file:\n%s", note)
+	}
+
+	// Everything round-trips through a fresh open
+	reopened := openTestStorage(t, dir)
+	got, err := reopened.GetPattern(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetPattern after reopen failed: %v", err)
+	}
+	if got.Response != p.Response || got.SpaceID != "work" || got.Tags[0] != "ops" {
+		t.Errorf("pattern did not round-trip: %+v", got)
+	}
+	gotNote, err := reopened.GetNote(ctx, n.ID)
+	if err != nil {
+		t.Fatalf("GetNote after reopen failed: %v", err)
+	}
+	if gotNote.Content != n.Content || len(gotNote.PatternIDs) != 1 {
+		t.Errorf("note did not round-trip: %+v", gotNote)
+	}
+
+	// Deleting removes the file and the empty directories
+	if err := s.DeletePattern(ctx, p.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "work", "patterns")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty patterns directory to be removed, got %v", err)
+	}
+	if note := readFile(t, filepath.Join(dir, "global", "notes", n.ID+".md")); strings.Contains(note, p.ID) {
+		t.Error("expected the note to lose its link to the deleted pattern")
+	}
+}
+
+func TestStorage_WritesOnlyChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStorage(t, dir)
+	ctx := context.Background()
+
+	a := models.NewPattern("a", "1")
+	b := models.NewPattern("b", "2")
+	for _, p := range []*models.Pattern{a, b} {
+		if err := s.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	pathA := filepath.Join(dir, "global", "patterns", a.ID+".yaml")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(pathA, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Response = "changed"
+	if err := s.UpdatePattern(ctx, b); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	info, err := os.Stat(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Error("expected the unchanged pattern's file not to be rewritten")
+	}
+}
+
+func TestStorage_ExternalEdits(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStorage(t, dir)
+	ctx := context.Background()
+
+	p := models.NewPattern("greet", "hello")
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+
+	// Edit an existing file
+	path := filepath.Join(dir, "global", "patterns", p.ID+".yaml")
+	edited := strings.Replace(readFile(t, path), "response: hello", "response: hello there", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetPattern(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetPattern failed: %v", err)
+	}
+	if got.Response != "hello there" {
+		t.Errorf("expected the external edit to be picked up, got %q", got.Response)
+	}
+
+	// Add hand-written files: the file name is the default ID, and the
+	// defaults of a new pattern apply
+	handDir := filepath.Join(dir, "ops", "patterns")
+	if err := os.MkdirAll(handDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(handDir, "restart.yaml"), []byte("trigger: restart\nresponse: systemctl restart app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hand, err := s.GetPattern(ctx, "restart")
+	if err != nil {
+		t.Fatalf("GetPattern(restart) failed: %v", err)
+	}
+	if hand.SpaceID != "ops" || hand.Threshold != models.NewPattern("x", "y").Threshold {
+		t.Errorf("unexpected hand-written pattern: %+v", hand)
+	}
+
+	// The hand-written file keeps its content until it is edited through
+	// the storage, and then keeps its name
+	if err := s.SavePattern(ctx, models.NewPattern("other", "x")); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(handDir, "restart.yaml")); got != "trigger: restart\nresponse: systemctl restart app\n" {
+		t.Errorf("hand-written file was rewritten:\n%s", got)
+	}
+	hand.Strength = 70
+	if err := s.UpdatePattern(ctx, hand); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(handDir, "restart.yaml")); !strings.Contains(got, "strength: 70\n") {
+		t.Errorf("expected the update in restart.yaml:\n%s", got)
+	}
+
+	// Removing a file removes the pattern
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPattern(ctx, p.ID); err == nil {
+		t.Error("expected the pattern to go with its file")
+	}
+
+	// Broken files are reported with their path
+	if err := os.WriteFile(filepath.Join(handDir, "broken.yaml"), []byte("trigger: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ListPatterns(ctx, contracts.ListOptions{}); err == nil || !strings.Contains(err.Error(), "broken.yaml") {
+		t.Errorf("expected an error naming broken.yaml, got %v", err)
+	}
+}
+
+func TestStorage_RejectsUnsafeNames(t *testing.T) {
+	s := openTestStorage(t, t.TempDir())
+	ctx := context.Background()
+
+	p := models.NewPattern("x", "y")
+	p.SpaceID = "../outside"
+	if err := s.SavePattern(ctx, p); err == nil {
+		t.Error("expected a space ID with a path separator to be rejected")
+	}
+	if err := s.CreateSpace(ctx, &models.Space{ID: ".git", Name: "git"}); err == nil {
+		t.Error("expected a hidden space ID to be rejected")
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	dir := t.TempDir()
+	tree := openTestStorage(t, dir)
+	ctx := context.Background()
+
+	kept := models.NewPattern("kept", "1")
+	edited := models.NewPattern("edited", "2")
+	removed := models.NewPattern("removed", "3")
+	external := models.NewPattern("external", "4")
+	for _, p := range []*models.Pattern{kept, edited, removed, external} {
+		if err := tree.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	keptPath := filepath.Join(dir, "global", "patterns", kept.ID+".yaml")
+	keptBefore := readFile(t, keptPath)
+
+	work := memory.NewStorage()
+	checkout, err := tree.Checkout(ctx, work)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if n, _ := work.CountPatterns(ctx, contracts.ListOptions{}); n != 4 {
+		t.Fatalf("expected 4 patterns in the copy, got %d", n)
+	}
+
+	// Change the copy, and the tree behind its back
+	edited.Response = "changed in the copy"
+	if err := work.UpdatePattern(ctx, edited); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	if err := work.DeletePattern(ctx, removed.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	added := models.NewPattern("added", "5")
+	if err := work.SavePattern(ctx, added); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	extPath := filepath.Join(dir, "global", "patterns", external.ID+".yaml")
+	if err := os.WriteFile(extPath, []byte(strings.Replace(readFile(t, extPath), "response: \"4\"", "response: edited outside", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkout.Commit(ctx); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if got := readFile(t, keptPath); got != keptBefore {
+		t.Errorf("unchanged pattern was rewritten:\n%s\nwas:\n%s", got, keptBefore)
+	}
+	for id, want := range map[string]string{edited.ID: "changed in the copy", added.ID: "5", external.ID: "edited outside"} {
+		got, err := tree.GetPattern(ctx, id)
+		if err != nil || got.Response != want {
+			t.Errorf("GetPattern(%s) = %v, %v; want response %q", id, got, err, want)
+		}
+	}
+	if _, err := tree.GetPattern(ctx, removed.ID); err == nil {
+		t.Error("expected the pattern deleted in the copy to be removed")
+	}
+}
@@ -0,0 +1,763 @@
+// Package memory implements contracts.Storage in memory.
+// It is safe for concurrent use and behaves like the SQLite backend, so
+// tests and tools can use it without creating a database. Nothing is
+// persisted: all data is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+	"github.com/google/uuid"
+)
+
+// defaultSearchLimit caps SearchPatterns without a limit, as in SQLite.
+const defaultSearchLimit = 100
+
+// Storage is an in-memory contracts.Storage.
+type Storage struct {
+	mu    sync.RWMutex
+	state state
+}
+
+// state is everything the storage holds.
+type state struct {
+	patterns map[string]*models.Pattern
+	spaces   map[string]*models.Space
+	notes    map[string]*models.Note
+}
+
+var _ contracts.Storage = (*Storage)(nil)
+
+// NewStorage creates an empty in-memory storage.
+func NewStorage() *Storage {
+	return &Storage{state: newState()}
+}
+
+// InitDefaultSpaces adds the default spaces if they don't exist.
+func (s *Storage) InitDefaultSpaces(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, space := range models.DefaultSpaces() {
+		if _, ok := s.state.spaces[space.ID]; !ok {
+			s.state.spaces[space.ID] = space
+		}
+	}
+	return nil
+}
+
+// Replace swaps the whole content of the storage for the given items,
+// stored as they are: IDs, timestamps and tags are not touched. Backends
+// that keep their data elsewhere use it to load an index.
+func (s *Storage) Replace(patterns []*models.Pattern, spaces []*models.Space, notes []*models.Note) {
+	st := newState()
+	for _, p := range patterns {
+		st.patterns[p.ID] = clonePattern(p)
+	}
+	for _, space := range spaces {
+		st.spaces[space.ID] = cloneSpace(space)
+	}
+	for _, n := range notes {
+		st.notes[n.ID] = cloneNote(n)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = st
+}
+
+// ==================== Pattern Operations ====================
+
+// SavePattern creates or replaces a pattern.
+func (s *Storage) SavePattern(ctx context.Context, p *models.Pattern) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.savePattern(p, time.Now())
+	return nil
+}
+
+func (s *Storage) savePattern(p *models.Pattern, now time.Time) {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now
+	}
+	p.UpdatedAt = now
+	if p.SpaceID == "" {
+		p.SpaceID = "global"
+	}
+	p.Tags = models.NormalizeTags(p.Tags)
+	s.state.patterns[p.ID] = clonePattern(p)
+	if p.DeletedAt != nil {
+		s.unlinkPattern(p.ID)
+	}
+}
+
+// GetPattern retrieves a pattern by ID.
+func (s *Storage) GetPattern(ctx context.Context, id string) (*models.Pattern, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.state.patterns[id]
+	if !ok || p.DeletedAt != nil {
+		return nil, fmt.Errorf("pattern not found: %s", id)
+	}
+	return clonePattern(p), nil
+}
+
+// ListPatterns lists patterns matching opts, most recently updated first.
+func (s *Storage) ListPatterns(ctx context.Context, opts contracts.ListOptions) ([]*models.Pattern, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	patterns := s.filterPatterns(opts, nil)
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].UpdatedAt.After(patterns[j].UpdatedAt)
+	})
+	return page(patterns, opts.Offset, opts.Limit), nil
+}
+
+// DeletePattern soft deletes a pattern and removes its note links.
+func (s *Storage) DeletePattern(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletePattern(id, time.Now())
+	return nil
+}
+
+func (s *Storage) deletePattern(id string, now time.Time) {
+	if p, ok := s.state.patterns[id]; ok {
+		p.DeletedAt = &now
+	}
+	s.unlinkPattern(id)
+}
+
+// MovePatternToSpace moves a pattern to a different space.
+func (s *Storage) MovePatternToSpace(ctx context.Context, patternID, newSpaceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.state.patterns[patternID]; ok {
+		p.SpaceID = newSpaceID
+		p.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// UpdatePattern updates an existing pattern.
+func (s *Storage) UpdatePattern(ctx context.Context, p *models.Pattern) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.updatePattern(p, time.Now()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// updatePattern replaces the updatable fields; space, owner, creation
+// time and deletion are kept, as in SQLite.
+func (s *Storage) updatePattern(p *models.Pattern, now time.Time) error {
+	existing, ok := s.state.patterns[p.ID]
+	if !ok {
+		return fmt.Errorf("pattern not found: %s", p.ID)
+	}
+	p.UpdatedAt = now
+	p.Tags = models.NormalizeTags(p.Tags)
+	updated := clonePattern(p)
+	updated.SpaceID = existing.SpaceID
+	updated.UserID = existing.UserID
+	updated.CreatedAt = existing.CreatedAt
+	updated.DeletedAt = existing.DeletedAt
+	s.state.patterns[p.ID] = updated
+	return nil
+}
+
+// GetPatternByTrigger retrieves a pattern by its exact trigger.
+func (s *Storage) GetPatternByTrigger(ctx context.Context, trigger string) (*models.Pattern, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.state.patterns {
+		if p.DeletedAt == nil && p.Trigger == trigger {
+			return clonePattern(p), nil
+		}
+	}
+	return nil, fmt.Errorf("pattern not found with trigger: %s", trigger)
+}
+
+// CountPatterns counts the patterns matching opts (ignoring paging).
+func (s *Storage) CountPatterns(ctx context.Context, opts contracts.ListOptions) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.filterPatterns(opts, nil)), nil
+}
+
+// GetRecentlyUsedPatterns returns used patterns, most recently used first.
+func (s *Storage) GetRecentlyUsedPatterns(ctx context.Context, limit int) ([]*models.Pattern, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	patterns := s.filterPatterns(contracts.ListOptions{}, func(p *models.Pattern) bool {
+		return p.LastUsedAt != nil
+	})
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].LastUsedAt.After(*patterns[j].LastUsedAt)
+	})
+	return page(patterns, 0, limit), nil
+}
+
+// SearchPatterns finds patterns whose trigger or response contains query
+// (ignoring case), strongest first.
+func (s *Storage) SearchPatterns(ctx context.Context, query string, opts contracts.ListOptions) ([]*models.Pattern, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Tags are not a search filter, as in SQLite
+	opts.Tags = nil
+	patterns := s.filterPatterns(opts, func(p *models.Pattern) bool {
+		return containsFold(p.Trigger, query) || containsFold(p.Response, query)
+	})
+	sortByStrength(patterns)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	return page(patterns, 0, limit), nil
+}
+
+// GetTopPatterns returns the strongest patterns.
+func (s *Storage) GetTopPatterns(ctx context.Context, limit int) ([]*models.Pattern, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	patterns := s.filterPatterns(contracts.ListOptions{}, nil)
+	sortByStrength(patterns)
+	return page(patterns, 0, limit), nil
+}
+
+// filterPatterns returns copies of the live patterns matching opts (space,
+// project, strength and tags) and keep.
+func (s *Storage) filterPatterns(opts contracts.ListOptions, keep func(*models.Pattern) bool) []*models.Pattern {
+	var out []*models.Pattern
+	for _, p := range s.state.patterns {
+		switch {
+		case p.DeletedAt != nil && !opts.IncludeDeleted,
+			opts.SpaceID != "" && p.SpaceID != opts.SpaceID,
+			opts.Project != "" && p.Project != opts.Project,
+			opts.MinStrength > 0 && p.Strength < opts.MinStrength,
+			len(opts.Tags) > 0 && !hasTag(p.Tags, opts.Tags),
+			keep != nil && !keep(p):
+			continue
+		}
+		out = append(out, clonePattern(p))
+	}
+	// Map order is random; start from a stable order
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// ==================== Batch Operations ====================
+
+// SavePatternsBatch saves patterns atomically: nothing is saved if any
+// pattern is invalid.
+func (s *Storage) SavePatternsBatch(ctx context.Context, patterns []*models.Pattern) error {
+	for _, p := range patterns {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("validation failed for pattern %s: %w", p.ID, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, p := range patterns {
+		s.savePattern(p, now)
+	}
+	return nil
+}
+
+// DeletePatternsBatch soft deletes patterns.
+func (s *Storage) DeletePatternsBatch(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		s.deletePattern(id, now)
+	}
+	return nil
+}
+
+// UpdatePatternsBatch updates patterns atomically; unknown IDs are skipped.
+func (s *Storage) UpdatePatternsBatch(ctx context.Context, patterns []*models.Pattern) error {
+	for _, p := range patterns {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("validation failed for pattern %s: %w", p.ID, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, p := range patterns {
+		s.updatePattern(p, now)
+	}
+	return nil
+}
+
+// ==================== Space Operations ====================
+
+// CreateSpace creates or replaces a space.
+func (s *Storage) CreateSpace(ctx context.Context, space *models.Space) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if space.CreatedAt.IsZero() {
+		space.CreatedAt = now
+	}
+	space.UpdatedAt = now
+	s.state.spaces[space.ID] = cloneSpace(space)
+	return nil
+}
+
+// GetSpace retrieves a space by ID.
+func (s *Storage) GetSpace(ctx context.Context, id string) (*models.Space, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	space, ok := s.state.spaces[id]
+	if !ok {
+		return nil, fmt.Errorf("space not found: %s", id)
+	}
+	return cloneSpace(space), nil
+}
+
+// ListSpaces lists all spaces by name.
+func (s *Storage) ListSpaces(ctx context.Context) ([]*models.Space, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	spaces := make([]*models.Space, 0, len(s.state.spaces))
+	for _, space := range s.state.spaces {
+		spaces = append(spaces, cloneSpace(space))
+	}
+	sort.Slice(spaces, func(i, j int) bool {
+		if spaces[i].Name != spaces[j].Name {
+			return spaces[i].Name < spaces[j].Name
+		}
+		return spaces[i].ID < spaces[j].ID
+	})
+	return spaces, nil
+}
+
+// UpdateSpace updates an existing space; unknown spaces are ignored.
+func (s *Storage) UpdateSpace(ctx context.Context, space *models.Space) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.state.spaces[space.ID]
+	if !ok {
+		return nil
+	}
+	space.UpdatedAt = time.Now()
+	updated := cloneSpace(space)
+	updated.CreatedAt = existing.CreatedAt
+	s.state.spaces[space.ID] = updated
+	return nil
+}
+
+// DeleteSpace deletes a space by ID.
+func (s *Storage) DeleteSpace(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.spaces[id]; !ok {
+		return fmt.Errorf("space not found: %s", id)
+	}
+	delete(s.state.spaces, id)
+	return nil
+}
+
+// SetDefaultSpace makes id the only default space.
+func (s *Storage) SetDefaultSpace(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, space := range s.state.spaces {
+		space.DefaultSpace = space.ID == id
+	}
+	return nil
+}
+
+// GetDefaultSpace returns the default space, falling back to "global".
+func (s *Storage) GetDefaultSpace(ctx context.Context) (*models.Space, error) {
+	s.mu.RLock()
+	var def *models.Space
+	for _, space := range s.state.spaces {
+		if space.DefaultSpace && (def == nil || space.ID < def.ID) {
+			def = space
+		}
+	}
+	s.mu.RUnlock()
+	if def == nil {
+		return s.GetSpace(ctx, "global")
+	}
+	return cloneSpace(def), nil
+}
+
+// ==================== Note Operations ====================
+
+// SaveNote creates or replaces a note.
+func (s *Storage) SaveNote(ctx context.Context, note *models.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveNote(note, time.Now())
+	return nil
+}
+
+func (s *Storage) saveNote(note *models.Note, now time.Time) {
+	if note.ID == "" {
+		note.ID = uuid.New().String()
+	}
+	note.CalculateStats()
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	note.Tags = models.NormalizeTags(note.Tags)
+	if existing, ok := s.state.notes[note.ID]; ok {
+		// An upsert keeps the original creation time, as in SQLite
+		note.CreatedAt = existing.CreatedAt
+	}
+	s.state.notes[note.ID] = cloneNote(note)
+}
+
+// GetNote retrieves a note by ID.
+func (s *Storage) GetNote(ctx context.Context, id string) (*models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	note, ok := s.state.notes[id]
+	if !ok {
+		return nil, fmt.Errorf("note not found: %s", id)
+	}
+	return s.liveNote(note), nil
+}
+
+// ListNotes lists notes matching opts (Project filters the category),
+// pinned first, then most recently updated.
+func (s *Storage) ListNotes(ctx context.Context, opts contracts.ListOptions) ([]*models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	notes := s.filterNotes(opts, nil)
+	return page(notes, opts.Offset, opts.Limit), nil
+}
+
+// DeleteNote removes a note by ID.
+func (s *Storage) DeleteNote(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteNote(id)
+}
+
+func (s *Storage) deleteNote(id string) error {
+	if _, ok := s.state.notes[id]; !ok {
+		return fmt.Errorf("note not found")
+	}
+	delete(s.state.notes, id)
+	return nil
+}
+
+// UpdateNote updates an existing note, including its pattern links.
+func (s *Storage) UpdateNote(ctx context.Context, note *models.Note) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.state.notes[note.ID]
+	if !ok {
+		return fmt.Errorf("note not found")
+	}
+	note.CalculateStats()
+	note.UpdatedAt = time.Now()
+	note.Tags = models.NormalizeTags(note.Tags)
+	updated := cloneNote(note)
+	updated.CreatedAt = existing.CreatedAt
+	s.state.notes[note.ID] = updated
+	return nil
+}
+
+// SearchNotes finds notes whose title or content contains query
+// (ignoring case).
+func (s *Storage) SearchNotes(ctx context.Context, query string, opts contracts.ListOptions) ([]*models.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Only the space filter applies to search, as in SQLite
+	opts = contracts.ListOptions{SpaceID: opts.SpaceID, Limit: opts.Limit}
+	notes := s.filterNotes(opts, func(n *models.Note) bool {
+		return containsFold(n.Title, query) || containsFold(n.Content, query)
+	})
+	return page(notes, 0, opts.Limit), nil
+}
+
+// filterNotes returns copies of the notes matching opts and keep, pinned
+// first, then most recently updated.
+func (s *Storage) filterNotes(opts contracts.ListOptions, keep func(*models.Note) bool) []*models.Note {
+	var out []*models.Note
+	for _, n := range s.state.notes {
+		switch {
+		case opts.SpaceID != "" && n.SpaceID != opts.SpaceID,
+			opts.Project != "" && n.Category != opts.Project,
+			len(opts.Tags) > 0 && !hasTag(n.Tags, opts.Tags),
+			keep != nil && !keep(n):
+			continue
+		}
+		out = append(out, s.liveNote(n))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.IsPinned != b.IsPinned {
+			return a.IsPinned
+		}
+		if !a.UpdatedAt.Equal(b.UpdatedAt) {
+			return a.UpdatedAt.After(b.UpdatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return out
+}
+
+// liveNote copies a note, dropping links to deleted patterns.
+func (s *Storage) liveNote(n *models.Note) *models.Note {
+	out := cloneNote(n)
+	out.PatternIDs = nil
+	for _, id := range n.PatternIDs {
+		if p, ok := s.state.patterns[id]; !ok || p.DeletedAt == nil {
+			out.PatternIDs = append(out.PatternIDs, id)
+		}
+	}
+	return out
+}
+
+// unlinkPattern removes a deleted pattern from every note.
+func (s *Storage) unlinkPattern(id string) {
+	for _, n := range s.state.notes {
+		n.RemovePattern(id)
+	}
+}
+
+// ==================== Transaction Support ====================
+
+// BeginTx starts a transaction. Like SQLite's single connection, it holds
+// the storage until it ends: other operations wait for Commit or Rollback.
+// Rolling back restores the items the transaction wrote.
+func (s *Storage) BeginTx(ctx context.Context) (contracts.Transaction, error) {
+	s.mu.Lock()
+	return &transaction{
+		storage:  s,
+		patterns: make(map[string]*models.Pattern),
+		notes:    make(map[string]*models.Note),
+	}, nil
+}
+
+// Close releases the storage. It holds no resources, so this is a no-op.
+func (s *Storage) Close() error {
+	return nil
+}
+
+// transaction is an open transaction; it holds storage.mu. The undo log
+// keeps each item's value from before the transaction first wrote it, nil
+// for items that did not exist.
+type transaction struct {
+	storage  *Storage
+	patterns map[string]*models.Pattern
+	notes    map[string]*models.Note
+	done     bool
+}
+
+var errTxDone = fmt.Errorf("transaction has already been committed or rolled back")
+
+func (t *transaction) SavePattern(ctx context.Context, p *models.Pattern) error {
+	if t.done {
+		return errTxDone
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	t.keepPattern(p.ID)
+	if p.DeletedAt != nil {
+		t.keepLinkedNotes(p.ID)
+	}
+	t.storage.savePattern(p, time.Now())
+	return nil
+}
+
+func (t *transaction) DeletePattern(ctx context.Context, id string) error {
+	if t.done {
+		return errTxDone
+	}
+	t.keepPattern(id)
+	t.keepLinkedNotes(id)
+	t.storage.deletePattern(id, time.Now())
+	return nil
+}
+
+func (t *transaction) SaveNote(ctx context.Context, note *models.Note) error {
+	if t.done {
+		return errTxDone
+	}
+	if note.ID == "" {
+		note.ID = uuid.New().String()
+	}
+	t.keepNote(note.ID)
+	t.storage.saveNote(note, time.Now())
+	return nil
+}
+
+func (t *transaction) DeleteNote(ctx context.Context, id string) error {
+	if t.done {
+		return errTxDone
+	}
+	t.keepNote(id)
+	return t.storage.deleteNote(id)
+}
+
+func (t *transaction) Commit() error {
+	if t.done {
+		return errTxDone
+	}
+	t.done = true
+	t.storage.mu.Unlock()
+	return nil
+}
+
+func (t *transaction) Rollback() error {
+	if t.done {
+		return errTxDone
+	}
+	t.done = true
+	defer t.storage.mu.Unlock()
+	st := t.storage.state
+	for id, p := range t.patterns {
+		if p == nil {
+			delete(st.patterns, id)
+		} else {
+			st.patterns[id] = p
+		}
+	}
+	for id, n := range t.notes {
+		if n == nil {
+			delete(st.notes, id)
+		} else {
+			st.notes[id] = n
+		}
+	}
+	return nil
+}
+
+// keepPattern logs a pattern's value before the transaction's first
+// write to it.
+func (t *transaction) keepPattern(id string) {
+	if _, ok := t.patterns[id]; ok {
+		return
+	}
+	var before *models.Pattern
+	if p, ok := t.storage.state.patterns[id]; ok {
+		before = clonePattern(p)
+	}
+	t.patterns[id] = before
+}
+
+// keepNote logs a note's value before the transaction's first write to it.
+func (t *transaction) keepNote(id string) {
+	if _, ok := t.notes[id]; ok {
+		return
+	}
+	var before *models.Note
+	if n, ok := t.storage.state.notes[id]; ok {
+		before = cloneNote(n)
+	}
+	t.notes[id] = before
+}
+
+// keepLinkedNotes logs the notes linked to a pattern, which lose the link
+// when it is deleted.
+func (t *transaction) keepLinkedNotes(patternID string) {
+	for id, n := range t.storage.state.notes {
+		for _, linked := range n.PatternIDs {
+			if linked == patternID {
+				t.keepNote(id)
+				break
+			}
+		}
+	}
+}
+
+// ==================== Helpers ====================
+
+func newState() state {
+	return state{
+		patterns: make(map[string]*models.Pattern),
+		spaces:   make(map[string]*models.Space),
+		notes:    make(map[string]*models.Note),
+	}
+}
+
+func clonePattern(p *models.Pattern) *models.Pattern {
+	out := *p
+	out.Tags = append([]string(nil), p.Tags...)
+	out.Connections = append([]string(nil), p.Connections...)
+	out.LastUsedAt = cloneTime(p.LastUsedAt)
+	out.DeletedAt = cloneTime(p.DeletedAt)
+	return &out
+}
+
+func cloneNote(n *models.Note) *models.Note {
+	out := *n
+	out.Tags = append([]string(nil), n.Tags...)
+	out.PatternIDs = append([]string(nil), n.PatternIDs...)
+	out.LastViewed = cloneTime(n.LastViewed)
+	return &out
+}
+
+func cloneSpace(space *models.Space) *models.Space {
+	out := *space
+	return &out
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// sortByStrength orders patterns strongest first.
+func sortByStrength(patterns []*models.Pattern) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].Strength > patterns[j].Strength
+	})
+}
+
+// hasTag reports whether tags include any of filter or their descendants.
+func hasTag(tags, filter []string) bool {
+	for _, tag := range tags {
+		for _, f := range filter {
+			if f = models.NormalizeTag(f); f != "" && models.TagUnder(tag, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// page applies offset and limit (0 = no limit).
+func page[T any](items []T, offset, limit int) []T {
+	if offset > 0 {
+		if offset >= len(items) {
+			return nil
+		}
+		items = items[offset:]
+	}
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/storagetest"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) contracts.Storage {
+		return NewStorage()
+	})
+}
+
+func TestRollbackRestoresOwnWrites(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	kept := models.NewPattern("kept", "1")
+	if err := s.SavePattern(ctx, kept); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if err := tx.SavePattern(ctx, models.NewPattern("dropped", "2")); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	if err := tx.DeletePattern(ctx, kept.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	patterns, _ := s.ListPatterns(ctx, contracts.ListOptions{})
+	if len(patterns) != 1 || patterns[0].ID != kept.ID {
+		t.Errorf("expected only %q after rollback, got %d patterns", kept.Trigger, len(patterns))
+	}
+}
+
+func TestReturnedValuesAreCopies(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	p := models.NewPattern("trigger", "response")
+	p.Tags = []string{"a"}
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	p.Response = "changed"
+	got, _ := s.GetPattern(ctx, p.ID)
+	got.Tags[0] = "changed"
+
+	again, _ := s.GetPattern(ctx, p.ID)
+	if again.Response != "response" || again.Tags[0] != "a" {
+		t.Errorf("stored pattern was modified through a caller's copy: %+v", again)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p := models.NewPattern(fmt.Sprintf("t%d-%d", i, j), "r")
+				if err := s.SavePattern(ctx, p); err != nil {
+					t.Errorf("SavePattern failed: %v", err)
+					return
+				}
+				s.ListPatterns(ctx, contracts.ListOptions{Limit: 5})
+				s.SearchPatterns(ctx, "t", contracts.ListOptions{})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n, _ := s.CountPatterns(ctx, contracts.ListOptions{}); n != 400 {
+		t.Errorf("expected 400 patterns, got %d", n)
+	}
+}
@@ -0,0 +1,373 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/export"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+	"github.com/google/uuid"
+)
+
+// ==================== Archives ====================
+
+// ExportArchive reads the spaces, live patterns, notes and their links,
+// thought sessions and events into an archive. Encrypted content is
+// exported decrypted, so the storage must be unlocked.
+func (s *Storage) ExportArchive(ctx context.Context) (*export.Archive, error) {
+	if err := s.requireUnlocked(ctx); err != nil {
+		return nil, err
+	}
+	version, err := s.db.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a := &export.Archive{Manifest: export.ArchiveManifest{SchemaVersion: version}}
+
+	if a.Spaces, err = s.ListSpaces(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list spaces: %w", err)
+	}
+	if a.Patterns, err = s.ListPatterns(ctx, contracts.ListOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to list patterns: %w", err)
+	}
+	if a.Notes, err = s.ListNotes(ctx, contracts.ListOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	for _, n := range a.Notes {
+		for _, patternID := range n.PatternIDs {
+			a.NoteLinks = append(a.NoteLinks, export.NoteLink{NoteID: n.ID, PatternID: patternID})
+		}
+		n.PatternIDs = nil
+	}
+	if a.ThoughtSessions, err = s.ListThoughtSessionsSince(ctx, time.Time{}); err != nil {
+		return nil, fmt.Errorf("failed to list thought sessions: %w", err)
+	}
+	for _, sess := range a.ThoughtSessions {
+		nodes, err := s.ListThoughtNodesBySession(ctx, sess.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list thought nodes: %w", err)
+		}
+		a.ThoughtNodes = append(a.ThoughtNodes, nodes...)
+	}
+	if a.Events, err = s.listEvents(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *Storage) listEvents(ctx context.Context) ([]*models.Event, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT id, type, timestamp, payload, source, trace_id, pattern_id, user_id
+		FROM events ORDER BY timestamp
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		var e models.Event
+		var timestamp int64
+		var payload, source, traceID, patternID, userID sql.NullString
+		if err := rows.Scan(&e.ID, &e.Type, &timestamp, &payload, &source, &traceID, &patternID, &userID); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		e.Timestamp = time.Unix(timestamp, 0)
+		e.Payload, e.Source, e.TraceID = payload.String, source.String, traceID.String
+		e.PatternID, e.UserID = patternID.String, userID.String
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// checkEncryptedImport returns an error if the storage is locked and any
+// space that would be created from spaces is encrypted: its content would
+// be stored in plaintext.
+func (s *Storage) checkEncryptedImport(ctx context.Context, spaces []*models.Space) error {
+	if !s.Locked() {
+		return nil
+	}
+	for _, space := range spaces {
+		if !space.Encrypted {
+			continue
+		}
+		exists, err := rowExists(ctx, s.db.db, "spaces", space.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		reason := ErrLocked
+		if enabled, err := s.EncryptionEnabled(ctx); err != nil {
+			return err
+		} else if !enabled {
+			reason = ErrNoEncryption
+		}
+		return fmt.Errorf("space %s is encrypted in the archive and would be imported in plaintext (allow that with --allow-plaintext): %w", space.ID, reason)
+	}
+	return nil
+}
+
+// ArchiveImportOptions controls ImportArchive.
+type ArchiveImportOptions struct {
+	// NewIDs gives every imported item a new ID, so importing an archive
+	// twice makes two copies. Otherwise IDs are kept unless they are
+	// already taken.
+	NewIDs bool
+	// AllowPlaintext imports spaces that are encrypted in the archive
+	// unencrypted when the storage is locked. Without it such archives
+	// are rejected.
+	AllowPlaintext bool
+}
+
+// ArchiveImportResult counts what ImportArchive added.
+type ArchiveImportResult struct {
+	Spaces          int
+	Patterns        int
+	Notes           int
+	NoteLinks       int
+	ThoughtSessions int
+	ThoughtNodes    int
+	Events          int
+	// Remapped counts items that were given a new ID
+	Remapped int
+	// Unencrypted lists spaces that were encrypted in the archive but are
+	// imported in plaintext because the storage is locked (only with
+	// AllowPlaintext)
+	Unencrypted []string
+}
+
+// ImportArchive adds the contents of an archive in a single transaction,
+// keeping timestamps. Spaces are merged by ID; other items get new IDs
+// where needed (see ArchiveImportOptions) and references between them
+// follow. Archives from a newer schema are rejected, and so are new
+// encrypted spaces while the storage is locked, unless opts.AllowPlaintext.
+func (s *Storage) ImportArchive(ctx context.Context, a *export.Archive, opts ArchiveImportOptions) (*ArchiveImportResult, error) {
+	if a.Manifest.SchemaVersion > LatestSchemaVersion() {
+		return nil, fmt.Errorf("archive has schema version %d, newer than this version of otr supports (%d)",
+			a.Manifest.SchemaVersion, LatestSchemaVersion())
+	}
+	if !opts.AllowPlaintext {
+		if err := s.checkEncryptedImport(ctx, a.Spaces); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &ArchiveImportResult{}
+	s.mu.RLock()
+	locked := s.dataKey == nil
+	s.mu.RUnlock()
+
+	for _, space := range a.Spaces {
+		exists, err := rowExists(ctx, tx, "spaces", space.ID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+		encrypted := space.Encrypted
+		if encrypted && locked {
+			encrypted = false
+			result.Unencrypted = append(result.Unencrypted, space.ID)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO spaces (id, name, description, owner, is_default, pattern_limit, pattern_count, encrypted, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 0, ?, 0, ?, ?, ?)
+		`, space.ID, space.Name, space.Description, space.Owner, space.PatternLimit,
+			boolToInt(encrypted), space.CreatedAt.Unix(), space.UpdatedAt.Unix()); err != nil {
+			return nil, fmt.Errorf("failed to import space %s: %w", space.ID, err)
+		}
+		result.Spaces++
+	}
+
+	// New IDs are assigned up front, so references can point forward
+	ids := make(map[string]string)
+	assign := func(table, id string) error {
+		newID := id
+		exists, err := rowExists(ctx, tx, table, id)
+		if err != nil {
+			return err
+		}
+		if opts.NewIDs || exists || id == "" {
+			newID = uuid.New().String()
+			result.Remapped++
+		}
+		ids[table+":"+id] = newID
+		return nil
+	}
+	mapped := func(table, id string) string {
+		if newID, ok := ids[table+":"+id]; ok {
+			return newID
+		}
+		return id
+	}
+	for _, p := range a.Patterns {
+		if err := assign("patterns", p.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range a.Notes {
+		if err := assign("notes", n.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, sess := range a.ThoughtSessions {
+		if err := assign("thought_sessions", sess.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, node := range a.ThoughtNodes {
+		if err := assign("thought_nodes", node.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range a.Events {
+		if err := assign("events", e.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, orig := range a.Patterns {
+		p := *orig
+		p.ID = mapped("patterns", orig.ID)
+		if p.SpaceID == "" {
+			p.SpaceID = "global"
+		}
+		p.Tags = models.NormalizeTags(p.Tags)
+		p.Connections = nil
+		for _, id := range orig.Connections {
+			p.Connections = append(p.Connections, mapped("patterns", id))
+		}
+		connections, _ := json.Marshal(p.Connections)
+		tags, _ := json.Marshal(p.Tags)
+		sealed, err := s.seal(ctx, tx, p.SpaceID, p.ID, fieldPatternResponse, p.Response)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO patterns (
+				id, trigger, response, strength, threshold, decay_rate, decay_enabled,
+				connections, created_at, updated_at, reinforcement_count, decay_count,
+				last_used_at, tags, project, user_id, space_id, deleted_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			p.ID, p.Trigger, sealed[0], p.Strength, p.Threshold, p.DecayRate, p.DecayEnabled,
+			string(connections), p.CreatedAt.Unix(), p.UpdatedAt.Unix(), p.ReinforceCnt, p.DecayCnt,
+			int64TimeToPtr(p.LastUsedAt), string(tags), p.Project, p.UserID, p.SpaceID, int64TimeToPtr(p.DeletedAt),
+		); err != nil {
+			return nil, fmt.Errorf("failed to import pattern %s: %w", orig.ID, err)
+		}
+		if err := syncPatternTaggings(ctx, tx, &p); err != nil {
+			return nil, err
+		}
+		result.Patterns++
+	}
+
+	for _, orig := range a.Notes {
+		n := *orig
+		n.ID = mapped("notes", orig.ID)
+		n.Tags = models.NormalizeTags(n.Tags)
+		n.CalculateStats()
+		tags, _ := json.Marshal(n.Tags)
+		sealed, err := s.seal(ctx, tx, n.SpaceID, n.ID, fieldNoteTitle, n.Title, fieldNoteContent, n.Content)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO notes (id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, n.ID, sealed[0], sealed[1], n.SpaceID, string(tags), n.IsPinned, n.Category,
+			n.WordCount, n.CharCount, int64TimeToPtr(n.LastViewed), n.CreatedAt.Unix(), n.UpdatedAt.Unix()); err != nil {
+			return nil, fmt.Errorf("failed to import note %s: %w", orig.ID, err)
+		}
+		if err := syncTaggings(ctx, tx, tagItemNote, n.ID, n.Tags); err != nil {
+			return nil, err
+		}
+		result.Notes++
+	}
+
+	// Links to patterns that are neither in the archive nor stored are
+	// dropped
+	now := time.Now().Unix()
+	for _, link := range a.NoteLinks {
+		patternID := mapped("patterns", link.PatternID)
+		exists, err := rowExists(ctx, tx, "patterns", patternID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO note_patterns (note_id, pattern_id, created_at) VALUES (?, ?, ?)
+		`, mapped("notes", link.NoteID), patternID, now); err != nil {
+			return nil, fmt.Errorf("failed to import note link: %w", err)
+		}
+		result.NoteLinks++
+	}
+
+	for _, sess := range a.ThoughtSessions {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO thought_sessions (id, title, created_at, updated_at) VALUES (?, ?, ?, ?)
+		`, mapped("thought_sessions", sess.ID), sess.Title, sess.CreatedAt.Unix(), sess.UpdatedAt.Unix()); err != nil {
+			return nil, fmt.Errorf("failed to import thought session %s: %w", sess.ID, err)
+		}
+		result.ThoughtSessions++
+	}
+	for _, node := range a.ThoughtNodes {
+		parentID := ""
+		if node.ParentID != "" {
+			parentID = mapped("thought_nodes", node.ParentID)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO thought_nodes (id, session_id, parent_id, text, created_at) VALUES (?, ?, ?, ?, ?)
+		`, mapped("thought_nodes", node.ID), mapped("thought_sessions", node.SessionID),
+			nullIfEmpty(parentID), node.Text, node.CreatedAt.Unix()); err != nil {
+			return nil, fmt.Errorf("failed to import thought node %s: %w", node.ID, err)
+		}
+		result.ThoughtNodes++
+	}
+
+	for _, e := range a.Events {
+		patternID := ""
+		if e.PatternID != "" {
+			patternID = mapped("patterns", e.PatternID)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO events (id, type, timestamp, payload, source, trace_id, pattern_id, user_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, mapped("events", e.ID), e.Type, e.Timestamp.Unix(), nullIfEmpty(e.Payload), nullIfEmpty(e.Source),
+			nullIfEmpty(e.TraceID), nullIfEmpty(patternID), nullIfEmpty(e.UserID)); err != nil {
+			return nil, fmt.Errorf("failed to import event %s: %w", e.ID, err)
+		}
+		result.Events++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return result, nil
+}
+
+// rowExists reports whether table has a row with id.
+func rowExists(ctx context.Context, ex execer, table, id string) (bool, error) {
+	rows, err := ex.QueryContext(ctx, `SELECT 1 FROM `+table+` WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
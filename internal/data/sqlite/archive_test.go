@@ -0,0 +1,221 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// seedArchiveData fills s with one of every kind of item an archive holds.
+func seedArchiveData(t *testing.T, s *Storage) (*models.Pattern, *models.Note, *models.ThoughtSession) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.CreateSpace(ctx, &models.Space{ID: "work", Name: "Work", Description: "day job"}); err != nil {
+		t.Fatalf("CreateSpace failed: %v", err)
+	}
+	a := models.NewPattern("deploy", "make release")
+	a.SpaceID = "work"
+	a.Tags = []string{"ops"}
+	a.CreatedAt = time.Unix(1000, 0)
+	b := models.NewPattern("rollback", "make rollback")
+	b.Connections = []string{a.ID}
+	for _, p := range []*models.Pattern{a, b} {
+		if err := s.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	n := models.NewNote("Runbook", "deploy, then watch")
+	n.SpaceID = "work"
+	n.AddPattern(a.ID)
+	if err := s.SaveNote(ctx, n); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	sess := models.NewThoughtSession("incident")
+	if err := s.CreateThoughtSession(ctx, sess); err != nil {
+		t.Fatalf("CreateThoughtSession failed: %v", err)
+	}
+	root := models.NewThoughtNode(sess.ID, "", "what broke?")
+	child := models.NewThoughtNode(sess.ID, root.ID, "the deploy")
+	for _, node := range []*models.ThoughtNode{root, child} {
+		if err := s.AddThoughtNode(ctx, node); err != nil {
+			t.Fatalf("AddThoughtNode failed: %v", err)
+		}
+	}
+	if _, err := s.db.db.Exec(`INSERT INTO events (id, type, timestamp, pattern_id) VALUES ('e1', 'pattern.used', 100, ?)`, a.ID); err != nil {
+		t.Fatalf("failed to insert event: %v", err)
+	}
+	return a, n, sess
+}
+
+func TestArchive_RoundTrip(t *testing.T) {
+	src, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	p, n, sess := seedArchiveData(t, src)
+
+	a, err := src.ExportArchive(ctx)
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+	if len(a.Patterns) != 2 || len(a.NoteLinks) != 1 || len(a.ThoughtNodes) != 2 || len(a.Events) != 1 {
+		t.Fatalf("unexpected archive contents: %d patterns, %d links, %d nodes, %d events",
+			len(a.Patterns), len(a.NoteLinks), len(a.ThoughtNodes), len(a.Events))
+	}
+
+	dst, cleanup2 := setupTestDB(t)
+	defer cleanup2()
+	result, err := dst.ImportArchive(ctx, a, ArchiveImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+	if result.Remapped != 0 || result.Patterns != 2 || result.Notes != 1 || result.Events != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// IDs, timestamps, tags and links survive
+	got, err := dst.GetPattern(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetPattern failed: %v", err)
+	}
+	if !got.CreatedAt.Equal(time.Unix(1000, 0)) || got.SpaceID != "work" || len(got.Tags) != 1 {
+		t.Errorf("pattern did not round-trip: %+v", got)
+	}
+	if tagged, _ := dst.ListPatterns(ctx, contracts.ListOptions{Tags: []string{"ops"}}); len(tagged) != 1 {
+		t.Error("expected the imported tags to be indexed")
+	}
+	gotNote, err := dst.GetNote(ctx, n.ID)
+	if err != nil || len(gotNote.PatternIDs) != 1 || gotNote.PatternIDs[0] != p.ID {
+		t.Fatalf("note links did not round-trip: %+v, %v", gotNote, err)
+	}
+	nodes, err := dst.ListThoughtNodesBySession(ctx, sess.ID)
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("thought nodes did not round-trip: %v, %v", nodes, err)
+	}
+	if space, err := dst.GetSpace(ctx, "work"); err != nil || space.Description != "day job" {
+		t.Errorf("space did not round-trip: %+v, %v", space, err)
+	}
+}
+
+func TestArchive_ImportRemapsIDs(t *testing.T) {
+	s, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	p, n, sess := seedArchiveData(t, s)
+
+	a, err := s.ExportArchive(ctx)
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	// Importing into the same database makes copies with new IDs whose
+	// references point at each other, not at the originals
+	result, err := s.ImportArchive(ctx, a, ArchiveImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+	if result.Spaces != 0 || result.Remapped != 2+1+1+2+1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	copies, err := s.ListPatterns(ctx, contracts.ListOptions{})
+	if err != nil || len(copies) != 4 {
+		t.Fatalf("expected 4 patterns, got %d (%v)", len(copies), err)
+	}
+	var deployCopy, rollbackCopy *models.Pattern
+	for _, c := range copies {
+		switch {
+		case c.Trigger == "deploy" && c.ID != p.ID:
+			deployCopy = c
+		case c.Trigger == "rollback" && len(c.Connections) == 1 && c.Connections[0] != p.ID:
+			rollbackCopy = c
+		}
+	}
+	if deployCopy == nil || rollbackCopy == nil || rollbackCopy.Connections[0] != deployCopy.ID {
+		t.Fatalf("expected the copied connection to point at the copied pattern: %+v %+v", deployCopy, rollbackCopy)
+	}
+
+	notes, err := s.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil || len(notes) != 2 {
+		t.Fatalf("expected 2 notes, got %d (%v)", len(notes), err)
+	}
+	for _, note := range notes {
+		if note.ID != n.ID && (len(note.PatternIDs) != 1 || note.PatternIDs[0] != deployCopy.ID) {
+			t.Errorf("expected the copied note to link the copied pattern, got %v", note.PatternIDs)
+		}
+	}
+
+	sessions, err := s.ListThoughtSessionsSince(ctx, time.Time{})
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d (%v)", len(sessions), err)
+	}
+	for _, other := range sessions {
+		if other.ID == sess.ID {
+			continue
+		}
+		nodes, err := s.ListThoughtNodesBySession(ctx, other.ID)
+		if err != nil || len(nodes) != 2 || nodes[1].ParentID != nodes[0].ID {
+			t.Errorf("expected the copied nodes to keep their tree: %v, %v", nodes, err)
+		}
+	}
+}
+
+func TestArchive_RejectsNewerSchema(t *testing.T) {
+	s, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	a, err := s.ExportArchive(ctx)
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+	a.Manifest.SchemaVersion = LatestSchemaVersion() + 1
+	if _, err := s.ImportArchive(ctx, a, ArchiveImportOptions{}); err == nil {
+		t.Error("expected an archive from a newer schema to be rejected")
+	}
+}
+
+func TestArchive_LockedImportOfEncryptedSpace(t *testing.T) {
+	src := setupEncryptedDB(t)
+	ctx := context.Background()
+	p := models.NewPattern("vpn", "password: hunter2")
+	p.SpaceID = "work"
+	if err := src.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	a, err := src.ExportArchive(ctx)
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	// Without a passphrase, and with one but locked, the import is refused
+	dst, cleanup := setupTestDB(t)
+	defer cleanup()
+	if _, err := dst.ImportArchive(ctx, a, ArchiveImportOptions{}); !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("expected ErrNoEncryption, got %v", err)
+	}
+	if _, err := dst.Rekey(ctx, "other"); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	locked := NewStorage(dst.db)
+	if _, err := locked.ImportArchive(ctx, a, ArchiveImportOptions{}); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	if patterns, _ := locked.ListPatterns(ctx, contracts.ListOptions{}); len(patterns) != 0 {
+		t.Fatalf("expected nothing imported, got %d patterns", len(patterns))
+	}
+
+	result, err := locked.ImportArchive(ctx, a, ArchiveImportOptions{AllowPlaintext: true})
+	if err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+	if len(result.Unencrypted) != 1 || result.Unencrypted[0] != "work" {
+		t.Errorf("expected work reported as unencrypted, got %v", result.Unencrypted)
+	}
+	if got := storedValue(t, locked, `SELECT response FROM patterns WHERE id = ?`, p.ID); got != p.Response {
+		t.Errorf("expected the allowed plaintext import, got %q", got)
+	}
+}
@@ -0,0 +1,256 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	msqlite "modernc.org/sqlite"
+)
+
+// ==================== Backup and Restore ====================
+
+// BackupInfo describes a database snapshot.
+type BackupInfo struct {
+	Path          string
+	Size          int64
+	CreatedAt     time.Time
+	SchemaVersion int
+	Patterns      int
+	Notes         int
+	Spaces        int
+}
+
+// Snapshots written to a backup directory are named otr-<time>.db, so
+// their names sort by age.
+const (
+	snapshotPrefix = "otr-"
+	snapshotExt    = ".db"
+	snapshotLayout = "20060102-150405"
+)
+
+// SnapshotPath returns the path of a snapshot taken at t in dir.
+func SnapshotPath(dir string, t time.Time) string {
+	return filepath.Join(dir, snapshotPrefix+t.Format(snapshotLayout)+snapshotExt)
+}
+
+// labelledSnapshotPath is SnapshotPath with a label saying why the
+// snapshot was taken. It sorts after a plain snapshot of the same second.
+func labelledSnapshotPath(dir string, t time.Time, label string) string {
+	return filepath.Join(dir, snapshotPrefix+t.Format(snapshotLayout)+"."+label+snapshotExt)
+}
+
+// Snapshot writes a consistent copy of the live database to path with
+// VACUUM INTO and verifies it. The copy only appears at path once it is
+// complete; an existing file is not overwritten.
+func (d *Database) Snapshot(ctx context.Context, path string) (*BackupInfo, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup already exists: %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := d.db.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	if _, err := VerifyBackup(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to save backup: %w", err)
+	}
+	return VerifyBackup(ctx, path)
+}
+
+// VerifyBackup opens a snapshot read-only, checks its integrity and reads
+// its schema version and item counts.
+func VerifyBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	dsn := url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return nil, fmt.Errorf("failed to check backup %s: %w", path, err)
+	}
+	if result != "ok" {
+		return nil, fmt.Errorf("backup %s is corrupt: %s", path, result)
+	}
+
+	info := &BackupInfo{Path: path, Size: stat.Size(), CreatedAt: stat.ModTime()}
+	for _, c := range []struct {
+		table string
+		n     *int
+	}{{"patterns", &info.Patterns}, {"notes", &info.Notes}, {"spaces", &info.Spaces}} {
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+c.table).Scan(c.n); err != nil {
+			return nil, fmt.Errorf("%s is not an otr database: %w", path, err)
+		}
+	}
+	// Databases from before versioned migrations have no schema_migrations
+	var hasVersions int
+	if err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'
+	`).Scan(&hasVersions); err != nil {
+		return nil, fmt.Errorf("failed to read backup schema: %w", err)
+	}
+	if hasVersions > 0 {
+		if err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+		`).Scan(&info.SchemaVersion); err != nil {
+			return nil, fmt.Errorf("failed to read backup schema version: %w", err)
+		}
+	}
+	return info, nil
+}
+
+// Restore replaces the database's contents with the snapshot at path,
+// using SQLite's online backup API. The snapshot is verified first and
+// the current database is snapshotted into dir, which is then rotated
+// down to keep snapshots; the path of that copy is returned. Snapshots
+// from older schema versions are brought up to date by the next
+// migration.
+func (d *Database) Restore(ctx context.Context, path, dir string, keep int) (*BackupInfo, string, error) {
+	info, err := VerifyBackup(ctx, path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.SchemaVersion > LatestSchemaVersion() {
+		return nil, "", fmt.Errorf("backup has schema version %d, newer than this version of otr supports (%d)",
+			info.SchemaVersion, LatestSchemaVersion())
+	}
+
+	var previous string
+	if d.path != "" && !strings.Contains(d.path, ":memory:") {
+		previous = labelledSnapshotPath(dir, time.Now(), "pre-restore")
+		if _, err := d.Snapshot(ctx, previous); err != nil {
+			return nil, "", err
+		}
+	}
+
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, previous, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+	err = conn.Raw(func(driverConn interface{}) error {
+		r, ok := driverConn.(interface {
+			NewRestore(string) (*msqlite.Backup, error)
+		})
+		if !ok {
+			return fmt.Errorf("driver does not support restore")
+		}
+		b, err := r.NewRestore(path)
+		if err != nil {
+			return err
+		}
+		for more := true; more; {
+			if more, err = b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+		}
+		return b.Finish()
+	})
+	if err != nil {
+		return nil, previous, fmt.Errorf("failed to restore database: %w", err)
+	}
+	// Rotate only now: the snapshot restored from may be one of the oldest
+	if _, err := RotateBackups(dir, keep); err != nil {
+		return info, previous, fmt.Errorf("restored, but %w", err)
+	}
+	return info, previous, nil
+}
+
+// ListBackups returns the snapshots in dir, newest first. Only file
+// information is filled in; see VerifyBackup.
+func ListBackups(dir string) ([]*BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []*BackupInfo
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+			continue
+		}
+		stat, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups: %w", err)
+		}
+		backups = append(backups, &BackupInfo{
+			Path:      filepath.Join(dir, name),
+			Size:      stat.Size(),
+			CreatedAt: stat.ModTime(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Path > backups[j].Path })
+	return backups, nil
+}
+
+// RotateBackups removes all but the newest keep snapshots in dir and
+// returns the removed paths. keep <= 0 keeps everything.
+func RotateBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			return removed, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		removed = append(removed, backups[i].Path)
+	}
+	return removed, nil
+}
+
+// AutoBackup takes a snapshot in dir if the newest one is older than
+// interval, then rotates the directory down to keep snapshots. It returns
+// nil if no snapshot was due. In-memory databases are never backed up.
+func (d *Database) AutoBackup(ctx context.Context, dir string, interval time.Duration, keep int) (*BackupInfo, error) {
+	if interval <= 0 || d.path == "" || strings.Contains(d.path, ":memory:") {
+		return nil, nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if len(backups) > 0 && now.Sub(backups[0].CreatedAt) < interval {
+		return nil, nil
+	}
+	info, err := d.Snapshot(ctx, SnapshotPath(dir, now))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := RotateBackups(dir, keep); err != nil {
+		return info, err
+	}
+	return info, nil
+}
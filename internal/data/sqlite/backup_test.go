@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func TestDatabase_SnapshotAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDatabase(t, filepath.Join(dir, "otr.db"))
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	s := NewStorage(db)
+	kept := models.NewPattern("kept", "1")
+	if err := s.SavePattern(ctx, kept); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+
+	backups := filepath.Join(dir, "backups")
+	path := SnapshotPath(backups, time.Now())
+	info, err := db.Snapshot(ctx, path)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if info.Patterns != 1 || info.SchemaVersion != LatestSchemaVersion() {
+		t.Errorf("unexpected snapshot info: %+v", info)
+	}
+	if _, err := db.Snapshot(ctx, path); err == nil {
+		t.Error("expected an existing snapshot not to be overwritten")
+	}
+
+	// Changes after the snapshot are undone by the restore
+	if err := s.SavePattern(ctx, models.NewPattern("later", "2")); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	if err := s.DeletePattern(ctx, kept.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	_, previous, err := db.Restore(ctx, path, backups, 1)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if filepath.Dir(previous) != backups {
+		t.Errorf("expected the current database to be backed up into %s, got %q", backups, previous)
+	}
+	// The pre-restore snapshot is rotated with the others, and kept as
+	// the newest
+	if list, _ := ListBackups(backups); len(list) != 1 || list[0].Path != previous {
+		t.Errorf("expected only the pre-restore snapshot to be kept, got %v", list)
+	}
+	if _, err := s.GetPattern(ctx, kept.ID); err != nil {
+		t.Errorf("expected the snapshot's pattern back: %v", err)
+	}
+	if _, err := s.GetPatternByTrigger(ctx, "later"); err == nil {
+		t.Error("expected the pattern saved after the snapshot to be gone")
+	}
+}
+
+func TestVerifyBackup_RejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database at all, just some text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBackup(ctx, garbage); err == nil {
+		t.Error("expected a non-database file to be rejected")
+	}
+
+	other := openTestDatabase(t, filepath.Join(dir, "other.db"))
+	if _, err := other.db.Exec(`CREATE TABLE unrelated (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBackup(ctx, filepath.Join(dir, "other.db")); err == nil {
+		t.Error("expected a database without otr tables to be rejected")
+	}
+
+	db := openTestDatabase(t, filepath.Join(dir, "otr.db"))
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if _, _, err := db.Restore(ctx, garbage, filepath.Join(dir, "backups"), 0); err == nil {
+		t.Error("expected Restore to refuse an unverified file")
+	}
+}
+
+func TestAutoBackupRotates(t *testing.T) {
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	db := openTestDatabase(t, filepath.Join(dir, "otr.db"))
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	// Three old snapshots, a day apart
+	for i := 3; i > 0; i-- {
+		at := time.Now().Add(-time.Duration(i) * 24 * time.Hour)
+		path := SnapshotPath(backups, at)
+		if _, err := db.Snapshot(ctx, path); err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := db.AutoBackup(ctx, backups, 12*time.Hour, 2)
+	if err != nil || info == nil {
+		t.Fatalf("expected a snapshot to be due, got %v, %v", info, err)
+	}
+	list, err := ListBackups(backups)
+	if err != nil || len(list) != 2 || list[0].Path != info.Path {
+		t.Fatalf("expected the 2 newest snapshots to be kept, got %v, %v", list, err)
+	}
+
+	if info, err := db.AutoBackup(ctx, backups, 12*time.Hour, 2); err != nil || info != nil {
+		t.Errorf("expected no snapshot right after one, got %v, %v", info, err)
+	}
+}
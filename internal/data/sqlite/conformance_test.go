@@ -0,0 +1,16 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/data/storagetest"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) contracts.Storage {
+		storage, cleanup := setupTestDB(t)
+		t.Cleanup(cleanup)
+		return storage
+	})
+}
@@ -0,0 +1,188 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== Conversation Operations ====================
+
+// CreateConversation inserts a new conversation.
+func (s *Storage) CreateConversation(ctx context.Context, conv *models.Conversation) error {
+	_, err := s.db.db.ExecContext(ctx, `
+		INSERT INTO conversations (id, session_id, title, space_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, conv.ID, nullIfEmpty(conv.SessionID), conv.Title, conv.SpaceID,
+		conv.CreatedAt.Unix(), conv.UpdatedAt.Unix())
+	return err
+}
+
+// GetConversation retrieves a conversation by ID.
+func (s *Storage) GetConversation(ctx context.Context, id string) (*models.Conversation, error) {
+	row := s.db.db.QueryRowContext(ctx, `
+		SELECT id, session_id, title, space_id, created_at, updated_at
+		FROM conversations WHERE id = ?
+	`, id)
+	conv, err := scanConversation(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("conversation not found: %s", id)
+	}
+	return conv, err
+}
+
+// GetLatestConversation returns the most recently active conversation or nil if none.
+func (s *Storage) GetLatestConversation(ctx context.Context) (*models.Conversation, error) {
+	row := s.db.db.QueryRowContext(ctx, `
+		SELECT id, session_id, title, space_id, created_at, updated_at
+		FROM conversations
+		ORDER BY updated_at DESC, rowid DESC
+		LIMIT 1
+	`)
+	conv, err := scanConversation(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return conv, err
+}
+
+// ListConversations lists conversations, most recently active first.
+func (s *Storage) ListConversations(ctx context.Context, limit int) ([]*models.Conversation, error) {
+	query := `
+		SELECT id, session_id, title, space_id, created_at, updated_at
+		FROM conversations
+		ORDER BY updated_at DESC, rowid DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var convs []*models.Conversation
+	for rows.Next() {
+		conv, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		convs = append(convs, conv)
+	}
+	return convs, rows.Err()
+}
+
+// DeleteConversation removes a conversation and its messages.
+func (s *Storage) DeleteConversation(ctx context.Context, id string) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM conversation_messages WHERE conversation_id = ?", id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM conversations WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+	return tx.Commit()
+}
+
+// AddConversationMessage appends a message and bumps the conversation's updated_at.
+func (s *Storage) AddConversationMessage(ctx context.Context, msg *models.ConversationMessage) error {
+	return s.AddConversationMessages(ctx, msg)
+}
+
+// AddConversationMessages appends messages in order and bumps their
+// conversations' updated_at, all in one transaction: either every message
+// is stored or none is, so a chat turn is never left half-written.
+func (s *Storage) AddConversationMessages(ctx context.Context, msgs ...*models.ConversationMessage) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	touched := make(map[string]bool)
+	for _, msg := range msgs {
+		attachmentsJSON, _ := json.Marshal(msg.Attachments)
+		patternIDsJSON, _ := json.Marshal(msg.PatternIDs)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO conversation_messages (id, conversation_id, role, content, attachments, pattern_ids, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, msg.ID, msg.ConversationID, msg.Role, msg.Content, attachmentsJSON, patternIDsJSON, msg.CreatedAt.Unix()); err != nil {
+			return err
+		}
+		touched[msg.ConversationID] = true
+	}
+	now := time.Now().Unix()
+	for id := range touched {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE conversations SET updated_at = ? WHERE id = ?
+		`, now, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListConversationMessages lists all messages of a conversation in order.
+func (s *Storage) ListConversationMessages(ctx context.Context, conversationID string) ([]*models.ConversationMessage, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT id, conversation_id, role, content, attachments, pattern_ids, created_at
+		FROM conversation_messages
+		WHERE conversation_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []*models.ConversationMessage
+	for rows.Next() {
+		var m models.ConversationMessage
+		var attachmentsJSON, patternIDsJSON []byte
+		var createdAt sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content,
+			&attachmentsJSON, &patternIDsJSON, &createdAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal(attachmentsJSON, &m.Attachments)
+		json.Unmarshal(patternIDsJSON, &m.PatternIDs)
+		m.CreatedAt = int64ToTime(createdAt)
+		msgs = append(msgs, &m)
+	}
+	return msgs, rows.Err()
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanConversation scans a conversation row.
+func scanConversation(row rowScanner) (*models.Conversation, error) {
+	var conv models.Conversation
+	var sessionID, title, spaceID sql.NullString
+	var createdAt, updatedAt sql.NullInt64
+	if err := row.Scan(&conv.ID, &sessionID, &title, &spaceID, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	conv.SessionID = sessionID.String
+	conv.Title = title.String
+	conv.SpaceID = spaceID.String
+	conv.CreatedAt = int64ToTime(createdAt)
+	conv.UpdatedAt = int64ToTime(updatedAt)
+	return &conv, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/ArmyClaw/open-think-reflex/pkg/models"
@@ -49,8 +50,16 @@ func NewDatabaseWithConfig(path string, config DatabaseConfig) (*Database, error
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	// Open database connection
-	db, err := sql.Open("sqlite", path)
+	// Open database connection. Other processes (a CLI command while the
+	// TUI is watching) wait for the lock instead of failing at once.
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+	dsn += "_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -111,121 +120,15 @@ func (d *Database) IsHealthy(ctx context.Context) bool {
 	return stats.InUse < stats.MaxOpenConnections
 }
 
-// Migrate runs database migrations
+// Migrate applies pending schema migrations up to the pinned version, or
+// all of them when none is pinned. See migrations.go.
 func (d *Database) Migrate(ctx context.Context) error {
-	migrations := []string{
-		// Patterns table
-		`CREATE TABLE IF NOT EXISTS patterns (
-			id TEXT PRIMARY KEY,
-			trigger TEXT NOT NULL,
-			response TEXT NOT NULL,
-			strength REAL NOT NULL DEFAULT 0,
-			threshold REAL NOT NULL DEFAULT 50,
-			decay_rate REAL NOT NULL DEFAULT 0.01,
-			decay_enabled INTEGER NOT NULL DEFAULT 1,
-			connections TEXT,
-			created_at INTEGER NOT NULL,
-			updated_at INTEGER NOT NULL,
-			reinforcement_count INTEGER NOT NULL DEFAULT 0,
-			decay_count INTEGER NOT NULL DEFAULT 0,
-			last_used_at INTEGER,
-			tags TEXT,
-			project TEXT,
-			user_id TEXT,
-			space_id TEXT DEFAULT 'global',
-			deleted_at INTEGER
-		)`,
-
-		// Spaces table
-		`CREATE TABLE IF NOT EXISTS spaces (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			description TEXT,
-			owner TEXT,
-			is_default INTEGER NOT NULL DEFAULT 0,
-			pattern_limit INTEGER NOT NULL DEFAULT 0,
-			pattern_count INTEGER NOT NULL DEFAULT 0,
-			created_at INTEGER NOT NULL,
-			updated_at INTEGER NOT NULL
-		)`,
-
-		// Events table (for audit/logging)
-		`CREATE TABLE IF NOT EXISTS events (
-			id TEXT PRIMARY KEY,
-			type TEXT NOT NULL,
-			timestamp INTEGER NOT NULL,
-			payload TEXT,
-			source TEXT,
-			trace_id TEXT,
-			pattern_id TEXT,
-			user_id TEXT
-		)`,
-
-		// Thought sessions
-		`CREATE TABLE IF NOT EXISTS thought_sessions (
-			id TEXT PRIMARY KEY,
-			title TEXT,
-			created_at INTEGER NOT NULL,
-			updated_at INTEGER NOT NULL
-		)`,
-
-		// Thought nodes
-		`CREATE TABLE IF NOT EXISTS thought_nodes (
-			id TEXT PRIMARY KEY,
-			session_id TEXT NOT NULL,
-			parent_id TEXT,
-			text TEXT NOT NULL,
-			created_at INTEGER NOT NULL
-		)`,
-
-		// Notes table (Phase 10: 思绪整理)
-		`CREATE TABLE IF NOT EXISTS notes (
-			id TEXT PRIMARY KEY,
-			title TEXT NOT NULL,
-			content TEXT NOT NULL,
-			space_id TEXT DEFAULT 'global',
-			tags TEXT,
-			is_pinned INTEGER NOT NULL DEFAULT 0,
-			category TEXT DEFAULT 'note',
-			word_count INTEGER NOT NULL DEFAULT 0,
-			char_count INTEGER NOT NULL DEFAULT 0,
-			last_viewed_at INTEGER,
-			created_at INTEGER NOT NULL,
-			updated_at INTEGER NOT NULL
-		)`,
-
-		// Indices - Basic
-		`CREATE INDEX IF NOT EXISTS idx_patterns_trigger ON patterns(trigger)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_strength ON patterns(strength)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_project ON patterns(project)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_tags ON patterns(tags)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_deleted ON patterns(deleted_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_events_type ON events(type)`,
-		`CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events(timestamp)`,
-
-		// Indices - Performance optimization (Iter 43)
-		`CREATE INDEX IF NOT EXISTS idx_patterns_last_used_at ON patterns(last_used_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_updated_at ON patterns(updated_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_project_deleted ON patterns(project, deleted_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_strength_threshold ON patterns(strength, threshold)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_decay_enabled ON patterns(decay_enabled)`,
-		`CREATE INDEX IF NOT EXISTS idx_patterns_space_id ON patterns(space_id)`,
-
-		// Notes indices (Phase 10)
-		`CREATE INDEX IF NOT EXISTS idx_notes_space_id ON notes(space_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_notes_category ON notes(category)`,
-		`CREATE INDEX IF NOT EXISTS idx_notes_is_pinned ON notes(is_pinned)`,
-		`CREATE INDEX IF NOT EXISTS idx_notes_created_at ON notes(created_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_notes_updated_at ON notes(updated_at)`,
-	}
-
-	for _, migration := range migrations {
-		if _, err := d.db.ExecContext(ctx, migration); err != nil {
-			return fmt.Errorf("migration failed: %w", err)
-		}
+	pinned, err := d.PinnedVersion(ctx)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	_, err = d.migrate(ctx, migrations, pinned)
+	return err
 }
 
 // InitDefaultSpaces initializes default spaces if they don't exist
@@ -0,0 +1,528 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ==================== Encryption at Rest ====================
+//
+// Pattern responses, note titles and note contents in encrypted spaces are
+// sealed with AES-256-GCM under a random data key. The data key is stored
+// in encryption_key, wrapped (AES-GCM again) with a key derived from the
+// passphrase by scrypt, so changing the passphrase never leaves the data
+// key in the clear. Sealed values carry a prefix, so reads decrypt them
+// whatever the space's current setting.
+
+// Encrypted field names. With the row ID they form the additional data,
+// so sealed values can't be swapped between fields or rows.
+const (
+	fieldPatternResponse = "pattern.response"
+	fieldNoteTitle       = "note.title"
+	fieldNoteContent     = "note.content"
+	fieldSyncSecret      = "sync.secret"
+)
+
+// sealedPrefix marks encrypted values; the version after it says what
+// additional data they were sealed with: v1 the field name alone (read
+// only), v2 the field name and the row ID.
+const (
+	sealedPrefix = "otr:enc:"
+	sealedV1     = sealedPrefix + "v1:"
+	sealedV2     = sealedPrefix + "v2:"
+)
+
+// LockedPlaceholder replaces encrypted values read while the storage is
+// locked.
+const LockedPlaceholder = "[encrypted]"
+
+var (
+	// ErrLocked is returned when writing to an encrypted space without the
+	// passphrase.
+	ErrLocked = errors.New("encrypted data is locked: unlock with the passphrase (e.g. set OTR_PASSPHRASE)")
+	// ErrWrongPassphrase is returned when a passphrase doesn't unwrap the
+	// data key.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrNoEncryption is returned when no passphrase has been set.
+	ErrNoEncryption = errors.New("encryption is not set up (run 'otr db rekey')")
+)
+
+// kdfParams are the scrypt parameters for new keys. Existing keys keep the
+// parameters stored with them.
+var kdfParams = scryptParams{N: 1 << 15, R: 8, P: 1}
+
+type scryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+func (p scryptParams) derive(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, p.N, p.R, p.P, 32)
+}
+
+// EncryptionEnabled reports whether a passphrase has been set.
+func (s *Storage) EncryptionEnabled(ctx context.Context) (bool, error) {
+	var n int
+	if err := s.db.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM encryption_key`).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Locked reports whether encrypted values can't be read or written.
+func (s *Storage) Locked() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dataKey == nil
+}
+
+// requireUnlocked returns ErrLocked if encrypted values can't be read, for
+// operations that copy content out of the database.
+func (s *Storage) requireUnlocked(ctx context.Context) error {
+	if !s.Locked() {
+		return nil
+	}
+	enabled, err := s.EncryptionEnabled(ctx)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return ErrLocked
+	}
+	return nil
+}
+
+// Unlock unwraps the data key with passphrase.
+func (s *Storage) Unlock(ctx context.Context, passphrase string) error {
+	var kdf, params string
+	var salt, wrapped []byte
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT kdf, kdf_params, salt, wrapped_key FROM encryption_key WHERE id = 1
+	`).Scan(&kdf, &params, &salt, &wrapped)
+	if err == sql.ErrNoRows {
+		return ErrNoEncryption
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	if kdf != "scrypt" {
+		return fmt.Errorf("unsupported key derivation: %s", kdf)
+	}
+	var p scryptParams
+	if err := json.Unmarshal([]byte(params), &p); err != nil {
+		return fmt.Errorf("failed to parse key parameters: %w", err)
+	}
+	kek, err := p.derive(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	key, err := openBytes(kek, wrapped, []byte("data key"))
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dataKey = aead
+	s.mu.Unlock()
+	return nil
+}
+
+// Rekey sets the passphrase and rotates the data key: every encrypted
+// value is re-encrypted under a new key, wrapped with newPassphrase. If
+// encryption is already set up, the storage must be unlocked.
+func (s *Storage) Rekey(ctx context.Context, newPassphrase string) (int, error) {
+	if newPassphrase == "" {
+		return 0, fmt.Errorf("passphrase cannot be empty")
+	}
+	enabled, err := s.EncryptionEnabled(ctx)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.RLock()
+	old := s.dataKey
+	s.mu.RUnlock()
+	if enabled && old == nil {
+		return 0, ErrLocked
+	}
+
+	key := make([]byte, 32)
+	salt := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return 0, err
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+	kek, err := kdfParams.derive(newPassphrase, salt)
+	if err != nil {
+		return 0, err
+	}
+	wrapped, err := sealBytes(kek, key, []byte("data key"))
+	if err != nil {
+		return 0, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	params, _ := json.Marshal(kdfParams)
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Re-encrypt everything sealed under the old key
+	n, err := reseal(ctx, tx, `SELECT id, response FROM patterns WHERE response LIKE ?`,
+		`UPDATE patterns SET response = ? WHERE id = ?`, fieldPatternResponse, old, aead)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range []struct{ column, field string }{{"title", fieldNoteTitle}, {"content", fieldNoteContent}} {
+		m, err := reseal(ctx, tx, `SELECT id, `+f.column+` FROM notes WHERE `+f.column+` LIKE ?`,
+			`UPDATE notes SET `+f.column+` = ? WHERE id = ?`, f.field, old, aead)
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	// The sync secret is sealed too once there is a data key
+	if _, err := reseal(ctx, tx, `SELECT id, secret FROM sync_replica WHERE id = ? AND secret IS NOT NULL`,
+		`UPDATE sync_replica SET secret = ? WHERE id = ?`, fieldSyncSecret, old, aead, 1); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO encryption_key (id, kdf, kdf_params, salt, wrapped_key, created_at)
+		VALUES (1, 'scrypt', ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			kdf = excluded.kdf, kdf_params = excluded.kdf_params, salt = excluded.salt,
+			wrapped_key = excluded.wrapped_key, rotated_at = ?
+	`, string(params), salt, wrapped, now, now); err != nil {
+		return 0, fmt.Errorf("failed to save encryption key: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	s.mu.Lock()
+	s.dataKey = aead
+	s.mu.Unlock()
+	return n, nil
+}
+
+// SetSpaceEncrypted turns encryption of a space on or off, encrypting or
+// decrypting its patterns and notes. It returns the number of values
+// changed.
+func (s *Storage) SetSpaceEncrypted(ctx context.Context, spaceID string, encrypted bool) (int, error) {
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	if key == nil {
+		enabled, err := s.EncryptionEnabled(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if !enabled {
+			return 0, ErrNoEncryption
+		}
+		return 0, ErrLocked
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE spaces SET encrypted = ? WHERE id = ?`, boolToInt(encrypted), spaceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update space: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, fmt.Errorf("space not found: %s", spaceID)
+	}
+
+	// Encrypting reseals plaintext and decrypting opens sealed values
+	target := key
+	if !encrypted {
+		target = nil
+	}
+	// Items without a space belong to global
+	inSpace := ` WHERE (space_id = ? OR (? = 'global' AND COALESCE(space_id, '') = ''))`
+	n, err := reseal(ctx, tx, `SELECT id, response FROM patterns`+inSpace,
+		`UPDATE patterns SET response = ? WHERE id = ?`, fieldPatternResponse, key, target, spaceID, spaceID)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range []struct{ column, field string }{{"title", fieldNoteTitle}, {"content", fieldNoteContent}} {
+		m, err := reseal(ctx, tx, `SELECT id, `+f.column+` FROM notes`+inSpace,
+			`UPDATE notes SET `+f.column+` = ? WHERE id = ?`, f.field, key, target, spaceID, spaceID)
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+	return n, nil
+}
+
+// reseal rewrites the values selected by query (id, value): sealed values
+// are opened with from, then everything is sealed with to (or left in
+// plaintext if to is nil). Without args, query takes the sealed prefix as
+// a LIKE pattern. It returns the number of values rewritten.
+func reseal(ctx context.Context, tx *sql.Tx, query, update, field string, from, to cipher.AEAD, args ...interface{}) (int, error) {
+	if len(args) == 0 {
+		args = []interface{}{sealedPrefix + "%"}
+	}
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", field, err)
+	}
+	type value struct{ id, text string }
+	var values []value
+	for rows.Next() {
+		var v value
+		if err := rows.Scan(&v.id, &v.text); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read %s: %w", field, err)
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", field, err)
+	}
+
+	n := 0
+	for _, v := range values {
+		plain, err := openField(from, field, v.id, v.text)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt %s of %s: %w", field, v.id, err)
+		}
+		text := plain
+		if to != nil {
+			if text, err = sealField(to, field, v.id, plain); err != nil {
+				return 0, err
+			}
+		}
+		if text == v.text {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, update, text, v.id); err != nil {
+			return 0, fmt.Errorf("failed to update %s of %s: %w", field, v.id, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// SpaceEncrypted reports whether a space has encryption turned on ("" is
+// global). Content derived from such spaces must not be stored in
+// plaintext elsewhere, e.g. in chat history or the response cache.
+func (s *Storage) SpaceEncrypted(ctx context.Context, spaceID string) (bool, error) {
+	return spaceEncrypted(ctx, s.db.db, spaceID)
+}
+
+// spaceEncrypted reports whether a space has encryption turned on.
+func spaceEncrypted(ctx context.Context, ex execer, spaceID string) (bool, error) {
+	if spaceID == "" {
+		spaceID = "global"
+	}
+	rows, err := ex.QueryContext(ctx, `SELECT encrypted FROM spaces WHERE id = ?`, spaceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read space: %w", err)
+	}
+	defer rows.Close()
+	var encrypted bool
+	if rows.Next() {
+		if err := rows.Scan(&encrypted); err != nil {
+			return false, fmt.Errorf("failed to read space: %w", err)
+		}
+	}
+	return encrypted, rows.Err()
+}
+
+// patternSpace returns the space of a stored pattern ("" if missing).
+func patternSpace(ctx context.Context, ex execer, patternID string) (string, error) {
+	rows, err := ex.QueryContext(ctx, `SELECT space_id FROM patterns WHERE id = ?`, patternID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read pattern: %w", err)
+	}
+	defer rows.Close()
+	var spaceID sql.NullString
+	if rows.Next() {
+		if err := rows.Scan(&spaceID); err != nil {
+			return "", fmt.Errorf("failed to read pattern: %w", err)
+		}
+	}
+	return spaceID.String, rows.Err()
+}
+
+// seal returns the values of fields as stored in spaceID: encrypted if the
+// space is, unchanged otherwise. id is the row they belong to; values
+// alternate field names and values.
+func (s *Storage) seal(ctx context.Context, ex execer, spaceID, id string, values ...string) ([]string, error) {
+	out := make([]string, 0, len(values)/2)
+	encrypted, err := spaceEncrypted(ctx, ex, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	for i := 0; i < len(values); i += 2 {
+		field, text := values[i], values[i+1]
+		if !encrypted {
+			out = append(out, text)
+			continue
+		}
+		if key == nil {
+			return nil, ErrLocked
+		}
+		sealed, err := sealField(key, field, id, text)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sealed)
+	}
+	return out, nil
+}
+
+// openPatterns decrypts the responses of patterns read from the database.
+func (s *Storage) openPatterns(patterns ...*models.Pattern) {
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	for _, p := range patterns {
+		p.Response = openOrPlaceholder(key, fieldPatternResponse, p.ID, p.Response)
+	}
+}
+
+// openNotes decrypts the titles and contents of notes read from the
+// database, and recomputes their stats.
+func (s *Storage) openNotes(notes ...*models.Note) {
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	for _, n := range notes {
+		title := openOrPlaceholder(key, fieldNoteTitle, n.ID, n.Title)
+		content := openOrPlaceholder(key, fieldNoteContent, n.ID, n.Content)
+		if title != n.Title || content != n.Content {
+			n.Title, n.Content = title, content
+			n.CalculateStats()
+		}
+	}
+}
+
+// openOrPlaceholder opens a stored value, or returns LockedPlaceholder if
+// it is sealed and can't be opened.
+func openOrPlaceholder(key cipher.AEAD, field, id, text string) string {
+	if !strings.HasPrefix(text, sealedPrefix) {
+		return text
+	}
+	if key == nil {
+		return LockedPlaceholder
+	}
+	plain, err := openField(key, field, id, text)
+	if err != nil {
+		return LockedPlaceholder
+	}
+	return plain
+}
+
+// sealField encrypts the value of field in row id.
+func sealField(key cipher.AEAD, field, id, text string) (string, error) {
+	nonce := make([]byte, key.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := key.Seal(nonce, nonce, []byte(text), sealedData(field, id))
+	return sealedV2 + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openField decrypts a sealed value of field in row id; plaintext is
+// returned as is.
+func openField(key cipher.AEAD, field, id, text string) (string, error) {
+	if !strings.HasPrefix(text, sealedPrefix) {
+		return text, nil
+	}
+	if key == nil {
+		return "", ErrLocked
+	}
+	var ad []byte
+	encoded, ok := strings.CutPrefix(text, sealedV2)
+	if ok {
+		ad = sealedData(field, id)
+	} else if encoded, ok = strings.CutPrefix(text, sealedV1); ok {
+		ad = []byte(field)
+	} else {
+		return "", fmt.Errorf("unsupported encrypted value")
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < key.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plain, err := key.Open(nil, data[:key.NonceSize()], data[key.NonceSize():], ad)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// sealedData is the additional data binding a sealed value to its field
+// and row.
+func sealedData(field, id string) []byte {
+	return []byte(field + "\x00" + id)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealBytes(key, data, ad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, ad), nil
+}
+
+func openBytes(key, data, ad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed wrapped key")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+}
@@ -0,0 +1,380 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// setupEncryptedDB returns a storage with a passphrase set and the "work"
+// space encrypted. The scrypt cost is lowered to keep the tests fast.
+func setupEncryptedDB(t *testing.T) *Storage {
+	t.Helper()
+	old := kdfParams
+	kdfParams = scryptParams{N: 1 << 10, R: 8, P: 1}
+	t.Cleanup(func() { kdfParams = old })
+
+	s, cleanup := setupTestDB(t)
+	t.Cleanup(cleanup)
+	ctx := context.Background()
+	if err := s.CreateSpace(ctx, &models.Space{ID: "work", Name: "Work"}); err != nil {
+		t.Fatalf("CreateSpace failed: %v", err)
+	}
+	if _, err := s.Rekey(ctx, "secret"); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if _, err := s.SetSpaceEncrypted(ctx, "work", true); err != nil {
+		t.Fatalf("SetSpaceEncrypted failed: %v", err)
+	}
+	return s
+}
+
+// storedValue reads a column as stored, bypassing decryption.
+func storedValue(t *testing.T, s *Storage, query, id string) string {
+	t.Helper()
+	var v string
+	if err := s.db.db.QueryRow(query, id).Scan(&v); err != nil {
+		t.Fatalf("failed to read stored value: %v", err)
+	}
+	return v
+}
+
+func TestEncryption_RoundTrip(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+
+	p := models.NewPattern("vpn", "password: hunter2")
+	p.SpaceID = "work"
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	plain := models.NewPattern("hello", "world")
+	if err := s.SavePattern(ctx, plain); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	n := models.NewNote("Credentials", "root / hunter2")
+	n.SpaceID = "work"
+	if err := s.SaveNote(ctx, n); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	// Only the encrypted space is sealed in the database
+	if got := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, p.ID); !strings.HasPrefix(got, sealedPrefix) || strings.Contains(got, "hunter2") {
+		t.Errorf("expected a sealed response, got %q", got)
+	}
+	if got := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, plain.ID); got != "world" {
+		t.Errorf("expected plaintext outside encrypted spaces, got %q", got)
+	}
+	for _, column := range []string{"title", "content"} {
+		if got := storedValue(t, s, `SELECT `+column+` FROM notes WHERE id = ?`, n.ID); !strings.HasPrefix(got, sealedPrefix) {
+			t.Errorf("expected a sealed note %s, got %q", column, got)
+		}
+	}
+
+	got, err := s.GetPattern(ctx, p.ID)
+	if err != nil || got.Response != "password: hunter2" {
+		t.Fatalf("GetPattern = %v, %v", got, err)
+	}
+	byTrigger, err := s.GetPatternByTrigger(ctx, "vpn")
+	if err != nil || byTrigger.Response != p.Response {
+		t.Fatalf("GetPatternByTrigger = %v, %v", byTrigger, err)
+	}
+	list, err := s.ListPatterns(ctx, contracts.ListOptions{SpaceID: "work"})
+	if err != nil || len(list) != 1 || list[0].Response != p.Response {
+		t.Fatalf("ListPatterns = %v, %v", list, err)
+	}
+	gotNote, err := s.GetNote(ctx, n.ID)
+	if err != nil || gotNote.Title != "Credentials" || gotNote.Content != "root / hunter2" {
+		t.Fatalf("GetNote = %+v, %v", gotNote, err)
+	}
+
+	p.Response = "password: changed"
+	if err := s.UpdatePattern(ctx, p); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	if got := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, p.ID); !strings.HasPrefix(got, sealedPrefix) {
+		t.Errorf("expected the update to stay sealed, got %q", got)
+	}
+
+	// Moving out of the encrypted space decrypts
+	if err := s.MovePatternToSpace(ctx, p.ID, "global"); err != nil {
+		t.Fatalf("MovePatternToSpace failed: %v", err)
+	}
+	if got := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, p.ID); got != "password: changed" {
+		t.Errorf("expected plaintext after moving out, got %q", got)
+	}
+}
+
+func TestEncryption_Locked(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+
+	p := models.NewPattern("vpn", "password: hunter2")
+	p.SpaceID = "work"
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+
+	// A fresh storage on the same database starts locked
+	locked := NewStorage(s.db)
+	if !locked.Locked() {
+		t.Fatal("expected a new storage to be locked")
+	}
+	got, err := locked.GetPattern(ctx, p.ID)
+	if err != nil || got.Response != LockedPlaceholder {
+		t.Fatalf("expected the placeholder while locked, got %v, %v", got, err)
+	}
+	if err := locked.SavePattern(ctx, &models.Pattern{Trigger: "x", Response: "y", SpaceID: "work", Threshold: 50}); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked writing to an encrypted space, got %v", err)
+	}
+	if err := locked.SavePattern(ctx, models.NewPattern("open", "fine")); err != nil {
+		t.Errorf("expected writes to other spaces to work while locked, got %v", err)
+	}
+	if _, err := locked.Rekey(ctx, "other"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected Rekey to need the old key, got %v", err)
+	}
+
+	if err := locked.Unlock(ctx, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := locked.Unlock(ctx, "secret"); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	got, err = locked.GetPattern(ctx, p.ID)
+	if err != nil || got.Response != p.Response {
+		t.Fatalf("GetPattern after unlock = %v, %v", got, err)
+	}
+}
+
+func TestEncryption_BoundToRow(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+
+	secret := models.NewPattern("vpn", "password: hunter2")
+	secret.SpaceID = "work"
+	other := models.NewPattern("lunch", "noodles")
+	other.SpaceID = "work"
+	for _, p := range []*models.Pattern{secret, other} {
+		if err := s.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+
+	// A sealed value copied to another row doesn't open there
+	sealed := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, secret.ID)
+	if _, err := s.db.db.Exec(`UPDATE patterns SET response = ? WHERE id = ?`, sealed, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetPattern(ctx, other.ID); err != nil || got.Response != LockedPlaceholder {
+		t.Fatalf("expected the placeholder for a swapped value, got %v, %v", got, err)
+	}
+
+	// Values sealed before row binding are still read
+	legacy, err := s.sealLegacy(fieldPatternResponse, "noodles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.db.Exec(`UPDATE patterns SET response = ? WHERE id = ?`, legacy, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetPattern(ctx, other.ID); err != nil || got.Response != "noodles" {
+		t.Fatalf("expected a v1 value to open, got %v, %v", got, err)
+	}
+}
+
+// sealLegacy seals text as before row binding, with only the field name as
+// additional data.
+func (s *Storage) sealLegacy(field, text string) (string, error) {
+	nonce := make([]byte, s.dataKey.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.dataKey.Seal(nonce, nonce, []byte(text), []byte(field))
+	return sealedV1 + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func TestEncryption_Search(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+
+	for _, p := range []*models.Pattern{
+		models.NewPattern("vpn", "password: hunter2"),
+		models.NewPattern("vpn", "hunter2 again"),
+		models.NewPattern("lunch", "nothing here"),
+	} {
+		p.SpaceID = "work"
+		if err := s.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	n := models.NewNote("Credentials", "root / hunter2")
+	n.SpaceID = "work"
+	if err := s.SaveNote(ctx, n); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	results, err := s.SearchPatterns(ctx, "HUNTER2", contracts.ListOptions{})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("SearchPatterns(HUNTER2) = %v, %v; want 2 decrypted matches", results, err)
+	}
+	for _, p := range results {
+		if !strings.Contains(p.Response, "hunter2") {
+			t.Errorf("expected a decrypted response, got %q", p.Response)
+		}
+	}
+	if results, _ := s.SearchPatterns(ctx, "hunter2", contracts.ListOptions{Limit: 1}); len(results) != 1 {
+		t.Errorf("expected SearchPatterns to honour the limit, got %d", len(results))
+	}
+	if results, _ := s.SearchPatterns(ctx, sealedPrefix, contracts.ListOptions{}); len(results) != 0 {
+		t.Errorf("expected the ciphertext not to match, got %d", len(results))
+	}
+	notes, err := s.SearchNotes(ctx, "hunter2", contracts.ListOptions{})
+	if err != nil || len(notes) != 1 || notes[0].Title != "Credentials" {
+		t.Fatalf("SearchNotes(hunter2) = %v, %v", notes, err)
+	}
+	if notes, _ := s.SearchNotes(ctx, sealedPrefix, contracts.ListOptions{}); len(notes) != 0 {
+		t.Errorf("expected the ciphertext not to match, got %d", len(notes))
+	}
+
+	// While locked only the plaintext triggers are searched
+	locked := NewStorage(s.db)
+	if results, _ := locked.SearchPatterns(ctx, "hunter2", contracts.ListOptions{}); len(results) != 0 {
+		t.Errorf("expected no matches in sealed responses while locked, got %d", len(results))
+	}
+	results, err = locked.SearchPatterns(ctx, "vpn", contracts.ListOptions{})
+	if err != nil || len(results) != 2 || results[0].Response != LockedPlaceholder {
+		t.Fatalf("SearchPatterns(vpn) while locked = %v, %v", results, err)
+	}
+	if notes, _ := locked.SearchNotes(ctx, "Credentials", contracts.ListOptions{}); len(notes) != 0 {
+		t.Errorf("expected sealed notes not to be searched while locked, got %d", len(notes))
+	}
+}
+
+func TestEncryption_Rekey(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+
+	p := models.NewPattern("vpn", "password: hunter2")
+	p.SpaceID = "work"
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	before := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, p.ID)
+
+	n, err := s.Rekey(ctx, "new secret")
+	if err != nil || n != 1 {
+		t.Fatalf("Rekey = %d, %v; want 1 value re-encrypted", n, err)
+	}
+	if after := storedValue(t, s, `SELECT response FROM patterns WHERE id = ?`, p.ID); after == before {
+		t.Error("expected the value to be re-encrypted under the new key")
+	}
+
+	fresh := NewStorage(s.db)
+	if err := fresh.Unlock(ctx, "secret"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected the old passphrase to be rejected, got %v", err)
+	}
+	if err := fresh.Unlock(ctx, "new secret"); err != nil {
+		t.Fatalf("Unlock with the new passphrase failed: %v", err)
+	}
+	if got, err := fresh.GetPattern(ctx, p.ID); err != nil || got.Response != p.Response {
+		t.Fatalf("GetPattern after rekey = %v, %v", got, err)
+	}
+}
+
+func TestEncryption_SetSpaceEncrypted(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+
+	if err := s.CreateSpace(ctx, &models.Space{ID: "global", Name: "Global"}); err != nil {
+		t.Fatalf("CreateSpace failed: %v", err)
+	}
+	n := models.NewNote("Plan", "ship it")
+	if err := s.SaveNote(ctx, n); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	changed, err := s.SetSpaceEncrypted(ctx, "global", true)
+	if err != nil || changed != 2 {
+		t.Fatalf("SetSpaceEncrypted(on) = %d, %v; want 2 values", changed, err)
+	}
+	if got := storedValue(t, s, `SELECT content FROM notes WHERE id = ?`, n.ID); !strings.HasPrefix(got, sealedPrefix) {
+		t.Errorf("expected existing notes to be encrypted, got %q", got)
+	}
+	space, err := s.GetSpace(ctx, "global")
+	if err != nil || !space.Encrypted {
+		t.Fatalf("expected the space to be marked encrypted, got %+v, %v", space, err)
+	}
+
+	// Saving the space again keeps the setting
+	space.Description = "changed"
+	if err := s.CreateSpace(ctx, space); err != nil {
+		t.Fatalf("CreateSpace failed: %v", err)
+	}
+	if space, _ := s.GetSpace(ctx, "global"); !space.Encrypted {
+		t.Error("expected CreateSpace to keep the encrypted flag")
+	}
+
+	if _, err := s.SetSpaceEncrypted(ctx, "global", false); err != nil {
+		t.Fatalf("SetSpaceEncrypted(off) failed: %v", err)
+	}
+	if got := storedValue(t, s, `SELECT content FROM notes WHERE id = ?`, n.ID); got != "ship it" {
+		t.Errorf("expected the note to be decrypted, got %q", got)
+	}
+	if _, err := s.SetSpaceEncrypted(ctx, "missing", true); err == nil {
+		t.Error("expected an error for a missing space")
+	}
+}
+
+func TestEncryption_RollbackRefusedWhileEncrypted(t *testing.T) {
+	s := setupEncryptedDB(t)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		backups, _ := filepath.Glob(s.db.path + ".*.bak")
+		for _, path := range backups {
+			os.Remove(path)
+		}
+	})
+
+	// Reverting the encryption migration would drop the data key
+	steps := LatestSchemaVersion() - 5
+	if _, err := s.db.Rollback(ctx, steps); err == nil || !strings.Contains(err.Error(), "otr space decrypt") {
+		t.Fatalf("expected the rollback to be refused, got %v", err)
+	}
+	if version, _ := s.db.SchemaVersion(ctx); version != LatestSchemaVersion() {
+		t.Errorf("refused rollback should change nothing, got version %d", version)
+	}
+
+	if _, err := s.SetSpaceEncrypted(ctx, "work", false); err != nil {
+		t.Fatalf("SetSpaceEncrypted failed: %v", err)
+	}
+	if _, err := s.db.Rollback(ctx, steps); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if version, _ := s.db.SchemaVersion(ctx); version != 5 {
+		t.Errorf("expected version 5, got %d", version)
+	}
+}
+
+func TestEncryption_RequiresPassphrase(t *testing.T) {
+	s, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if enabled, err := s.EncryptionEnabled(ctx); err != nil || enabled {
+		t.Fatalf("EncryptionEnabled = %v, %v; want false", enabled, err)
+	}
+	if _, err := s.SetSpaceEncrypted(ctx, "global", true); !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("expected ErrNoEncryption, got %v", err)
+	}
+	if err := s.Unlock(ctx, "x"); !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("expected ErrNoEncryption, got %v", err)
+	}
+}
@@ -25,7 +25,7 @@ func TestIndexOptimization(t *testing.T) {
 		"idx_patterns_trigger",
 		"idx_patterns_strength",
 		"idx_patterns_project",
-		"idx_patterns_tags",
+		"idx_taggings_item", // Replaces idx_patterns_tags (migration 5)
 		"idx_patterns_deleted",
 		// New indexes from Iter 43
 		"idx_patterns_last_used_at",
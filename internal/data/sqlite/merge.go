@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== Pattern Merge ====================
+
+// MergePatterns applies merges in a single transaction: each kept pattern
+// is updated, the merged patterns are soft deleted, and their triggers and
+// aliases are re-pointed at the kept pattern. Either all merges apply or
+// none do.
+func (s *Storage) MergePatterns(ctx context.Context, merges []*models.PatternMerge) error {
+	if len(merges) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, m := range merges {
+		if err := s.mergeOne(ctx, tx, m, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Storage) mergeOne(ctx context.Context, tx *sql.Tx, m *models.PatternMerge, now time.Time) error {
+	p := m.Keep
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("validation failed for pattern %s: %w", p.ID, err)
+	}
+	p.UpdatedAt = now
+	p.Tags = models.NormalizeTags(p.Tags)
+	connections, _ := json.Marshal(p.Connections)
+	tags, _ := json.Marshal(p.Tags)
+	spaceID, err := patternSpace(ctx, tx, p.ID)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.seal(ctx, tx, spaceID, p.ID, fieldPatternResponse, p.Response)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE patterns SET
+			trigger = ?, response = ?, strength = ?, connections = ?, updated_at = ?,
+			reinforcement_count = ?, decay_count = ?, last_used_at = ?, tags = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, p.Trigger, sealed[0], p.Strength, string(connections), p.UpdatedAt.Unix(),
+		p.ReinforceCnt, p.DecayCnt, int64TimeToPtr(p.LastUsedAt), string(tags), p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update pattern %s: %w", p.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("pattern not found: %s", p.ID)
+	}
+	if err := syncTaggings(ctx, tx, tagItemPattern, p.ID, p.Tags); err != nil {
+		return err
+	}
+
+	for _, id := range m.Merged {
+		if id == p.ID {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE patterns SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL
+		`, now.Unix(), id); err != nil {
+			return fmt.Errorf("failed to delete pattern %s: %w", id, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE pattern_aliases SET pattern_id = ? WHERE pattern_id = ?
+		`, p.ID, id); err != nil {
+			return fmt.Errorf("failed to move aliases of pattern %s: %w", id, err)
+		}
+		// Notes linked to both keep a single link
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE OR IGNORE note_patterns SET pattern_id = ? WHERE pattern_id = ?
+		`, p.ID, id); err != nil {
+			return fmt.Errorf("failed to move note links of pattern %s: %w", id, err)
+		}
+		if err := unlinkPattern(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := untagItem(ctx, tx, tagItemPattern, id); err != nil {
+			return err
+		}
+	}
+
+	for _, alias := range m.Aliases {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || alias == p.Trigger {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO pattern_aliases (alias, pattern_id, created_at) VALUES (?, ?, ?)
+		`, alias, p.ID, now.Unix()); err != nil {
+			return fmt.Errorf("failed to save alias %q: %w", alias, err)
+		}
+	}
+	// The kept trigger must not also be an alias (it may have been one before)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pattern_aliases WHERE alias = ?`, p.Trigger); err != nil {
+		return fmt.Errorf("failed to remove alias %q: %w", p.Trigger, err)
+	}
+	return nil
+}
+
+// ListPatternAliases returns the aliases of a pattern, sorted.
+func (s *Storage) ListPatternAliases(ctx context.Context, patternID string) ([]string, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT alias FROM pattern_aliases WHERE pattern_id = ? ORDER BY alias
+	`, patternID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// resolveAlias returns the ID of the pattern an alias points to, or ""
+// if there is none.
+func (s *Storage) resolveAlias(ctx context.Context, alias string) (string, error) {
+	var id string
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT pattern_id FROM pattern_aliases WHERE alias = ?
+	`, alias).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func TestStorage_MergePatterns(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	keep := models.NewPattern("deploy app", "make release")
+	dup := models.NewPattern("deploy the app", "run make release")
+	for _, p := range []*models.Pattern{keep, dup} {
+		if err := storage.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+
+	merged := *keep
+	merged.Tags = []string{"ops"}
+	merged.ReinforceCnt = 3
+	err := storage.MergePatterns(ctx, []*models.PatternMerge{{
+		Keep:    &merged,
+		Merged:  []string{dup.ID},
+		Aliases: []string{dup.Trigger},
+	}})
+	if err != nil {
+		t.Fatalf("MergePatterns failed: %v", err)
+	}
+
+	patterns, _ := storage.ListPatterns(ctx, contracts.ListOptions{})
+	if len(patterns) != 1 || patterns[0].ID != keep.ID || patterns[0].ReinforceCnt != 3 {
+		t.Fatalf("expected only the merged pattern, got %+v", patterns)
+	}
+	aliases, err := storage.ListPatternAliases(ctx, keep.ID)
+	if err != nil || len(aliases) != 1 || aliases[0] != "deploy the app" {
+		t.Errorf("unexpected aliases: %v (%v)", aliases, err)
+	}
+	p, err := storage.GetPatternByTrigger(ctx, "deploy the app")
+	if err != nil || p.ID != keep.ID {
+		t.Errorf("expected alias to resolve to kept pattern, got %+v (%v)", p, err)
+	}
+
+	// A failing merge rolls back the whole batch
+	other := models.NewPattern("backup", "make backup")
+	if err := storage.SavePattern(ctx, other); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	missing := models.NewPattern("missing", "x")
+	err = storage.MergePatterns(ctx, []*models.PatternMerge{
+		{Keep: &merged, Merged: []string{other.ID}},
+		{Keep: missing},
+	})
+	if err == nil {
+		t.Fatal("expected error for missing pattern")
+	}
+	if _, err := storage.GetPattern(ctx, other.ID); err != nil {
+		t.Errorf("expected rollback to keep %s: %v", other.ID, err)
+	}
+}
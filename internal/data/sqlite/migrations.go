@@ -0,0 +1,959 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration is one numbered step of the schema. Pending migrations are
+// applied in version order, each in its own transaction together with its
+// row in schema_migrations. A released migration must not be edited: its
+// checksum is recorded when it is applied and checked on every run. Add a
+// new migration instead.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string // Statements to apply
+	Down    []string // Statements to revert (nil = cannot be rolled back, empty = nothing to undo)
+
+	// Prepare runs before Up, for steps that depend on the current schema
+	// (e.g. adding a column only if it is missing). It is not checksummed.
+	Prepare func(ctx context.Context, tx *sql.Tx) error
+
+	// CheckDown runs before a rollback starts and refuses it when
+	// reverting would lose data Down can't carry back.
+	CheckDown func(ctx context.Context, db *sql.DB) error
+
+	// Destructive migrations drop, rebuild or rewrite data on the way up
+	// or down; the database file is backed up before they run (rollbacks
+	// always back up).
+	Destructive bool
+}
+
+// Reversible reports whether the migration can be rolled back.
+func (m *Migration) Reversible() bool {
+	return m.Down != nil
+}
+
+// Checksum identifies the migration's statements.
+func (m *Migration) Checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n", m.Version, m.Name)
+	for _, stmt := range m.Up {
+		fmt.Fprintf(h, "up\n%s\n", strings.TrimSpace(stmt))
+	}
+	for _, stmt := range m.Down {
+		fmt.Fprintf(h, "down\n%s\n", strings.TrimSpace(stmt))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MigrationState is a migration's status in a database.
+type MigrationState struct {
+	Version    int
+	Name       string
+	Applied    bool
+	AppliedAt  time.Time
+	Reversible bool
+	Modified   bool // The migration changed after it was applied
+	Unknown    bool // Applied, but not known to this build
+}
+
+// MigrationResult is a migration that was applied or rolled back.
+type MigrationResult struct {
+	Version int
+	Name    string
+	Backup  string // Backup taken before the step (empty if none)
+}
+
+// Migrations returns the schema migrations in version order.
+func Migrations() []*Migration {
+	return append([]*Migration(nil), migrations...)
+}
+
+// LatestSchemaVersion is the schema version this build migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the highest applied migration (0 for a new database).
+func (d *Database) SchemaVersion(ctx context.Context) (int, error) {
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// ErrSchemaBehind is returned by CheckSchema when the schema is older
+// than this version of otr reads and writes.
+var ErrSchemaBehind = errors.New("database schema is out of date")
+
+// CheckSchema returns ErrSchemaBehind if migrations are pending, e.g.
+// after 'otr db rollback' pinned an older version. Storage must not be
+// used on such a schema: the tables and columns it needs may be missing.
+func (d *Database) CheckSchema(ctx context.Context) error {
+	version, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version >= LatestSchemaVersion() {
+		return nil
+	}
+	return fmt.Errorf("%w: version %d of %d; run 'otr db migrate' (until then only db migrate/status/rollback, backup and restore work)",
+		ErrSchemaBehind, version, LatestSchemaVersion())
+}
+
+// MigrationStatus lists every known and applied migration in version order.
+func (d *Database) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	return d.migrationStatus(ctx, migrations)
+}
+
+// MigrateTo applies pending migrations up to version (0 = latest) and
+// returns the applied steps. An older target the schema ends up at is
+// pinned so Migrate stops there too; migrating to the latest version
+// removes the pin.
+func (d *Database) MigrateTo(ctx context.Context, version int) ([]MigrationResult, error) {
+	results, err := d.migrate(ctx, migrations, version)
+	if err != nil {
+		return results, err
+	}
+	if version == 0 || version == LatestSchemaVersion() {
+		return results, d.pinVersion(ctx, 0)
+	}
+	current, err := d.SchemaVersion(ctx)
+	if err != nil || current != version {
+		// Already past the target; migrations are never reverted here
+		return results, err
+	}
+	return results, d.pinVersion(ctx, version)
+}
+
+// Rollback reverts the last steps applied migrations, newest first, and
+// returns the reverted steps. The database file is backed up first.
+// The resulting version is pinned so Migrate doesn't apply the steps
+// again; until 'otr db migrate' removes the pin, CheckSchema fails.
+func (d *Database) Rollback(ctx context.Context, steps int) ([]MigrationResult, error) {
+	results, err := d.rollback(ctx, migrations, steps)
+	if len(results) == 0 {
+		return results, err
+	}
+	version, verr := d.SchemaVersion(ctx)
+	if verr == nil {
+		verr = d.pinVersion(ctx, version)
+	}
+	if err == nil {
+		err = verr
+	}
+	return results, err
+}
+
+// PinnedVersion returns the version Migrate stops at, set by migrating to
+// an older version or rolling back (0 = none, Migrate goes to the latest).
+func (d *Database) PinnedVersion(ctx context.Context) (int, error) {
+	if err := d.createPinTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := d.db.QueryRowContext(ctx, `SELECT version FROM schema_pin`).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema_pin: %w", err)
+	}
+	return version, nil
+}
+
+// pinVersion records the version Migrate stops at (0 removes the pin).
+func (d *Database) pinVersion(ctx context.Context, version int) error {
+	if err := d.createPinTable(ctx); err != nil {
+		return err
+	}
+	if _, err := d.db.ExecContext(ctx, `DELETE FROM schema_pin`); err != nil {
+		return fmt.Errorf("failed to clear schema_pin: %w", err)
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := d.db.ExecContext(ctx, `INSERT INTO schema_pin (version) VALUES (?)`, version); err != nil {
+		return fmt.Errorf("failed to write schema_pin: %w", err)
+	}
+	return nil
+}
+
+// createPinTable creates schema_pin. Like schema_migrations it lives
+// outside the migrations, so rolling back never drops it.
+func (d *Database) createPinTable(ctx context.Context) error {
+	if _, err := d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_pin (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to create schema_pin: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) migrationStatus(ctx context.Context, list []*Migration) ([]MigrationState, error) {
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	known := make(map[int]bool, len(list))
+	for _, m := range list {
+		known[m.Version] = true
+		state := MigrationState{Version: m.Version, Name: m.Name, Reversible: m.Reversible()}
+		if row, ok := applied[m.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = row.appliedAt
+			state.Modified = row.checksum != m.Checksum()
+		}
+		states = append(states, state)
+	}
+	for v, row := range applied {
+		if !known[v] {
+			states = append(states, MigrationState{
+				Version: v, Name: row.name, Applied: true, AppliedAt: row.appliedAt, Unknown: true,
+			})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+func (d *Database) migrate(ctx context.Context, list []*Migration, target int) ([]MigrationResult, error) {
+	if err := validateMigrations(list); err != nil {
+		return nil, err
+	}
+	latest := list[len(list)-1].Version
+	if target == 0 {
+		target = latest
+	}
+	if target < 0 || target > latest {
+		return nil, fmt.Errorf("unknown schema version %d (latest is %d)", target, latest)
+	}
+
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkApplied(list, applied); err != nil {
+		return nil, err
+	}
+
+	// One backup covers every destructive step of the run; a new
+	// database has nothing to lose
+	backedUp := false
+	if len(applied) == 0 {
+		var tables int
+		if err := d.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'schema_pin')`,
+		).Scan(&tables); err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		backedUp = tables == 0
+	}
+	var results []MigrationResult
+	for _, m := range list {
+		if m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		result := MigrationResult{Version: m.Version, Name: m.Name}
+		if m.Destructive && !backedUp {
+			backedUp = true
+			if result.Backup, err = d.backup(ctx, fmt.Sprintf("pre-v%d", m.Version)); err != nil {
+				return results, err
+			}
+		}
+		if err := d.applyMigration(ctx, m); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (d *Database) rollback(ctx context.Context, list []*Migration, steps int) ([]MigrationResult, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive")
+	}
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkApplied(list, applied); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration, len(list))
+	for _, m := range list {
+		byVersion[m.Version] = m
+	}
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps > len(versions) {
+		return nil, fmt.Errorf("only %d migrations are applied", len(versions))
+	}
+
+	// Check every step first so a rollback never stops half way
+	todo := make([]*Migration, 0, steps)
+	for _, v := range versions[:steps] {
+		m := byVersion[v]
+		if !m.Reversible() {
+			return nil, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		if m.CheckDown != nil {
+			if err := m.CheckDown(ctx, d.db); err != nil {
+				return nil, fmt.Errorf("migration %d (%s) cannot be rolled back: %w", m.Version, m.Name, err)
+			}
+		}
+		todo = append(todo, m)
+	}
+
+	backup, err := d.backup(ctx, fmt.Sprintf("pre-rollback-v%d", versions[0]))
+	if err != nil {
+		return nil, err
+	}
+	var results []MigrationResult
+	for _, m := range todo {
+		if err := d.revertMigration(ctx, m); err != nil {
+			return results, err
+		}
+		results = append(results, MigrationResult{Version: m.Version, Name: m.Name, Backup: backup})
+		backup = ""
+	}
+	return results, nil
+}
+
+func (d *Database) applyMigration(ctx context.Context, m *Migration) error {
+	return d.inTx(ctx, func(tx *sql.Tx) error {
+		if m.Prepare != nil {
+			if err := m.Prepare(ctx, tx); err != nil {
+				return err
+			}
+		}
+		for _, stmt := range m.Up {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+			m.Version, m.Name, m.Checksum(), time.Now().Unix())
+		return err
+	}, "migration %d (%s) failed", m.Version, m.Name)
+}
+
+func (d *Database) revertMigration(ctx context.Context, m *Migration) error {
+	return d.inTx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range m.Down {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+		return err
+	}, "rollback of migration %d (%s) failed", m.Version, m.Name)
+}
+
+// inTx runs fn in a transaction, wrapping its error with the message.
+func (d *Database) inTx(ctx context.Context, fn func(tx *sql.Tx) error, format string, args ...any) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err)
+	}
+	return nil
+}
+
+// backup copies the database file next to itself before a destructive
+// step and returns the copy's path. In-memory databases are not backed up.
+func (d *Database) backup(ctx context.Context, label string) (string, error) {
+	if d.path == "" || strings.Contains(d.path, ":memory:") {
+		return "", nil
+	}
+	path := fmt.Sprintf("%s.%s-%s.bak", d.path, label, time.Now().Format("20060102-150405"))
+	if _, err := d.db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return "", fmt.Errorf("failed to back up database: %w", err)
+	}
+	return path, nil
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// appliedMigrations reads schema_migrations, creating it if needed.
+func (d *Database) appliedMigrations(ctx context.Context) (map[int]appliedMigration, error) {
+	if _, err := d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var row appliedMigration
+		var appliedAt int64
+		if err := rows.Scan(&version, &row.name, &row.checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		row.appliedAt = time.Unix(appliedAt, 0)
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+// checkApplied refuses to touch a database whose applied migrations were
+// edited, or that was migrated by a newer build.
+func checkApplied(list []*Migration, applied map[int]appliedMigration) error {
+	latest := list[len(list)-1].Version
+	for _, m := range list {
+		if row, ok := applied[m.Version]; ok && row.checksum != m.Checksum() {
+			return fmt.Errorf("migration %d (%s) has changed since it was applied", m.Version, m.Name)
+		}
+	}
+	for v := range applied {
+		if v > latest {
+			return fmt.Errorf("database schema version %d is newer than this build supports (%d)", v, latest)
+		}
+	}
+	return nil
+}
+
+func validateMigrations(list []*Migration) error {
+	if len(list) == 0 {
+		return fmt.Errorf("no migrations")
+	}
+	for i, m := range list {
+		if m.Version <= 0 || (i > 0 && m.Version <= list[i-1].Version) {
+			return fmt.Errorf("migration versions must be positive and increasing (%d)", m.Version)
+		}
+	}
+	return nil
+}
+
+// ==================== Schema helpers ====================
+
+// hasColumn reports whether table has the column.
+func hasColumn(ctx context.Context, tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumn adds a column unless table already has it.
+func addColumn(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
+	ok, err := hasColumn(ctx, tx, table, column)
+	if err != nil || ok {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// ==================== Migrations ====================
+
+// migrations is the schema history. Append new migrations; never edit or
+// renumber released ones.
+var migrations = []*Migration{
+	{
+		// Everything up to the introduction of versioned migrations.
+		// Idempotent, so databases created before schema_migrations
+		// existed pick it up unchanged.
+		Version: 1,
+		Name:    "baseline",
+		Up: []string{
+			// Patterns table
+			`CREATE TABLE IF NOT EXISTS patterns (
+				id TEXT PRIMARY KEY,
+				trigger TEXT NOT NULL,
+				response TEXT NOT NULL,
+				strength REAL NOT NULL DEFAULT 0,
+				threshold REAL NOT NULL DEFAULT 50,
+				decay_rate REAL NOT NULL DEFAULT 0.01,
+				decay_enabled INTEGER NOT NULL DEFAULT 1,
+				connections TEXT,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL,
+				reinforcement_count INTEGER NOT NULL DEFAULT 0,
+				decay_count INTEGER NOT NULL DEFAULT 0,
+				last_used_at INTEGER,
+				tags TEXT,
+				project TEXT,
+				user_id TEXT,
+				space_id TEXT DEFAULT 'global',
+				deleted_at INTEGER
+			)`,
+
+			// Spaces table
+			`CREATE TABLE IF NOT EXISTS spaces (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				description TEXT,
+				owner TEXT,
+				is_default INTEGER NOT NULL DEFAULT 0,
+				pattern_limit INTEGER NOT NULL DEFAULT 0,
+				pattern_count INTEGER NOT NULL DEFAULT 0,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL
+			)`,
+
+			// Events table (for audit/logging)
+			`CREATE TABLE IF NOT EXISTS events (
+				id TEXT PRIMARY KEY,
+				type TEXT NOT NULL,
+				timestamp INTEGER NOT NULL,
+				payload TEXT,
+				source TEXT,
+				trace_id TEXT,
+				pattern_id TEXT,
+				user_id TEXT
+			)`,
+
+			// Thought sessions
+			`CREATE TABLE IF NOT EXISTS thought_sessions (
+				id TEXT PRIMARY KEY,
+				title TEXT,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL
+			)`,
+
+			// Thought nodes
+			`CREATE TABLE IF NOT EXISTS thought_nodes (
+				id TEXT PRIMARY KEY,
+				session_id TEXT NOT NULL,
+				parent_id TEXT,
+				text TEXT NOT NULL,
+				created_at INTEGER NOT NULL
+			)`,
+
+			// Notes table (Phase 10: 思绪整理)
+			`CREATE TABLE IF NOT EXISTS notes (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				space_id TEXT DEFAULT 'global',
+				tags TEXT,
+				is_pinned INTEGER NOT NULL DEFAULT 0,
+				category TEXT DEFAULT 'note',
+				word_count INTEGER NOT NULL DEFAULT 0,
+				char_count INTEGER NOT NULL DEFAULT 0,
+				last_viewed_at INTEGER,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL
+			)`,
+
+			// Conversations (multi-turn AI chat, linked to thought sessions)
+			`CREATE TABLE IF NOT EXISTS conversations (
+				id TEXT PRIMARY KEY,
+				session_id TEXT,
+				title TEXT,
+				space_id TEXT DEFAULT 'global',
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL
+			)`,
+
+			// Conversation messages
+			`CREATE TABLE IF NOT EXISTS conversation_messages (
+				id TEXT PRIMARY KEY,
+				conversation_id TEXT NOT NULL,
+				role TEXT NOT NULL,
+				content TEXT NOT NULL,
+				attachments TEXT,
+				pattern_ids TEXT,
+				created_at INTEGER NOT NULL
+			)`,
+
+			// AI usage ledger (one row per provider call)
+			`CREATE TABLE IF NOT EXISTS ai_usage (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				provider TEXT NOT NULL,
+				model TEXT,
+				space_id TEXT,
+				input_tokens INTEGER NOT NULL DEFAULT 0,
+				output_tokens INTEGER NOT NULL DEFAULT 0,
+				latency_ms INTEGER NOT NULL DEFAULT 0,
+				cost REAL NOT NULL DEFAULT 0,
+				estimated INTEGER NOT NULL DEFAULT 0,
+				error TEXT,
+				created_at INTEGER NOT NULL
+			)`,
+
+			// AI response cache
+			`CREATE TABLE IF NOT EXISTS ai_response_cache (
+				key TEXT PRIMARY KEY,
+				provider TEXT NOT NULL,
+				model TEXT,
+				content TEXT NOT NULL,
+				input_tokens INTEGER NOT NULL DEFAULT 0,
+				output_tokens INTEGER NOT NULL DEFAULT 0,
+				finish_reason TEXT,
+				hits INTEGER NOT NULL DEFAULT 0,
+				created_at INTEGER NOT NULL,
+				expires_at INTEGER NOT NULL,
+				last_hit_at INTEGER
+			)`,
+
+			// Pattern provenance (e.g., responses captured from AI output)
+			`CREATE TABLE IF NOT EXISTS pattern_provenance (
+				pattern_id TEXT PRIMARY KEY,
+				source TEXT NOT NULL,
+				provider TEXT,
+				model TEXT,
+				query TEXT,
+				conversation_id TEXT,
+				message_id TEXT,
+				source_pattern_id TEXT,
+				created_at INTEGER NOT NULL
+			)`,
+
+			// Pattern aliases (triggers of patterns merged into another)
+			`CREATE TABLE IF NOT EXISTS pattern_aliases (
+				alias TEXT PRIMARY KEY,
+				pattern_id TEXT NOT NULL,
+				created_at INTEGER NOT NULL
+			)`,
+
+			// Indices - Basic
+			`CREATE INDEX IF NOT EXISTS idx_patterns_trigger ON patterns(trigger)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_strength ON patterns(strength)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_project ON patterns(project)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_tags ON patterns(tags)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_deleted ON patterns(deleted_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_type ON events(type)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events(timestamp)`,
+
+			// Indices - Performance optimization (Iter 43)
+			`CREATE INDEX IF NOT EXISTS idx_patterns_last_used_at ON patterns(last_used_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_updated_at ON patterns(updated_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_project_deleted ON patterns(project, deleted_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_strength_threshold ON patterns(strength, threshold)`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_decay_enabled ON patterns(decay_enabled)`,
+
+			// Notes indices (Phase 10)
+			`CREATE INDEX IF NOT EXISTS idx_notes_category ON notes(category)`,
+			`CREATE INDEX IF NOT EXISTS idx_notes_is_pinned ON notes(is_pinned)`,
+			`CREATE INDEX IF NOT EXISTS idx_notes_created_at ON notes(created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_notes_updated_at ON notes(updated_at)`,
+
+			// Conversation indices
+			`CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_conversation_messages_conv ON conversation_messages(conversation_id)`,
+
+			// Usage indices
+			`CREATE INDEX IF NOT EXISTS idx_ai_usage_created_at ON ai_usage(created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_ai_response_cache_expires_at ON ai_response_cache(expires_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_pattern_aliases_pattern ON pattern_aliases(pattern_id)`,
+		},
+	},
+	{
+		// Databases created before spaces lack the space_id columns
+		Version: 2,
+		Name:    "space_columns",
+		Prepare: func(ctx context.Context, tx *sql.Tx) error {
+			for _, table := range []string{"patterns", "notes", "conversations"} {
+				if err := addColumn(ctx, tx, table, "space_id", "TEXT DEFAULT 'global'"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_patterns_space_id ON patterns(space_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_notes_space_id ON notes(space_id)`,
+		},
+		Down: []string{}, // The columns are part of the baseline for new databases
+	},
+	{
+		// notes.last_viewed was renamed to last_viewed_at
+		Version:     3,
+		Name:        "notes_last_viewed_at",
+		Destructive: true,
+		Prepare: func(ctx context.Context, tx *sql.Tx) error {
+			old, err := hasColumn(ctx, tx, "notes", "last_viewed")
+			if err != nil || !old {
+				return err
+			}
+			renamed, err := hasColumn(ctx, tx, "notes", "last_viewed_at")
+			if err != nil {
+				return err
+			}
+			if renamed {
+				_, err = tx.ExecContext(ctx, `UPDATE notes SET last_viewed_at = last_viewed WHERE last_viewed_at IS NULL`)
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `ALTER TABLE notes RENAME COLUMN last_viewed TO last_viewed_at`)
+			return err
+		},
+		Up:   []string{},
+		Down: []string{},
+	},
+	{
+		// Links between notes and patterns (Note.PatternIDs)
+		Version: 4,
+		Name:    "note_patterns",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS note_patterns (
+				note_id TEXT NOT NULL,
+				pattern_id TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				PRIMARY KEY (note_id, pattern_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_note_patterns_pattern ON note_patterns(pattern_id)`,
+		},
+		Down:        []string{`DROP TABLE IF EXISTS note_patterns`},
+		Destructive: true,
+	},
+	{
+		// Normalized tags shared by patterns and notes, filled from the
+		// JSON tags columns (which are kept in sync as a copy)
+		Version: 5,
+		Name:    "tags",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				created_at INTEGER NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS taggings (
+				tag_id INTEGER NOT NULL,
+				item_type TEXT NOT NULL,
+				item_id TEXT NOT NULL,
+				PRIMARY KEY (tag_id, item_type, item_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_taggings_item ON taggings(item_type, item_id)`,
+			`INSERT OR IGNORE INTO tags (name, created_at)
+				SELECT trim(j.value), strftime('%s', 'now')
+				FROM patterns p, json_each(p.tags) j
+				WHERE p.deleted_at IS NULL AND json_valid(p.tags) AND json_type(p.tags) = 'array'
+					AND j.type = 'text' AND trim(j.value) <> ''
+				ORDER BY p.created_at`,
+			`INSERT OR IGNORE INTO tags (name, created_at)
+				SELECT trim(j.value), strftime('%s', 'now')
+				FROM notes n, json_each(n.tags) j
+				WHERE json_valid(n.tags) AND json_type(n.tags) = 'array'
+					AND j.type = 'text' AND trim(j.value) <> ''
+				ORDER BY n.created_at`,
+			`INSERT OR IGNORE INTO taggings (tag_id, item_type, item_id)
+				SELECT t.id, 'pattern', p.id
+				FROM patterns p, json_each(p.tags) j JOIN tags t ON t.name = trim(j.value)
+				WHERE p.deleted_at IS NULL AND json_valid(p.tags) AND json_type(p.tags) = 'array'
+					AND j.type = 'text'`,
+			`INSERT OR IGNORE INTO taggings (tag_id, item_type, item_id)
+				SELECT t.id, 'note', n.id
+				FROM notes n, json_each(n.tags) j JOIN tags t ON t.name = trim(j.value)
+				WHERE json_valid(n.tags) AND json_type(n.tags) = 'array'
+					AND j.type = 'text'`,
+			// Tag filters use taggings; a JSON text index can't serve them
+			`DROP INDEX IF EXISTS idx_patterns_tags`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS taggings`,
+			`DROP TABLE IF EXISTS tags`,
+			`CREATE INDEX IF NOT EXISTS idx_patterns_tags ON patterns(tags)`,
+		},
+		Destructive: true,
+	},
+	{
+		// Encryption at rest: the wrapped data key and per-space opt-in.
+		// Rolling back drops the key, so it is refused while any space is
+		// encrypted.
+		Version: 6,
+		Name:    "encryption",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS encryption_key (
+				id INTEGER PRIMARY KEY CHECK (id = 1),
+				kdf TEXT NOT NULL,
+				kdf_params TEXT NOT NULL,
+				salt BLOB NOT NULL,
+				wrapped_key BLOB NOT NULL,
+				created_at INTEGER NOT NULL,
+				rotated_at INTEGER
+			)`,
+			`ALTER TABLE spaces ADD COLUMN encrypted INTEGER NOT NULL DEFAULT 0`,
+		},
+		Down: []string{
+			`ALTER TABLE spaces DROP COLUMN encrypted`,
+			`DROP TABLE IF EXISTS encryption_key`,
+		},
+		CheckDown: func(ctx context.Context, db *sql.DB) error {
+			var name string
+			err := db.QueryRowContext(ctx, `SELECT name FROM spaces WHERE encrypted = 1 LIMIT 1`).Scan(&name)
+			switch {
+			case err == sql.ErrNoRows:
+				return nil
+			case err != nil:
+				return fmt.Errorf("failed to check encrypted spaces: %w", err)
+			}
+			return fmt.Errorf("space %q is encrypted; run 'otr space decrypt' first", name)
+		},
+		Destructive: true,
+	},
+	{
+		// Sync between databases: this database's replica ID, the state
+		// of every record at the last sync with each peer, and tombstones
+		// for hard deletes
+		Version: 7,
+		Name:    "sync",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS sync_replica (
+				id INTEGER PRIMARY KEY CHECK (id = 1),
+				replica_id TEXT NOT NULL,
+				created_at INTEGER NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS sync_peers (
+				peer_id TEXT PRIMARY KEY,
+				location TEXT,
+				last_synced_at INTEGER NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS sync_base (
+				peer_id TEXT NOT NULL,
+				item_type TEXT NOT NULL,
+				item_id TEXT NOT NULL,
+				state TEXT NOT NULL,
+				PRIMARY KEY (peer_id, item_type, item_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS sync_tombstones (
+				item_type TEXT NOT NULL,
+				item_id TEXT NOT NULL,
+				deleted_at INTEGER NOT NULL,
+				PRIMARY KEY (item_type, item_id)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS sync_tombstones`,
+			`DROP TABLE IF EXISTS sync_base`,
+			`DROP TABLE IF EXISTS sync_peers`,
+			`DROP TABLE IF EXISTS sync_replica`,
+		},
+		Destructive: true,
+	},
+	{
+		// Change log filled by triggers, so watchers see writes made by
+		// any process (see watch.go)
+		Version: 8,
+		Name:    "change_log",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS change_log (
+				seq INTEGER PRIMARY KEY AUTOINCREMENT,
+				item_type TEXT NOT NULL,
+				item_id TEXT NOT NULL,
+				op TEXT NOT NULL,
+				changed_at INTEGER NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_change_log_changed_at ON change_log(changed_at)`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_pattern_insert AFTER INSERT ON patterns BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at)
+				VALUES ('pattern', NEW.id, CASE WHEN NEW.deleted_at IS NULL THEN 'saved' ELSE 'deleted' END, unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_pattern_update AFTER UPDATE ON patterns BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at)
+				VALUES ('pattern', NEW.id, CASE WHEN NEW.deleted_at IS NULL THEN 'saved' ELSE 'deleted' END, unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_pattern_delete AFTER DELETE ON patterns BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('pattern', OLD.id, 'deleted', unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_note_insert AFTER INSERT ON notes BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('note', NEW.id, 'saved', unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_note_update AFTER UPDATE ON notes BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('note', NEW.id, 'saved', unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_note_delete AFTER DELETE ON notes BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('note', OLD.id, 'deleted', unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_space_insert AFTER INSERT ON spaces BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('space', NEW.id, 'saved', unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_space_update AFTER UPDATE ON spaces BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('space', NEW.id, 'saved', unixepoch());
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS change_log_space_delete AFTER DELETE ON spaces BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('space', OLD.id, 'deleted', unixepoch());
+			END`,
+			// Only removals matter to in-memory response caches
+			`CREATE TRIGGER IF NOT EXISTS change_log_ai_response_delete AFTER DELETE ON ai_response_cache BEGIN
+				INSERT INTO change_log (item_type, item_id, op, changed_at) VALUES ('ai_response', OLD.key, 'deleted', unixepoch());
+			END`,
+		},
+		Down: []string{
+			`DROP TRIGGER IF EXISTS change_log_pattern_insert`,
+			`DROP TRIGGER IF EXISTS change_log_pattern_update`,
+			`DROP TRIGGER IF EXISTS change_log_pattern_delete`,
+			`DROP TRIGGER IF EXISTS change_log_note_insert`,
+			`DROP TRIGGER IF EXISTS change_log_note_update`,
+			`DROP TRIGGER IF EXISTS change_log_note_delete`,
+			`DROP TRIGGER IF EXISTS change_log_space_insert`,
+			`DROP TRIGGER IF EXISTS change_log_space_update`,
+			`DROP TRIGGER IF EXISTS change_log_space_delete`,
+			`DROP TRIGGER IF EXISTS change_log_ai_response_delete`,
+			`DROP TABLE IF EXISTS change_log`,
+		},
+	},
+	{
+		// Sync fingerprints are keyed by a per-replica secret (see
+		// sync.go). The plain hashes recorded so far are dropped; the next
+		// sync with each peer reports the records that differ as conflicts.
+		Version: 9,
+		Name:    "sync_secret",
+		Up: []string{
+			`ALTER TABLE sync_replica ADD COLUMN secret TEXT`,
+			`DELETE FROM sync_base`,
+		},
+		Down:        []string{`ALTER TABLE sync_replica DROP COLUMN secret`},
+		Destructive: true,
+	},
+}
@@ -0,0 +1,273 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func openTestDatabase(t *testing.T, path string) *Database {
+	t.Helper()
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestDatabase_MigrateRecordsVersions(t *testing.T) {
+	db := openTestDatabase(t, ":memory:")
+	ctx := context.Background()
+
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	version, err := db.SchemaVersion(ctx)
+	if err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("expected version %d, got %d (%v)", LatestSchemaVersion(), version, err)
+	}
+
+	// Running again is a no-op
+	results, err := db.MigrateTo(ctx, 0)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("expected nothing to apply, got %v (%v)", results, err)
+	}
+
+	states, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	for _, s := range states {
+		if !s.Applied || s.Modified || s.Unknown {
+			t.Errorf("unexpected state %+v", s)
+		}
+	}
+}
+
+func TestDatabase_MigrateUpgradesOldSchema(t *testing.T) {
+	db := openTestDatabase(t, ":memory:")
+	ctx := context.Background()
+
+	// A database from before spaces and the last_viewed_at rename
+	for _, stmt := range []string{
+		`CREATE TABLE patterns (id TEXT PRIMARY KEY, trigger TEXT NOT NULL, response TEXT NOT NULL,
+			strength REAL NOT NULL DEFAULT 0, threshold REAL NOT NULL DEFAULT 50,
+			decay_rate REAL NOT NULL DEFAULT 0.01, decay_enabled INTEGER NOT NULL DEFAULT 1,
+			connections TEXT, created_at INTEGER NOT NULL, updated_at INTEGER NOT NULL,
+			reinforcement_count INTEGER NOT NULL DEFAULT 0, decay_count INTEGER NOT NULL DEFAULT 0,
+			last_used_at INTEGER, tags TEXT, project TEXT, user_id TEXT, deleted_at INTEGER)`,
+		`CREATE TABLE notes (id TEXT PRIMARY KEY, title TEXT NOT NULL, content TEXT NOT NULL,
+			tags TEXT, is_pinned INTEGER NOT NULL DEFAULT 0, category TEXT DEFAULT 'note',
+			word_count INTEGER NOT NULL DEFAULT 0, char_count INTEGER NOT NULL DEFAULT 0,
+			last_viewed INTEGER, created_at INTEGER NOT NULL, updated_at INTEGER NOT NULL)`,
+		`INSERT INTO notes (id, title, content, last_viewed, created_at, updated_at) VALUES ('n1', 'Old', 'x', 42, 1, 1)`,
+	} {
+		if _, err := db.db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	storage := NewStorage(db)
+	note, err := storage.GetNote(ctx, "n1")
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+	if note.SpaceID != "global" || note.LastViewed == nil || note.LastViewed.Unix() != 42 {
+		t.Errorf("expected migrated note, got %+v", note)
+	}
+}
+
+func TestDatabase_MigrateRejectsChangedMigration(t *testing.T) {
+	db := openTestDatabase(t, ":memory:")
+	ctx := context.Background()
+
+	list := []*Migration{{Version: 1, Name: "one", Up: []string{`CREATE TABLE a (id TEXT)`}}}
+	if _, err := db.migrate(ctx, list, 0); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	edited := []*Migration{{Version: 1, Name: "one", Up: []string{`CREATE TABLE a (id INTEGER)`}}}
+	if _, err := db.migrate(ctx, edited, 0); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+	states, _ := db.migrationStatus(ctx, edited)
+	if len(states) != 1 || !states[0].Modified {
+		t.Errorf("expected modified state, got %+v", states)
+	}
+
+	// A database migrated by a newer build is left alone
+	newer := append(list, &Migration{Version: 2, Name: "two", Up: []string{`CREATE TABLE b (id TEXT)`}})
+	if _, err := db.migrate(ctx, newer, 0); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := db.migrate(ctx, list, 0); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected newer schema error, got %v", err)
+	}
+}
+
+func TestDatabase_MigrateRunsInTransaction(t *testing.T) {
+	db := openTestDatabase(t, ":memory:")
+	ctx := context.Background()
+
+	list := []*Migration{
+		{Version: 1, Name: "one", Up: []string{`CREATE TABLE a (id TEXT)`}},
+		{Version: 2, Name: "broken", Up: []string{`CREATE TABLE b (id TEXT)`, `NOT SQL`}},
+	}
+	results, err := db.migrate(ctx, list, 0)
+	if err == nil || !strings.Contains(err.Error(), "migration 2 (broken)") {
+		t.Fatalf("expected migration 2 to fail, got %v", err)
+	}
+	if len(results) != 1 || results[0].Version != 1 {
+		t.Errorf("expected only migration 1 applied, got %+v", results)
+	}
+	if version, _ := db.SchemaVersion(ctx); version != 1 {
+		t.Errorf("expected version 1, got %d", version)
+	}
+	var name string
+	err = db.db.QueryRowContext(ctx, `SELECT name FROM sqlite_master WHERE name = 'b'`).Scan(&name)
+	if err != sql.ErrNoRows {
+		t.Errorf("expected table b to be rolled back, got %q (%v)", name, err)
+	}
+}
+
+func TestDatabase_RollbackWithBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	db := openTestDatabase(t, path)
+	ctx := context.Background()
+
+	list := []*Migration{
+		{Version: 1, Name: "base", Up: []string{`CREATE TABLE a (id TEXT)`}},
+		{
+			Version:     2,
+			Name:        "drop_a",
+			Up:          []string{`CREATE TABLE b (id TEXT)`, `DROP TABLE a`},
+			Down:        []string{`CREATE TABLE a (id TEXT)`, `DROP TABLE b`},
+			Destructive: true,
+		},
+	}
+	if _, err := db.migrate(ctx, list, 1); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	results, err := db.migrate(ctx, list, 0)
+	if err != nil || len(results) != 1 || results[0].Backup == "" {
+		t.Fatalf("expected a backup before the destructive step, got %+v (%v)", results, err)
+	}
+	if _, err := os.Stat(results[0].Backup); err != nil {
+		t.Errorf("backup missing: %v", err)
+	}
+
+	// Migration 1 has no down statements, so only one step can be undone
+	if _, err := db.rollback(ctx, list, 2); err == nil || !strings.Contains(err.Error(), "cannot be rolled back") {
+		t.Errorf("expected irreversible error, got %v", err)
+	}
+	if version, _ := db.SchemaVersion(ctx); version != 2 {
+		t.Errorf("failed rollback should change nothing, got version %d", version)
+	}
+
+	results, err = db.rollback(ctx, list, 1)
+	if err != nil || len(results) != 1 || results[0].Version != 2 || results[0].Backup == "" {
+		t.Fatalf("unexpected rollback result %+v (%v)", results, err)
+	}
+	if version, _ := db.SchemaVersion(ctx); version != 1 {
+		t.Errorf("expected version 1, got %d", version)
+	}
+	if _, err := db.db.ExecContext(ctx, `INSERT INTO a (id) VALUES ('x')`); err != nil {
+		t.Errorf("expected table a to be restored: %v", err)
+	}
+}
+
+func TestDatabase_MigratePinsOlderTarget(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(t.TempDir(), "data.db"))
+	ctx := context.Background()
+	latest := LatestSchemaVersion()
+
+	if _, err := db.MigrateTo(ctx, latest-1); err != nil {
+		t.Fatalf("MigrateTo failed: %v", err)
+	}
+	if pinned, err := db.PinnedVersion(ctx); err != nil || pinned != latest-1 {
+		t.Fatalf("expected pin %d, got %d (%v)", latest-1, pinned, err)
+	}
+
+	// Startup migration stops at the pin
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if version, _ := db.SchemaVersion(ctx); version != latest-1 {
+		t.Fatalf("expected version %d, got %d", latest-1, version)
+	}
+
+	// Migrating to the latest version removes the pin
+	if _, err := db.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("MigrateTo failed: %v", err)
+	}
+	if pinned, _ := db.PinnedVersion(ctx); pinned != 0 {
+		t.Fatalf("expected no pin, got %d", pinned)
+	}
+
+	// A rollback pins the version it leaves behind
+	if _, err := db.Rollback(ctx, 1); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if version, _ := db.SchemaVersion(ctx); version != latest-1 {
+		t.Errorf("rolled back migration was applied again (version %d)", version)
+	}
+}
+
+func TestDatabase_RollbackBlocksStorageUntilMigrated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.db")
+	db := openTestDatabase(t, path)
+	ctx := context.Background()
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if err := db.InitDefaultSpaces(ctx); err != nil {
+		t.Fatalf("InitDefaultSpaces failed: %v", err)
+	}
+	if _, err := db.Rollback(ctx, 5); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	db.Close()
+
+	// Startup migrates up to the pin, and the schema is then too old
+	db = openTestDatabase(t, path)
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if err := db.CheckSchema(ctx); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("expected ErrSchemaBehind after a rollback, got %v", err)
+	}
+
+	// 'otr db migrate' brings it back, and storage works again
+	if _, err := db.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("MigrateTo failed: %v", err)
+	}
+	if err := db.CheckSchema(ctx); err != nil {
+		t.Fatalf("CheckSchema failed: %v", err)
+	}
+	s := NewStorage(db)
+	note := models.NewNote("After rollback", "still writable")
+	if err := s.SaveNote(ctx, note); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	if err := s.DeleteNote(ctx, note.ID); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+	if err := s.SavePattern(ctx, models.NewPattern("after", "rollback")); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== Note–Pattern Links ====================
+
+// ListNotePatterns returns the patterns linked to a note, oldest link first.
+// Deleted patterns are skipped.
+func (s *Storage) ListNotePatterns(ctx context.Context, noteID string) ([]*models.Pattern, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT p.id, p.trigger, p.response, p.strength, p.threshold, p.decay_rate, p.decay_enabled,
+			p.connections, p.created_at, p.updated_at, p.reinforcement_count, p.decay_count,
+			p.last_used_at, p.tags, p.project, p.user_id
+		FROM note_patterns np JOIN patterns p ON p.id = np.pattern_id
+		WHERE np.note_id = ? AND p.deleted_at IS NULL
+		ORDER BY np.created_at, np.rowid
+	`, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list linked patterns: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanPatterns(rows)
+}
+
+// ListPatternNotes returns the notes linked to a pattern, most recently
+// updated first.
+func (s *Storage) ListPatternNotes(ctx context.Context, patternID string) ([]*models.Note, error) {
+	cols := "n." + strings.ReplaceAll(noteColumns, ", ", ", n.")
+	return s.queryNotes(ctx, `
+		SELECT `+cols+`
+		FROM note_patterns np JOIN notes n ON n.id = np.note_id
+		WHERE np.pattern_id = ?
+		ORDER BY n.updated_at DESC
+	`, patternID)
+}
+
+// saveNoteLinks replaces the pattern links of a note with note.PatternIDs.
+// Links that already exist keep their creation time.
+func saveNoteLinks(ctx context.Context, tx *sql.Tx, note *models.Note) error {
+	query := `DELETE FROM note_patterns WHERE note_id = ?`
+	args := []interface{}{note.ID}
+	if len(note.PatternIDs) > 0 {
+		query += ` AND pattern_id NOT IN (?` + strings.Repeat(",?", len(note.PatternIDs)-1) + `)`
+		for _, id := range note.PatternIDs {
+			args = append(args, id)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to clear note links: %w", err)
+	}
+	now := time.Now().Unix()
+	for _, patternID := range note.PatternIDs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO note_patterns (note_id, pattern_id, created_at) VALUES (?, ?, ?)
+		`, note.ID, patternID, now); err != nil {
+			return fmt.Errorf("failed to link pattern %s: %w", patternID, err)
+		}
+	}
+	return nil
+}
+
+// loadNoteLinks fills in PatternIDs for notes.
+func (s *Storage) loadNoteLinks(ctx context.Context, notes []*models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	byID := make(map[string]*models.Note, len(notes))
+	placeholders := make([]string, 0, len(notes))
+	args := make([]interface{}, 0, len(notes))
+	for _, n := range notes {
+		n.PatternIDs = nil
+		if _, ok := byID[n.ID]; !ok {
+			placeholders = append(placeholders, "?")
+			args = append(args, n.ID)
+		}
+		byID[n.ID] = n
+	}
+
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT note_id, pattern_id FROM note_patterns
+		WHERE note_id IN (`+strings.Join(placeholders, ",")+`)
+		ORDER BY created_at, rowid
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to load note links: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID, patternID string
+		if err := rows.Scan(&noteID, &patternID); err != nil {
+			return fmt.Errorf("failed to load note links: %w", err)
+		}
+		n := byID[noteID]
+		n.PatternIDs = append(n.PatternIDs, patternID)
+	}
+	return rows.Err()
+}
+
+// unlinkPattern removes all note links of a deleted pattern.
+func unlinkPattern(ctx context.Context, ex execer, patternID string) error {
+	if _, err := ex.ExecContext(ctx, `DELETE FROM note_patterns WHERE pattern_id = ?`, patternID); err != nil {
+		return fmt.Errorf("failed to unlink pattern %s: %w", patternID, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func TestStorage_NoteLinks(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	api := models.NewPattern("api", "REST API")
+	db := models.NewPattern("db", "SQLite")
+	for _, p := range []*models.Pattern{api, db} {
+		if err := storage.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+
+	note := models.NewNote("Design", "Notes on the design")
+	note.AddPattern(api.ID)
+	if err := storage.SaveNote(ctx, note); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	// Links are saved by UpdateNote and loaded by the note queries
+	got, err := storage.GetNote(ctx, note.ID)
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+	got.AddPattern(db.ID)
+	if err := storage.UpdateNote(ctx, got); err != nil {
+		t.Fatalf("UpdateNote failed: %v", err)
+	}
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil || len(notes) != 1 || len(notes[0].PatternIDs) != 2 || notes[0].PatternIDs[0] != api.ID {
+		t.Fatalf("expected two links, got %+v (%v)", notes, err)
+	}
+
+	patterns, err := storage.ListNotePatterns(ctx, note.ID)
+	if err != nil || len(patterns) != 2 {
+		t.Fatalf("expected two linked patterns, got %d (%v)", len(patterns), err)
+	}
+	linked, err := storage.ListPatternNotes(ctx, db.ID)
+	if err != nil || len(linked) != 1 || linked[0].ID != note.ID {
+		t.Fatalf("expected the note linked to db, got %+v (%v)", linked, err)
+	}
+
+	// Deleting a pattern removes its links
+	if err := storage.DeletePattern(ctx, db.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	got, _ = storage.GetNote(ctx, note.ID)
+	if len(got.PatternIDs) != 1 || got.PatternIDs[0] != api.ID {
+		t.Errorf("expected only the api link, got %v", got.PatternIDs)
+	}
+
+	// Deleting the note removes the rest
+	if err := storage.DeleteNote(ctx, note.ID); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+	linked, err = storage.ListPatternNotes(ctx, api.ID)
+	if err != nil || len(linked) != 0 {
+		t.Errorf("expected no linked notes, got %d (%v)", len(linked), err)
+	}
+}
+
+func TestStorage_MergePatternsMovesNoteLinks(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	keep := models.NewPattern("deploy app", "make release")
+	dup := models.NewPattern("deploy the app", "run make release")
+	for _, p := range []*models.Pattern{keep, dup} {
+		if err := storage.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	both := models.NewNote("Both", "x")
+	both.PatternIDs = []string{keep.ID, dup.ID}
+	onlyDup := models.NewNote("Dup", "y")
+	onlyDup.PatternIDs = []string{dup.ID}
+	for _, n := range []*models.Note{both, onlyDup} {
+		if err := storage.SaveNote(ctx, n); err != nil {
+			t.Fatalf("SaveNote failed: %v", err)
+		}
+	}
+
+	if err := storage.MergePatterns(ctx, []*models.PatternMerge{{Keep: keep, Merged: []string{dup.ID}}}); err != nil {
+		t.Fatalf("MergePatterns failed: %v", err)
+	}
+	linked, err := storage.ListPatternNotes(ctx, keep.ID)
+	if err != nil || len(linked) != 2 {
+		t.Fatalf("expected both notes linked to the kept pattern, got %d (%v)", len(linked), err)
+	}
+	for _, n := range linked {
+		if len(n.PatternIDs) != 1 || n.PatternIDs[0] != keep.ID {
+			t.Errorf("note %s: expected one link to the kept pattern, got %v", n.Title, n.PatternIDs)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== Pattern Provenance ====================
+
+// SavePatternProvenance stores the provenance of a pattern's response,
+// replacing any previous record.
+func (s *Storage) SavePatternProvenance(ctx context.Context, p *models.PatternProvenance) error {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	_, err := s.db.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO pattern_provenance
+			(pattern_id, source, provider, model, query, conversation_id, message_id, source_pattern_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, p.PatternID, p.Source, nullIfEmpty(p.Provider), nullIfEmpty(p.Model), nullIfEmpty(p.Query),
+		nullIfEmpty(p.ConversationID), nullIfEmpty(p.MessageID), nullIfEmpty(p.SourcePatternID), p.CreatedAt.Unix())
+	return err
+}
+
+// GetPatternProvenance returns the provenance of a pattern, or nil if it
+// has none (e.g., it was written by hand).
+func (s *Storage) GetPatternProvenance(ctx context.Context, patternID string) (*models.PatternProvenance, error) {
+	var p models.PatternProvenance
+	var provider, model, query, convID, msgID, sourceID sql.NullString
+	var createdAt sql.NullInt64
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT pattern_id, source, provider, model, query, conversation_id, message_id, source_pattern_id, created_at
+		FROM pattern_provenance WHERE pattern_id = ?
+	`, patternID).Scan(&p.PatternID, &p.Source, &provider, &model, &query, &convID, &msgID, &sourceID, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Provider = provider.String
+	p.Model = model.String
+	p.Query = query.String
+	p.ConversationID = convID.String
+	p.MessageID = msgID.String
+	p.SourcePatternID = sourceID.String
+	p.CreatedAt = int64ToTime(createdAt)
+	return &p, nil
+}
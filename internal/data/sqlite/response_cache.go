@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== AI Response Cache ====================
+
+// GetCachedResponse returns the live cache entry for key and records a hit.
+// Returns nil (and no error) on a miss or an expired entry.
+func (s *Storage) GetCachedResponse(ctx context.Context, key string, now time.Time) (*models.CachedResponse, error) {
+	var c models.CachedResponse
+	var model, finishReason sql.NullString
+	var createdAt, expiresAt, lastHitAt sql.NullInt64
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT key, provider, model, content, input_tokens, output_tokens, finish_reason,
+			hits, created_at, expires_at, last_hit_at
+		FROM ai_response_cache WHERE key = ? AND expires_at > ?
+	`, key, now.Unix()).Scan(&c.Key, &c.Provider, &model, &c.Content, &c.InputTokens,
+		&c.OutputTokens, &finishReason, &c.Hits, &createdAt, &expiresAt, &lastHitAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Model = model.String
+	c.FinishReason = finishReason.String
+	c.CreatedAt = int64ToTime(createdAt)
+	c.ExpiresAt = int64ToTime(expiresAt)
+	c.LastHitAt = int64ToTimePtr(lastHitAt)
+
+	if _, err := s.db.db.ExecContext(ctx, `
+		UPDATE ai_response_cache SET hits = hits + 1, last_hit_at = ? WHERE key = ?
+	`, now.Unix(), key); err != nil {
+		return nil, err
+	}
+	c.Hits++
+	c.LastHitAt = &now
+	return &c, nil
+}
+
+// PutCachedResponse stores or replaces a cache entry. Expired entries are
+// dropped and, when maxEntries > 0, the least recently used entries beyond
+// that limit are evicted.
+func (s *Storage) PutCachedResponse(ctx context.Context, c *models.CachedResponse, maxEntries int) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO ai_response_cache
+			(key, provider, model, content, input_tokens, output_tokens, finish_reason, hits, created_at, expires_at, last_hit_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, NULL)
+	`, c.Key, c.Provider, nullIfEmpty(c.Model), c.Content, c.InputTokens, c.OutputTokens,
+		nullIfEmpty(c.FinishReason), c.CreatedAt.Unix(), c.ExpiresAt.Unix()); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM ai_response_cache WHERE expires_at <= ?
+	`, c.CreatedAt.Unix()); err != nil {
+		return err
+	}
+
+	if maxEntries > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM ai_response_cache WHERE key IN (
+				SELECT key FROM ai_response_cache
+				ORDER BY COALESCE(last_hit_at, created_at) DESC, rowid DESC
+				LIMIT -1 OFFSET ?
+			)
+		`, maxEntries); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ResponseCacheStats summarizes the response cache at now.
+func (s *Storage) ResponseCacheStats(ctx context.Context, now time.Time) (*models.ResponseCacheStats, error) {
+	var stats models.ResponseCacheStats
+	var oldest, newest sql.NullInt64
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN expires_at <= ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(hits), 0),
+			COALESCE(SUM(LENGTH(CAST(content AS BLOB))), 0),
+			COALESCE(SUM(hits * (input_tokens + output_tokens)), 0),
+			MIN(created_at),
+			MAX(created_at)
+		FROM ai_response_cache
+	`, now.Unix()).Scan(&stats.Entries, &stats.Expired, &stats.Hits, &stats.Bytes,
+		&stats.SavedTokens, &oldest, &newest)
+	if err != nil {
+		return nil, err
+	}
+	stats.OldestEntry = int64ToTimePtr(oldest)
+	stats.NewestEntry = int64ToTimePtr(newest)
+	return &stats, nil
+}
+
+// ClearResponseCache deletes cache entries and returns how many were removed.
+// With expiredOnly, only entries past their expiry at now are removed.
+func (s *Storage) ClearResponseCache(ctx context.Context, expiredOnly bool, now time.Time) (int64, error) {
+	query := `DELETE FROM ai_response_cache`
+	var args []interface{}
+	if expiredOnly {
+		query += ` WHERE expires_at <= ?`
+		args = append(args, now.Unix())
+	}
+	result, err := s.db.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"context"
+	"crypto/cipher"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -21,6 +22,9 @@ type Storage struct {
 	mu        sync.RWMutex
 	queryCache *QueryCache  // Iter 49
 
+	// dataKey seals encrypted fields; nil while locked
+	dataKey cipher.AEAD
+
 	// Concurrency statistics (Iter 47)
 	stats StorageStats
 }
@@ -43,13 +47,36 @@ func NewStorage(db *Database) *Storage {
 	}
 }
 
+// Database returns the underlying database
+func (s *Storage) Database() *Database {
+	return s.db
+}
+
 // SavePattern saves a pattern to the database
 func (s *Storage) SavePattern(ctx context.Context, p *models.Pattern) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.savePattern(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// savePattern saves a pattern within tx.
+func (s *Storage) savePattern(ctx context.Context, tx *sql.Tx, p *models.Pattern) error {
 	// Validate pattern
 	if err := p.Validate(); err != nil {
 		return err
 	}
 
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	p.Tags = models.NormalizeTags(p.Tags)
 	connections, _ := json.Marshal(p.Connections)
 	tags, _ := json.Marshal(p.Tags)
 
@@ -64,36 +91,43 @@ func (s *Storage) SavePattern(ctx context.Context, p *models.Pattern) error {
 		p.SpaceID = "global"
 	}
 
-	_, err := s.db.db.ExecContext(ctx, `
+	sealed, err := s.seal(ctx, tx, p.SpaceID, p.ID, fieldPatternResponse, p.Response)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
 		INSERT OR REPLACE INTO patterns (
 			id, trigger, response, strength, threshold, decay_rate, decay_enabled,
 			connections, created_at, updated_at, reinforcement_count, decay_count,
 			last_used_at, tags, project, user_id, space_id, deleted_at
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
-		p.ID, p.Trigger, p.Response, p.Strength, p.Threshold, p.DecayRate, p.DecayEnabled,
+		p.ID, p.Trigger, sealed[0], p.Strength, p.Threshold, p.DecayRate, p.DecayEnabled,
 		string(connections), p.CreatedAt.Unix(), p.UpdatedAt.Unix(), p.ReinforceCnt, p.DecayCnt,
 		int64TimeToPtr(p.LastUsedAt), string(tags), p.Project, p.UserID, p.SpaceID, int64TimeToPtr(p.DeletedAt),
 	)
-
-	return err
+	if err != nil {
+		return err
+	}
+	return syncPatternTaggings(ctx, tx, p)
 }
 
 // GetPattern retrieves a pattern by ID
 func (s *Storage) GetPattern(ctx context.Context, id string) (*models.Pattern, error) {
 	var p models.Pattern
-	var connections, tags sql.NullString
+	var connections, tags, spaceID sql.NullString
 	var lastUsedAt, deletedAt, createdAt, updatedAt sql.NullInt64
 
 	err := s.db.db.QueryRowContext(ctx, `
 		SELECT id, trigger, response, strength, threshold, decay_rate, decay_enabled,
 			connections, created_at, updated_at, reinforcement_count, decay_count,
-			last_used_at, tags, project, user_id, deleted_at
+			last_used_at, tags, project, user_id, space_id, deleted_at
 		FROM patterns WHERE id = ? AND deleted_at IS NULL
 	`, id).Scan(
 		&p.ID, &p.Trigger, &p.Response, &p.Strength, &p.Threshold, &p.DecayRate, &p.DecayEnabled,
 		&connections, &createdAt, &updatedAt, &p.ReinforceCnt, &p.DecayCnt,
-		&lastUsedAt, &tags, &p.Project, &p.UserID, &deletedAt,
+		&lastUsedAt, &tags, &p.Project, &p.UserID, &spaceID, &deletedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -118,6 +152,8 @@ func (s *Storage) GetPattern(ctx context.Context, id string) (*models.Pattern, e
 	p.UpdatedAt = int64ToTime(updatedAt)
 	p.LastUsedAt = int64ToTimePtr(lastUsedAt)
 	p.DeletedAt = int64ToTimePtr(deletedAt)
+	p.SpaceID = spaceID.String
+	s.openPatterns(&p)
 
 	return &p, nil
 }
@@ -147,6 +183,13 @@ func (s *Storage) ListPatterns(ctx context.Context, opts contracts.ListOptions)
 		args = append(args, opts.MinStrength)
 	}
 
+	// Filter by tag, including descendants ("api" matches "api/users")
+	if len(opts.Tags) > 0 {
+		cond, condArgs := taggedFilter(tagItemPattern, opts.Tags)
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+
 	// Add ORDER BY for consistency
 	query += " ORDER BY updated_at DESC"
 
@@ -198,6 +241,7 @@ func (s *Storage) ListPatterns(ctx context.Context, opts contracts.ListOptions)
 
 		patterns = append(patterns, &p)
 	}
+	s.openPatterns(patterns...)
 
 	return patterns, rows.Err()
 }
@@ -233,6 +277,36 @@ func (s *Storage) GetLatestThoughtSession(ctx context.Context) (*models.ThoughtS
 	return &sess, nil
 }
 
+// ListThoughtSessionsSince returns sessions updated at or after since,
+// most recent first.
+func (s *Storage) ListThoughtSessionsSince(ctx context.Context, since time.Time) ([]*models.ThoughtSession, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT id, title, created_at, updated_at
+		FROM thought_sessions
+		WHERE updated_at >= ?
+		ORDER BY updated_at DESC
+	`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.ThoughtSession
+	for rows.Next() {
+		var sess models.ThoughtSession
+		var title sql.NullString
+		var createdAt, updatedAt sql.NullInt64
+		if err := rows.Scan(&sess.ID, &title, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		sess.Title = title.String
+		sess.CreatedAt = int64ToTime(createdAt)
+		sess.UpdatedAt = int64ToTime(updatedAt)
+		sessions = append(sessions, &sess)
+	}
+	return sessions, rows.Err()
+}
+
 // AddThoughtNode inserts a thought node.
 func (s *Storage) AddThoughtNode(ctx context.Context, node *models.ThoughtNode) error {
 	_, err := s.db.db.ExecContext(ctx, `
@@ -285,32 +359,94 @@ func nullIfEmpty(s string) interface{} {
 	return s
 }
 
-// DeletePattern soft deletes a pattern
+// DeletePattern soft deletes a pattern and removes its note links
 func (s *Storage) DeletePattern(ctx context.Context, id string) error {
-	now := time.Now()
-	_, err := s.db.db.ExecContext(ctx, `
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deletePattern(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deletePattern soft deletes a pattern within ex.
+func deletePattern(ctx context.Context, ex execer, id string) error {
+	if _, err := ex.ExecContext(ctx, `
 		UPDATE patterns SET deleted_at = ? WHERE id = ?
-	`, now.Unix(), id)
-	return err
+	`, time.Now().Unix(), id); err != nil {
+		return err
+	}
+	if err := unlinkPattern(ctx, ex, id); err != nil {
+		return err
+	}
+	return untagItem(ctx, ex, tagItemPattern, id)
 }
 
 // MovePatternToSpace moves a pattern to a different space
+// The response is re-encrypted or decrypted to match the new space.
 func (s *Storage) MovePatternToSpace(ctx context.Context, patternID, newSpaceID string) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var response string
+	err = tx.QueryRowContext(ctx, `SELECT response FROM patterns WHERE id = ?`, patternID).Scan(&response)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	if response, err = openField(key, fieldPatternResponse, patternID, response); err != nil {
+		return err
+	}
+	sealed, err := s.seal(ctx, tx, newSpaceID, patternID, fieldPatternResponse, response)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now()
-	_, err := s.db.db.ExecContext(ctx, `
-		UPDATE patterns SET space_id = ?, updated_at = ? WHERE id = ?
-	`, newSpaceID, now.Unix(), patternID)
-	return err
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE patterns SET space_id = ?, response = ?, updated_at = ? WHERE id = ?
+	`, newSpaceID, sealed[0], now.Unix(), patternID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // UpdatePattern updates an existing pattern
 func (s *Storage) UpdatePattern(ctx context.Context, p *models.Pattern) error {
 	p.UpdatedAt = time.Now()
 
+	p.Tags = models.NormalizeTags(p.Tags)
 	connections, _ := json.Marshal(p.Connections)
 	tags, _ := json.Marshal(p.Tags)
 
-	_, err := s.db.db.ExecContext(ctx, `
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	spaceID, err := patternSpace(ctx, tx, p.ID)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.seal(ctx, tx, spaceID, p.ID, fieldPatternResponse, p.Response)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
 		UPDATE patterns SET
 			trigger = ?, response = ?, strength = ?, threshold = ?,
 			decay_rate = ?, decay_enabled = ?, connections = ?,
@@ -318,14 +454,24 @@ func (s *Storage) UpdatePattern(ctx context.Context, p *models.Pattern) error {
 			last_used_at = ?, tags = ?, project = ?
 		WHERE id = ?
 	`,
-		p.Trigger, p.Response, p.Strength, p.Threshold,
+		p.Trigger, sealed[0], p.Strength, p.Threshold,
 		p.DecayRate, p.DecayEnabled, string(connections),
 		p.UpdatedAt.Unix(), p.ReinforceCnt, p.DecayCnt,
 		int64TimeToPtr(p.LastUsedAt), string(tags), p.Project,
 		p.ID,
 	)
-
-	return err
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("pattern not found: %s", p.ID)
+	}
+	if err := syncPatternTaggings(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // CreateSpace creates a new space
@@ -336,13 +482,29 @@ func (s *Storage) CreateSpace(ctx context.Context, space *models.Space) error {
 	}
 	space.UpdatedAt = now
 
-	_, err := s.db.db.ExecContext(ctx, `
-		INSERT OR REPLACE INTO spaces (id, name, description, owner, is_default, pattern_limit, pattern_count, created_at, updated_at)
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO spaces (id, name, description, owner, is_default, pattern_limit, pattern_count, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name, description = excluded.description, owner = excluded.owner,
+			is_default = excluded.is_default, pattern_limit = excluded.pattern_limit,
+			pattern_count = excluded.pattern_count, created_at = excluded.created_at,
+			updated_at = excluded.updated_at
 	`, space.ID, space.Name, space.Description, space.Owner, boolToInt(space.DefaultSpace),
-		space.PatternLimit, space.PatternCount, space.CreatedAt.Unix(), space.UpdatedAt.Unix())
-
-	return err
+		space.PatternLimit, space.PatternCount, space.CreatedAt.Unix(), space.UpdatedAt.Unix()); err != nil {
+		return err
+	}
+	// A space created again under a deleted ID is no longer deleted
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sync_tombstones WHERE item_type = ? AND item_id = ?`, syncItemSpace, space.ID); err != nil {
+		return fmt.Errorf("failed to clear tombstone: %w", err)
+	}
+	return tx.Commit()
 }
 
 // GetSpace retrieves a space by ID
@@ -352,11 +514,11 @@ func (s *Storage) GetSpace(ctx context.Context, id string) (*models.Space, error
 	var createdAt, updatedAt sql.NullInt64
 
 	err := s.db.db.QueryRowContext(ctx, `
-		SELECT id, name, description, owner, is_default, pattern_limit, pattern_count, created_at, updated_at
+		SELECT id, name, description, owner, is_default, pattern_limit, pattern_count, encrypted, created_at, updated_at
 		FROM spaces WHERE id = ?
 	`, id).Scan(
 		&space.ID, &space.Name, &space.Description, &ownerNull, &space.DefaultSpace,
-		&space.PatternLimit, &space.PatternCount, &createdAt, &updatedAt,
+		&space.PatternLimit, &space.PatternCount, &space.Encrypted, &createdAt, &updatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -375,7 +537,7 @@ func (s *Storage) GetSpace(ctx context.Context, id string) (*models.Space, error
 // ListSpaces lists all spaces
 func (s *Storage) ListSpaces(ctx context.Context) ([]*models.Space, error) {
 	rows, err := s.db.db.QueryContext(ctx, `
-		SELECT id, name, description, owner, is_default, pattern_limit, pattern_count, created_at, updated_at
+		SELECT id, name, description, owner, is_default, pattern_limit, pattern_count, encrypted, created_at, updated_at
 		FROM spaces ORDER BY name
 	`)
 	if err != nil {
@@ -390,7 +552,7 @@ func (s *Storage) ListSpaces(ctx context.Context) ([]*models.Space, error) {
 		var createdAt, updatedAt sql.NullInt64
 		err := rows.Scan(
 			&space.ID, &space.Name, &space.Description, &ownerNull, &space.DefaultSpace,
-			&space.PatternLimit, &space.PatternCount, &createdAt, &updatedAt,
+			&space.PatternLimit, &space.PatternCount, &space.Encrypted, &createdAt, &updatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -425,7 +587,13 @@ func (s *Storage) UpdateSpace(ctx context.Context, space *models.Space) error {
 
 // DeleteSpace deletes a space by ID.
 func (s *Storage) DeleteSpace(ctx context.Context, id string) error {
-	result, err := s.db.db.ExecContext(ctx, `DELETE FROM spaces WHERE id = ?`, id)
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM spaces WHERE id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete space: %w", err)
 	}
@@ -438,7 +606,11 @@ func (s *Storage) DeleteSpace(ctx context.Context, id string) error {
 		return fmt.Errorf("space not found: %s", id)
 	}
 
-	return nil
+	// Sync deletes the space on other databases too
+	if err := addTombstone(ctx, tx, syncItemSpace, id, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // SetDefaultSpace sets a space as the default space.
@@ -465,11 +637,11 @@ func (s *Storage) GetDefaultSpace(ctx context.Context) (*models.Space, error) {
 	var createdAt, updatedAt sql.NullInt64
 
 	err := s.db.db.QueryRowContext(ctx, `
-		SELECT id, name, description, owner, is_default, pattern_limit, pattern_count, created_at, updated_at
+		SELECT id, name, description, owner, is_default, pattern_limit, pattern_count, encrypted, created_at, updated_at
 		FROM spaces WHERE is_default = 1
 	`).Scan(
 		&space.ID, &space.Name, &space.Description, &ownerNull, &space.DefaultSpace,
-		&space.PatternLimit, &space.PatternCount, &createdAt, &updatedAt,
+		&space.PatternLimit, &space.PatternCount, &space.Encrypted, &createdAt, &updatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -486,13 +658,14 @@ func (s *Storage) GetDefaultSpace(ctx context.Context) (*models.Space, error) {
 	return &space, nil
 }
 
-// BeginTx starts a new transaction
+// BeginTx starts a new transaction. It holds the only connection, so
+// other operations wait until it ends.
 func (s *Storage) BeginTx(ctx context.Context) (contracts.Transaction, error) {
 	tx, err := s.db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	return &transaction{tx: tx}, nil
+	return &transaction{s: s, tx: tx}, nil
 }
 
 // Close closes the storage and releases cached statements
@@ -559,8 +732,8 @@ func (s *Storage) SavePatternsBatch(ctx context.Context, patterns []*models.Patt
 		INSERT OR REPLACE INTO patterns (
 			id, trigger, response, strength, threshold, decay_rate, decay_enabled,
 			connections, created_at, updated_at, reinforcement_count, decay_count,
-			last_used_at, tags, project, user_id, deleted_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			last_used_at, tags, project, user_id, space_id, deleted_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -569,6 +742,7 @@ func (s *Storage) SavePatternsBatch(ctx context.Context, patterns []*models.Patt
 
 	now := time.Now()
 	for _, p := range patterns {
+		p.Tags = models.NormalizeTags(p.Tags)
 		connections, _ := json.Marshal(p.Connections)
 		tags, _ := json.Marshal(p.Tags)
 
@@ -576,15 +750,25 @@ func (s *Storage) SavePatternsBatch(ctx context.Context, patterns []*models.Patt
 			p.CreatedAt = now
 		}
 		p.UpdatedAt = now
+		if p.SpaceID == "" {
+			p.SpaceID = "global"
+		}
+		sealed, err := s.seal(ctx, tx, p.SpaceID, p.ID, fieldPatternResponse, p.Response)
+		if err != nil {
+			return err
+		}
 
-		_, err := stmt.ExecContext(ctx,
-			p.ID, p.Trigger, p.Response, p.Strength, p.Threshold, p.DecayRate, p.DecayEnabled,
+		_, err = stmt.ExecContext(ctx,
+			p.ID, p.Trigger, sealed[0], p.Strength, p.Threshold, p.DecayRate, p.DecayEnabled,
 			string(connections), p.CreatedAt.Unix(), p.UpdatedAt.Unix(), p.ReinforceCnt, p.DecayCnt,
-			int64TimeToPtr(p.LastUsedAt), string(tags), p.Project, p.UserID, int64TimeToPtr(p.DeletedAt),
+			int64TimeToPtr(p.LastUsedAt), string(tags), p.Project, p.UserID, p.SpaceID, int64TimeToPtr(p.DeletedAt),
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert pattern %s: %w", p.ID, err)
 		}
+		if err := syncPatternTaggings(ctx, tx, p); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -614,6 +798,12 @@ func (s *Storage) DeletePatternsBatch(ctx context.Context, ids []string) error {
 		if err != nil {
 			return fmt.Errorf("failed to delete pattern %s: %w", id, err)
 		}
+		if err := unlinkPattern(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := untagItem(ctx, tx, tagItemPattern, id); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -650,12 +840,21 @@ func (s *Storage) UpdatePatternsBatch(ctx context.Context, patterns []*models.Pa
 
 	now := time.Now()
 	for _, p := range patterns {
+		p.Tags = models.NormalizeTags(p.Tags)
 		connections, _ := json.Marshal(p.Connections)
 		tags, _ := json.Marshal(p.Tags)
 		p.UpdatedAt = now
+		spaceID, err := patternSpace(ctx, tx, p.ID)
+		if err != nil {
+			return err
+		}
+		sealed, err := s.seal(ctx, tx, spaceID, p.ID, fieldPatternResponse, p.Response)
+		if err != nil {
+			return err
+		}
 
-		_, err := stmt.ExecContext(ctx,
-			p.Trigger, p.Response, p.Strength, p.Threshold,
+		_, err = stmt.ExecContext(ctx,
+			p.Trigger, sealed[0], p.Strength, p.Threshold,
 			p.DecayRate, p.DecayEnabled, string(connections), p.UpdatedAt.Unix(),
 			p.ReinforceCnt, p.DecayCnt, int64TimeToPtr(p.LastUsedAt), string(tags), p.Project,
 			p.ID,
@@ -663,6 +862,9 @@ func (s *Storage) UpdatePatternsBatch(ctx context.Context, patterns []*models.Pa
 		if err != nil {
 			return fmt.Errorf("failed to update pattern %s: %w", p.ID, err)
 		}
+		if err := syncPatternTaggings(ctx, tx, p); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -670,7 +872,8 @@ func (s *Storage) UpdatePatternsBatch(ctx context.Context, patterns []*models.Pa
 
 // ==================== Query Optimization Methods (Iter 46) ====================
 
-// GetPatternByTrigger retrieves a pattern by its trigger (exact match)
+// GetPatternByTrigger retrieves a pattern by its trigger (exact match),
+// falling back to the aliases left by merged patterns.
 // Uses cached statement for better performance
 func (s *Storage) GetPatternByTrigger(ctx context.Context, trigger string) (*models.Pattern, error) {
 	stmt, err := s.getStmt(ctx, `
@@ -694,6 +897,10 @@ func (s *Storage) GetPatternByTrigger(ctx context.Context, trigger string) (*mod
 	)
 
 	if err == sql.ErrNoRows {
+		// Triggers of merged patterns live on as aliases
+		if id, aliasErr := s.resolveAlias(ctx, trigger); aliasErr == nil && id != "" {
+			return s.GetPattern(ctx, id)
+		}
 		return nil, fmt.Errorf("pattern not found with trigger: %s", trigger)
 	}
 	if err != nil {
@@ -715,6 +922,7 @@ func (s *Storage) GetPatternByTrigger(ctx context.Context, trigger string) (*mod
 	p.UpdatedAt = int64ToTime(updatedAt)
 	p.LastUsedAt = int64ToTimePtr(lastUsedAt)
 	p.DeletedAt = int64ToTimePtr(deletedAt)
+	s.openPatterns(&p)
 
 	return &p, nil
 }
@@ -725,6 +933,11 @@ func (s *Storage) CountPatterns(ctx context.Context, opts contracts.ListOptions)
 	query := "SELECT COUNT(*) FROM patterns WHERE deleted_at IS NULL"
 	args := []interface{}{}
 
+	if opts.SpaceID != "" {
+		query += " AND space_id = ?"
+		args = append(args, opts.SpaceID)
+	}
+
 	if opts.Project != "" {
 		query += " AND project = ?"
 		args = append(args, opts.Project)
@@ -735,6 +948,12 @@ func (s *Storage) CountPatterns(ctx context.Context, opts contracts.ListOptions)
 		args = append(args, opts.MinStrength)
 	}
 
+	if len(opts.Tags) > 0 {
+		cond, condArgs := taggedFilter(tagItemPattern, opts.Tags)
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+
 	var count int
 	err := s.db.db.QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
@@ -766,11 +985,13 @@ func (s *Storage) GetRecentlyUsedPatterns(ctx context.Context, limit int) ([]*mo
 	}
 	defer rows.Close()
 
-	return scanPatternsRows(rows)
+	return s.scanPatterns(rows)
 }
 
 // SearchPatterns performs a full-text search on trigger and response
-// Uses LIKE for simplicity - can be upgraded to FTS5 for production
+// Uses LIKE for simplicity - can be upgraded to FTS5 for production.
+// Encrypted responses are decrypted and matched in Go; while the storage
+// is locked only their triggers are searched.
 func (s *Storage) SearchPatterns(ctx context.Context, query string, opts contracts.ListOptions) ([]*models.Pattern, error) {
 	searchPattern := "%" + query + "%"
 
@@ -780,10 +1001,15 @@ func (s *Storage) SearchPatterns(ctx context.Context, query string, opts contrac
 			last_used_at, tags, project, user_id
 		FROM patterns 
 		WHERE deleted_at IS NULL 
-		AND (trigger LIKE ? OR response LIKE ?)
+		AND (trigger LIKE ? OR response LIKE ? OR response LIKE ?)
 	`
 
-	args := []interface{}{searchPattern, searchPattern}
+	args := []interface{}{searchPattern, searchPattern, sealedPrefix + "%"}
+
+	if opts.SpaceID != "" {
+		baseQuery += " AND space_id = ?"
+		args = append(args, opts.SpaceID)
+	}
 
 	if opts.Project != "" {
 		baseQuery += " AND project = ?"
@@ -792,11 +1018,9 @@ func (s *Storage) SearchPatterns(ctx context.Context, query string, opts contrac
 
 	baseQuery += " ORDER BY strength DESC"
 
-	if opts.Limit > 0 {
-		baseQuery += " LIMIT ?"
-		args = append(args, opts.Limit)
-	} else {
-		baseQuery += " LIMIT 100" // Default limit for search
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 100 // Default limit for search
 	}
 
 	rows, err := s.db.db.QueryContext(ctx, baseQuery, args...)
@@ -805,7 +1029,34 @@ func (s *Storage) SearchPatterns(ctx context.Context, query string, opts contrac
 	}
 	defer rows.Close()
 
-	return scanPatternsRows(rows)
+	patterns, err := scanPatternsRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sealed responses were selected whatever they hold: keep those
+	// matching once opened, and stop at the limit here instead.
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	var found []*models.Pattern
+	for _, p := range patterns {
+		if strings.HasPrefix(p.Response, sealedPrefix) {
+			response, err := openField(key, fieldPatternResponse, p.ID, p.Response)
+			if err == nil {
+				p.Response = response
+			}
+			if !containsFold(p.Trigger, query) && (err != nil || !containsFold(response, query)) {
+				continue
+			}
+		}
+		found = append(found, p)
+		if len(found) == limit {
+			break
+		}
+	}
+	s.openPatterns(found...)
+	return found, nil
 }
 
 // GetTopPatterns retrieves the strongest patterns (for matching priority)
@@ -829,7 +1080,17 @@ func (s *Storage) GetTopPatterns(ctx context.Context, limit int) ([]*models.Patt
 	}
 	defer rows.Close()
 
-	return scanPatternsRows(rows)
+	return s.scanPatterns(rows)
+}
+
+// scanPatterns scans pattern rows and decrypts their responses.
+func (s *Storage) scanPatterns(rows *sql.Rows) ([]*models.Pattern, error) {
+	patterns, err := scanPatternsRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	s.openPatterns(patterns...)
+	return patterns, nil
 }
 
 // scanPatternsRows is a helper to scan pattern rows
@@ -915,7 +1176,7 @@ func (s *Storage) BatchGetPatterns(ctx context.Context, ids []string) ([]*models
 		args[i] = id
 	}
 
-	query := "SELECT id, trigger, response, strength, threshold, decay_rate, decay_enabled, connections, created_at, updated_at, reinforcement_count, decay_count, last_used_at, tags, project, user_id, deleted_at FROM patterns WHERE id IN (" + strings.Join(placeholders, ",") + ") AND deleted_at IS NULL"
+	query := "SELECT id, trigger, response, strength, threshold, decay_rate, decay_enabled, connections, created_at, updated_at, reinforcement_count, decay_count, last_used_at, tags, project, user_id, space_id, deleted_at FROM patterns WHERE id IN (" + strings.Join(placeholders, ",") + ") AND deleted_at IS NULL"
 
 	rows, err := s.db.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -926,12 +1187,12 @@ func (s *Storage) BatchGetPatterns(ctx context.Context, ids []string) ([]*models
 	var patterns []*models.Pattern
 	for rows.Next() {
 		var p models.Pattern
-		var connections, tags sql.NullString
+		var connections, tags, spaceID sql.NullString
 		var lastUsedAt, deletedAt, createdAt, updatedAt sql.NullInt64
 		err := rows.Scan(
 			&p.ID, &p.Trigger, &p.Response, &p.Strength, &p.Threshold, &p.DecayRate, &p.DecayEnabled,
 			&connections, &createdAt, &updatedAt, &p.ReinforceCnt, &p.DecayCnt,
-			&lastUsedAt, &tags, &p.Project, &p.UserID, &deletedAt,
+			&lastUsedAt, &tags, &p.Project, &p.UserID, &spaceID, &deletedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -946,9 +1207,11 @@ func (s *Storage) BatchGetPatterns(ctx context.Context, ids []string) ([]*models
 		p.UpdatedAt = int64ToTime(updatedAt)
 		p.LastUsedAt = int64ToTimePtr(lastUsedAt)
 		p.DeletedAt = int64ToTimePtr(deletedAt)
+		p.SpaceID = spaceID.String
 		if err != nil {
 			return nil, err
 		}
+		s.openPatterns(&p)
 		patterns = append(patterns, &p)
 		
 		// Update cache if available
@@ -962,8 +1225,26 @@ func (s *Storage) BatchGetPatterns(ctx context.Context, ids []string) ([]*models
 
 // ==================== Note Operations (Phase 10) ====================
 
-// SaveNote creates or updates a note in storage.
+// noteColumns are the notes columns read by scanNote, in order.
+const noteColumns = "id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at"
+
+// SaveNote creates or updates a note in storage, together with its
+// pattern links.
 func (s *Storage) SaveNote(ctx context.Context, note *models.Note) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.saveNote(ctx, tx, note); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveNote saves a note within tx.
+func (s *Storage) saveNote(ctx context.Context, tx *sql.Tx, note *models.Note) error {
 	if note.ID == "" {
 		note.ID = uuid.New().String()
 	}
@@ -972,9 +1253,15 @@ func (s *Storage) SaveNote(ctx context.Context, note *models.Note) error {
 	note.CreatedAt = now
 	note.UpdatedAt = now
 
+	note.Tags = models.NormalizeTags(note.Tags)
 	tagsJSON, _ := json.Marshal(note.Tags)
 
-	_, err := s.db.db.ExecContext(ctx, `
+	sealed, err := s.seal(ctx, tx, note.SpaceID, note.ID, fieldNoteTitle, note.Title, fieldNoteContent, note.Content)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
 		INSERT INTO notes (id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
@@ -989,45 +1276,38 @@ func (s *Storage) SaveNote(ctx context.Context, note *models.Note) error {
 			last_viewed_at = excluded.last_viewed_at,
 			updated_at = excluded.updated_at
 	`,
-		note.ID, note.Title, note.Content, note.SpaceID, tagsJSON, note.IsPinned, note.Category,
+		note.ID, sealed[0], sealed[1], note.SpaceID, tagsJSON, note.IsPinned, note.Category,
 		note.WordCount, note.CharCount, note.LastViewed, note.CreatedAt.Unix(), note.UpdatedAt.Unix())
-
-	return err
+	if err != nil {
+		return err
+	}
+	if err := saveNoteLinks(ctx, tx, note); err != nil {
+		return err
+	}
+	return syncTaggings(ctx, tx, tagItemNote, note.ID, note.Tags)
 }
 
 // GetNote retrieves a note by its ID.
 func (s *Storage) GetNote(ctx context.Context, id string) (*models.Note, error) {
-	var note models.Note
-	var tagsJSON []byte
-	var lastViewed sql.NullInt64
-
-	err := s.db.db.QueryRowContext(ctx, `
-		SELECT id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at
-		FROM notes WHERE id = ?
-	`, id).Scan(
-		&note.ID, &note.Title, &note.Content, &note.SpaceID, &tagsJSON,
-		&note.IsPinned, &note.Category, &note.WordCount, &note.CharCount, &lastViewed,
-		&note.CreatedAt, &note.UpdatedAt)
-
+	note, err := scanNote(s.db.db.QueryRowContext(ctx,
+		"SELECT "+noteColumns+" FROM notes WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("note not found: %s", id)
 	}
 	if err != nil {
 		return nil, err
 	}
+	s.openNotes(note)
 
-	json.Unmarshal(tagsJSON, &note.Tags)
-	if lastViewed.Valid {
-		t := time.Unix(lastViewed.Int64, 0)
-		note.LastViewed = &t
+	if err := s.loadNoteLinks(ctx, []*models.Note{note}); err != nil {
+		return nil, err
 	}
-
-	return &note, nil
+	return note, nil
 }
 
 // ListNotes retrieves notes matching the given filter options.
 func (s *Storage) ListNotes(ctx context.Context, opts contracts.ListOptions) ([]*models.Note, error) {
-	query := "SELECT id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at FROM notes WHERE 1=1"
+	query := "SELECT " + noteColumns + " FROM notes WHERE 1=1"
 	args := []interface{}{}
 
 	if opts.SpaceID != "" {
@@ -1040,6 +1320,12 @@ func (s *Storage) ListNotes(ctx context.Context, opts contracts.ListOptions) ([]
 		args = append(args, opts.Project)
 	}
 
+	if len(opts.Tags) > 0 {
+		cond, condArgs := taggedFilter(tagItemNote, opts.Tags)
+		query += " AND " + cond
+		args = append(args, condArgs...)
+	}
+
 	query += " ORDER BY is_pinned DESC, updated_at DESC"
 
 	if opts.Limit > 0 {
@@ -1049,44 +1335,27 @@ func (s *Storage) ListNotes(ctx context.Context, opts contracts.ListOptions) ([]
 		query += fmt.Sprintf(" OFFSET %d", opts.Offset)
 	}
 
-	rows, err := s.db.db.QueryContext(ctx, query, args...)
+	return s.queryNotes(ctx, query, args...)
+}
+
+// DeleteNote removes a note by its ID, together with its pattern links.
+func (s *Storage) DeleteNote(ctx context.Context, id string) error {
+	tx, err := s.db.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
-
-	var notes []*models.Note
-	for rows.Next() {
-		var note models.Note
-		var tagsJSON []byte
-		var lastViewed sql.NullInt64
-		var createdAt, updatedAt sql.NullInt64
-
-		err := rows.Scan(
-			&note.ID, &note.Title, &note.Content, &note.SpaceID, &tagsJSON,
-			&note.IsPinned, &note.Category, &note.WordCount, &note.CharCount, &lastViewed,
-			&createdAt, &updatedAt)
-		if err != nil {
-			return nil, err
-		}
-
-		json.Unmarshal(tagsJSON, &note.Tags)
-		if lastViewed.Valid {
-			t := time.Unix(lastViewed.Int64, 0)
-			note.LastViewed = &t
-		}
-		note.CreatedAt = time.Unix(createdAt.Int64, 0)
-		note.UpdatedAt = time.Unix(updatedAt.Int64, 0)
+	defer tx.Rollback()
 
-		notes = append(notes, &note)
+	if err := deleteNote(ctx, tx, id); err != nil {
+		return err
 	}
-
-	return notes, rows.Err()
+	return tx.Commit()
 }
 
-// DeleteNote removes a note by its ID.
-func (s *Storage) DeleteNote(ctx context.Context, id string) error {
-	result, err := s.db.db.ExecContext(ctx, "DELETE FROM notes WHERE id = ?", id)
+// deleteNote removes a note and its links within ex, leaving a tombstone
+// for sync.
+func deleteNote(ctx context.Context, ex execer, id string) error {
+	result, err := ex.ExecContext(ctx, "DELETE FROM notes WHERE id = ?", id)
 	if err != nil {
 		return err
 	}
@@ -1099,17 +1368,36 @@ func (s *Storage) DeleteNote(ctx context.Context, id string) error {
 		return fmt.Errorf("note not found")
 	}
 
-	return nil
+	if _, err := ex.ExecContext(ctx, "DELETE FROM note_patterns WHERE note_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete note links: %w", err)
+	}
+	if err := untagItem(ctx, ex, tagItemNote, id); err != nil {
+		return err
+	}
+	return addTombstone(ctx, ex, tagItemNote, id, time.Now())
 }
 
-// UpdateNote updates an existing note.
+// UpdateNote updates an existing note. Its pattern links are replaced by
+// note.PatternIDs.
 func (s *Storage) UpdateNote(ctx context.Context, note *models.Note) error {
 	note.CalculateStats()
 	note.UpdatedAt = time.Now()
 
+	note.Tags = models.NormalizeTags(note.Tags)
 	tagsJSON, _ := json.Marshal(note.Tags)
 
-	result, err := s.db.db.ExecContext(ctx, `
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	sealed, err := s.seal(ctx, tx, note.SpaceID, note.ID, fieldNoteTitle, note.Title, fieldNoteContent, note.Content)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
 		UPDATE notes SET
 			title = ?,
 			content = ?,
@@ -1123,7 +1411,7 @@ func (s *Storage) UpdateNote(ctx context.Context, note *models.Note) error {
 			updated_at = ?
 		WHERE id = ?
 	`,
-		note.Title, note.Content, note.SpaceID, tagsJSON, note.IsPinned, note.Category,
+		sealed[0], sealed[1], note.SpaceID, tagsJSON, note.IsPinned, note.Category,
 		note.WordCount, note.CharCount, note.LastViewed, note.UpdatedAt.Unix(), note.ID)
 
 	if err != nil {
@@ -1138,14 +1426,22 @@ func (s *Storage) UpdateNote(ctx context.Context, note *models.Note) error {
 		return fmt.Errorf("note not found")
 	}
 
-	return nil
+	if err := saveNoteLinks(ctx, tx, note); err != nil {
+		return err
+	}
+	if err := syncTaggings(ctx, tx, tagItemNote, note.ID, note.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // SearchNotes performs a full-text search on title and content.
+// Encrypted notes are decrypted and matched in Go; while the storage is
+// locked they are not searched.
 func (s *Storage) SearchNotes(ctx context.Context, query string, opts contracts.ListOptions) ([]*models.Note, error) {
 	searchQuery := "%" + query + "%"
-	sqlQuery := "SELECT id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at FROM notes WHERE (title LIKE ? OR content LIKE ?)"
-	args := []interface{}{searchQuery, searchQuery}
+	sqlQuery := "SELECT " + noteColumns + " FROM notes WHERE (title LIKE ? OR content LIKE ? OR title LIKE ? OR content LIKE ?)"
+	args := []interface{}{searchQuery, searchQuery, sealedPrefix + "%", sealedPrefix + "%"}
 
 	if opts.SpaceID != "" {
 		sqlQuery += " AND space_id = ?"
@@ -1154,48 +1450,135 @@ func (s *Storage) SearchNotes(ctx context.Context, query string, opts contracts.
 
 	sqlQuery += " ORDER BY is_pinned DESC, updated_at DESC"
 
-	if opts.Limit > 0 {
-		sqlQuery += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	rows, err := s.db.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	rows, err := s.db.db.QueryContext(ctx, sqlQuery, args...)
+	notes, err := scanNotes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sealed notes were selected whatever they hold: keep those matching
+	// once opened, and stop at the limit here instead.
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+	var found []*models.Note
+	for _, n := range notes {
+		if strings.HasPrefix(n.Title, sealedPrefix) || strings.HasPrefix(n.Content, sealedPrefix) {
+			title, err := openField(key, fieldNoteTitle, n.ID, n.Title)
+			if err != nil {
+				continue
+			}
+			content, err := openField(key, fieldNoteContent, n.ID, n.Content)
+			if err != nil || !containsFold(title, query) && !containsFold(content, query) {
+				continue
+			}
+		}
+		found = append(found, n)
+		if len(found) == opts.Limit {
+			break
+		}
+	}
+	s.openNotes(found...)
+
+	if err := s.loadNoteLinks(ctx, found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// queryNotes runs a query selecting noteColumns and loads the pattern
+// links of the notes found.
+func (s *Storage) queryNotes(ctx context.Context, query string, args ...interface{}) ([]*models.Note, error) {
+	rows, err := s.db.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	notes, err := scanNotes(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+	s.openNotes(notes...)
+
+	if err := s.loadNoteLinks(ctx, notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// containsFold reports whether s contains substr, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// scanNotes scans rows of noteColumns.
+func scanNotes(rows *sql.Rows) ([]*models.Note, error) {
 	var notes []*models.Note
 	for rows.Next() {
-		var note models.Note
-		var tagsJSON []byte
-		var lastViewed sql.NullInt64
-
-		err := rows.Scan(
-			&note.ID, &note.Title, &note.Content, &note.SpaceID, &tagsJSON,
-			&note.IsPinned, &note.Category, &note.WordCount, &note.CharCount, &lastViewed,
-			&note.CreatedAt, &note.UpdatedAt)
+		note, err := scanNote(rows)
 		if err != nil {
 			return nil, err
 		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
 
-		json.Unmarshal(tagsJSON, &note.Tags)
-		if lastViewed.Valid {
-			t := time.Unix(lastViewed.Int64, 0)
-			note.LastViewed = &t
-		}
+// scanNote scans one row of noteColumns.
+func scanNote(row interface{ Scan(...any) error }) (*models.Note, error) {
+	var note models.Note
+	var tagsJSON []byte
+	var lastViewed sql.NullInt64
+	var createdAt, updatedAt sql.NullInt64
 
-		notes = append(notes, &note)
+	err := row.Scan(
+		&note.ID, &note.Title, &note.Content, &note.SpaceID, &tagsJSON,
+		&note.IsPinned, &note.Category, &note.WordCount, &note.CharCount, &lastViewed,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
 	}
 
-	return notes, rows.Err()
+	json.Unmarshal(tagsJSON, &note.Tags)
+	if lastViewed.Valid {
+		t := time.Unix(lastViewed.Int64, 0)
+		note.LastViewed = &t
+	}
+	note.CreatedAt = time.Unix(createdAt.Int64, 0)
+	note.UpdatedAt = time.Unix(updatedAt.Int64, 0)
+	return &note, nil
 }
 
 
 // transaction implements contracts.Transaction
 type transaction struct {
+	s  *Storage
 	tx *sql.Tx
 }
 
+func (t *transaction) SavePattern(ctx context.Context, p *models.Pattern) error {
+	return t.s.savePattern(ctx, t.tx, p)
+}
+
+func (t *transaction) DeletePattern(ctx context.Context, id string) error {
+	return deletePattern(ctx, t.tx, id)
+}
+
+func (t *transaction) SaveNote(ctx context.Context, note *models.Note) error {
+	return t.s.saveNote(ctx, t.tx, note)
+}
+
+func (t *transaction) DeleteNote(ctx context.Context, id string) error {
+	return deleteNote(ctx, t.tx, id)
+}
+
 func (t *transaction) Commit() error {
 	return t.tx.Commit()
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
 	"github.com/ArmyClaw/open-think-reflex/pkg/models"
@@ -263,3 +264,203 @@ func TestStorage_Close(t *testing.T) {
 	// Double close should also not panic
 	storage.Close()
 }
+
+func TestStorage_Conversations(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	conv := models.NewConversation("session-1", "First chat", "global")
+	if err := storage.CreateConversation(ctx, conv); err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+
+	user := models.NewConversationMessage(conv.ID, models.RoleUser, "hello")
+	user.PatternIDs = []string{"p1"}
+	user.Attachments = []models.MessageAttachment{{Name: "a.txt", MediaType: "text/plain", Data: []byte("x")}}
+	reply := models.NewConversationMessage(conv.ID, models.RoleAssistant, "hi")
+	for _, m := range []*models.ConversationMessage{user, reply} {
+		if err := storage.AddConversationMessage(ctx, m); err != nil {
+			t.Fatalf("AddConversationMessage failed: %v", err)
+		}
+	}
+
+	msgs, err := storage.ListConversationMessages(ctx, conv.ID)
+	if err != nil {
+		t.Fatalf("ListConversationMessages failed: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "hello" || msgs[1].Role != models.RoleAssistant {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+	if len(msgs[0].PatternIDs) != 1 || string(msgs[0].Attachments[0].Data) != "x" {
+		t.Errorf("message metadata not persisted: %+v", msgs[0])
+	}
+
+	latest, err := storage.GetLatestConversation(ctx)
+	if err != nil || latest == nil || latest.ID != conv.ID || latest.SessionID != "session-1" {
+		t.Errorf("unexpected latest conversation: %+v, %v", latest, err)
+	}
+
+	if err := storage.DeleteConversation(ctx, conv.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	if msgs, _ := storage.ListConversationMessages(ctx, conv.ID); len(msgs) != 0 {
+		t.Errorf("expected messages to be deleted, got %d", len(msgs))
+	}
+	if _, err := storage.GetConversation(ctx, conv.ID); err == nil {
+		t.Error("expected error for deleted conversation")
+	}
+}
+
+func TestStorage_AddConversationMessageIsAtomic(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	conv := models.NewConversation("session-1", "First chat", "global")
+	if err := storage.CreateConversation(ctx, conv); err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+	if _, err := storage.db.db.Exec(`
+		CREATE TRIGGER no_touch BEFORE UPDATE ON conversations BEGIN SELECT RAISE(ABORT, 'read only'); END
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed updated_at bump fails the call and drops the message
+	if err := storage.AddConversationMessage(ctx, models.NewConversationMessage(conv.ID, models.RoleUser, "hello")); err == nil {
+		t.Fatal("expected the failed update to be returned")
+	}
+	if msgs, _ := storage.ListConversationMessages(ctx, conv.ID); len(msgs) != 0 {
+		t.Errorf("expected the message to be rolled back, got %d", len(msgs))
+	}
+}
+
+func TestStorage_AddConversationMessagesIsAtomic(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	conv := models.NewConversation("session-1", "First chat", "global")
+	if err := storage.CreateConversation(ctx, conv); err != nil {
+		t.Fatalf("CreateConversation failed: %v", err)
+	}
+	user := models.NewConversationMessage(conv.ID, models.RoleUser, "hello")
+	reply := models.NewConversationMessage(conv.ID, models.RoleAssistant, "hi")
+	if err := storage.AddConversationMessages(ctx, user, reply); err != nil {
+		t.Fatalf("AddConversationMessages failed: %v", err)
+	}
+
+	// The second message collides with a stored one, so the first is dropped too
+	next := models.NewConversationMessage(conv.ID, models.RoleUser, "again")
+	if err := storage.AddConversationMessages(ctx, next, reply); err == nil {
+		t.Fatal("expected the duplicate message to be rejected")
+	}
+	msgs, err := storage.ListConversationMessages(ctx, conv.ID)
+	if err != nil {
+		t.Fatalf("ListConversationMessages failed: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "hello" || msgs[1].Content != "hi" {
+		t.Errorf("expected only the first turn, got %d messages", len(msgs))
+	}
+}
+
+func TestStorage_UsageLedger(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Now()
+	records := []*models.UsageRecord{
+		{Provider: "claude", Model: "claude-sonnet-4", SpaceID: "work", InputTokens: 100, OutputTokens: 50, Cost: 0.5, Latency: 200 * time.Millisecond, CreatedAt: now},
+		{Provider: "claude", Model: "claude-sonnet-4", SpaceID: "work", InputTokens: 10, OutputTokens: 5, Cost: 0.25, CreatedAt: now},
+		{Provider: "local", Model: "llama3", InputTokens: 10, OutputTokens: 5, Error: "timeout", CreatedAt: now},
+		{Provider: "claude", Model: "claude-sonnet-4", Cost: 10, CreatedAt: now.AddDate(0, 0, -40)},
+	}
+	for _, r := range records {
+		if err := storage.RecordUsage(ctx, r); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+	}
+
+	cost, err := storage.UsageCostSince(ctx, now.AddDate(0, 0, -1))
+	if err != nil || cost != 0.75 {
+		t.Errorf("expected cost 0.75, got %v (%v)", cost, err)
+	}
+
+	byModel, err := storage.UsageSummary(ctx, UsageByModel, now.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("UsageSummary failed: %v", err)
+	}
+	if len(byModel) != 2 || byModel[0].Key != "claude-sonnet-4" || byModel[0].Calls != 2 || byModel[0].InputTokens != 110 {
+		t.Errorf("unexpected model summary: %+v", byModel[0])
+	}
+
+	bySpace, _ := storage.UsageSummary(ctx, UsageBySpace, now.AddDate(0, 0, -30))
+	if len(bySpace) != 2 || bySpace[1].Key != "global" || bySpace[1].Errors != 1 {
+		t.Errorf("unexpected space summary: %+v", bySpace)
+	}
+
+	if _, err := storage.UsageSummary(ctx, "week", now); err == nil {
+		t.Error("expected error for invalid grouping")
+	}
+}
+
+func TestStorage_ResponseCache(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Now()
+	put := func(key string, created time.Time, ttl time.Duration, max int) {
+		t.Helper()
+		err := storage.PutCachedResponse(ctx, &models.CachedResponse{
+			Key: key, Provider: "claude", Content: "answer " + key,
+			InputTokens: 10, OutputTokens: 5,
+			CreatedAt: created, ExpiresAt: created.Add(ttl),
+		}, max)
+		if err != nil {
+			t.Fatalf("PutCachedResponse failed: %v", err)
+		}
+	}
+
+	put("a", now.Add(-3*time.Second), time.Hour, 0)
+	got, err := storage.GetCachedResponse(ctx, "a", now)
+	if err != nil || got == nil {
+		t.Fatalf("GetCachedResponse = %v, %v; want entry", got, err)
+	}
+	if got.Content != "answer a" || got.Hits != 1 {
+		t.Errorf("got content %q hits %d", got.Content, got.Hits)
+	}
+
+	if got, _ := storage.GetCachedResponse(ctx, "a", now.Add(2*time.Hour)); got != nil {
+		t.Error("expired entry should be a miss")
+	}
+	if got, _ := storage.GetCachedResponse(ctx, "missing", now); got != nil {
+		t.Error("unknown key should be a miss")
+	}
+
+	// "b" is older than "a" (which was hit), so it is evicted first
+	put("b", now.Add(-2*time.Second), time.Hour, 0)
+	put("c", now, time.Hour, 2)
+	if got, _ := storage.GetCachedResponse(ctx, "b", now); got != nil {
+		t.Error("least recently used entry should be evicted")
+	}
+
+	stats, err := storage.ResponseCacheStats(ctx, now)
+	if err != nil {
+		t.Fatalf("ResponseCacheStats failed: %v", err)
+	}
+	if stats.Entries != 2 || stats.Hits != 1 || stats.SavedTokens != 15 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	n, err := storage.ClearResponseCache(ctx, true, now)
+	if err != nil || n != 0 {
+		t.Errorf("ClearResponseCache(expired) = %d, %v; want 0", n, err)
+	}
+	n, err = storage.ClearResponseCache(ctx, false, now)
+	if err != nil || n != 2 {
+		t.Errorf("ClearResponseCache = %d, %v; want 2", n, err)
+	}
+}
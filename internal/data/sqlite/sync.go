@@ -0,0 +1,1058 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+	"github.com/google/uuid"
+)
+
+// ==================== Sync ====================
+
+// SyncStrategy decides what happens to a record both sides changed since
+// their last sync.
+type SyncStrategy string
+
+const (
+	// SyncLastWriterWins takes the whole record from the side that wrote
+	// it last.
+	SyncLastWriterWins SyncStrategy = "lww"
+	// SyncFieldMerge keeps the changes of both sides field by field; only
+	// a field changed on both sides conflicts, and the last writer wins it.
+	SyncFieldMerge SyncStrategy = "field"
+)
+
+// ParseSyncStrategy parses a strategy name. The empty string is field
+// merging.
+func ParseSyncStrategy(name string) (SyncStrategy, error) {
+	switch SyncStrategy(name) {
+	case "", SyncFieldMerge:
+		return SyncFieldMerge, nil
+	case SyncLastWriterWins:
+		return SyncLastWriterWins, nil
+	}
+	return "", fmt.Errorf("unknown sync strategy %q (want %s or %s)", name, SyncFieldMerge, SyncLastWriterWins)
+}
+
+// SyncOptions controls Sync.
+type SyncOptions struct {
+	Strategy SyncStrategy
+	// Location describes the peer in the sync history, e.g. its path
+	Location string
+	// DryRun reports what would change without writing anything
+	DryRun bool
+}
+
+// SyncCounts counts the writes to one side of a sync.
+type SyncCounts struct {
+	Spaces   int `json:"spaces"`   // Created or updated
+	Patterns int `json:"patterns"` // Created or updated, deletions included
+	Notes    int `json:"notes"`    // Created or updated
+	Deleted  int `json:"deleted"`  // Spaces, patterns and notes deleted
+}
+
+// SyncConflict is a record both sides changed since their last sync.
+type SyncConflict struct {
+	ItemType string   `json:"item_type"`
+	ItemID   string   `json:"item_id"`
+	Label    string   `json:"label"`            // Trigger or title
+	Fields   []string `json:"fields,omitempty"` // Fields changed on both sides
+	Winner   string   `json:"winner"`           // "local" or "remote"
+	Reason   string   `json:"reason"`
+}
+
+// SyncReport describes a sync. Pulled counts writes to the local database,
+// Pushed writes to the peer.
+type SyncReport struct {
+	PeerID     string         `json:"peer_id"`
+	LastSynced *time.Time     `json:"last_synced,omitempty"` // Previous sync with the peer
+	Strategy   SyncStrategy   `json:"strategy"`
+	DryRun     bool           `json:"dry_run,omitempty"`
+	Pulled     SyncCounts     `json:"pulled"`
+	Pushed     SyncCounts     `json:"pushed"`
+	Conflicts  []SyncConflict `json:"conflicts"`
+	// Unencrypted lists spaces that are encrypted on one side but were
+	// created unencrypted on the other, which has no passphrase set
+	Unencrypted []string `json:"unencrypted,omitempty"`
+}
+
+// syncState is what a record looked like at the last sync with a peer:
+// fingerprints of its fields, and its counters, which merge additively.
+type syncState struct {
+	Fields       map[string]string `json:"fields"`
+	Strength     float64           `json:"strength,omitempty"`
+	ReinforceCnt int               `json:"reinforcement_count,omitempty"`
+	DecayCnt     int               `json:"decay_count,omitempty"`
+}
+
+// syncField is a field of a synced record.
+type syncField[T any] struct {
+	name string
+	get  func(*T) interface{}
+	set  func(dst, src *T)
+}
+
+var patternSyncFields = []syncField[models.Pattern]{
+	{"trigger", func(p *models.Pattern) interface{} { return p.Trigger }, func(d, s *models.Pattern) { d.Trigger = s.Trigger }},
+	{"response", func(p *models.Pattern) interface{} { return p.Response }, func(d, s *models.Pattern) { d.Response = s.Response }},
+	{"space_id", func(p *models.Pattern) interface{} { return p.SpaceID }, func(d, s *models.Pattern) { d.SpaceID = s.SpaceID }},
+	{"threshold", func(p *models.Pattern) interface{} { return p.Threshold }, func(d, s *models.Pattern) { d.Threshold = s.Threshold }},
+	{"decay_rate", func(p *models.Pattern) interface{} { return p.DecayRate }, func(d, s *models.Pattern) { d.DecayRate = s.DecayRate }},
+	{"decay_enabled", func(p *models.Pattern) interface{} { return p.DecayEnabled }, func(d, s *models.Pattern) { d.DecayEnabled = s.DecayEnabled }},
+	{"connections", func(p *models.Pattern) interface{} { return p.Connections }, func(d, s *models.Pattern) { d.Connections = s.Connections }},
+	{"tags", func(p *models.Pattern) interface{} { return p.Tags }, func(d, s *models.Pattern) { d.Tags = s.Tags }},
+	{"project", func(p *models.Pattern) interface{} { return p.Project }, func(d, s *models.Pattern) { d.Project = s.Project }},
+	{"user_id", func(p *models.Pattern) interface{} { return p.UserID }, func(d, s *models.Pattern) { d.UserID = s.UserID }},
+	{"deleted", func(p *models.Pattern) interface{} { return p.DeletedAt != nil }, func(d, s *models.Pattern) { d.DeletedAt = s.DeletedAt }},
+}
+
+// syncItemSpace is the item type of spaces in the sync tables; patterns
+// and notes use their tagging item types.
+const syncItemSpace = "space"
+
+// Each database keeps its own default space, pattern counts and
+// encryption settings, so those are not synced.
+var spaceSyncFields = []syncField[models.Space]{
+	{"name", func(s *models.Space) interface{} { return s.Name }, func(d, s *models.Space) { d.Name = s.Name }},
+	{"description", func(s *models.Space) interface{} { return s.Description }, func(d, s *models.Space) { d.Description = s.Description }},
+	{"owner", func(s *models.Space) interface{} { return s.Owner }, func(d, s *models.Space) { d.Owner = s.Owner }},
+	{"pattern_limit", func(s *models.Space) interface{} { return s.PatternLimit }, func(d, s *models.Space) { d.PatternLimit = s.PatternLimit }},
+}
+
+var noteSyncFields = []syncField[models.Note]{
+	{"title", func(n *models.Note) interface{} { return n.Title }, func(d, s *models.Note) { d.Title = s.Title }},
+	{"content", func(n *models.Note) interface{} { return n.Content }, func(d, s *models.Note) { d.Content = s.Content }},
+	{"space_id", func(n *models.Note) interface{} { return n.SpaceID }, func(d, s *models.Note) { d.SpaceID = s.SpaceID }},
+	{"tags", func(n *models.Note) interface{} { return n.Tags }, func(d, s *models.Note) { d.Tags = s.Tags }},
+	{"is_pinned", func(n *models.Note) interface{} { return n.IsPinned }, func(d, s *models.Note) { d.IsPinned = s.IsPinned }},
+	{"category", func(n *models.Note) interface{} { return n.Category }, func(d, s *models.Note) { d.Category = s.Category }},
+	{"pattern_ids", func(n *models.Note) interface{} { return sortedCopy(n.PatternIDs) }, func(d, s *models.Note) { d.PatternIDs = s.PatternIDs }},
+}
+
+func sortedCopy(ids []string) []string {
+	out := append([]string{}, ids...)
+	sort.Strings(out)
+	return out
+}
+
+// fingerprints hashes each field of item, so changes can be detected
+// without keeping a copy of (possibly encrypted) content. The hashes are
+// keyed by the replica's sync secret, so they can't be matched against
+// guessed content.
+func fingerprints[T any](secret []byte, fields []syncField[T], item *T) map[string]string {
+	out := make(map[string]string, len(fields))
+	for _, f := range fields {
+		data, _ := json.Marshal(f.get(item))
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(f.name))
+		mac.Write([]byte{0})
+		mac.Write(data)
+		out[f.name] = hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	return out
+}
+
+// fieldMerge is the result of merging two versions of a record.
+type fieldMerge[T any] struct {
+	merged    *T
+	conflicts []string // Fields changed on both sides
+	local     []string // Fields only the local side changed
+	remote    []string // Fields only the remote side changed
+	winner    string   // Side whose values won the conflicts
+}
+
+// mergeFields merges two versions of a record against base, the
+// fingerprints at the last sync under secret (nil if the record was never
+// synced, in which case every difference is a conflict).
+func mergeFields[T any](secret []byte, fields []syncField[T], local, remote *T, base map[string]string, remoteNewer bool, strategy SyncStrategy) fieldMerge[T] {
+	merged := *local
+	m := fieldMerge[T]{merged: &merged, winner: "local"}
+	if remoteNewer {
+		m.winner = "remote"
+	}
+	lf, rf := fingerprints(secret, fields, local), fingerprints(secret, fields, remote)
+	for _, f := range fields {
+		l, r := lf[f.name], rf[f.name]
+		if l == r {
+			continue
+		}
+		b, synced := base[f.name]
+		switch {
+		case synced && l == b:
+			m.remote = append(m.remote, f.name)
+			f.set(&merged, remote)
+		case synced && r == b:
+			m.local = append(m.local, f.name)
+		default:
+			m.conflicts = append(m.conflicts, f.name)
+			if remoteNewer {
+				f.set(&merged, remote)
+			}
+		}
+	}
+
+	// Last writer wins: a record both sides changed is taken whole from
+	// the newer side, dropping the other side's changes
+	if strategy == SyncLastWriterWins && (len(m.conflicts) > 0 || len(m.local) > 0 && len(m.remote) > 0) {
+		m.conflicts = append(append(m.conflicts, m.local...), m.remote...)
+		m.local, m.remote = nil, nil
+		if remoteNewer {
+			merged = *remote
+		} else {
+			merged = *local
+		}
+	}
+	return m
+}
+
+// mergeCounters merges strength and usage counters additively: each
+// side's change since the last sync is applied. Records that were never
+// synced keep the larger values.
+func mergeCounters(merged, local, remote *models.Pattern, base *syncState) {
+	if base != nil {
+		merged.Strength = additive(local.Strength, remote.Strength, base.Strength)
+		merged.ReinforceCnt = additive(local.ReinforceCnt, remote.ReinforceCnt, base.ReinforceCnt)
+		merged.DecayCnt = additive(local.DecayCnt, remote.DecayCnt, base.DecayCnt)
+	} else {
+		merged.Strength = max(local.Strength, remote.Strength)
+		merged.ReinforceCnt = max(local.ReinforceCnt, remote.ReinforceCnt)
+		merged.DecayCnt = max(local.DecayCnt, remote.DecayCnt)
+	}
+	merged.Strength = min(max(merged.Strength, 0), 100)
+	merged.ReinforceCnt = max(merged.ReinforceCnt, 0)
+	merged.DecayCnt = max(merged.DecayCnt, 0)
+	merged.LastUsedAt = laterTime(local.LastUsedAt, remote.LastUsedAt)
+	merged.CreatedAt = earlier(local.CreatedAt, remote.CreatedAt)
+	merged.UpdatedAt = later(local.UpdatedAt, remote.UpdatedAt)
+}
+
+// additive applies both sides' changes since base. A side that didn't
+// change is skipped, so unchanged values don't pick up rounding errors.
+func additive[N int | float64](local, remote, base N) N {
+	switch {
+	case local == base:
+		return remote
+	case remote == base:
+		return local
+	}
+	return local + remote - base
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func earlier(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func laterTime(a, b *time.Time) *time.Time {
+	if a == nil || b != nil && b.After(*a) {
+		return b
+	}
+	return a
+}
+
+// lastWrite is when a pattern was last changed, deletion included.
+func lastWrite(p *models.Pattern) time.Time {
+	if p.DeletedAt != nil {
+		return later(p.UpdatedAt, *p.DeletedAt)
+	}
+	return p.UpdatedAt
+}
+
+// sameRecord reports whether two versions of a record would be stored
+// identically.
+func sameRecord(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// syncSide is one database during a sync: what it holds, and what the sync
+// will write to it.
+type syncSide struct {
+	name       string // "local" or "remote"
+	s          *Storage
+	replicaID  string
+	spaces     map[string]*models.Space
+	patterns   map[string]*models.Pattern // Deleted patterns included
+	notes      map[string]*models.Note
+	tombstones map[string]time.Time // Deleted notes
+	spaceGone  map[string]time.Time // Deleted spaces
+
+	saveSpaces    []*models.Space
+	deleteSpaces  []string
+	savePatterns  []*models.Pattern
+	saveNotes     []*models.Note
+	deleteNotes   []string
+	counts        *SyncCounts
+	unencrypted   []string
+	encryptionSet bool
+	secret        []byte // Keys the fingerprints of this side's sync state
+}
+
+func (s *Storage) loadSyncSide(ctx context.Context, name string, counts *SyncCounts) (*syncSide, error) {
+	if err := s.requireUnlocked(ctx); err != nil {
+		return nil, err
+	}
+	side := &syncSide{
+		name:       name,
+		s:          s,
+		spaces:     make(map[string]*models.Space),
+		patterns:   make(map[string]*models.Pattern),
+		notes:      make(map[string]*models.Note),
+		tombstones: make(map[string]time.Time),
+		spaceGone:  make(map[string]time.Time),
+		counts:     counts,
+	}
+	var err error
+	if side.replicaID, err = s.ReplicaID(ctx); err != nil {
+		return nil, err
+	}
+	if side.encryptionSet, err = s.EncryptionEnabled(ctx); err != nil {
+		return nil, err
+	}
+	if side.secret, err = s.syncSecret(ctx); err != nil {
+		return nil, err
+	}
+
+	spaces, err := s.ListSpaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spaces: %w", err)
+	}
+	for _, space := range spaces {
+		side.spaces[space.ID] = space
+	}
+	patterns, err := s.allPatterns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patterns {
+		side.patterns[p.ID] = p
+	}
+	notes, err := s.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	for _, n := range notes {
+		side.notes[n.ID] = n
+	}
+
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT item_type, item_id, deleted_at FROM sync_tombstones WHERE item_type IN (?, ?)
+	`, tagItemNote, syncItemSpace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tombstones: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var itemType, id string
+		var deletedAt int64
+		if err := rows.Scan(&itemType, &id, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to read tombstones: %w", err)
+		}
+		if itemType == syncItemSpace {
+			side.spaceGone[id] = time.Unix(deletedAt, 0)
+		} else {
+			side.tombstones[id] = time.Unix(deletedAt, 0)
+		}
+	}
+	return side, rows.Err()
+}
+
+// allPatterns returns every pattern, deleted ones included.
+func (s *Storage) allPatterns(ctx context.Context) ([]*models.Pattern, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT id, trigger, response, strength, threshold, decay_rate, decay_enabled,
+			connections, created_at, updated_at, reinforcement_count, decay_count,
+			last_used_at, tags, project, user_id, space_id, deleted_at
+		FROM patterns ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list patterns: %w", err)
+	}
+	defer rows.Close()
+
+	var patterns []*models.Pattern
+	for rows.Next() {
+		var p models.Pattern
+		var connections, tags, project, userID, spaceID sql.NullString
+		var lastUsedAt, deletedAt, createdAt, updatedAt sql.NullInt64
+		if err := rows.Scan(
+			&p.ID, &p.Trigger, &p.Response, &p.Strength, &p.Threshold, &p.DecayRate, &p.DecayEnabled,
+			&connections, &createdAt, &updatedAt, &p.ReinforceCnt, &p.DecayCnt,
+			&lastUsedAt, &tags, &project, &userID, &spaceID, &deletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to read pattern: %w", err)
+		}
+		if connections.Valid {
+			if err := json.Unmarshal([]byte(connections.String), &p.Connections); err != nil {
+				return nil, fmt.Errorf("failed to parse connections for pattern %s: %w", p.ID, err)
+			}
+		}
+		if tags.Valid {
+			if err := json.Unmarshal([]byte(tags.String), &p.Tags); err != nil {
+				return nil, fmt.Errorf("failed to parse tags for pattern %s: %w", p.ID, err)
+			}
+		}
+		p.Project = project.String
+		p.UserID = userID.String
+		p.SpaceID = spaceID.String
+		p.CreatedAt = int64ToTime(createdAt)
+		p.UpdatedAt = int64ToTime(updatedAt)
+		p.LastUsedAt = int64ToTimePtr(lastUsedAt)
+		p.DeletedAt = int64ToTimePtr(deletedAt)
+		patterns = append(patterns, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.openPatterns(patterns...)
+	return patterns, nil
+}
+
+// loadSyncBase returns the state of every record at the last sync with
+// peerID, keyed by item type and ID, and when that sync was.
+func (s *Storage) loadSyncBase(ctx context.Context, peerID string) (map[string]*syncState, *time.Time, error) {
+	var lastSynced *time.Time
+	var at int64
+	err := s.db.db.QueryRowContext(ctx, `SELECT last_synced_at FROM sync_peers WHERE peer_id = ?`, peerID).Scan(&at)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to read sync history: %w", err)
+	default:
+		t := time.Unix(at, 0)
+		lastSynced = &t
+	}
+
+	rows, err := s.db.db.QueryContext(ctx, `SELECT item_type, item_id, state FROM sync_base WHERE peer_id = ?`, peerID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	defer rows.Close()
+	base := make(map[string]*syncState)
+	for rows.Next() {
+		var itemType, itemID, data string
+		if err := rows.Scan(&itemType, &itemID, &data); err != nil {
+			return nil, nil, fmt.Errorf("failed to read sync state: %w", err)
+		}
+		var state syncState
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse sync state of %s %s: %w", itemType, itemID, err)
+		}
+		base[itemType+":"+itemID] = &state
+	}
+	return base, lastSynced, rows.Err()
+}
+
+// ReplicaID returns the ID that identifies this database to the databases
+// it syncs with, creating it on first use.
+func (s *Storage) ReplicaID(ctx context.Context) (string, error) {
+	var id string
+	err := s.db.db.QueryRowContext(ctx, `SELECT replica_id FROM sync_replica WHERE id = 1`).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to read replica ID: %w", err)
+	}
+	id = uuid.New().String()
+	if _, err := s.db.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO sync_replica (id, replica_id, created_at) VALUES (1, ?, ?)
+	`, id, time.Now().Unix()); err != nil {
+		return "", fmt.Errorf("failed to save replica ID: %w", err)
+	}
+	return s.ReplicaID(ctx)
+}
+
+// syncSecret returns the random key of this replica's sync fingerprints,
+// creating it on first use. It is sealed with the data key once
+// encryption is set up, so the fingerprints of encrypted content can't be
+// checked against guesses without the passphrase.
+func (s *Storage) syncSecret(ctx context.Context) ([]byte, error) {
+	if _, err := s.ReplicaID(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	key := s.dataKey
+	s.mu.RUnlock()
+
+	var stored sql.NullString
+	if err := s.db.db.QueryRowContext(ctx, `SELECT secret FROM sync_replica WHERE id = 1`).Scan(&stored); err != nil {
+		return nil, fmt.Errorf("failed to read sync secret: %w", err)
+	}
+	if !stored.Valid {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		text := base64.RawStdEncoding.EncodeToString(secret)
+		if key != nil {
+			sealed, err := sealField(key, fieldSyncSecret, "1", text)
+			if err != nil {
+				return nil, err
+			}
+			text = sealed
+		}
+		if _, err := s.db.db.ExecContext(ctx, `
+			UPDATE sync_replica SET secret = ? WHERE id = 1 AND secret IS NULL
+		`, text); err != nil {
+			return nil, fmt.Errorf("failed to save sync secret: %w", err)
+		}
+		return s.syncSecret(ctx)
+	}
+
+	text, err := openField(key, fieldSyncSecret, "1", stored.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync secret: %w", err)
+	}
+	secret, err := base64.RawStdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("malformed sync secret")
+	}
+	return secret, nil
+}
+
+// ResetReplicaID gives the database a new replica ID and forgets its sync
+// history, for a database that was copied from another one. The next sync
+// with each peer treats every difference as a conflict.
+func (s *Storage) ResetReplicaID(ctx context.Context) (string, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	id := uuid.New().String()
+	for _, query := range []string{`DELETE FROM sync_base`, `DELETE FROM sync_peers`, `DELETE FROM sync_replica`} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return "", fmt.Errorf("failed to reset sync state: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sync_replica (id, replica_id, created_at) VALUES (1, ?, ?)
+	`, id, time.Now().Unix()); err != nil {
+		return "", fmt.Errorf("failed to save replica ID: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+	return id, nil
+}
+
+// Sync merges this database and peer in both directions. Changes since
+// their last sync are found by comparing each record with its state at
+// that sync; a record both sides changed is resolved by opts.Strategy and
+// reported as a conflict. Strength and usage counters add up the changes
+// of both sides. Deleted patterns sync as soft deletes, deleted notes and
+// spaces as tombstones. Both databases must be unlocked.
+func (s *Storage) Sync(ctx context.Context, peer *Storage, opts SyncOptions) (*SyncReport, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = SyncFieldMerge
+	}
+	report := &SyncReport{Strategy: opts.Strategy, DryRun: opts.DryRun, Conflicts: []SyncConflict{}}
+	local, err := s.loadSyncSide(ctx, "local", &report.Pulled)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := peer.loadSyncSide(ctx, "remote", &report.Pushed)
+	if err != nil {
+		return nil, fmt.Errorf("peer: %w", err)
+	}
+	if local.replicaID == remote.replicaID {
+		return nil, fmt.Errorf("both databases have replica ID %s; if one was copied from the other, reset its ID first", local.replicaID)
+	}
+	report.PeerID = remote.replicaID
+
+	// Both sides record the same base, each under its own secret, so the
+	// local one is used
+	base, lastSynced, err := s.loadSyncBase(ctx, remote.replicaID)
+	if err != nil {
+		return nil, err
+	}
+	report.LastSynced = lastSynced
+
+	mergedSpaces := syncSpaces(local, remote, base, opts.Strategy, report)
+	merged := syncPatterns(local, remote, base, opts.Strategy, report)
+	mergedNotes := syncNotes(local, remote, base, merged, opts.Strategy, report)
+	report.Unencrypted = append(local.unencrypted, remote.unencrypted...)
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// Both sides are written before either commits, so a failed write
+	// leaves both as they were. Counters need that: a side that kept the
+	// merge while the other kept its old base would add the other side's
+	// changes again on the next sync. Each side keeps the state under its
+	// own secret
+	now := time.Now()
+	remoteTx, err := remote.stage(ctx, local.replicaID, opts.Location, remote.syncState(mergedSpaces, merged, mergedNotes), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write peer: %w", err)
+	}
+	defer remoteTx.Rollback()
+	localTx, err := local.stage(ctx, remote.replicaID, opts.Location, local.syncState(mergedSpaces, merged, mergedNotes), now)
+	if err != nil {
+		return nil, err
+	}
+	defer localTx.Rollback()
+
+	// The peer commits first: if committing here then fails, the next
+	// sync sees the merged records as the peer's changes and converges
+	if err := remoteTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit peer: %w", err)
+	}
+	if err := localTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return report, nil
+}
+
+// syncState returns the state of the merged records to keep until the
+// next sync, keyed by item type and ID.
+func (side *syncSide) syncState(spaces map[string]*models.Space, patterns map[string]*models.Pattern, notes map[string]*models.Note) map[string]*syncState {
+	state := make(map[string]*syncState, len(spaces)+len(patterns)+len(notes))
+	for id, space := range spaces {
+		state[syncItemSpace+":"+id] = &syncState{Fields: fingerprints(side.secret, spaceSyncFields, space)}
+	}
+	for id, p := range patterns {
+		state[tagItemPattern+":"+id] = &syncState{
+			Fields:       fingerprints(side.secret, patternSyncFields, p),
+			Strength:     p.Strength,
+			ReinforceCnt: p.ReinforceCnt,
+			DecayCnt:     p.DecayCnt,
+		}
+	}
+	for id, n := range notes {
+		state[tagItemNote+":"+id] = &syncState{Fields: fingerprints(side.secret, noteSyncFields, n)}
+	}
+	return state
+}
+
+// syncSpaces merges the spaces of both sides like notes: a field changed
+// on one side is taken, and a space deleted on one side is deleted on the
+// other unless it was edited there since. It returns every merged space by
+// ID.
+func syncSpaces(local, remote *syncSide, base map[string]*syncState, strategy SyncStrategy, report *SyncReport) map[string]*models.Space {
+	merged := make(map[string]*models.Space)
+	for _, id := range sortedKeys(local.spaces, remote.spaces) {
+		l, r := local.spaces[id], remote.spaces[id]
+		var fields map[string]string
+		if state := base[syncItemSpace+":"+id]; state != nil {
+			fields = state.Fields
+		}
+
+		if l == nil || r == nil {
+			// On one side only: new there, or deleted on the other side
+			have, haveSide, otherSide := l, local, remote
+			if l == nil {
+				have, haveSide, otherSide = r, remote, local
+			}
+			if deletedAt, deleted := otherSide.spaceGone[id]; deleted {
+				unchanged := fields != nil && !changedSince(local.secret, spaceSyncFields, have, fields, "")
+				keep := !unchanged && have.UpdatedAt.After(deletedAt)
+				if !unchanged {
+					winner := haveSide.name
+					if !keep {
+						winner = otherSide.name
+					}
+					report.Conflicts = append(report.Conflicts, SyncConflict{
+						ItemType: syncItemSpace, ItemID: id, Label: have.Name, Winner: winner,
+						Reason: "deleted on one side, edited on the other",
+					})
+				}
+				if !keep {
+					haveSide.deleteSpaces = append(haveSide.deleteSpaces, id)
+					haveSide.counts.Deleted++
+					continue
+				}
+			}
+			merged[id] = have
+			otherSide.queueSpace(have, nil)
+			continue
+		}
+
+		m := mergeFields(local.secret, spaceSyncFields, l, r, fields, r.UpdatedAt.After(l.UpdatedAt), strategy)
+		space := m.merged
+		space.CreatedAt = earlier(l.CreatedAt, r.CreatedAt)
+		space.UpdatedAt = later(l.UpdatedAt, r.UpdatedAt)
+		merged[id] = space
+		if len(m.conflicts) > 0 {
+			report.Conflicts = append(report.Conflicts, SyncConflict{
+				ItemType: syncItemSpace, ItemID: id, Label: space.Name, Fields: m.conflicts, Winner: m.winner,
+				Reason: "changed on both sides",
+			})
+		}
+		local.queueSpace(space, l)
+		remote.queueSpace(space, r)
+	}
+	return merged
+}
+
+// queueSpace queues space to be written unless current already matches
+// it. The side keeps its own default, pattern count and encryption
+// setting; a space it doesn't have yet is created unencrypted if it has
+// no passphrase.
+func (side *syncSide) queueSpace(space, current *models.Space) {
+	copied := *space
+	if current != nil {
+		copied.DefaultSpace, copied.PatternCount, copied.Encrypted = current.DefaultSpace, current.PatternCount, current.Encrypted
+		if sameRecord(&copied, current) {
+			return
+		}
+	} else {
+		copied.DefaultSpace = false
+		copied.PatternCount = 0
+		if copied.Encrypted && !side.encryptionSet {
+			copied.Encrypted = false
+			side.unencrypted = append(side.unencrypted, copied.ID)
+		}
+	}
+	side.saveSpaces = append(side.saveSpaces, &copied)
+	side.counts.Spaces++
+}
+
+// sortedKeys returns the keys of maps, sorted and without duplicates.
+func sortedKeys[V any](maps ...map[string]V) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// syncPatterns merges the patterns of both sides and queues the writes.
+// It returns every merged pattern by ID.
+func syncPatterns(local, remote *syncSide, base map[string]*syncState, strategy SyncStrategy, report *SyncReport) map[string]*models.Pattern {
+	merged := make(map[string]*models.Pattern)
+	for _, id := range sortedKeys(local.patterns, remote.patterns) {
+		l, r := local.patterns[id], remote.patterns[id]
+		switch {
+		case r == nil:
+			merged[id] = l
+			remote.queuePattern(l, nil)
+			continue
+		case l == nil:
+			merged[id] = r
+			local.queuePattern(r, nil)
+			continue
+		}
+
+		state := base[tagItemPattern+":"+id]
+		var fields map[string]string
+		if state != nil {
+			fields = state.Fields
+		}
+		m := mergeFields(local.secret, patternSyncFields, l, r, fields, lastWrite(r).After(lastWrite(l)), strategy)
+		p := m.merged
+		mergeCounters(p, l, r, state)
+		merged[id] = p
+
+		switch {
+		case len(m.conflicts) > 0:
+			report.Conflicts = append(report.Conflicts, SyncConflict{
+				ItemType: tagItemPattern, ItemID: id, Label: p.Trigger, Fields: m.conflicts, Winner: m.winner,
+				Reason: "changed on both sides",
+			})
+		case p.DeletedAt != nil && (l.DeletedAt == nil && len(m.local) > 0 || r.DeletedAt == nil && len(m.remote) > 0):
+			winner := "remote"
+			if l.DeletedAt != nil {
+				winner = "local"
+			}
+			report.Conflicts = append(report.Conflicts, SyncConflict{
+				ItemType: tagItemPattern, ItemID: id, Label: p.Trigger, Fields: append(m.local, m.remote...), Winner: winner,
+				Reason: "deleted on one side, edited on the other",
+			})
+		}
+		local.queuePattern(p, l)
+		remote.queuePattern(p, r)
+	}
+	return merged
+}
+
+// queuePattern queues p to be written unless current already matches it.
+func (side *syncSide) queuePattern(p, current *models.Pattern) {
+	if current != nil && sameRecord(p, current) {
+		return
+	}
+	side.savePatterns = append(side.savePatterns, p)
+	side.counts.Patterns++
+	if p.DeletedAt != nil && (current == nil || current.DeletedAt == nil) {
+		side.counts.Deleted++
+	}
+}
+
+// syncNotes merges the notes of both sides and queues the writes. Links to
+// patterns that are deleted after the merge are dropped. It returns every
+// merged note by ID.
+func syncNotes(local, remote *syncSide, base map[string]*syncState, patterns map[string]*models.Pattern, strategy SyncStrategy, report *SyncReport) map[string]*models.Note {
+	merged := make(map[string]*models.Note)
+	for _, id := range sortedKeys(local.notes, remote.notes) {
+		l, r := local.notes[id], remote.notes[id]
+		var fields map[string]string
+		if state := base[tagItemNote+":"+id]; state != nil {
+			fields = state.Fields
+		}
+
+		if l == nil || r == nil {
+			// On one side only: new there, or deleted on the other side
+			have, haveSide, otherSide := l, local, remote
+			if l == nil {
+				have, haveSide, otherSide = r, remote, local
+			}
+			deletedAt, deleted := otherSide.tombstones[id]
+			if !deleted {
+				n := liveLinks(have, patterns)
+				merged[id] = n
+				otherSide.queueNote(n, nil)
+				haveSide.queueNote(n, have)
+				continue
+			}
+			// Links are left out: deleting a pattern drops them, which is
+			// not an edit of the note
+			unchanged := fields != nil && !changedSince(local.secret, noteSyncFields, have, fields, "pattern_ids")
+			keep := !unchanged && have.UpdatedAt.After(deletedAt)
+			if !unchanged {
+				winner := haveSide.name
+				if !keep {
+					winner = otherSide.name
+				}
+				report.Conflicts = append(report.Conflicts, SyncConflict{
+					ItemType: tagItemNote, ItemID: id, Label: have.Title, Winner: winner,
+					Reason: "deleted on one side, edited on the other",
+				})
+			}
+			if keep {
+				n := liveLinks(have, patterns)
+				merged[id] = n
+				otherSide.queueNote(n, nil)
+				haveSide.queueNote(n, have)
+			} else {
+				haveSide.deleteNotes = append(haveSide.deleteNotes, id)
+				haveSide.counts.Deleted++
+			}
+			continue
+		}
+
+		m := mergeFields(local.secret, noteSyncFields, l, r, fields, r.UpdatedAt.After(l.UpdatedAt), strategy)
+		n := liveLinks(m.merged, patterns)
+		n.CreatedAt = earlier(l.CreatedAt, r.CreatedAt)
+		n.UpdatedAt = later(l.UpdatedAt, r.UpdatedAt)
+		n.LastViewed = laterTime(l.LastViewed, r.LastViewed)
+		n.CalculateStats()
+		merged[id] = n
+		if len(m.conflicts) > 0 {
+			report.Conflicts = append(report.Conflicts, SyncConflict{
+				ItemType: tagItemNote, ItemID: id, Label: n.Title, Fields: m.conflicts, Winner: m.winner,
+				Reason: "changed on both sides",
+			})
+		}
+		local.queueNote(n, l)
+		remote.queueNote(n, r)
+	}
+	return merged
+}
+
+// changedSince reports whether item differs from its state at the last
+// sync, leaving out the ignored field.
+func changedSince[T any](secret []byte, fields []syncField[T], item *T, base map[string]string, ignore string) bool {
+	for name, fp := range fingerprints(secret, fields, item) {
+		if name != ignore && fp != base[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// liveLinks returns a copy of n linking only to patterns that exist and
+// are not deleted.
+func liveLinks(n *models.Note, patterns map[string]*models.Pattern) *models.Note {
+	copied := *n
+	copied.PatternIDs = nil
+	for _, id := range n.PatternIDs {
+		if p := patterns[id]; p != nil && p.DeletedAt == nil {
+			copied.PatternIDs = append(copied.PatternIDs, id)
+		}
+	}
+	return &copied
+}
+
+// queueNote queues n to be written unless current already matches it.
+func (side *syncSide) queueNote(n, current *models.Note) {
+	if current != nil && sameRecord(n, current) {
+		return
+	}
+	side.saveNotes = append(side.saveNotes, n)
+	side.counts.Notes++
+}
+
+// stage writes the queued changes and the new sync state in a transaction,
+// keeping the records' own timestamps, and returns it uncommitted.
+func (side *syncSide) stage(ctx context.Context, peerID, location string, state map[string]*syncState, now time.Time) (*sql.Tx, error) {
+	tx, err := side.s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := side.apply(ctx, tx, peerID, location, state, now); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// apply writes the queued changes and the new sync state in tx.
+func (side *syncSide) apply(ctx context.Context, tx *sql.Tx, peerID, location string, state map[string]*syncState, now time.Time) error {
+	s := side.s
+
+	for _, space := range side.saveSpaces {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO spaces (id, name, description, owner, is_default, pattern_limit, pattern_count, encrypted, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 0, ?, 0, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				name = excluded.name, description = excluded.description, owner = excluded.owner,
+				pattern_limit = excluded.pattern_limit, created_at = excluded.created_at,
+				updated_at = excluded.updated_at
+		`, space.ID, space.Name, space.Description, space.Owner, space.PatternLimit,
+			boolToInt(space.Encrypted), space.CreatedAt.Unix(), space.UpdatedAt.Unix()); err != nil {
+			return fmt.Errorf("failed to sync space %s: %w", space.ID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sync_tombstones WHERE item_type = ? AND item_id = ?`, syncItemSpace, space.ID); err != nil {
+			return fmt.Errorf("failed to clear tombstone: %w", err)
+		}
+	}
+
+	for _, p := range side.savePatterns {
+		connections, _ := json.Marshal(p.Connections)
+		tags, _ := json.Marshal(p.Tags)
+		sealed, err := s.seal(ctx, tx, p.SpaceID, p.ID, fieldPatternResponse, p.Response)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO patterns (
+				id, trigger, response, strength, threshold, decay_rate, decay_enabled,
+				connections, created_at, updated_at, reinforcement_count, decay_count,
+				last_used_at, tags, project, user_id, space_id, deleted_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			p.ID, p.Trigger, sealed[0], p.Strength, p.Threshold, p.DecayRate, p.DecayEnabled,
+			string(connections), p.CreatedAt.Unix(), p.UpdatedAt.Unix(), p.ReinforceCnt, p.DecayCnt,
+			int64TimeToPtr(p.LastUsedAt), string(tags), p.Project, p.UserID, p.SpaceID, int64TimeToPtr(p.DeletedAt),
+		); err != nil {
+			return fmt.Errorf("failed to sync pattern %s: %w", p.ID, err)
+		}
+		if p.DeletedAt != nil {
+			if err := unlinkPattern(ctx, tx, p.ID); err != nil {
+				return err
+			}
+		}
+		if err := syncPatternTaggings(ctx, tx, p); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range side.saveNotes {
+		tags, _ := json.Marshal(n.Tags)
+		sealed, err := s.seal(ctx, tx, n.SpaceID, n.ID, fieldNoteTitle, n.Title, fieldNoteContent, n.Content)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO notes (id, title, content, space_id, tags, is_pinned, category, word_count, char_count, last_viewed_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, n.ID, sealed[0], sealed[1], n.SpaceID, string(tags), n.IsPinned, n.Category,
+			n.WordCount, n.CharCount, int64TimeToPtr(n.LastViewed), n.CreatedAt.Unix(), n.UpdatedAt.Unix()); err != nil {
+			return fmt.Errorf("failed to sync note %s: %w", n.ID, err)
+		}
+		if err := saveNoteLinks(ctx, tx, n); err != nil {
+			return err
+		}
+		if err := syncTaggings(ctx, tx, tagItemNote, n.ID, n.Tags); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sync_tombstones WHERE item_type = ? AND item_id = ?`, tagItemNote, n.ID); err != nil {
+			return fmt.Errorf("failed to clear tombstone: %w", err)
+		}
+	}
+
+	for _, id := range side.deleteNotes {
+		for _, query := range []string{`DELETE FROM notes WHERE id = ?`, `DELETE FROM note_patterns WHERE note_id = ?`} {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return fmt.Errorf("failed to delete note %s: %w", id, err)
+			}
+		}
+		if err := untagItem(ctx, tx, tagItemNote, id); err != nil {
+			return err
+		}
+		if err := addTombstone(ctx, tx, tagItemNote, id, now); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range side.deleteSpaces {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM spaces WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete space %s: %w", id, err)
+		}
+		if err := addTombstone(ctx, tx, syncItemSpace, id, now); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sync_base WHERE peer_id = ?`, peerID); err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	for key, st := range state {
+		itemType, itemID, _ := strings.Cut(key, ":")
+		data, _ := json.Marshal(st)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO sync_base (peer_id, item_type, item_id, state) VALUES (?, ?, ?, ?)
+		`, peerID, itemType, itemID, string(data)); err != nil {
+			return fmt.Errorf("failed to save sync state: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sync_peers (peer_id, location, last_synced_at) VALUES (?, ?, ?)
+		ON CONFLICT(peer_id) DO UPDATE SET location = excluded.location, last_synced_at = excluded.last_synced_at
+	`, peerID, nullIfEmpty(location), now.Unix()); err != nil {
+		return fmt.Errorf("failed to save sync history: %w", err)
+	}
+	return nil
+}
+
+// addTombstone records that an item was deleted, so a sync deletes it on
+// the other side too.
+func addTombstone(ctx context.Context, ex execer, itemType, itemID string, deletedAt time.Time) error {
+	if _, err := ex.ExecContext(ctx, `
+		INSERT OR REPLACE INTO sync_tombstones (item_type, item_id, deleted_at) VALUES (?, ?, ?)
+	`, itemType, itemID, deletedAt.Unix()); err != nil {
+		return fmt.Errorf("failed to record deletion of %s %s: %w", itemType, itemID, err)
+	}
+	return nil
+}
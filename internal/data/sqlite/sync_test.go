@@ -0,0 +1,409 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// setupSyncPair returns two databases that have synced one pattern and one
+// note.
+func setupSyncPair(t *testing.T) (*Storage, *Storage, *models.Pattern, *models.Note) {
+	t.Helper()
+	a, cleanupA := setupTestDB(t)
+	t.Cleanup(cleanupA)
+	b, cleanupB := setupTestDB(t)
+	t.Cleanup(cleanupB)
+	ctx := context.Background()
+
+	p := models.NewPattern("deploy", "make release")
+	p.Strength = 50
+	p.ReinforceCnt = 3
+	if err := a.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	n := models.NewNote("Runbook", "watch the graphs")
+	n.AddPattern(p.ID)
+	if err := b.SaveNote(ctx, n); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	if _, err := a.Sync(ctx, b, SyncOptions{}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	return a, b, p, n
+}
+
+// touch sets when a pattern was last updated, to decide who wrote last.
+func touch(t *testing.T, s *Storage, id string, at time.Time) {
+	t.Helper()
+	if _, err := s.db.db.Exec(`UPDATE patterns SET updated_at = ? WHERE id = ?`, at.Unix(), id); err != nil {
+		t.Fatalf("failed to set updated_at: %v", err)
+	}
+}
+
+func TestSync_CopiesBothWays(t *testing.T) {
+	a, b, p, n := setupSyncPair(t)
+	ctx := context.Background()
+
+	got, err := b.GetPattern(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("pattern was not pushed: %v", err)
+	}
+	if got.Strength != 50 || !got.CreatedAt.Equal(time.Unix(p.CreatedAt.Unix(), 0)) {
+		t.Errorf("pattern did not keep its values: %+v", got)
+	}
+	gotNote, err := a.GetNote(ctx, n.ID)
+	if err != nil || len(gotNote.PatternIDs) != 1 {
+		t.Fatalf("note was not pulled with its link: %+v, %v", gotNote, err)
+	}
+
+	// Nothing changed, so nothing is written
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Pulled != (SyncCounts{}) || report.Pushed != (SyncCounts{}) || len(report.Conflicts) != 0 {
+		t.Errorf("expected an empty second sync, got %+v", report)
+	}
+	if report.LastSynced == nil {
+		t.Error("expected the previous sync time")
+	}
+}
+
+func TestSync_CountersAreAdditive(t *testing.T) {
+	a, b, p, _ := setupSyncPair(t)
+	ctx := context.Background()
+
+	pa, _ := a.GetPattern(ctx, p.ID)
+	pa.Strength, pa.ReinforceCnt = 60, 5
+	pb, _ := b.GetPattern(ctx, p.ID)
+	pb.Strength, pb.ReinforceCnt = 55, 4
+	if err := a.UpdatePattern(ctx, pa); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdatePattern(ctx, pb); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Conflicts) != 0 {
+		t.Errorf("counters should not conflict: %+v", report.Conflicts)
+	}
+	for _, s := range []*Storage{a, b} {
+		got, _ := s.GetPattern(ctx, p.ID)
+		if got.Strength != 65 || got.ReinforceCnt != 6 {
+			t.Errorf("expected strength 65 and 6 reinforcements, got %v and %d", got.Strength, got.ReinforceCnt)
+		}
+	}
+}
+
+func TestSync_FailedLocalWriteKeepsCounters(t *testing.T) {
+	a, b, p, _ := setupSyncPair(t)
+	ctx := context.Background()
+
+	pa, _ := a.GetPattern(ctx, p.ID)
+	pa.Strength, pa.ReinforceCnt = 60, 5
+	pb, _ := b.GetPattern(ctx, p.ID)
+	pb.Strength, pb.ReinforceCnt = 55, 4
+	if err := a.UpdatePattern(ctx, pa); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdatePattern(ctx, pb); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing the local side fails after the peer's writes are staged
+	if _, err := a.db.db.Exec(`
+		CREATE TRIGGER no_sync BEFORE INSERT ON sync_base BEGIN SELECT RAISE(ABORT, 'read only'); END
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Sync(ctx, b, SyncOptions{}); err == nil {
+		t.Fatal("expected the failed local write to be returned")
+	}
+	if got, _ := b.GetPattern(ctx, p.ID); got.Strength != 55 || got.ReinforceCnt != 4 {
+		t.Errorf("expected the peer left as it was, got %v and %d", got.Strength, got.ReinforceCnt)
+	}
+	if _, err := a.db.db.Exec(`DROP TRIGGER no_sync`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Sync(ctx, b, SyncOptions{}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	for _, s := range []*Storage{a, b} {
+		got, _ := s.GetPattern(ctx, p.ID)
+		if got.Strength != 65 || got.ReinforceCnt != 6 {
+			t.Errorf("expected strength 65 and 6 reinforcements, got %v and %d", got.Strength, got.ReinforceCnt)
+		}
+	}
+}
+
+func TestSync_Strategies(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		strategy     SyncStrategy
+		wantTrigger  string
+		wantResponse string
+		wantConflict bool
+	}{
+		{SyncFieldMerge, "deploy prod", "make release v2", false},
+		{SyncLastWriterWins, "deploy", "make release v2", true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			a, b, p, _ := setupSyncPair(t)
+			pa, _ := a.GetPattern(ctx, p.ID)
+			pa.Trigger = "deploy prod"
+			pb, _ := b.GetPattern(ctx, p.ID)
+			pb.Response = "make release v2"
+			if err := a.UpdatePattern(ctx, pa); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.UpdatePattern(ctx, pb); err != nil {
+				t.Fatal(err)
+			}
+			touch(t, b, p.ID, time.Now().Add(time.Minute))
+
+			report, err := a.Sync(ctx, b, SyncOptions{Strategy: tt.strategy})
+			if err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+			if (len(report.Conflicts) > 0) != tt.wantConflict {
+				t.Errorf("unexpected conflicts: %+v", report.Conflicts)
+			}
+			for _, s := range []*Storage{a, b} {
+				got, _ := s.GetPattern(ctx, p.ID)
+				if got.Trigger != tt.wantTrigger || got.Response != tt.wantResponse {
+					t.Errorf("expected %q -> %q, got %q -> %q", tt.wantTrigger, tt.wantResponse, got.Trigger, got.Response)
+				}
+			}
+		})
+	}
+}
+
+func TestSync_SameFieldConflict(t *testing.T) {
+	a, b, p, _ := setupSyncPair(t)
+	ctx := context.Background()
+
+	pa, _ := a.GetPattern(ctx, p.ID)
+	pa.Response = "local edit"
+	pb, _ := b.GetPattern(ctx, p.ID)
+	pb.Response = "remote edit"
+	a.UpdatePattern(ctx, pa)
+	b.UpdatePattern(ctx, pb)
+	touch(t, a, p.ID, time.Now().Add(time.Minute))
+
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Winner != "local" || report.Conflicts[0].Fields[0] != "response" {
+		t.Fatalf("expected a response conflict won by local, got %+v", report.Conflicts)
+	}
+	got, _ := b.GetPattern(ctx, p.ID)
+	if got.Response != "local edit" {
+		t.Errorf("expected the last writer to win, got %q", got.Response)
+	}
+}
+
+func TestSync_Deletes(t *testing.T) {
+	a, b, p, n := setupSyncPair(t)
+	ctx := context.Background()
+
+	if err := b.DeletePattern(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DeleteNote(ctx, n.ID); err != nil {
+		t.Fatal(err)
+	}
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Pulled.Deleted != 1 || report.Pushed.Deleted != 1 || len(report.Conflicts) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if _, err := a.GetPattern(ctx, p.ID); err == nil {
+		t.Error("expected the pattern deletion to be pulled")
+	}
+	if _, err := b.GetNote(ctx, n.ID); err == nil {
+		t.Error("expected the note deletion to be pushed")
+	}
+}
+
+func TestSync_DeleteEditConflict(t *testing.T) {
+	a, b, _, n := setupSyncPair(t)
+	ctx := context.Background()
+
+	if err := a.DeleteNote(ctx, n.ID); err != nil {
+		t.Fatal(err)
+	}
+	edited, _ := b.GetNote(ctx, n.ID)
+	edited.Content = "still needed"
+	if err := b.UpdateNote(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.db.db.Exec(`UPDATE notes SET updated_at = ? WHERE id = ?`, time.Now().Add(time.Minute).Unix(), n.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Winner != "remote" {
+		t.Fatalf("expected a delete/edit conflict won by the edit, got %+v", report.Conflicts)
+	}
+	got, err := a.GetNote(ctx, n.ID)
+	if err != nil || got.Content != "still needed" {
+		t.Errorf("expected the edited note to be restored, got %+v, %v", got, err)
+	}
+}
+
+func TestSync_Spaces(t *testing.T) {
+	a, b, _, _ := setupSyncPair(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"work", "old"} {
+		if err := a.CreateSpace(ctx, &models.Space{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := a.Sync(ctx, b, SyncOptions{}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// A rename on one side and a new description on the other both apply
+	work, _ := a.GetSpace(ctx, "work")
+	work.Name = "Work"
+	if err := a.CreateSpace(ctx, work); err != nil {
+		t.Fatal(err)
+	}
+	work, _ = b.GetSpace(ctx, "work")
+	work.Description = "day job"
+	if err := b.CreateSpace(ctx, work); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteSpace(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Conflicts) != 0 || report.Pulled.Deleted != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	for _, s := range []*Storage{a, b} {
+		got, err := s.GetSpace(ctx, "work")
+		if err != nil || got.Name != "Work" || got.Description != "day job" {
+			t.Errorf("expected both edits to be merged, got %+v, %v", got, err)
+		}
+	}
+	if _, err := a.GetSpace(ctx, "old"); err == nil {
+		t.Error("expected the space deletion to be pulled")
+	}
+
+	// Recreating a deleted space keeps it on the next sync
+	if err := b.CreateSpace(ctx, &models.Space{ID: "old", Name: "Old again"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.db.db.Exec(`UPDATE spaces SET updated_at = ? WHERE id = 'old'`, time.Now().Add(time.Minute).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Sync(ctx, b, SyncOptions{}); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got, err := a.GetSpace(ctx, "old"); err != nil || got.Name != "Old again" {
+		t.Errorf("expected the recreated space to be pulled, got %+v, %v", got, err)
+	}
+}
+
+func TestSync_DryRunAndSameReplica(t *testing.T) {
+	a, b, _, _ := setupSyncPair(t)
+	ctx := context.Background()
+
+	p := models.NewPattern("new", "only here")
+	if err := a.SavePattern(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	report, err := a.Sync(ctx, b, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if report.Pushed.Patterns != 1 {
+		t.Errorf("expected one pattern to push, got %+v", report.Pushed)
+	}
+	if patterns, _ := b.ListPatterns(ctx, contracts.ListOptions{}); len(patterns) != 1 {
+		t.Errorf("a dry run must not write, peer has %d patterns", len(patterns))
+	}
+
+	if _, err := a.Sync(ctx, a, SyncOptions{}); err == nil {
+		t.Error("expected syncing a database with itself to fail")
+	}
+	oldID, _ := a.ReplicaID(ctx)
+	newID, err := a.ResetReplicaID(ctx)
+	if err != nil || newID == oldID {
+		t.Errorf("expected a new replica ID, got %q (%v)", newID, err)
+	}
+}
+
+func TestSync_StateIsKeyed(t *testing.T) {
+	a, b, p, _ := setupSyncPair(t)
+	ctx := context.Background()
+
+	var data string
+	if err := a.db.db.QueryRow(`SELECT state FROM sync_base WHERE item_type = ? AND item_id = ?`,
+		tagItemPattern, p.ID).Scan(&data); err != nil {
+		t.Fatalf("failed to read sync state: %v", err)
+	}
+	var state syncState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		t.Fatalf("failed to parse sync state: %v", err)
+	}
+	plain, _ := json.Marshal(p.Response)
+	sum := sha256.Sum256(plain)
+	if state.Fields["response"] == hex.EncodeToString(sum[:8]) {
+		t.Error("sync state should not hold a plain hash of the content")
+	}
+
+	// Each side keys its own state
+	secretA, _ := a.syncSecret(ctx)
+	secretB, _ := b.syncSecret(ctx)
+	if len(secretA) == 0 || bytes.Equal(secretA, secretB) {
+		t.Fatal("expected a distinct secret per replica")
+	}
+
+	// Setting a passphrase seals the secret without changing it
+	old := kdfParams
+	kdfParams = scryptParams{N: 1 << 10, R: 8, P: 1}
+	t.Cleanup(func() { kdfParams = old })
+	if _, err := a.Rekey(ctx, "secret"); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if got := storedValue(t, a, `SELECT secret FROM sync_replica WHERE id = ?`, "1"); !strings.HasPrefix(got, sealedPrefix) {
+		t.Errorf("expected the sync secret to be sealed, got %q", got)
+	}
+	if got, err := a.syncSecret(ctx); err != nil || !bytes.Equal(got, secretA) {
+		t.Errorf("secret changed after Rekey: %v", err)
+	}
+
+	// Syncing again still sees no changes
+	report, err := a.Sync(ctx, b, SyncOptions{})
+	if err != nil || len(report.Conflicts) != 0 || report.Pulled.Patterns+report.Pushed.Patterns != 0 {
+		t.Errorf("expected nothing to sync, got %+v (%v)", report, err)
+	}
+}
@@ -0,0 +1,300 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== Tags ====================
+//
+// Tags live in the tags table and are attached to patterns and notes via
+// taggings. The JSON tags columns are kept as a copy so items load without
+// a join; every write of an item's tags goes through syncTaggings.
+
+// Tagging item types
+const (
+	tagItemPattern = "pattern"
+	tagItemNote    = "note"
+)
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// ListTags returns every tag in use with its pattern and note counts,
+// sorted by name so children follow their parents.
+func (s *Storage) ListTags(ctx context.Context) ([]*models.Tag, error) {
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT t.name,
+			SUM(CASE WHEN tg.item_type = 'pattern' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN tg.item_type = 'note' THEN 1 ELSE 0 END)
+		FROM tags t JOIN taggings tg ON tg.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY t.name COLLATE NOCASE
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []*models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Name, &t.Patterns, &t.Notes); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, &t)
+	}
+	return tags, rows.Err()
+}
+
+// RenameTag renames a tag and its descendants ("api/users" follows "api")
+// on every pattern and note, and returns the number of items changed.
+// Renaming onto an existing tag is refused; use MergeTags.
+func (s *Storage) RenameTag(ctx context.Context, oldName, newName string) (int, error) {
+	oldName, newName = models.NormalizeTag(oldName), models.NormalizeTag(newName)
+	if oldName == "" || newName == "" {
+		return 0, fmt.Errorf("tag name required")
+	}
+	if models.TagUnder(newName, oldName) && !strings.EqualFold(newName, oldName) {
+		return 0, fmt.Errorf("cannot rename tag %q under itself", oldName)
+	}
+	if !strings.EqualFold(oldName, newName) {
+		exists, err := s.tagExists(ctx, newName)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, fmt.Errorf("tag %q already exists (use merge)", newName)
+		}
+	}
+	n, err := s.retag(ctx, []string{oldName}, func(tag string) (string, bool) {
+		return newName + tag[len(oldName):], true
+	})
+	if err != nil || !strings.EqualFold(oldName, newName) {
+		return n, err
+	}
+	// Only the case changed, so the tag rows were kept; rename them too
+	where, args := tagMatch([]string{oldName})
+	if _, err := s.db.db.ExecContext(ctx, `
+		UPDATE tags SET name = ? || substr(name, ?) WHERE id IN (SELECT t.id FROM tags t WHERE `+where+`)
+	`, append([]interface{}{newName, utf8.RuneCountInString(oldName) + 1}, args...)...); err != nil {
+		return n, fmt.Errorf("failed to rename tag: %w", err)
+	}
+	return n, nil
+}
+
+// MergeTags folds tags (and their descendants) into another tag on every
+// pattern and note, and returns the number of items changed.
+func (s *Storage) MergeTags(ctx context.Context, from []string, into string) (int, error) {
+	into = models.NormalizeTag(into)
+	if into == "" {
+		return 0, fmt.Errorf("tag name required")
+	}
+	var roots []string
+	for _, name := range from {
+		name = models.NormalizeTag(name)
+		if name == "" || strings.EqualFold(name, into) {
+			continue
+		}
+		if models.TagUnder(into, name) {
+			return 0, fmt.Errorf("cannot merge tag %q into its descendant %q", name, into)
+		}
+		roots = append(roots, name)
+	}
+	if len(roots) == 0 {
+		return 0, fmt.Errorf("no tags to merge")
+	}
+	return s.retag(ctx, roots, func(tag string) (string, bool) {
+		for _, root := range roots {
+			if models.TagUnder(tag, root) {
+				return into + tag[len(root):], true
+			}
+		}
+		return tag, true
+	})
+}
+
+// DeleteTag removes a tag from every pattern and note and returns the
+// number of items changed. Descendant tags are kept.
+func (s *Storage) DeleteTag(ctx context.Context, name string) (int, error) {
+	name = models.NormalizeTag(name)
+	if name == "" {
+		return 0, fmt.Errorf("tag name required")
+	}
+	return s.retag(ctx, []string{name}, func(tag string) (string, bool) {
+		return tag, !strings.EqualFold(tag, name)
+	})
+}
+
+func (s *Storage) tagExists(ctx context.Context, name string) (bool, error) {
+	var n int
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tags t JOIN taggings tg ON tg.tag_id = t.id WHERE t.name = ?
+	`, name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up tag: %w", err)
+	}
+	return n > 0, nil
+}
+
+// retag rewrites the tags under roots on every item carrying one, in a
+// single transaction. fn maps a tag to its new name, or drops it.
+func (s *Storage) retag(ctx context.Context, roots []string, fn func(tag string) (string, bool)) (int, error) {
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := tagMatch(roots)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT tg.item_type, tg.item_id
+		FROM taggings tg JOIN tags t ON t.id = tg.tag_id
+		WHERE `+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find tagged items: %w", err)
+	}
+	type item struct{ kind, id string }
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.kind, &it.id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to find tagged items: %w", err)
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to find tagged items: %w", err)
+	}
+
+	now := time.Now().Unix()
+	for _, it := range items {
+		table := "patterns"
+		if it.kind == tagItemNote {
+			table = "notes"
+		}
+		var tagsJSON sql.NullString
+		if err := tx.QueryRowContext(ctx, `SELECT tags FROM `+table+` WHERE id = ?`, it.id).Scan(&tagsJSON); err != nil {
+			return 0, fmt.Errorf("failed to read tags of %s %s: %w", it.kind, it.id, err)
+		}
+		var tags []string
+		if tagsJSON.Valid {
+			json.Unmarshal([]byte(tagsJSON.String), &tags)
+		}
+
+		var updated []string
+		for _, tag := range tags {
+			under := false
+			for _, root := range roots {
+				if models.TagUnder(models.NormalizeTag(tag), root) {
+					under = true
+					break
+				}
+			}
+			if under {
+				var keep bool
+				if tag, keep = fn(models.NormalizeTag(tag)); !keep {
+					continue
+				}
+			}
+			updated = append(updated, tag)
+		}
+		updated = models.NormalizeTags(updated)
+
+		data, _ := json.Marshal(updated)
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET tags = ?, updated_at = ? WHERE id = ?`,
+			string(data), now, it.id); err != nil {
+			return 0, fmt.Errorf("failed to update tags of %s %s: %w", it.kind, it.id, err)
+		}
+		if err := syncTaggings(ctx, tx, it.kind, it.id, updated); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+	return len(items), nil
+}
+
+// syncTaggings replaces the taggings of an item with tags (already
+// normalized) and drops tags no longer in use.
+func syncTaggings(ctx context.Context, ex execer, itemType, itemID string, tags []string) error {
+	if _, err := ex.ExecContext(ctx, `DELETE FROM taggings WHERE item_type = ? AND item_id = ?`, itemType, itemID); err != nil {
+		return fmt.Errorf("failed to clear tags of %s %s: %w", itemType, itemID, err)
+	}
+	now := time.Now().Unix()
+	for _, tag := range tags {
+		if _, err := ex.ExecContext(ctx, `INSERT OR IGNORE INTO tags (name, created_at) VALUES (?, ?)`, tag, now); err != nil {
+			return fmt.Errorf("failed to save tag %q: %w", tag, err)
+		}
+		if _, err := ex.ExecContext(ctx, `
+			INSERT OR IGNORE INTO taggings (tag_id, item_type, item_id)
+			SELECT id, ?, ? FROM tags WHERE name = ?
+		`, itemType, itemID, tag); err != nil {
+			return fmt.Errorf("failed to tag %s %s: %w", itemType, itemID, err)
+		}
+	}
+	if _, err := ex.ExecContext(ctx, `
+		DELETE FROM tags WHERE NOT EXISTS (SELECT 1 FROM taggings WHERE tag_id = tags.id)
+	`); err != nil {
+		return fmt.Errorf("failed to prune tags: %w", err)
+	}
+	return nil
+}
+
+// syncPatternTaggings updates the taggings of a saved pattern.
+func syncPatternTaggings(ctx context.Context, ex execer, p *models.Pattern) error {
+	if p.DeletedAt != nil {
+		return untagItem(ctx, ex, tagItemPattern, p.ID)
+	}
+	return syncTaggings(ctx, ex, tagItemPattern, p.ID, p.Tags)
+}
+
+// untagItem removes all taggings of a deleted item.
+func untagItem(ctx context.Context, ex execer, itemType, itemID string) error {
+	return syncTaggings(ctx, ex, itemType, itemID, nil)
+}
+
+// tagMatch returns a condition on tags t matching any of the tags or their
+// descendants.
+func tagMatch(tags []string) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, tag := range tags {
+		tag = models.NormalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		conds = append(conds, `(t.name = ? OR t.name LIKE ? ESCAPE '\')`)
+		args = append(args, tag, escapeLike(tag)+models.TagSeparator+"%")
+	}
+	if len(conds) == 0 {
+		return "0", nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// taggedFilter returns a condition restricting id to items of itemType
+// carrying any of the tags or their descendants.
+func taggedFilter(itemType string, tags []string) (string, []interface{}) {
+	where, args := tagMatch(tags)
+	return `id IN (SELECT tg.item_id FROM taggings tg JOIN tags t ON t.id = tg.tag_id
+		WHERE tg.item_type = ? AND ` + where + `)`, append([]interface{}{itemType}, args...)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func tagNames(tags []*models.Tag) map[string][2]int {
+	out := make(map[string][2]int, len(tags))
+	for _, t := range tags {
+		out[t.Name] = [2]int{t.Patterns, t.Notes}
+	}
+	return out
+}
+
+func TestStorage_Tags(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	users := models.NewPattern("list users", "GET /users")
+	users.Tags = []string{"api/users", " backend "}
+	orders := models.NewPattern("list orders", "GET /orders")
+	orders.Tags = []string{"api/orders"}
+	other := models.NewPattern("deploy", "make release")
+	other.Tags = []string{"ops"}
+	for _, p := range []*models.Pattern{users, orders, other} {
+		if err := storage.SavePattern(ctx, p); err != nil {
+			t.Fatalf("SavePattern failed: %v", err)
+		}
+	}
+	note := models.NewNote("API design", "Use cursors")
+	note.Tags = []string{"api", "Backend"}
+	if err := storage.SaveNote(ctx, note); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	tags, err := storage.ListTags(ctx)
+	if err != nil {
+		t.Fatalf("ListTags failed: %v", err)
+	}
+	want := map[string][2]int{
+		"api": {0, 1}, "api/orders": {1, 0}, "api/users": {1, 0}, "backend": {1, 1}, "ops": {1, 0},
+	}
+	if got := tagNames(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListTags = %v, want %v", got, want)
+	}
+
+	// A tag filter matches descendants
+	patterns, err := storage.ListPatterns(ctx, contracts.ListOptions{Tags: []string{"api"}})
+	if err != nil || len(patterns) != 2 {
+		t.Errorf("expected 2 patterns tagged api/*, got %d (%v)", len(patterns), err)
+	}
+	if n, _ := storage.CountPatterns(ctx, contracts.ListOptions{Tags: []string{"API/Users"}}); n != 1 {
+		t.Errorf("expected 1 pattern tagged api/users, got %d", n)
+	}
+	notes, err := storage.ListNotes(ctx, contracts.ListOptions{Tags: []string{"backend"}})
+	if err != nil || len(notes) != 1 {
+		t.Errorf("expected 1 note tagged backend, got %d (%v)", len(notes), err)
+	}
+
+	// Renaming carries descendants along and updates the items
+	if _, err := storage.RenameTag(ctx, "api", "ops"); err == nil {
+		t.Error("expected rename onto an existing tag to fail")
+	}
+	n, err := storage.RenameTag(ctx, "api", "rest")
+	if err != nil || n != 3 {
+		t.Fatalf("RenameTag changed %d items (%v), want 3", n, err)
+	}
+	got, _ := storage.GetPattern(ctx, users.ID)
+	if !reflect.DeepEqual(got.Tags, []string{"rest/users", "backend"}) {
+		t.Errorf("unexpected tags after rename: %v", got.Tags)
+	}
+
+	// Merging folds tags together without duplicates
+	if _, err := storage.MergeTags(ctx, []string{"backend"}, "rest"); err != nil {
+		t.Fatalf("MergeTags failed: %v", err)
+	}
+	gotNote, _ := storage.GetNote(ctx, note.ID)
+	if !reflect.DeepEqual(gotNote.Tags, []string{"rest"}) {
+		t.Errorf("unexpected note tags after merge: %v", gotNote.Tags)
+	}
+
+	// Deleting removes only the exact tag
+	if _, err := storage.DeleteTag(ctx, "rest"); err != nil {
+		t.Fatalf("DeleteTag failed: %v", err)
+	}
+	tags, _ = storage.ListTags(ctx)
+	want = map[string][2]int{"rest/orders": {1, 0}, "rest/users": {1, 0}, "ops": {1, 0}}
+	if got := tagNames(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListTags after delete = %v, want %v", got, want)
+	}
+
+	// Deleted patterns no longer count
+	if err := storage.DeletePattern(ctx, other.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	tags, _ = storage.ListTags(ctx)
+	if _, ok := tagNames(tags)["ops"]; ok {
+		t.Error("expected ops to disappear with its only pattern")
+	}
+}
+
+func TestStorage_RenameTagCase(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	p := models.NewPattern("x", "y")
+	p.Tags = []string{"api/users"}
+	if err := storage.SavePattern(ctx, p); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+	if _, err := storage.RenameTag(ctx, "api", "API"); err != nil {
+		t.Fatalf("RenameTag failed: %v", err)
+	}
+	tags, _ := storage.ListTags(ctx)
+	if len(tags) != 1 || tags[0].Name != "API/users" {
+		t.Errorf("expected API/users, got %v", tagNames(tags))
+	}
+}
+
+func TestDatabase_MigrateTagsFromJSON(t *testing.T) {
+	db := openTestDatabase(t, ":memory:")
+	ctx := context.Background()
+
+	// Apply everything before the tags migration, then write JSON tags directly
+	if _, err := db.MigrateTo(ctx, 4); err != nil {
+		t.Fatalf("MigrateTo failed: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO patterns (id, trigger, response, tags, created_at, updated_at) VALUES ('p1', 'a', 'b', '["api","Ops"]', 1, 1)`,
+		`INSERT INTO patterns (id, trigger, response, tags, created_at, updated_at, deleted_at) VALUES ('p2', 'c', 'd', '["gone"]', 1, 1, 2)`,
+		`INSERT INTO patterns (id, trigger, response, tags, created_at, updated_at) VALUES ('p3', 'e', 'f', 'null', 1, 1)`,
+		`INSERT INTO notes (id, title, content, tags, created_at, updated_at) VALUES ('n1', 't', 'c', '["ops"]', 1, 1)`,
+	} {
+		if _, err := db.db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	if _, err := db.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("MigrateTo failed: %v", err)
+	}
+
+	tags, err := NewStorage(db).ListTags(ctx)
+	if err != nil {
+		t.Fatalf("ListTags failed: %v", err)
+	}
+	want := map[string][2]int{"api": {1, 0}, "Ops": {1, 1}}
+	if got := tagNames(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrated tags = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ==================== AI Usage Ledger ====================
+
+// Usage report groupings
+const (
+	UsageByDay   = "day"
+	UsageBySpace = "space"
+	UsageByModel = "model"
+)
+
+// RecordUsage stores one provider call in the usage ledger.
+// Implements ai.UsageLedger.
+func (s *Storage) RecordUsage(ctx context.Context, rec *models.UsageRecord) error {
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	result, err := s.db.db.ExecContext(ctx, `
+		INSERT INTO ai_usage (provider, model, space_id, input_tokens, output_tokens, latency_ms, cost, estimated, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rec.Provider, rec.Model, rec.SpaceID, rec.InputTokens, rec.OutputTokens,
+		rec.Latency.Milliseconds(), rec.Cost, boolToInt(rec.Estimated), nullIfEmpty(rec.Error), rec.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	rec.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// UsageCostSince returns the total estimated cost of calls since t.
+// Implements ai.UsageLedger.
+func (s *Storage) UsageCostSince(ctx context.Context, since time.Time) (float64, error) {
+	var cost float64
+	err := s.db.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(cost), 0) FROM ai_usage WHERE created_at >= ?
+	`, since.Unix()).Scan(&cost)
+	return cost, err
+}
+
+// UsageSummary aggregates usage since t, grouped by day, space or model.
+// Groups are ordered by key (newest day first for UsageByDay).
+func (s *Storage) UsageSummary(ctx context.Context, groupBy string, since time.Time) ([]*models.UsageSummary, error) {
+	var keyExpr, order string
+	switch groupBy {
+	case UsageByDay, "":
+		keyExpr = "date(created_at, 'unixepoch', 'localtime')"
+		order = "key DESC"
+	case UsageBySpace:
+		keyExpr = "COALESCE(NULLIF(space_id, ''), 'global')"
+		order = "cost DESC, key"
+	case UsageByModel:
+		keyExpr = "COALESCE(NULLIF(model, ''), provider)"
+		order = "cost DESC, key"
+	default:
+		return nil, fmt.Errorf("invalid usage grouping: %s (use day, space or model)", groupBy)
+	}
+
+	rows, err := s.db.db.QueryContext(ctx, `
+		SELECT `+keyExpr+` AS key,
+			COUNT(*),
+			SUM(CASE WHEN error IS NULL THEN 0 ELSE 1 END),
+			SUM(input_tokens),
+			SUM(output_tokens),
+			SUM(cost) AS cost,
+			AVG(latency_ms)
+		FROM ai_usage
+		WHERE created_at >= ?
+		GROUP BY key
+		ORDER BY `+order, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*models.UsageSummary
+	for rows.Next() {
+		var sum models.UsageSummary
+		var avgLatency float64
+		if err := rows.Scan(&sum.Key, &sum.Calls, &sum.Errors, &sum.InputTokens,
+			&sum.OutputTokens, &sum.Cost, &avgLatency); err != nil {
+			return nil, err
+		}
+		sum.AvgLatency = time.Duration(avgLatency) * time.Millisecond
+		summaries = append(summaries, &sum)
+	}
+	return summaries, rows.Err()
+}
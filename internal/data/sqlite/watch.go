@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==================== Change Notifications ====================
+
+// Item types in the change log.
+const (
+	ChangePattern    = "pattern"
+	ChangeNote       = "note"
+	ChangeSpace      = "space"
+	ChangeAIResponse = "ai_response" // Keyed by cache key; deletions only
+)
+
+// ChangeOp is what happened to an item.
+type ChangeOp string
+
+const (
+	// ChangeSaved means the item was created or updated. It may have been
+	// deleted again since, so readers should handle it being gone.
+	ChangeSaved ChangeOp = "saved"
+	// ChangeDeleted means the item was deleted (soft deleted for patterns).
+	ChangeDeleted ChangeOp = "deleted"
+)
+
+// Change is one entry of the change log, written by triggers for every
+// change made by any process.
+type Change struct {
+	Seq      int64
+	ItemType string
+	ItemID   string
+	Op       ChangeOp
+	At       time.Time
+}
+
+// ChangeEvent is a batch of changes seen by a Watcher. Reset means changes
+// were missed (the log was pruned, the database restored, or the
+// subscriber fell behind), so everything should be reloaded.
+type ChangeEvent struct {
+	Changes []Change
+	Reset   bool
+}
+
+// IDs returns the distinct IDs of changed items of itemType, and whether
+// the event concerns itemType at all (always true for a reset).
+func (e ChangeEvent) IDs(itemType string) ([]string, bool) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, c := range e.Changes {
+		if c.ItemType == itemType && !seen[c.ItemID] {
+			seen[c.ItemID] = true
+			ids = append(ids, c.ItemID)
+		}
+	}
+	return ids, e.Reset || len(ids) > 0
+}
+
+// ChangesSince returns the changes after seq, oldest first, at most limit
+// of them (0 for all).
+func (s *Storage) ChangesSince(ctx context.Context, seq int64, limit int) ([]Change, error) {
+	query := `SELECT seq, item_type, item_id, op, changed_at FROM change_log WHERE seq > ? ORDER BY seq`
+	args := []interface{}{seq}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change log: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []Change
+	for rows.Next() {
+		var c Change
+		var at int64
+		if err := rows.Scan(&c.Seq, &c.ItemType, &c.ItemID, &c.Op, &at); err != nil {
+			return nil, fmt.Errorf("failed to read change log: %w", err)
+		}
+		c.At = time.Unix(at, 0)
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// LatestChangeSeq returns the sequence number of the newest change, or 0.
+func (s *Storage) LatestChangeSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	if err := s.db.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM change_log`).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to read change log: %w", err)
+	}
+	return seq, nil
+}
+
+// PruneChanges deletes changes older than before, returning how many were
+// removed. Watchers that still needed them see a reset.
+func (s *Storage) PruneChanges(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.db.ExecContext(ctx, `DELETE FROM change_log WHERE changed_at < ?`, before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune change log: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// dataVersion returns SQLite's data_version, which changes whenever
+// another connection commits. The pool has a single connection, so it is
+// read on the same one every time.
+func (s *Storage) dataVersion(ctx context.Context) (int64, error) {
+	var v int64
+	if err := s.db.db.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("failed to read data version: %w", err)
+	}
+	return v, nil
+}
+
+// Watcher polls the database for changes committed by other processes and
+// passes them to its subscribers. Changes made through the watching
+// Storage itself are picked up with the next outside change.
+type Watcher struct {
+	s        *Storage
+	interval time.Duration
+
+	mu     sync.Mutex
+	subs   []*subscriber
+	cursor int64
+}
+
+type subscriber struct {
+	ch     chan ChangeEvent
+	missed bool
+}
+
+// watchBatch caps the changes read per poll; the rest follow on the next.
+const watchBatch = 1000
+
+// NewWatcher creates a watcher polling every interval (default one
+// second). Call Run to start it.
+func (s *Storage) NewWatcher(interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Watcher{s: s, interval: interval}
+}
+
+// Subscribe returns a channel receiving change events. A subscriber that
+// falls behind gets a reset instead of the events it missed. The channel
+// is closed when Run returns.
+func (w *Watcher) Subscribe() <-chan ChangeEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sub := &subscriber{ch: make(chan ChangeEvent, 16)}
+	w.subs = append(w.subs, sub)
+	return sub.ch
+}
+
+// Run polls until ctx is done. Only changes after Run starts are reported.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer w.closeAll()
+
+	version, err := w.s.dataVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if w.cursor, err = w.s.LatestChangeSeq(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		v, err := w.s.dataVersion(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		pending := v != version
+		version = v
+		if err := w.poll(ctx, pending); err != nil && ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// poll reads new changes if another process committed, and publishes them.
+func (w *Watcher) poll(ctx context.Context, committed bool) error {
+	if !committed {
+		w.publish(ChangeEvent{})
+		return nil
+	}
+	changes, err := w.s.ChangesSince(ctx, w.cursor, watchBatch)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(changes) == 0:
+		// The log went backwards: the database was restored or replaced
+		latest, err := w.s.LatestChangeSeq(ctx)
+		if err != nil {
+			return err
+		}
+		if latest < w.cursor {
+			w.cursor = latest
+			w.publish(ChangeEvent{Reset: true})
+		}
+	case changes[0].Seq != w.cursor+1:
+		// Changes were pruned before this watcher saw them
+		w.cursor = changes[len(changes)-1].Seq
+		w.publish(ChangeEvent{Reset: true})
+	default:
+		w.cursor = changes[len(changes)-1].Seq
+		w.publish(ChangeEvent{Changes: changes})
+	}
+	if len(changes) == watchBatch {
+		return w.poll(ctx, true)
+	}
+	return nil
+}
+
+// publish sends ev to every subscriber without blocking. An empty event
+// only retries the resets owed to subscribers that fell behind.
+func (w *Watcher) publish(ev ChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, sub := range w.subs {
+		out := ev
+		if sub.missed {
+			out = ChangeEvent{Reset: true}
+		} else if !ev.Reset && len(ev.Changes) == 0 {
+			continue
+		}
+		select {
+		case sub.ch <- out:
+			sub.missed = false
+		default:
+			sub.missed = true
+		}
+	}
+}
+
+func (w *Watcher) closeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, sub := range w.subs {
+		close(sub.ch)
+	}
+	w.subs = nil
+}
@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// openSecondStorage opens another connection to the database of s, as a
+// second process would.
+func openSecondStorage(t *testing.T, s *Storage) *Storage {
+	t.Helper()
+	db, err := NewDatabase(s.db.path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	other := NewStorage(db)
+	t.Cleanup(func() {
+		other.Close()
+		db.Close()
+	})
+	return other
+}
+
+func nextEvent(t *testing.T, ch <-chan ChangeEvent) ChangeEvent {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change event")
+	}
+	return ChangeEvent{}
+}
+
+func TestChangeLog(t *testing.T) {
+	s, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	p := models.NewPattern("deploy", "make release")
+	if err := s.SavePattern(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeletePattern(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	n := models.NewNote("Runbook", "watch")
+	if err := s.SaveNote(ctx, n); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := s.ChangesSince(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	want := []struct {
+		itemType string
+		op       ChangeOp
+	}{{ChangePattern, ChangeSaved}, {ChangePattern, ChangeDeleted}, {ChangeNote, ChangeSaved}}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].ItemType != w.itemType || changes[i].Op != w.op {
+			t.Errorf("change %d: expected %s %s, got %+v", i, w.itemType, w.op, changes[i])
+		}
+	}
+
+	latest, _ := s.LatestChangeSeq(ctx)
+	if latest != changes[2].Seq {
+		t.Errorf("expected latest seq %d, got %d", changes[2].Seq, latest)
+	}
+	if n, err := s.PruneChanges(ctx, time.Now().Add(time.Minute)); err != nil || n != 3 {
+		t.Errorf("expected 3 pruned changes, got %d (%v)", n, err)
+	}
+}
+
+func TestWatcher_SeesOtherProcesses(t *testing.T) {
+	s, cleanup := setupTestDB(t)
+	defer cleanup()
+	other := openSecondStorage(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := s.NewWatcher(10 * time.Millisecond)
+	ch := w.Subscribe()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	p := models.NewPattern("deploy", "make release")
+	if err := other.SavePattern(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	ev := nextEvent(t, ch)
+	ids, ok := ev.IDs(ChangePattern)
+	if ev.Reset || !ok || len(ids) != 1 || ids[0] != p.ID {
+		t.Fatalf("expected a change to %s, got %+v", p.ID, ev)
+	}
+	if _, ok := ev.IDs(ChangeNote); ok {
+		t.Error("expected no note changes")
+	}
+
+	// Changes pruned before the watcher read them cause a reset
+	if err := other.DeletePattern(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.PruneChanges(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveNote(ctx, models.NewNote("later", "x")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		ev = nextEvent(t, ch)
+		if ev.Reset {
+			break
+		}
+		// The deletion may have been read before the prune
+		if ids, _ := ev.IDs(ChangePattern); len(ids) == 0 {
+			t.Fatalf("expected a reset, got %+v", ev)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run failed: %v", err)
+	}
+	if _, open := <-ch; open {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestWatcher_SlowSubscriberGetsReset(t *testing.T) {
+	s, cleanup := setupTestDB(t)
+	defer cleanup()
+	w := s.NewWatcher(time.Hour)
+	ch := w.Subscribe()
+
+	for i := 0; i < cap(ch)+1; i++ {
+		w.publish(ChangeEvent{Changes: []Change{{Seq: int64(i), ItemType: ChangePattern, ItemID: "p"}}})
+	}
+	for i := 0; i < cap(ch); i++ {
+		<-ch
+	}
+	w.publish(ChangeEvent{})
+	if ev := <-ch; !ev.Reset {
+		t.Errorf("expected a reset after falling behind, got %+v", ev)
+	}
+}
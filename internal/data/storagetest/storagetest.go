@@ -0,0 +1,655 @@
+// Package storagetest provides a conformance suite for contracts.Storage.
+// Every backend runs it from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) contracts.Storage { return newBackend(t) })
+//	}
+//
+// The suite only relies on behaviour the contract promises, so it does not
+// depend on timestamp precision or on the order of equal sort keys.
+package storagetest
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// Factory returns a new, empty storage. It should register any cleanup
+// with t.Cleanup.
+type Factory func(t *testing.T) contracts.Storage
+
+// Run runs the conformance suite against storages created by newStorage.
+// Each subtest gets a fresh storage.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s contracts.Storage)
+	}{
+		{"PatternCRUD", testPatternCRUD},
+		{"PatternList", testPatternList},
+		{"PatternQueries", testPatternQueries},
+		{"Batch", testBatch},
+		{"Search", testSearch},
+		{"Spaces", testSpaces},
+		{"Notes", testNotes},
+		{"NoteLinks", testNoteLinks},
+		{"Transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func savePattern(t *testing.T, s contracts.Storage, trigger, response string, edit func(p *models.Pattern)) *models.Pattern {
+	t.Helper()
+	p := models.NewPattern(trigger, response)
+	if edit != nil {
+		edit(p)
+	}
+	if err := s.SavePattern(context.Background(), p); err != nil {
+		t.Fatalf("SavePattern(%q) failed: %v", trigger, err)
+	}
+	return p
+}
+
+func patternIDs(patterns []*models.Pattern) []string {
+	ids := make([]string, len(patterns))
+	for i, p := range patterns {
+		ids[i] = p.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sameIDs reports whether got and want hold the same IDs in any order.
+func sameIDs(got []string, want ...string) bool {
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testPatternCRUD(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	p := savePattern(t, s, "hello", "world", func(p *models.Pattern) {
+		p.Strength = 42
+		p.Project = "demo"
+		p.Tags = []string{"greeting", " Greeting ", "api/ users"}
+	})
+
+	got, err := s.GetPattern(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetPattern failed: %v", err)
+	}
+	if got.Trigger != "hello" || got.Response != "world" || got.Strength != 42 || got.Project != "demo" {
+		t.Errorf("GetPattern returned %+v", got)
+	}
+	if len(got.Tags) != 2 || got.Tags[0] != "greeting" || got.Tags[1] != "api/users" {
+		t.Errorf("expected normalized tags [greeting api/users], got %v", got.Tags)
+	}
+
+	// An empty ID is generated
+	noID := models.NewPattern("no id", "generated")
+	noID.ID = ""
+	if err := s.SavePattern(ctx, noID); err != nil {
+		t.Fatalf("SavePattern without ID failed: %v", err)
+	}
+	if noID.ID == "" {
+		t.Error("expected SavePattern to generate an ID")
+	} else if _, err := s.GetPattern(ctx, noID.ID); err != nil {
+		t.Errorf("GetPattern(generated ID) failed: %v", err)
+	}
+
+	// Invalid patterns are rejected
+	if err := s.SavePattern(ctx, models.NewPattern("", "empty trigger")); err == nil {
+		t.Error("expected SavePattern to reject an empty trigger")
+	}
+
+	// Update
+	got.Response = "updated"
+	got.Strength = 50
+	if err := s.UpdatePattern(ctx, got); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	got, _ = s.GetPattern(ctx, p.ID)
+	if got.Response != "updated" || got.Strength != 50 {
+		t.Errorf("update not persisted: %+v", got)
+	}
+	if err := s.UpdatePattern(ctx, models.NewPattern("missing", "x")); err == nil {
+		t.Error("expected UpdatePattern of a missing pattern to fail")
+	}
+
+	// Move
+	if err := s.MovePatternToSpace(ctx, p.ID, "work"); err != nil {
+		t.Fatalf("MovePatternToSpace failed: %v", err)
+	}
+	if got, _ := s.GetPattern(ctx, p.ID); got.SpaceID != "work" {
+		t.Errorf("expected space work, got %q", got.SpaceID)
+	}
+
+	// Delete
+	if err := s.DeletePattern(ctx, p.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	if _, err := s.GetPattern(ctx, p.ID); err == nil {
+		t.Error("expected GetPattern of a deleted pattern to fail")
+	}
+	if _, err := s.GetPattern(ctx, "does-not-exist"); err == nil {
+		t.Error("expected GetPattern of an unknown ID to fail")
+	}
+}
+
+func testPatternList(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	a := savePattern(t, s, "alpha", "a", func(p *models.Pattern) {
+		p.Strength = 80
+		p.Project = "one"
+		p.SpaceID = "work"
+		p.Tags = []string{"api/users"}
+	})
+	b := savePattern(t, s, "beta", "b", func(p *models.Pattern) {
+		p.Strength = 20
+		p.Project = "one"
+		p.Tags = []string{"API/orders"}
+	})
+	c := savePattern(t, s, "gamma", "c", func(p *models.Pattern) {
+		p.Strength = 60
+		p.Project = "two"
+		p.Tags = []string{"ops"}
+	})
+	deleted := savePattern(t, s, "delta", "d", nil)
+	if err := s.DeletePattern(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts contracts.ListOptions
+		want []string
+	}{
+		{"all", contracts.ListOptions{}, []string{a.ID, b.ID, c.ID}},
+		{"space", contracts.ListOptions{SpaceID: "work"}, []string{a.ID}},
+		{"project", contracts.ListOptions{Project: "one"}, []string{a.ID, b.ID}},
+		{"min strength", contracts.ListOptions{MinStrength: 60}, []string{a.ID, c.ID}},
+		{"tag with descendants", contracts.ListOptions{Tags: []string{"api"}}, []string{a.ID, b.ID}},
+		{"tag ignoring case", contracts.ListOptions{Tags: []string{"Ops"}}, []string{c.ID}},
+		{"combined", contracts.ListOptions{Project: "one", MinStrength: 50}, []string{a.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns, err := s.ListPatterns(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("ListPatterns failed: %v", err)
+			}
+			if got := patternIDs(patterns); !sameIDs(got, tt.want...) {
+				t.Errorf("ListPatterns = %v, want %v", got, tt.want)
+			}
+			n, err := s.CountPatterns(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("CountPatterns failed: %v", err)
+			}
+			if n != len(tt.want) {
+				t.Errorf("CountPatterns = %d, want %d", n, len(tt.want))
+			}
+		})
+	}
+
+	// Paging covers every pattern exactly once
+	seen := make(map[string]bool)
+	for offset := 0; offset < 3; offset++ {
+		page, err := s.ListPatterns(ctx, contracts.ListOptions{Limit: 1, Offset: offset})
+		if err != nil {
+			t.Fatalf("ListPatterns failed: %v", err)
+		}
+		if len(page) != 1 {
+			t.Fatalf("expected a page of 1 at offset %d, got %d", offset, len(page))
+		}
+		seen[page[0].ID] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected paging to return 3 distinct patterns, got %d", len(seen))
+	}
+	if n, _ := s.CountPatterns(ctx, contracts.ListOptions{Limit: 1}); n != 3 {
+		t.Errorf("expected CountPatterns to ignore the limit, got %d", n)
+	}
+}
+
+func testPatternQueries(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	weak := savePattern(t, s, "weak", "w", func(p *models.Pattern) { p.Strength = 10 })
+	strong := savePattern(t, s, "strong", "s", func(p *models.Pattern) { p.Strength = 90 })
+	unused := savePattern(t, s, "unused", "u", func(p *models.Pattern) { p.Strength = 50 })
+
+	got, err := s.GetPatternByTrigger(ctx, "strong")
+	if err != nil || got.ID != strong.ID {
+		t.Errorf("GetPatternByTrigger(strong) = %v, %v", got, err)
+	}
+	if _, err := s.GetPatternByTrigger(ctx, "stro"); err == nil {
+		t.Error("expected GetPatternByTrigger to match exactly")
+	}
+
+	top, err := s.GetTopPatterns(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetTopPatterns failed: %v", err)
+	}
+	if len(top) != 2 || top[0].ID != strong.ID || top[1].ID != unused.ID {
+		t.Errorf("GetTopPatterns = %v, want [strong unused]", patternIDs(top))
+	}
+
+	// Only used patterns are recent, most recently used first
+	now := time.Now()
+	weak.LastUsedAt = &now
+	if err := s.UpdatePattern(ctx, weak); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	older := now.Add(-time.Hour)
+	strong.LastUsedAt = &older
+	if err := s.UpdatePattern(ctx, strong); err != nil {
+		t.Fatalf("UpdatePattern failed: %v", err)
+	}
+	recent, err := s.GetRecentlyUsedPatterns(ctx, 10)
+	if err != nil {
+		t.Fatalf("GetRecentlyUsedPatterns failed: %v", err)
+	}
+	if len(recent) != 2 || recent[0].ID != weak.ID || recent[1].ID != strong.ID {
+		t.Errorf("GetRecentlyUsedPatterns = %v, want [weak strong]", patternIDs(recent))
+	}
+	if recent, _ := s.GetRecentlyUsedPatterns(ctx, 1); len(recent) != 1 {
+		t.Errorf("expected GetRecentlyUsedPatterns to honour the limit, got %d", len(recent))
+	}
+}
+
+func testBatch(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	patterns := []*models.Pattern{
+		models.NewPattern("one", "1"),
+		models.NewPattern("two", "2"),
+		models.NewPattern("three", "3"),
+	}
+	if err := s.SavePatternsBatch(ctx, patterns); err != nil {
+		t.Fatalf("SavePatternsBatch failed: %v", err)
+	}
+	if n, _ := s.CountPatterns(ctx, contracts.ListOptions{}); n != 3 {
+		t.Fatalf("expected 3 patterns after batch save, got %d", n)
+	}
+
+	// An invalid pattern fails the whole batch
+	bad := []*models.Pattern{models.NewPattern("four", "4"), models.NewPattern("", "invalid")}
+	if err := s.SavePatternsBatch(ctx, bad); err == nil {
+		t.Error("expected SavePatternsBatch to reject an invalid pattern")
+	}
+	if n, _ := s.CountPatterns(ctx, contracts.ListOptions{}); n != 3 {
+		t.Errorf("expected a failed batch to save nothing, got %d patterns", n)
+	}
+
+	for _, p := range patterns {
+		p.Response += "!"
+	}
+	if err := s.UpdatePatternsBatch(ctx, patterns); err != nil {
+		t.Fatalf("UpdatePatternsBatch failed: %v", err)
+	}
+	for _, p := range patterns {
+		got, err := s.GetPattern(ctx, p.ID)
+		if err != nil || got.Response != p.Response {
+			t.Errorf("batch update of %s not persisted: %v, %v", p.Trigger, got, err)
+		}
+	}
+
+	if err := s.DeletePatternsBatch(ctx, []string{patterns[0].ID, patterns[1].ID}); err != nil {
+		t.Fatalf("DeletePatternsBatch failed: %v", err)
+	}
+	remaining, _ := s.ListPatterns(ctx, contracts.ListOptions{})
+	if got := patternIDs(remaining); !sameIDs(got, patterns[2].ID) {
+		t.Errorf("expected only %q to remain, got %v", patterns[2].Trigger, got)
+	}
+}
+
+func testSearch(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	git := savePattern(t, s, "git status", "show the working tree", func(p *models.Pattern) { p.Strength = 30 })
+	push := savePattern(t, s, "push", "Git push origin", func(p *models.Pattern) {
+		p.Strength = 70
+		p.SpaceID = "work"
+	})
+	savePattern(t, s, "ls", "list files", nil)
+
+	results, err := s.SearchPatterns(ctx, "GIT", contracts.ListOptions{})
+	if err != nil {
+		t.Fatalf("SearchPatterns failed: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != push.ID || results[1].ID != git.ID {
+		t.Errorf("SearchPatterns(GIT) = %v, want [push git] by strength", patternIDs(results))
+	}
+	results, _ = s.SearchPatterns(ctx, "git", contracts.ListOptions{SpaceID: "work"})
+	if got := patternIDs(results); !sameIDs(got, push.ID) {
+		t.Errorf("SearchPatterns in space work = %v", got)
+	}
+	if results, _ := s.SearchPatterns(ctx, "git", contracts.ListOptions{Limit: 1}); len(results) != 1 {
+		t.Errorf("expected SearchPatterns to honour the limit, got %d", len(results))
+	}
+	if results, _ := s.SearchPatterns(ctx, "nothing matches", contracts.ListOptions{}); len(results) != 0 {
+		t.Errorf("expected no results, got %d", len(results))
+	}
+	if err := s.DeletePattern(ctx, push.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	if results, _ := s.SearchPatterns(ctx, "push", contracts.ListOptions{}); len(results) != 0 {
+		t.Errorf("expected deleted patterns to be excluded from search, got %d", len(results))
+	}
+}
+
+func testSpaces(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	global := &models.Space{ID: "global", Name: "Global"}
+	work := &models.Space{ID: "work", Name: "Work"}
+	for _, space := range []*models.Space{work, global} {
+		if err := s.CreateSpace(ctx, space); err != nil {
+			t.Fatalf("CreateSpace failed: %v", err)
+		}
+	}
+
+	got, err := s.GetSpace(ctx, "work")
+	if err != nil || got.Name != "Work" {
+		t.Fatalf("GetSpace(work) = %v, %v", got, err)
+	}
+	if _, err := s.GetSpace(ctx, "missing"); err == nil {
+		t.Error("expected GetSpace of an unknown space to fail")
+	}
+
+	spaces, err := s.ListSpaces(ctx)
+	if err != nil {
+		t.Fatalf("ListSpaces failed: %v", err)
+	}
+	if len(spaces) != 2 || spaces[0].ID != "global" || spaces[1].ID != "work" {
+		t.Errorf("expected spaces ordered by name, got %d", len(spaces))
+	}
+
+	got.Description = "day job"
+	if err := s.UpdateSpace(ctx, got); err != nil {
+		t.Fatalf("UpdateSpace failed: %v", err)
+	}
+	if got, _ := s.GetSpace(ctx, "work"); got.Description != "day job" {
+		t.Errorf("update not persisted: %+v", got)
+	}
+
+	// Without a default, global is used
+	def, err := s.GetDefaultSpace(ctx)
+	if err != nil || def.ID != "global" {
+		t.Errorf("GetDefaultSpace = %v, %v, want global", def, err)
+	}
+	if err := s.SetDefaultSpace(ctx, "work"); err != nil {
+		t.Fatalf("SetDefaultSpace failed: %v", err)
+	}
+	if def, _ := s.GetDefaultSpace(ctx); def == nil || def.ID != "work" {
+		t.Errorf("expected work to be the default space, got %v", def)
+	}
+	if err := s.SetDefaultSpace(ctx, "global"); err != nil {
+		t.Fatalf("SetDefaultSpace failed: %v", err)
+	}
+	if got, _ := s.GetSpace(ctx, "work"); got.DefaultSpace {
+		t.Error("expected only one default space")
+	}
+
+	if err := s.DeleteSpace(ctx, "work"); err != nil {
+		t.Fatalf("DeleteSpace failed: %v", err)
+	}
+	if _, err := s.GetSpace(ctx, "work"); err == nil {
+		t.Error("expected deleted space to be gone")
+	}
+	if err := s.DeleteSpace(ctx, "work"); err == nil {
+		t.Error("expected DeleteSpace of an unknown space to fail")
+	}
+}
+
+func testNotes(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	plain := models.NewNote("Shopping", "milk and eggs")
+	plain.Category = "home"
+	plain.Tags = []string{"errands", "ERRANDS"}
+	pinned := models.NewNote("Ideas", "a Reflex engine")
+	pinned.IsPinned = true
+	pinned.Tags = []string{"work/ideas"}
+	pinned.SpaceID = "work"
+	for _, n := range []*models.Note{plain, pinned} {
+		if err := s.SaveNote(ctx, n); err != nil {
+			t.Fatalf("SaveNote failed: %v", err)
+		}
+	}
+
+	got, err := s.GetNote(ctx, plain.ID)
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+	if got.Title != "Shopping" || got.Content != "milk and eggs" || got.WordCount != 3 {
+		t.Errorf("GetNote returned %+v", got)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != "errands" {
+		t.Errorf("expected normalized tags [errands], got %v", got.Tags)
+	}
+	if _, err := s.GetNote(ctx, "missing"); err == nil {
+		t.Error("expected GetNote of an unknown ID to fail")
+	}
+
+	notes, err := s.ListNotes(ctx, contracts.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListNotes failed: %v", err)
+	}
+	if len(notes) != 2 || notes[0].ID != pinned.ID {
+		t.Errorf("expected 2 notes with the pinned one first, got %d", len(notes))
+	}
+	for _, tt := range []struct {
+		name string
+		opts contracts.ListOptions
+		want string
+	}{
+		{"space", contracts.ListOptions{SpaceID: "work"}, pinned.ID},
+		{"category", contracts.ListOptions{Project: "home"}, plain.ID},
+		{"tag", contracts.ListOptions{Tags: []string{"work"}}, pinned.ID},
+	} {
+		notes, err := s.ListNotes(ctx, tt.opts)
+		if err != nil || len(notes) != 1 || notes[0].ID != tt.want {
+			t.Errorf("ListNotes by %s returned %d notes (%v)", tt.name, len(notes), err)
+		}
+	}
+	if notes, _ := s.ListNotes(ctx, contracts.ListOptions{Limit: 1}); len(notes) != 1 {
+		t.Errorf("expected ListNotes to honour the limit, got %d", len(notes))
+	}
+
+	results, err := s.SearchNotes(ctx, "reflex", contracts.ListOptions{})
+	if err != nil || len(results) != 1 || results[0].ID != pinned.ID {
+		t.Errorf("SearchNotes(reflex) returned %d notes (%v)", len(results), err)
+	}
+	if results, _ := s.SearchNotes(ctx, "SHOPPING", contracts.ListOptions{SpaceID: "work"}); len(results) != 0 {
+		t.Errorf("expected SearchNotes to honour the space, got %d", len(results))
+	}
+
+	got.Content = "milk, eggs and bread"
+	if err := s.UpdateNote(ctx, got); err != nil {
+		t.Fatalf("UpdateNote failed: %v", err)
+	}
+	if got, _ := s.GetNote(ctx, plain.ID); got.Content != "milk, eggs and bread" || got.WordCount != 4 {
+		t.Errorf("update not persisted: %+v", got)
+	}
+	if err := s.UpdateNote(ctx, models.NewNote("missing", "")); err == nil {
+		t.Error("expected UpdateNote of a missing note to fail")
+	}
+
+	if err := s.DeleteNote(ctx, plain.ID); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+	if _, err := s.GetNote(ctx, plain.ID); err == nil {
+		t.Error("expected deleted note to be gone")
+	}
+	if err := s.DeleteNote(ctx, plain.ID); err == nil {
+		t.Error("expected DeleteNote of a missing note to fail")
+	}
+}
+
+func testNoteLinks(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+
+	a := savePattern(t, s, "a", "1", nil)
+	b := savePattern(t, s, "b", "2", nil)
+	note := models.NewNote("Linked", "")
+	note.AddPattern(a.ID)
+	note.AddPattern(b.ID)
+	if err := s.SaveNote(ctx, note); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+	got, _ := s.GetNote(ctx, note.ID)
+	if !sameIDs(got.PatternIDs, a.ID, b.ID) {
+		t.Errorf("expected links to both patterns, got %v", got.PatternIDs)
+	}
+
+	got.RemovePattern(a.ID)
+	if err := s.UpdateNote(ctx, got); err != nil {
+		t.Fatalf("UpdateNote failed: %v", err)
+	}
+	if got, _ := s.GetNote(ctx, note.ID); !sameIDs(got.PatternIDs, b.ID) {
+		t.Errorf("expected only the link to b, got %v", got.PatternIDs)
+	}
+
+	// Deleting a pattern removes its links
+	if err := s.DeletePattern(ctx, b.ID); err != nil {
+		t.Fatalf("DeletePattern failed: %v", err)
+	}
+	if got, _ := s.GetNote(ctx, note.ID); len(got.PatternIDs) != 0 {
+		t.Errorf("expected links to deleted patterns to go, got %v", got.PatternIDs)
+	}
+}
+
+func testTransactions(t *testing.T, s contracts.Storage) {
+	ctx := context.Background()
+	kept := savePattern(t, s, "kept", "before", nil)
+	note := &models.Note{Title: "kept", Content: "before", SpaceID: "global"}
+	note.AddPattern(kept.ID)
+	if err := s.SaveNote(ctx, note); err != nil {
+		t.Fatalf("SaveNote failed: %v", err)
+	}
+
+	// Rolled back writes disappear, including the note link a deletion
+	// removed. Backends may serialize transactions with other operations,
+	// so the outside write is made from another goroutine; it must survive
+	// the rollback whenever it runs.
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	outside := models.NewPattern("outside", "tx")
+	outsideDone := make(chan error)
+	go func() { outsideDone <- s.SavePattern(ctx, outside) }()
+	dropped := models.NewPattern("dropped", "tx")
+	if err := tx.SavePattern(ctx, dropped); err != nil {
+		t.Fatalf("SavePattern in transaction failed: %v", err)
+	}
+	edited := *kept
+	edited.Response = "edited"
+	if err := tx.SavePattern(ctx, &edited); err != nil {
+		t.Fatalf("SavePattern in transaction failed: %v", err)
+	}
+	if err := tx.DeletePattern(ctx, kept.ID); err != nil {
+		t.Fatalf("DeletePattern in transaction failed: %v", err)
+	}
+	if err := tx.DeleteNote(ctx, note.ID); err != nil {
+		t.Fatalf("DeleteNote in transaction failed: %v", err)
+	}
+	if err := tx.SaveNote(ctx, &models.Note{Title: "dropped", Content: "tx", SpaceID: "global"}); err != nil {
+		t.Fatalf("SaveNote in transaction failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if err := <-outsideDone; err != nil {
+		t.Fatalf("SavePattern outside the transaction failed: %v", err)
+	}
+
+	if _, err := s.GetPattern(ctx, dropped.ID); err == nil {
+		t.Error("expected the pattern saved in the rolled back transaction to be gone")
+	}
+	if got, err := s.GetPattern(ctx, kept.ID); err != nil || got.Response != "before" {
+		t.Errorf("expected the rolled back edit and deletion to be undone, got %+v, %v", got, err)
+	}
+	if got, err := s.GetNote(ctx, note.ID); err != nil || len(got.PatternIDs) != 1 {
+		t.Errorf("expected the note and its link to be restored, got %+v, %v", got, err)
+	}
+	if notes, _ := s.ListNotes(ctx, contracts.ListOptions{}); len(notes) != 1 {
+		t.Errorf("expected the note saved in the rolled back transaction to be gone, got %d notes", len(notes))
+	}
+	if _, err := s.GetPattern(ctx, outside.ID); err != nil {
+		t.Errorf("expected the write made outside the transaction to survive: %v", err)
+	}
+
+	// Committed writes stay
+	tx, err = s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	committed := models.NewPattern("committed", "tx")
+	if err := tx.SavePattern(ctx, committed); err != nil {
+		t.Fatalf("SavePattern in transaction failed: %v", err)
+	}
+	if err := tx.DeletePattern(ctx, outside.ID); err != nil {
+		t.Fatalf("DeletePattern in transaction failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if _, err := s.GetPattern(ctx, committed.ID); err != nil {
+		t.Errorf("expected the committed pattern to stay: %v", err)
+	}
+	if _, err := s.GetPattern(ctx, outside.ID); err == nil {
+		t.Error("expected the committed deletion to stay")
+	}
+
+	// Transactions end once
+	tx, err = s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := tx.Rollback(); err == nil {
+		t.Error("expected Rollback after Commit to fail")
+	}
+
+	tx, err = s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("expected Commit after Rollback to fail")
+	}
+
+	// The storage is usable after the transactions end
+	savePattern(t, s, "after", "tx", nil)
+	if n, _ := s.CountPatterns(ctx, contracts.ListOptions{}); n != 3 {
+		t.Errorf("expected 3 patterns, got %d", n)
+	}
+}
@@ -6,8 +6,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ArmyClaw/open-think-reflex/internal/ai/prompt"
+	"github.com/ArmyClaw/open-think-reflex/internal/config"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/branch"
+	"github.com/ArmyClaw/open-think-reflex/internal/core/capture"
 	"github.com/ArmyClaw/open-think-reflex/internal/core/matcher"
 	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
 	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
 	"github.com/ArmyClaw/open-think-reflex/pkg/models"
 	"github.com/gdamore/tcell/v2"
@@ -17,7 +22,7 @@ import (
 // App represents the main TUI application
 type App struct {
 	app         *tview.Application
-	storage     *sqlite.Storage
+	storage     contracts.Storage
 	matcher     *matcher.Engine
 	pages       *tview.Pages
 	theme       *Theme
@@ -40,6 +45,8 @@ type App struct {
 	headerInfo   *tview.TextView
 	onFirstDraw  func()
 	firstDrawOnce sync.Once
+	changes      <-chan sqlite.ChangeEvent // Changes made by other processes
+	notice       string                    // Shown once the data is loaded
 	
 	// State
 	currentSpace *models.Space
@@ -51,6 +58,17 @@ type App struct {
 	showForm     bool
 	showSettings bool
 	showHistory  bool
+	
+	// AI
+	provider     ai.Provider
+	expander     *branch.Expander
+	query        string // Query the current results were matched for
+	sessionID    string // Thought session for expanded branches
+	rootNodeID   string // Root thought node (the query)
+	expanding    bool
+	prompts      config.PromptsConfig // Prompt files for AI answers
+	spaceID      string               // Space AI answers run in ("" = none)
+	lastAnswer   *capture.Generation // Latest finished AI answer, for save/replace
 }
 
 // AppMode represents the current interaction mode
@@ -64,7 +82,7 @@ const (
 var currentMode = ModeInput
 
 // NewApp creates a new TUI application
-func NewApp(storage *sqlite.Storage) *App {
+func NewApp(storage contracts.Storage) *App {
 	themeManager := NewThemeManager()
 	a := &App{
 		storage:      storage,
@@ -108,10 +126,12 @@ func (a *App) Run(ctx context.Context) error {
 		a.app.SetAfterDrawFunc(nil)
 	})
 
+	loaded := make(chan struct{})
 	go func() {
 		patterns, space, err := a.fetchData(ctx)
 		<-ready
 		a.app.QueueUpdateDraw(func() {
+			defer close(loaded)
 			if err != nil {
 				a.output.SetStatus(fmt.Sprintf("Error loading data: %v", err), false)
 				a.statusBar.SetStatus(StatusError, "Load failed")
@@ -122,12 +142,142 @@ func (a *App) Run(ctx context.Context) error {
 			a.statusBar.SetPatternCount(len(a.patterns))
 			a.statusBar.SetStatus(StatusIdle, "Ready")
 			a.updateHeader()
+			if a.notice != "" {
+				a.output.SetStatus(a.notice, false)
+			}
 		})
 	}()
+	if a.changes != nil {
+		go a.followChanges(ctx, loaded)
+	}
 
 	return a.app.Run()
 }
 
+// SetNotice sets a message shown in the output once the data is loaded,
+// e.g. about features the storage doesn't support.
+func (a *App) SetNotice(text string) {
+	a.notice = text
+}
+
+// SetWatcher makes the app follow changes other processes make to the
+// database, such as 'otr pattern create' in another terminal or a decay
+// run. The watcher must be running.
+func (a *App) SetWatcher(w *sqlite.Watcher) {
+	a.changes = w.Subscribe()
+}
+
+// followChanges applies changes made by other processes to the loaded
+// patterns until the watcher stops. Only the changed patterns are read.
+func (a *App) followChanges(ctx context.Context, loaded <-chan struct{}) {
+	// Watchers only exist for SQLite storage
+	db, ok := a.storage.(*sqlite.Storage)
+	if !ok {
+		return
+	}
+	<-loaded
+	for ev := range a.changes {
+		ids, patternsChanged := ev.IDs(sqlite.ChangePattern)
+		_, spacesChanged := ev.IDs(sqlite.ChangeSpace)
+		if ev.Reset {
+			patterns, space, err := a.fetchData(ctx)
+			if err != nil {
+				continue
+			}
+			a.app.QueueUpdateDraw(func() {
+				a.patterns = patterns
+				a.currentSpace = space
+				a.refreshAfterChange()
+			})
+			continue
+		}
+		if !patternsChanged && !spacesChanged {
+			continue
+		}
+
+		var current []*models.Pattern
+		if patternsChanged {
+			var err error
+			if current, err = db.BatchGetPatterns(ctx, ids); err != nil {
+				continue
+			}
+		}
+		var space *models.Space
+		if spacesChanged {
+			spaces, err := a.storage.ListSpaces(ctx)
+			if err != nil {
+				continue
+			}
+			if len(spaces) > 0 {
+				space = spaces[0]
+			}
+		}
+		a.app.QueueUpdateDraw(func() {
+			if patternsChanged {
+				a.patterns = applyPatternChanges(a.patterns, ids, current)
+			}
+			if spacesChanged {
+				a.currentSpace = space
+			}
+			a.refreshAfterChange()
+		})
+	}
+}
+
+// applyPatternChanges replaces the patterns with the changed IDs by their
+// current versions, in place. Changed IDs without a current version were
+// deleted and are removed; new ones are appended.
+func applyPatternChanges(patterns []*models.Pattern, ids []string, current []*models.Pattern) []*models.Pattern {
+	byID := make(map[string]*models.Pattern, len(current))
+	for _, p := range current {
+		byID[p.ID] = p
+	}
+	changed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		changed[id] = true
+	}
+
+	out := make([]*models.Pattern, 0, len(patterns)+len(current))
+	for _, p := range patterns {
+		if !changed[p.ID] {
+			out = append(out, p)
+		} else if cur := byID[p.ID]; cur != nil {
+			out = append(out, cur)
+			delete(byID, p.ID)
+		}
+	}
+	for _, id := range ids {
+		if p := byID[id]; p != nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// refreshAfterChange updates what shows the loaded patterns. Current
+// results are kept; the next query matches against the new patterns.
+func (a *App) refreshAfterChange() {
+	a.statusBar.SetPatternCount(len(a.patterns))
+	a.updateHeader()
+	a.statusBar.SetStatus(StatusIdle, "Patterns updated")
+}
+
+// SetProvider enables AI answers and AI expansion of thought chain branches.
+func (a *App) SetProvider(provider ai.Provider) {
+	a.provider = provider
+	// Expanded branches are kept as thought sessions, which only SQLite stores
+	if db, ok := a.storage.(*sqlite.Storage); ok {
+		a.expander = branch.NewExpander(db, provider)
+	}
+}
+
+// SetPrompts makes AI answers use the system prompt and template
+// configured for spaceID, and bills and captures them in that space.
+func (a *App) SetPrompts(cfg config.PromptsConfig, spaceID string) {
+	a.prompts = cfg
+	a.spaceID = spaceID
+}
+
 // SetScreen allows callers to provide a pre-configured tcell screen.
 func (a *App) SetScreen(screen tcell.Screen) {
 	a.app.SetScreen(screen)
@@ -300,6 +450,14 @@ func (a *App) createInputArea() tview.Primitive {
 func (a *App) setupKeyBindings() {
 	// Global key bindings
 	a.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Esc cancels a streaming answer before anything else
+		if event.Key() == tcell.KeyEsc && a.output.IsStreaming() {
+			a.output.StopStreaming()
+			a.output.SetTitle("Output")
+			a.output.SetStatus("Stream cancelled", false)
+			return nil
+		}
+		
 		// Tab to switch between input and thought chain
 		if event.Key() == tcell.KeyTab {
 			if a.mode == ModeInput {
@@ -449,6 +607,30 @@ func (a *App) setupKeyBindings() {
 				// Toggle history panel
 				a.toggleHistory()
 				return nil
+			case 'x':
+				// Expand selected branch with AI (only in navigation mode)
+				if a.mode == ModeNavigation {
+					a.expandSelected()
+				}
+				return nil
+			case 'a':
+				// Ask AI about the current query (only in navigation mode)
+				if a.mode == ModeNavigation {
+					a.askAI()
+				}
+				return nil
+			case 'w':
+				// Save the AI answer as a new pattern (only in navigation mode)
+				if a.mode == ModeNavigation {
+					a.captureAnswer(false)
+				}
+				return nil
+			case 'r':
+				// Replace the matched pattern's response with the AI answer
+				if a.mode == ModeNavigation {
+					a.captureAnswer(true)
+				}
+				return nil
 			}
 		}
 		return event
@@ -476,6 +658,15 @@ func (a *App) updateHeader() {
 
 // updateOutputForSelection updates the output panel based on current selection
 func (a *App) updateOutputForSelection() {
+	if node := a.thoughtChain.SelectedNode(); node != nil && node.Branch != nil {
+		b := node.Branch
+		text := fmt.Sprintf("Branch: %s\nScore: %.0f%%\n", b.Thought, b.Score)
+		if b.Action != "" {
+			text += fmt.Sprintf("Next step: %s\n", b.Action)
+		}
+		a.output.SetOutput(text + "\nPress [x] to expand this branch further")
+		return
+	}
 	result := a.thoughtChain.GetSelectedResult()
 	if result != nil {
 		a.output.SetOutput(fmt.Sprintf("Selected: %s\n\nTrigger: %s\nResponse: %s\nConfidence: %.0f%% (%s)\nStrength: %.1f / %.1f\n\nPress [Enter] to use this response",
@@ -533,6 +724,12 @@ func (a *App) handleInput(text string) {
 	results := a.matcher.Match(ctx, text, activePatterns, opts)
 	a.results = results
 	
+	// A new query starts a new thought session on first expansion
+	a.query = text
+	a.sessionID = ""
+	a.rootNodeID = ""
+	a.lastAnswer = nil
+	
 	if len(results) == 0 {
 		a.output.SetOutput(fmt.Sprintf("No matches found for: %s\n\nTip: Use 'otr pattern create' to add patterns", text))
 		a.thoughtChain.Clear()
@@ -569,6 +766,176 @@ func (a *App) handleInput(text string) {
 		results[0].Pattern.Response))
 }
 
+// askAI streams an AI answer to the current query into the output panel,
+// with the matched patterns as context.
+func (a *App) askAI() {
+	if a.provider == nil {
+		a.output.SetStatus("AI is not available (no AI provider configured)", false)
+		return
+	}
+	if a.query == "" {
+		return
+	}
+	
+	builder, err := prompt.NewBuilderForSpace(a.prompts, a.spaceID)
+	if err != nil {
+		a.output.SetStatus(fmt.Sprintf("Failed to ask AI: %v", err), false)
+		a.statusBar.SetStatus(StatusError, "AI failed")
+		return
+	}
+	patterns := make([]*models.Pattern, len(a.results))
+	for i, r := range a.results {
+		patterns[i] = r.Pattern
+	}
+	req := &ai.Request{
+		System: builder.BuildChatSystemPrompt(builder.Fit(prompt.Candidates(patterns)).Included),
+		Prompt: a.query,
+	}
+	
+	a.lastAnswer = nil
+	query := a.query
+	var matchedID string
+	if len(patterns) > 0 {
+		matchedID = patterns[0].ID
+	}
+	stream, err := ai.OpenStream(ai.WithSpace(context.Background(), a.spaceID), a.provider, req)
+	if err != nil {
+		a.output.SetStatus(fmt.Sprintf("Failed to ask AI: %v", err), false)
+		a.statusBar.SetStatus(StatusError, "AI failed")
+		return
+	}
+	a.statusBar.SetStatus(StatusProcessing, "AI answering...")
+	a.output.StartStreaming(a.app, stream, func(resp *ai.Response, err error) {
+		if err != nil {
+			a.statusBar.SetStatus(StatusError, "AI failed")
+			return
+		}
+		if resp != nil && resp.Content != "" {
+			a.lastAnswer = &capture.Generation{
+				Query:            query,
+				Response:         resp.Content,
+				Provider:         a.provider.Name(),
+				Model:            resp.Model,
+				SpaceID:          a.spaceID,
+				MatchedPatternID: matchedID,
+			}
+			a.output.SetStatus("Press [w] to save the answer as a pattern or [r] to replace the matched response", true)
+		}
+		a.statusBar.SetStatus(StatusIdle, "Ready")
+	})
+}
+
+// captureAnswer keeps the latest AI answer as a reflex: a new pattern, or
+// with replace the new response of the best matching pattern.
+func (a *App) captureAnswer(replace bool) {
+	if a.lastAnswer == nil {
+		a.output.SetStatus("No AI answer to save yet; press [a] to ask AI", false)
+		return
+	}
+	// Provenance records only exist in SQLite storage
+	db, ok := a.storage.(*sqlite.Storage)
+	if !ok {
+		a.output.SetStatus("Saving AI answers needs SQLite storage", false)
+		return
+	}
+	ctx := context.Background()
+	
+	var pattern *models.Pattern
+	var err error
+	if replace {
+		pattern, err = capture.ReplaceResponse(ctx, db, a.lastAnswer)
+	} else {
+		pattern, err = capture.SaveAsPattern(ctx, db, a.lastAnswer)
+	}
+	if err != nil {
+		a.output.SetStatus(fmt.Sprintf("Error saving answer: %v", err), false)
+		return
+	}
+	
+	// Refresh pattern list
+	if err := a.loadData(ctx); err != nil {
+		a.output.SetStatus(fmt.Sprintf("Error reloading patterns: %v", err), false)
+		return
+	}
+	a.statusBar.SetPatternCount(len(a.patterns))
+	a.lastAnswer = nil
+	
+	if replace {
+		a.output.SetStatus(fmt.Sprintf("Replaced response of pattern '%s'", pattern.Trigger), true)
+	} else {
+		a.output.SetStatus(fmt.Sprintf("Saved answer as pattern '%s'", pattern.Trigger), true)
+	}
+}
+
+// expandSelected asks the AI provider for child branches of the selected
+// node. The call runs in the background; children are inserted into the
+// tree and persisted as thought nodes when it returns.
+func (a *App) expandSelected() {
+	node := a.thoughtChain.SelectedNode()
+	if node == nil {
+		return
+	}
+	if a.expander == nil {
+		a.output.SetStatus("AI expansion is not available (no AI provider configured)", false)
+		return
+	}
+	if a.expanding {
+		return
+	}
+	a.expanding = true
+	a.statusBar.SetStatus(StatusProcessing, "Expanding branch...")
+	
+	query := a.query
+	sessionID, rootNodeID := a.sessionID, a.rootNodeID
+	nodeID, label := node.NodeID, node.Label()
+	path := append([]string{query}, a.thoughtChain.Path(node)...)
+	
+	go func() {
+		ctx := context.Background()
+		var branches []*branch.Branch
+		err := func() error {
+			if sessionID == "" {
+				session, root, err := a.expander.Begin(ctx, query)
+				if err != nil {
+					return err
+				}
+				sessionID, rootNodeID = session.ID, root.ID
+			}
+			if nodeID == "" {
+				// Match results are persisted when first expanded
+				n, err := a.expander.AddNode(ctx, sessionID, rootNodeID, label)
+				if err != nil {
+					return err
+				}
+				nodeID = n.ID
+			}
+			var err error
+			branches, err = a.expander.Expand(ctx, sessionID, nodeID, path)
+			return err
+		}()
+		
+		a.app.QueueUpdateDraw(func() {
+			a.expanding = false
+			if a.query == query {
+				a.sessionID, a.rootNodeID = sessionID, rootNodeID
+				node.NodeID = nodeID
+			}
+			if err != nil {
+				a.output.SetStatus(fmt.Sprintf("Failed to expand branch: %v", err), false)
+				a.statusBar.SetStatus(StatusError, "Expand failed")
+				return
+			}
+			if a.query != query {
+				// The results were replaced while the provider was answering
+				a.statusBar.SetStatus(StatusIdle, "Ready")
+				return
+			}
+			a.thoughtChain.AddChildren(node, branches)
+			a.statusBar.SetStatus(StatusIdle, fmt.Sprintf("Added %d branch(es)", len(branches)))
+		})
+	}()
+}
+
 // toggleTheme switches between light and dark themes
 func (a *App) toggleTheme() {
 	a.themeManager.Toggle()
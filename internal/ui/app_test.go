@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/core/capture"
+	"github.com/ArmyClaw/open-think-reflex/internal/data/sqlite"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestApplyPatternChanges(t *testing.T) {
+	a := &models.Pattern{ID: "a", Trigger: "a"}
+	b := &models.Pattern{ID: "b", Trigger: "b"}
+	c := &models.Pattern{ID: "c", Trigger: "c"}
+	patterns := []*models.Pattern{a, b, c}
+
+	// b was edited, c deleted and d created
+	b2 := &models.Pattern{ID: "b", Trigger: "b2"}
+	d := &models.Pattern{ID: "d", Trigger: "d"}
+	got := applyPatternChanges(patterns, []string{"b", "c", "d"}, []*models.Pattern{d, b2})
+
+	want := []string{"a", "b2", "d"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d patterns, got %d", len(want), len(got))
+	}
+	for i, trigger := range want {
+		if got[i].Trigger != trigger {
+			t.Errorf("pattern %d: expected %q, got %q", i, trigger, got[i].Trigger)
+		}
+	}
+	if len(patterns) != 3 || patterns[1] != b {
+		t.Error("the original slice should not be modified")
+	}
+}
+
+func TestEscCancelsStreaming(t *testing.T) {
+	a := NewApp(nil)
+	a.setupKeyBindings()
+	stream, err := ai.OpenStream(context.Background(), ai.NewFakeProvider(ai.FakeStep{Content: "partial"}), &ai.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	a.output.StartStreaming(a.app, stream, nil)
+
+	esc := tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone)
+	if got := a.app.GetInputCapture()(esc); got != nil {
+		t.Error("Esc should be consumed while streaming")
+	}
+	if a.output.IsStreaming() || a.output.stream != nil {
+		t.Error("Esc should stop the stream")
+	}
+	if a.mode != ModeInput {
+		t.Errorf("Esc should only cancel the stream, mode is %v", a.mode)
+	}
+}
+
+func TestCaptureAnswer(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	storage := sqlite.NewStorage(db)
+	matched := models.NewPattern("deploy", "Run make release")
+	if err := storage.SavePattern(ctx, matched); err != nil {
+		t.Fatalf("SavePattern failed: %v", err)
+	}
+
+	a := NewApp(storage)
+	a.captureAnswer(false)
+	if patterns, _ := storage.ListPatterns(ctx, contracts.ListOptions{}); len(patterns) != 1 {
+		t.Fatalf("nothing should be saved before an answer, got %d patterns", len(patterns))
+	}
+
+	answer := &capture.Generation{
+		Query:            "deploy to staging",
+		Response:         "Run make release ENV=staging",
+		Provider:         "fake",
+		MatchedPatternID: matched.ID,
+	}
+	a.lastAnswer = answer
+	a.captureAnswer(false)
+	if len(a.patterns) != 2 {
+		t.Fatalf("expected the answer saved as a second pattern, got %d patterns", len(a.patterns))
+	}
+	if a.lastAnswer != nil {
+		t.Error("a captured answer should not be captured again")
+	}
+
+	a.lastAnswer = answer
+	a.captureAnswer(true)
+	got, err := storage.GetPattern(ctx, matched.ID)
+	if err != nil {
+		t.Fatalf("GetPattern failed: %v", err)
+	}
+	if got.Response != answer.Response {
+		t.Errorf("expected the matched response replaced, got %q", got.Response)
+	}
+}
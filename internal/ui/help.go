@@ -57,6 +57,11 @@ func (h *HelpPanel) getHelpContent() string {
 │  [c]         Create new pattern (Input mode)                    │
 │  [e]         Edit selected pattern (Navigation mode)            │
 │  [d]         Delete selected pattern (Navigation mode)         │
+│  [x]         Expand branch with AI (Navigation mode)           │
+│  [a]         Ask AI, streaming the answer (Navigation mode)    │
+│  [Esc]       Cancel the streaming answer                       │
+│  [w]         Save the AI answer as a pattern (Navigation mode) │
+│  [r]         Replace matched response with the AI answer       │
 │  [h/?]       Show/Hide this help                                │
 │  [q/Esc]     Quit application                                   │
 ├─────────────────────────────────────────────────────────────────┤
@@ -141,7 +146,7 @@ func (s *ShortcutBar) createView() *tview.TextView {
 
 func (s *ShortcutBar) getShortcuts(mode AppMode) string {
 	if mode == ModeNavigation {
-		return " [↑/↓] Navigate | [Enter] Select | [←/→] Expand/Collapse | [e] Edit | [d] Delete | [/] Filter | [s] Stats | [S] Spaces | [y] History | [,] Settings | [?] Help | [q] Quit "
+		return " [↑/↓] Navigate | [Enter] Select | [←/→] Expand/Collapse | [a] Ask AI | [w/r] Save/Replace | [x] AI Expand | [e] Edit | [d] Delete | [/] Filter | [s] Stats | [S] Spaces | [y] History | [,] Settings | [?] Help | [q] Quit "
 	}
 	return " [Tab] Switch | [c] Create | [t] Theme | [/] Filter | [s] Stats | [S] Spaces | [y] History | [,] Settings | [?] Help | [q] Quit "
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ArmyClaw/open-think-reflex/pkg/ai"
 	"github.com/rivo/tview"
 )
 
@@ -14,6 +15,7 @@ type OutputView struct {
 	theme       *Theme
 	title       string
 	streaming   bool
+	stream      ai.EventStream // Active stream, nil when idle
 	loading     bool
 	stopLoading chan struct{}
 }
@@ -81,13 +83,90 @@ func (v *OutputView) SetStatus(status string, success bool) {
 	v.AppendOutput(fmt.Sprintf("[%s]%s[white]", color, status))
 }
 
-// StartStreaming begins streaming animation
-func (v *OutputView) StartStreaming() {
+// StartStreaming shows an AI response as it streams in. Events are read
+// in the background and applied on the UI goroutine via app; onDone (may
+// be nil) runs there too once the stream ends, with the final message.
+func (v *OutputView) StartStreaming(app *tview.Application, stream ai.EventStream, onDone func(*ai.Response, error)) {
+	v.StopStreaming()
 	v.streaming = true
+	v.stream = stream
+	v.SetTitle("Streaming...")
+	v.view.SetText("")
+	
+	go func() {
+		var text strings.Builder
+		var final *ai.Response
+		for stream.Next() {
+			e := stream.Event()
+			switch e.Type {
+			case ai.EventText:
+				text.WriteString(e.Text)
+				content := tview.Escape(text.String())
+				app.QueueUpdateDraw(func() {
+					if v.stream != stream {
+						return
+					}
+					v.view.SetText(content)
+					v.view.ScrollToEnd()
+				})
+			case ai.EventToolCall:
+				name := e.ToolCall.Name
+				app.QueueUpdateDraw(func() {
+					if v.stream != stream {
+						return
+					}
+					v.SetTitle(fmt.Sprintf("Streaming... (tool: %s)", name))
+				})
+			case ai.EventDone:
+				final = e.Response
+			}
+		}
+		err := stream.Err()
+		stream.Close()
+		
+		app.QueueUpdateDraw(func() {
+			if v.stream != stream {
+				return // Replaced or stopped meanwhile
+			}
+			v.streaming = false
+			v.stream = nil
+			if err != nil {
+				v.SetTitle("Output")
+				v.SetStatus(fmt.Sprintf("Stream failed: %v", err), false)
+			} else {
+				v.SetTitle(streamTitle(final))
+			}
+			if onDone != nil {
+				onDone(final, err)
+			}
+		})
+	}()
+}
+
+// streamTitle summarizes a finished stream's stop reason and usage.
+func streamTitle(resp *ai.Response) string {
+	if resp == nil {
+		return "Output"
+	}
+	var parts []string
+	if resp.FinishReason != "" {
+		parts = append(parts, resp.FinishReason)
+	}
+	if resp.Usage != nil {
+		parts = append(parts, fmt.Sprintf("%d tokens", resp.Usage.InputTokens+resp.Usage.OutputTokens))
+	}
+	if len(parts) == 0 {
+		return "AI Response"
+	}
+	return fmt.Sprintf("AI Response (%s)", strings.Join(parts, ", "))
 }
 
-// StopStreaming stops streaming animation
+// StopStreaming cancels the active stream, if any
 func (v *OutputView) StopStreaming() {
+	if v.stream != nil {
+		v.stream.Close()
+		v.stream = nil
+	}
 	v.streaming = false
 }
 
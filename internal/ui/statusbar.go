@@ -83,9 +83,9 @@ func (sb *StatusBar) View() *tview.TextView {
 	return sb.view
 }
 
+// render redraws the bar. Callers hold sb.mu; taking it again here would
+// deadlock every setter.
 func (sb *StatusBar) render() {
-	sb.mu.RLock()
-	defer sb.mu.RUnlock()
 
 	// Status icon and color
 	statusIcon := "●"
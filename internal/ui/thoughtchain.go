@@ -10,17 +10,41 @@ package ui
 import (
 	"fmt"
 
+	"github.com/ArmyClaw/open-think-reflex/internal/core/branch"
 	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
 	"github.com/rivo/tview"
 )
 
 // ThoughtChainNode represents a node in the thought chain tree.
-// Each node corresponds to a match result, optionally with child branches.
+// Top-level nodes are match results; their descendants are branches
+// generated by AI expansion.
 type ThoughtChainNode struct {
-	Result    *contracts.MatchResult // The match result for this node
-	Children  []*ThoughtChainNode   // Child branches (sub-matches)
+	Result    *contracts.MatchResult // The match result (top-level nodes only)
+	Branch    *branch.Branch         // The AI branch (expanded nodes only)
+	Parent    *ThoughtChainNode      // Parent node (nil at top level)
+	Children  []*ThoughtChainNode   // Child branches
 	Expanded  bool                  // Whether children are visible
 	Level     int                   // Tree depth (0 = root)
+	NodeID    string                // Persisted thought node ("" until expanded)
+}
+
+// Label returns the node text as shown in the tree and stored in thought nodes.
+func (n *ThoughtChainNode) Label() string {
+	if n.Branch != nil {
+		return n.Branch.Label()
+	}
+	return fmt.Sprintf("%s (%.0f%%)", n.Result.Pattern.Trigger, n.Result.Confidence)
+}
+
+// context returns the node text sent to the AI when expanding below it.
+func (n *ThoughtChainNode) context() string {
+	if n.Branch != nil {
+		if n.Branch.Action != "" {
+			return n.Branch.Thought + " (next step: " + n.Branch.Action + ")"
+		}
+		return n.Branch.Thought
+	}
+	return n.Result.Pattern.Trigger + ": " + truncate(n.Result.Pattern.Response, 200)
 }
 
 // ThoughtChainView displays the thought chain tree (Layer 1).
@@ -29,8 +53,8 @@ type ThoughtChainView struct {
 	view     *tview.TextView // tview text view component
 	theme    *Theme          // Active theme for colors
 	results  []contracts.MatchResult // Raw match results
-	nodes    []*ThoughtChainNode     // Tree structure
-	selected int          // Currently selected node index
+	nodes    []*ThoughtChainNode     // Top-level nodes, one per result
+	selected int          // Selected index into the visible nodes
 	focused  bool         // Whether this view has focus
 }
 
@@ -66,29 +90,53 @@ func (v *ThoughtChainView) SetResults(results []contracts.MatchResult) {
 	v.render()
 }
 
-// buildTree converts flat results into a tree structure
+// buildTree converts flat results into top-level tree nodes.
+// Children are added later by AI expansion (see AddChildren).
 func (v *ThoughtChainView) buildTree(results []contracts.MatchResult) []*ThoughtChainNode {
 	nodes := make([]*ThoughtChainNode, len(results))
-	
-	for i, r := range results {
-		node := &ThoughtChainNode{
-			Result:   &r,
-			Children:  nil,
-			Expanded:  i < 3, // Auto-expand first 3
-			Level:    0,
-		}
-		
-		// Add simulated children for visual tree effect
-		if r.Confidence > 80 {
-			node.Children = []*ThoughtChainNode{
-				{Result: &r, Expanded: false, Level: 1},
+	for i := range results {
+		nodes[i] = &ThoughtChainNode{Result: &results[i], Level: 0}
+	}
+	return nodes
+}
+
+// visible returns the nodes currently shown, in display order.
+func (v *ThoughtChainView) visible() []*ThoughtChainNode {
+	var out []*ThoughtChainNode
+	var walk func(nodes []*ThoughtChainNode)
+	walk = func(nodes []*ThoughtChainNode) {
+		for _, n := range nodes {
+			out = append(out, n)
+			if n.Expanded {
+				walk(n.Children)
 			}
 		}
-		
-		nodes[i] = node
 	}
-	
-	return nodes
+	walk(v.nodes)
+	return out
+}
+
+// AddChildren inserts AI branches below node and expands it.
+func (v *ThoughtChainView) AddChildren(node *ThoughtChainNode, branches []*branch.Branch) {
+	for _, b := range branches {
+		node.Children = append(node.Children, &ThoughtChainNode{
+			Branch: b,
+			Parent: node,
+			Level:  node.Level + 1,
+			NodeID: b.NodeID,
+		})
+	}
+	node.Expanded = true
+	v.render()
+}
+
+// Path returns the context from the top-level result down to node.
+func (v *ThoughtChainView) Path(node *ThoughtChainNode) []string {
+	var path []string
+	for n := node; n != nil; n = n.Parent {
+		path = append([]string{n.context()}, path...)
+	}
+	return path
 }
 
 // SetFocused sets the focus state
@@ -116,7 +164,7 @@ func (v *ThoughtChainView) Selected() int {
 
 // SelectNext selects the next item
 func (v *ThoughtChainView) SelectNext() {
-	max := len(v.results)
+	max := len(v.visible())
 	if max == 0 {
 		return
 	}
@@ -126,7 +174,7 @@ func (v *ThoughtChainView) SelectNext() {
 
 // SelectPrev selects the previous item
 func (v *ThoughtChainView) SelectPrev() {
-	max := len(v.results)
+	max := len(v.visible())
 	if max == 0 {
 		return
 	}
@@ -136,28 +184,46 @@ func (v *ThoughtChainView) SelectPrev() {
 
 // Expand expands the selected node
 func (v *ThoughtChainView) Expand() {
-	if v.selected >= 0 && v.selected < len(v.nodes) {
-		if v.nodes[v.selected] != nil {
-			v.nodes[v.selected].Expanded = true
-			v.render()
-		}
+	if node := v.SelectedNode(); node != nil {
+		node.Expanded = true
+		v.render()
 	}
 }
 
-// Collapse collapses the selected node
+// Collapse collapses the selected node, or moves to its parent if it is
+// already collapsed
 func (v *ThoughtChainView) Collapse() {
-	if v.selected >= 0 && v.selected < len(v.nodes) {
-		if v.nodes[v.selected] != nil {
-			v.nodes[v.selected].Expanded = false
-			v.render()
+	node := v.SelectedNode()
+	if node == nil {
+		return
+	}
+	if !node.Expanded && node.Parent != nil {
+		node = node.Parent
+		for i, n := range v.visible() {
+			if n == node {
+				v.selected = i
+				break
+			}
 		}
 	}
+	node.Expanded = false
+	v.render()
+}
+
+// SelectedNode returns the currently selected node
+func (v *ThoughtChainView) SelectedNode() *ThoughtChainNode {
+	nodes := v.visible()
+	if v.selected >= 0 && v.selected < len(nodes) {
+		return nodes[v.selected]
+	}
+	return nil
 }
 
-// GetSelectedResult returns the currently selected result
+// GetSelectedResult returns the currently selected result, or nil when an
+// AI branch is selected
 func (v *ThoughtChainView) GetSelectedResult() *contracts.MatchResult {
-	if v.selected >= 0 && v.selected < len(v.results) {
-		return &v.results[v.selected]
+	if node := v.SelectedNode(); node != nil {
+		return node.Result
 	}
 	return nil
 }
@@ -178,19 +244,27 @@ func (v *ThoughtChainView) render() {
 	
 	text := ""
 	
-	for i, r := range v.results {
-		// Skip hidden children
-		if i > 0 && v.nodes[i-1] != nil && !v.nodes[i-1].Expanded && v.nodes[i].Level > 0 {
-			continue
-		}
+	for i, node := range v.visible() {
+		prefix := v.getTreePrefix(node.Level, i == v.selected, node.Expanded)
+		selected := (i == v.selected && v.focused)
 		
-		node := v.nodes[i]
-		if node == nil {
-			node = &ThoughtChainNode{Result: &v.results[i], Level: 0}
+		if node.Branch != nil {
+			b := node.Branch
+			if selected {
+				text += fmt.Sprintf("[%s]%s[white]\n", v.theme.Selected, prefix)
+				text += fmt.Sprintf("   ├ [%s]%s[white]\n", v.theme.Accent, b.Thought)
+				if b.Action != "" {
+					text += fmt.Sprintf("   ├ Next: %s\n", truncate(b.Action, 35))
+				}
+				text += fmt.Sprintf("   └ Score: [%.0f%%] ai\n", b.Score)
+			} else {
+				text += fmt.Sprintf("%s[%s]🌱[white] %s (%.0f%%)\n",
+					prefix, v.theme.Secondary, b.Thought, b.Score)
+			}
+			continue
 		}
 		
-		prefix := v.getTreePrefix(node.Level, i == v.selected, node.Expanded)
-		selected := (i == v.selected && v.focused)
+		r := node.Result
 		
 		// Format based on match type
 		matchType := r.Branch
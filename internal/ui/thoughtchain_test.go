@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/ArmyClaw/open-think-reflex/internal/core/branch"
+	"github.com/ArmyClaw/open-think-reflex/pkg/contracts"
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func TestThoughtChainView_AddChildren(t *testing.T) {
+	v := NewThoughtChainView(DefaultTheme())
+	v.SetResults([]contracts.MatchResult{
+		{Pattern: models.NewPattern("deploy", "make release"), Confidence: 90},
+		{Pattern: models.NewPattern("rollback", "git revert"), Confidence: 50},
+	})
+
+	if len(v.visible()) != 2 {
+		t.Fatalf("expected 2 visible nodes, got %d", len(v.visible()))
+	}
+
+	root := v.SelectedNode()
+	v.AddChildren(root, []*branch.Branch{
+		{Thought: "Check CI", Action: "open the pipeline", Score: 80},
+		{Thought: "Tag first", Score: 40},
+	})
+
+	visible := v.visible()
+	if len(visible) != 4 {
+		t.Fatalf("expected 4 visible nodes, got %d", len(visible))
+	}
+	if visible[1].Branch.Thought != "Check CI" || visible[1].Level != 1 {
+		t.Errorf("expected child below its parent, got %+v", visible[1])
+	}
+
+	v.SelectNext()
+	child := v.SelectedNode()
+	if v.GetSelectedResult() != nil {
+		t.Error("expected no match result for an AI branch")
+	}
+	path := v.Path(child)
+	if len(path) != 2 || path[1] != "Check CI (next step: open the pipeline)" {
+		t.Errorf("unexpected path: %v", path)
+	}
+
+	// Collapsing a leaf moves to its parent and hides the children
+	v.Collapse()
+	if v.SelectedNode() != root || len(v.visible()) != 2 {
+		t.Errorf("expected collapse to parent, got %d visible", len(v.visible()))
+	}
+}
@@ -4,16 +4,14 @@ package ai
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
-	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 )
 
 // ClaudeProvider implements the Provider interface for Anthropic's Claude models.
@@ -41,6 +39,7 @@ func NewClaudeProvider(opts ...Option) *ClaudeProvider {
 		Model:       "claude-3-sonnet-20240229",
 		MaxTokens:   1024,
 		Temperature: 0.7,
+		MaxRetries:  2,
 	}
 
 	// Apply functional options
@@ -49,9 +48,18 @@ func NewClaudeProvider(opts ...Option) *ClaudeProvider {
 	}
 
 	// Initialize Anthropic SDK client
-	anthropicClient := anthropic.NewClient(
+	clientOpts := []option.RequestOption{
 		option.WithAPIKey(cfg.APIKey),
-	)
+	}
+	if cfg.MaxRetries >= 0 {
+		clientOpts = append(clientOpts, option.WithMaxRetries(cfg.MaxRetries))
+	}
+	if cfg.Endpoint != "" {
+		// The SDK appends "v1/messages" itself
+		base := strings.TrimSuffix(strings.TrimRight(cfg.Endpoint, "/"), "/v1")
+		clientOpts = append(clientOpts, option.WithBaseURL(base+"/"))
+	}
+	anthropicClient := anthropic.NewClient(clientOpts...)
 
 	return &ClaudeProvider{
 		config:     cfg,
@@ -65,10 +73,90 @@ func (p *ClaudeProvider) Name() string {
 	return "claude"
 }
 
+// DefaultModel returns the configured model.
+func (p *ClaudeProvider) DefaultModel() string {
+	return p.config.Model
+}
+
 // Generate creates a complete response from Claude.
 // Blocks until the full response is received.
 func (p *ClaudeProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
-	// Apply defaults from config if not specified in request
+	messageReq := p.params(req)
+
+	// Send request to Claude API, running requested tools until the model
+	// answers without calling any
+	usage := &Usage{}
+	var calls []ToolCall
+	var model string
+	// Once tools have run the loop must not be repeated by a retry
+	fail := func(err error) error {
+		if len(calls) == 0 {
+			return err
+		}
+		return &ToolRoundError{Partial: &Response{Model: model, Usage: usage, ToolCalls: calls}, Err: err}
+	}
+	for round := 0; ; round++ {
+		resp, err := p.client.Messages.New(ctx, messageReq)
+		if err != nil {
+			return nil, fail(fmt.Errorf("failed to generate: %w", wrapClaudeError(err)))
+		}
+		model = string(resp.Model)
+		u := claudeUsage(resp.Usage)
+		usage.InputTokens += u.InputTokens
+		usage.OutputTokens += u.OutputTokens
+		usage.TotalTokens += u.TotalTokens
+
+		// Extract text content from response blocks
+		// Claude can return multiple content blocks (text, images, etc.)
+		var content string
+		var results []anthropic.ContentBlockParamUnion
+		for _, block := range resp.Content {
+			switch block.Type {
+			case "text":
+				content += block.Text
+			case "tool_use":
+				call := ToolCall{ID: block.ID, Name: block.Name, Input: block.Input}
+				RunTool(ctx, req.Tools, &call)
+				calls = append(calls, call)
+				results = append(results, anthropic.NewToolResultBlock(call.ID, call.Output, call.IsError))
+			}
+		}
+
+		if resp.StopReason != anthropic.StopReasonToolUse || len(results) == 0 {
+			return &Response{
+				Content:      content,
+				Model:        string(resp.Model),
+				Usage:        usage,
+				FinishReason: string(resp.StopReason),
+				ToolCalls:    calls,
+			}, nil
+		}
+		if round+1 >= req.maxToolRounds() {
+			return nil, fail(ErrTooManyToolRounds)
+		}
+		messageReq.Messages = append(messageReq.Messages, resp.ToParam(), anthropic.NewUserMessage(results...))
+	}
+}
+
+// claudeTools converts tools to Anthropic tool params.
+func claudeTools(tools []Tool) []anthropic.ToolUnionParam {
+	params := make([]anthropic.ToolUnionParam, 0, len(tools))
+	for _, t := range tools {
+		param := anthropic.ToolUnionParamOfTool(anthropic.ToolInputSchemaParam{
+			Properties: t.Properties,
+			Required:   t.Required,
+		}, t.Name)
+		if t.Description != "" {
+			param.OfTool.Description = anthropic.String(t.Description)
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// params builds message parameters, applying defaults from config where
+// the request leaves them unset.
+func (p *ClaudeProvider) params(req *Request) anthropic.MessageNewParams {
 	model := req.Model
 	if model == "" {
 		model = p.config.Model
@@ -89,11 +177,7 @@ func (p *ClaudeProvider) Generate(ctx context.Context, req *Request) (*Response,
 		Model:       anthropic.Model(model),
 		MaxTokens:   int64(maxTokens),
 		Temperature: anthropic.Float(temp),
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(
-				anthropic.NewTextBlock(req.Prompt),
-			),
-		},
+		Messages:    claudeMessages(req.Conversation()),
 	}
 
 	// Add system prompt if provided
@@ -106,36 +190,16 @@ func (p *ClaudeProvider) Generate(ctx context.Context, req *Request) (*Response,
 		}
 	}
 
-	// Send request to Claude API
-	resp, err := p.client.Messages.New(ctx, messageReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate: %w", err)
+	if len(req.Tools) > 0 {
+		messageReq.Tools = claudeTools(req.Tools)
 	}
-
-	// Extract text content from response blocks
-	// Claude can return multiple content blocks (text, images, etc.)
-	var content string
-	for _, block := range resp.Content {
-		if block.Type == "text" {
-			content += block.Text
-		}
-	}
-
-	return &Response{
-		Content: content,
-		Model:   string(resp.Model),
-		Usage: &Usage{
-			InputTokens:  int(resp.Usage.InputTokens),
-			OutputTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:  int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
-		},
-		FinishReason: string(resp.StopReason),
-	}, nil
+	return messageReq
 }
 
 // GenerateStream creates a streaming response from Claude.
 // Returns an io.ReadCloser that yields response chunks as they arrive.
 // The caller MUST close the reader to release resources.
+// Use StreamEvents to also receive tool calls, usage and the stop reason.
 //
 // The stream format is Server-Sent Events (SSE):
 //   data: Hello
@@ -147,164 +211,100 @@ func (p *ClaudeProvider) Generate(ctx context.Context, req *Request) (*Response,
 //   defer reader.Close()
 //   io.Copy(os.Stdout, reader)
 func (p *ClaudeProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
-	// Apply defaults
-	model := req.Model
-	if model == "" {
-		model = p.config.Model
-	}
-
-	maxTokens := req.MaxTokens
-	if maxTokens == 0 {
-		maxTokens = p.config.MaxTokens
-	}
-
-	// Build streaming message request
-	messageReq := anthropic.MessageNewParams{
-		Model:     anthropic.Model(model),
-		MaxTokens: int64(maxTokens),
-		Temperature: anthropic.Float(req.Temperature),
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(
-				anthropic.NewTextBlock(req.Prompt),
-			),
-		},
-	}
-
-	if req.System != "" {
-		messageReq.System = []anthropic.TextBlockParam{
-			{
-				Type: "text",
-				Text: req.System,
-			},
-		}
-	}
-
-	// Create streaming response from Anthropic SDK
-	stream := p.client.Messages.NewStreaming(ctx, messageReq)
-
-	// Wrap in our streamReader for io.ReadCloser compatibility
-	return newStreamReader(stream), nil
-}
-
-// streamReader wraps the Anthropic SSE stream to implement io.ReadCloser.
-// Handles the complex event types from Anthropic's streaming API.
-type streamReader struct {
-	stream *ssestream.Stream[anthropic.MessageStreamEventUnion]
-	mu     sync.Mutex
-	buffer []byte   // Buffered data not yet returned
-	closed bool     // Whether Close() was called
-}
-
-// newStreamReader creates a new stream reader wrapping the Anthropic stream.
-func newStreamReader(stream *ssestream.Stream[anthropic.MessageStreamEventUnion]) *streamReader {
-	return &streamReader{
-		stream: stream,
-		buffer: make([]byte, 0),
+	s, err := p.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
 	}
+	return NewSSEReader(s), nil
 }
 
-// Read implements io.Reader.
-// Reads the next chunk of the streaming response.
-// Returns io.EOF when the stream is complete.
-func (r *streamReader) Read(p []byte) (n int, err error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if r.closed {
-		return 0, io.EOF
-	}
-
-	// Return buffered data first
-	if len(r.buffer) > 0 {
-		copy(p, r.buffer)
-		r.buffer = r.buffer[len(p):]
-		if len(r.buffer) == 0 {
-			return len(p), nil
-		}
-		return len(p), nil
-	}
+// StreamEvents streams a response from Claude as typed events.
+// Tool calls are reported but not run; use Generate for the tool-use loop.
+// It returns once the first event arrives, so a request Claude rejects
+// fails here rather than from the stream's Err.
+func (p *ClaudeProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	messageReq := p.params(req)
+
+	return openPipeStream(ctx, func(ctx context.Context, emit emitFunc) error {
+		stream := p.client.Messages.NewStreaming(ctx, messageReq)
+		defer stream.Close()
+
+		var msg anthropic.Message
+		for stream.Next() {
+			event := stream.Current()
+			if err := msg.Accumulate(event); err != nil {
+				return fmt.Errorf("failed to read stream: %w", err)
+			}
 
-	// Try to read from stream
-	for {
-		if !r.stream.Next() {
-			r.closed = true
-			if err := r.stream.Err(); err != nil {
-				return 0, err
+			var e *Event
+			switch event.Type {
+			case "content_block_delta":
+				if text := event.AsContentBlockDelta().Delta.Text; text != "" {
+					e = &Event{Type: EventText, Text: text}
+				}
+			case "content_block_stop":
+				if block := msg.Content[len(msg.Content)-1]; block.Type == "tool_use" {
+					e = &Event{Type: EventToolCall, ToolCall: &ToolCall{ID: block.ID, Name: block.Name, Input: block.Input}}
+				}
+			case "message_delta":
+				e = &Event{Type: EventUsage, Usage: claudeUsage(msg.Usage)}
+			}
+			if e != nil {
+				if err := emit(*e); err != nil {
+					return err
+				}
 			}
-			return 0, io.EOF
 		}
-
-		event := r.stream.Current()
-
-		// Handle different event types
-		var text string
-		switch event.Type {
-		case "content_block_delta":
-			// Text delta - most common event type
-			deltaEvent := event.AsContentBlockDelta()
-			text = string(deltaEvent.Delta.Text)
-		case "message_delta":
-			// Final message delta - contains usage stats
-		case "message_stop":
-			// Stream complete
-			r.closed = true
-			return 0, io.EOF
+		if err := stream.Err(); err != nil {
+			return fmt.Errorf("failed to generate: %w", wrapClaudeError(err))
 		}
 
-		if text != "" {
-			// Format as SSE (Server-Sent Events)
-			data := "data: " + text + "\n\n"
-			r.buffer = []byte(data)
-
-			copy(p, r.buffer)
-			r.buffer = r.buffer[len(p):]
-			return len(p), nil
+		resp := &Response{
+			Model:        string(msg.Model),
+			Usage:        claudeUsage(msg.Usage),
+			FinishReason: string(msg.StopReason),
 		}
-	}
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				resp.Content += block.Text
+			case "tool_use":
+				resp.ToolCalls = append(resp.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Input: block.Input})
+			}
+		}
+		return emit(Event{Type: EventDone, Response: resp})
+	})
 }
 
-// Close implements io.Closer.
-// Must be called when done reading to release resources.
-func (r *streamReader) Close() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.closed = true
-	if r.stream != nil {
-		return r.stream.Close()
+// claudeUsage converts Anthropic usage statistics.
+func claudeUsage(u anthropic.Usage) *Usage {
+	return &Usage{
+		InputTokens:  int(u.InputTokens),
+		OutputTokens: int(u.OutputTokens),
+		TotalTokens:  int(u.InputTokens + u.OutputTokens),
 	}
-	return nil
-}
-
-// StreamEvent represents a parsed streaming event.
-// Used internally for SSE parsing.
-type StreamEvent struct {
-	Type         string          `json:"type"`
-	Delta        json.RawMessage `json:"delta,omitempty"`
-	Index        int             `json:"index,omitempty"`
-	Content      string          `json:"content,omitempty"`
-	Usage        *Usage          `json:"usage,omitempty"`
-	FinishReason string          `json:"finish_reason,omitempty"`
 }
 
-// parseStreamEvent parses a line from the SSE stream.
-// Returns nil if the line is not a data event.
-func parseStreamEvent(line string) (*StreamEvent, error) {
-	if !strings.HasPrefix(line, "data: ") {
-		return nil, nil
-	}
-
-	data := strings.TrimPrefix(line, "data: ")
-	if data == "[DONE]" {
-		return &StreamEvent{Type: "stop"}, nil
-	}
-
-	var event StreamEvent
-	if err := json.Unmarshal([]byte(data), &event); err != nil {
-		return nil, fmt.Errorf("failed to parse stream event: %w", err)
+// claudeMessages converts conversation turns to Anthropic message params.
+// Image attachments become image blocks; text attachments are inlined.
+func claudeMessages(msgs []Message) []anthropic.MessageParam {
+	params := make([]anthropic.MessageParam, 0, len(msgs))
+	for _, m := range msgs {
+		blocks := []anthropic.ContentBlockParamUnion{
+			anthropic.NewTextBlock(m.textWithAttachments()),
+		}
+		for _, a := range m.Attachments {
+			if a.IsImage() {
+				blocks = append(blocks, anthropic.NewImageBlockBase64(a.MediaType, base64.StdEncoding.EncodeToString(a.Data)))
+			}
+		}
+		if m.Role == RoleAssistant {
+			params = append(params, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			params = append(params, anthropic.NewUserMessage(blocks...))
+		}
 	}
-
-	return &event, nil
+	return params
 }
 
 // ValidateKey checks if the API key is valid by making a minimal request.
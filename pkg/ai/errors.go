@@ -0,0 +1,77 @@
+// Package ai provides AI provider implementations.
+// This file defines the error types shared by providers and middleware.
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// ErrCircuitOpen is returned when a circuit breaker rejects a call
+// because the wrapped provider has failed too many times in a row.
+var ErrCircuitOpen = errors.New("ai: circuit breaker open")
+
+// ErrNoProviders is returned by a fallback chain that has nothing to try.
+var ErrNoProviders = errors.New("ai: no providers configured")
+
+// StatusError is an HTTP-level failure reported by a provider API.
+// Middleware inspects StatusCode to decide whether a call can be retried.
+type StatusError struct {
+	Provider   string // Provider that produced the error
+	StatusCode int    // HTTP status code returned by the API
+	Err        error  // Underlying error (may be nil)
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s: HTTP %d %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err is worth retrying: rate limits (429),
+// server-side failures (5xx), network errors, connections cut short and
+// deadlines, such as the per-attempt one set by Timeout. Cancellation and
+// failures after tools ran (ToolRoundError) are never retryable; Retry
+// also stops once its own context is done.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var roundErr *ToolRoundError
+	if errors.As(err, &roundErr) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// wrapClaudeError converts Anthropic SDK errors into StatusError so that
+// middleware can classify them without depending on the SDK.
+func wrapClaudeError(err error) error {
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return &StatusError{Provider: "claude", StatusCode: apiErr.StatusCode, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+// Package ai provides AI provider implementations.
+// This file implements a scripted fake provider for unit tests.
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// FakeStep is one scripted reply of a FakeProvider.
+type FakeStep struct {
+	Content string   // Full response text
+	Chunks  []string // Stream chunks (default: Content as a single chunk)
+	Err     error    // Error to return instead of a response
+	Usage   *Usage   // Optional usage statistics
+
+	// ToolCalls are run against the request's tools, after which the
+	// fake continues with the next step, like a provider's tool-use loop
+	ToolCalls []ToolCall
+}
+
+// FakeProvider replays a fixed script of replies in order and records the
+// requests it receives. When the script runs out the last step repeats.
+// Thread-safe.
+//
+// Example:
+//
+//	fake := NewFakeProvider(FakeStep{Content: "hello"})
+//	resp, _ := fake.Generate(ctx, &Request{Prompt: "hi"})
+//	fake.Requests()[0].Prompt // "hi"
+type FakeProvider struct {
+	mu       sync.Mutex
+	name     string
+	steps    []FakeStep
+	next     int
+	requests []Request
+}
+
+// NewFakeProvider creates a fake provider with the given script.
+func NewFakeProvider(steps ...FakeStep) *FakeProvider {
+	return &FakeProvider{name: "fake", steps: steps}
+}
+
+// WithName sets the name reported by the fake, e.g. to test fallback chains.
+func (f *FakeProvider) WithName(name string) *FakeProvider {
+	f.name = name
+	return f
+}
+
+// Name returns the provider identifier.
+func (f *FakeProvider) Name() string {
+	return f.name
+}
+
+// Requests returns copies of all requests received so far.
+func (f *FakeProvider) Requests() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Request(nil), f.requests...)
+}
+
+// step records req and returns the next scripted step.
+func (f *FakeProvider) step(req *Request) (FakeStep, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req != nil {
+		f.requests = append(f.requests, *req)
+	}
+	if len(f.steps) == 0 {
+		return FakeStep{}, errors.New("fake: no scripted responses")
+	}
+	s := f.steps[f.next]
+	if f.next < len(f.steps)-1 {
+		f.next++
+	}
+	return s, nil
+}
+
+// Generate returns the next scripted response, running scripted tool
+// calls first. Like a provider's loop, it fails with a ToolRoundError
+// once tools have run, carrying the usage of the tool steps.
+func (f *FakeProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	var calls []ToolCall
+	var usage *Usage
+	fail := func(err error) error {
+		if len(calls) == 0 {
+			return err
+		}
+		return &ToolRoundError{Partial: &Response{Model: req.Model, Usage: usage, ToolCalls: calls}, Err: err}
+	}
+	for round := 0; ; round++ {
+		if err := ctx.Err(); err != nil {
+			return nil, fail(err)
+		}
+		s, err := f.step(req)
+		if err != nil {
+			return nil, fail(err)
+		}
+		if s.Err != nil {
+			return nil, fail(s.Err)
+		}
+		if len(s.ToolCalls) > 0 && len(req.Tools) > 0 {
+			if s.Usage != nil {
+				if usage == nil {
+					usage = &Usage{}
+				}
+				usage.InputTokens += s.Usage.InputTokens
+				usage.OutputTokens += s.Usage.OutputTokens
+				usage.TotalTokens += s.Usage.TotalTokens
+			}
+			if round+1 >= req.maxToolRounds() {
+				return nil, fail(ErrTooManyToolRounds)
+			}
+			for _, c := range s.ToolCalls {
+				RunTool(ctx, req.Tools, &c)
+				calls = append(calls, c)
+			}
+			continue
+		}
+		content := s.Content
+		if content == "" && len(s.Chunks) > 0 {
+			content = strings.Join(s.Chunks, "")
+		}
+		return &Response{
+			Content:      content,
+			Model:        req.Model,
+			Usage:        s.Usage,
+			FinishReason: "stop",
+			ToolCalls:    calls,
+		}, nil
+	}
+}
+
+// GenerateStream returns the next scripted reply as SSE-formatted chunks.
+func (f *FakeProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s, err := f.step(req)
+	if err != nil {
+		return nil, err
+	}
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	chunks := s.Chunks
+	if len(chunks) == 0 {
+		chunks = []string{s.Content}
+	}
+	var sb strings.Builder
+	for _, c := range chunks {
+		sb.WriteString("data: " + c + "\n\n")
+	}
+	return io.NopCloser(strings.NewReader(sb.String())), nil
+}
+
+// StreamEvents returns the next scripted reply as typed events: one text
+// event per chunk, the scripted tool calls, usage and the final message.
+func (f *FakeProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s, err := f.step(req)
+	if err != nil {
+		return nil, err
+	}
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	chunks := s.Chunks
+	if len(chunks) == 0 && s.Content != "" {
+		chunks = []string{s.Content}
+	}
+
+	return newPipeStream(ctx, func(ctx context.Context, emit emitFunc) error {
+		resp := &Response{Model: req.Model, Usage: s.Usage, FinishReason: "stop"}
+		var events []Event
+		for _, c := range chunks {
+			resp.Content += c
+			events = append(events, Event{Type: EventText, Text: c})
+		}
+		for i := range s.ToolCalls {
+			call := s.ToolCalls[i]
+			resp.ToolCalls = append(resp.ToolCalls, call)
+			events = append(events, Event{Type: EventToolCall, ToolCall: &call})
+		}
+		if len(s.ToolCalls) > 0 {
+			resp.FinishReason = "tool_use"
+		}
+		if s.Usage != nil {
+			events = append(events, Event{Type: EventUsage, Usage: s.Usage})
+		}
+		events = append(events, Event{Type: EventDone, Response: resp})
+
+		for _, e := range events {
+			if err := emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), nil
+}
+
+// ValidateKey always succeeds.
+func (f *FakeProvider) ValidateKey(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package ai provides AI provider implementations.
+// This file implements an ordered fallback chain across providers.
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FallbackProvider tries a list of providers in order and returns the
+// first successful result. Caller cancellation stops the chain; any other
+// failure moves on to the next provider.
+type FallbackProvider struct {
+	providers []Provider
+}
+
+// NewFallbackProvider creates a fallback chain. Providers are tried in the
+// order given, e.g. NewFallbackProvider(claude, local).
+func NewFallbackProvider(providers ...Provider) *FallbackProvider {
+	return &FallbackProvider{providers: providers}
+}
+
+// Name returns the chain identifier, e.g. "fallback(claude,local)".
+func (f *FallbackProvider) Name() string {
+	names := make([]string, len(f.providers))
+	for i, p := range f.providers {
+		names[i] = p.Name()
+	}
+	return "fallback(" + strings.Join(names, ",") + ")"
+}
+
+// DefaultModel returns the first provider's default model.
+func (f *FallbackProvider) DefaultModel() string {
+	if len(f.providers) == 0 {
+		return ""
+	}
+	return DefaultModel(f.providers[0])
+}
+
+// Providers returns the providers in the chain, in order.
+func (f *FallbackProvider) Providers() []Provider {
+	return f.providers
+}
+
+// try calls fn for each provider until one succeeds, or one fails after
+// running tools (see ToolRoundError). All failures are joined into the
+// returned error.
+func (f *FallbackProvider) try(ctx context.Context, fn func(Provider) error) error {
+	if len(f.providers) == 0 {
+		return ErrNoProviders
+	}
+
+	var errs []error
+	for _, p := range f.providers {
+		err := fn(p)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		var roundErr *ToolRoundError
+		if ctx.Err() != nil || errors.As(err, &roundErr) {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Generate returns the first successful response in the chain.
+func (f *FallbackProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	var resp *Response
+	err := f.try(ctx, func(p Provider) error {
+		var err error
+		resp, err = p.Generate(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GenerateStream returns the first stream that could be opened.
+// Failures after the stream has started are not retried elsewhere.
+func (f *FallbackProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := f.try(ctx, func(p Provider) error {
+		var err error
+		rc, err = p.GenerateStream(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// StreamEvents returns the first event stream that could be opened.
+// Failures after the stream has started are not retried elsewhere.
+func (f *FallbackProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	var s EventStream
+	err := f.try(ctx, func(p Provider) error {
+		var err error
+		s, err = OpenStream(ctx, p, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ValidateKey succeeds if at least one provider in the chain is usable.
+func (f *FallbackProvider) ValidateKey(ctx context.Context) error {
+	return f.try(ctx, func(p Provider) error {
+		return p.ValidateKey(ctx)
+	})
+}
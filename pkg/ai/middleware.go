@@ -0,0 +1,367 @@
+// Package ai provides AI provider implementations.
+// This file implements resilience middleware: decorators that wrap a
+// Provider with timeouts, retries and circuit breaking.
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Middleware decorates a Provider with additional behavior.
+type Middleware func(Provider) Provider
+
+// Chain applies middleware to a provider. The first middleware is the
+// outermost layer, so Chain(p, Retry(..), Timeout(..)) retries calls that
+// time out individually.
+func Chain(p Provider, mws ...Middleware) Provider {
+	for i := len(mws) - 1; i >= 0; i-- {
+		p = mws[i](p)
+	}
+	return p
+}
+
+// ==================== Timeout ====================
+
+// Timeout bounds every call to the wrapped provider by d.
+// For streams the deadline only covers opening the stream (up to the
+// first event for providers that wait for one); reading it is bounded by
+// the caller's context, so long answers are not cut off.
+func Timeout(d time.Duration) Middleware {
+	return func(next Provider) Provider {
+		if d <= 0 {
+			return next
+		}
+		return &timeoutProvider{next: next, timeout: d}
+	}
+}
+
+type timeoutProvider struct {
+	next    Provider
+	timeout time.Duration
+}
+
+func (p *timeoutProvider) Name() string { return p.next.Name() }
+
+func (p *timeoutProvider) DefaultModel() string { return DefaultModel(p.next) }
+
+func (p *timeoutProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.Generate(ctx, req)
+}
+
+func (p *timeoutProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	ctx, started, cancel := p.openContext(ctx)
+	rc, err := p.next.GenerateStream(ctx, req)
+	if err = started(err); err != nil {
+		if rc != nil {
+			rc.Close()
+		}
+		cancel()
+		return nil, err
+	}
+	return &cancelOnClose{ReadCloser: rc, cancel: cancel}, nil
+}
+
+func (p *timeoutProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	ctx, started, cancel := p.openContext(ctx)
+	s, err := OpenStream(ctx, p.next, req)
+	if err = started(err); err != nil {
+		if s != nil {
+			s.Close()
+		}
+		cancel()
+		return nil, err
+	}
+	return &cancelStreamOnClose{EventStream: s, cancel: cancel}, nil
+}
+
+// openContext returns the context to open a stream in: it is cancelled
+// if the stream hasn't started within the timeout. Once the stream is
+// open, started lifts that deadline and returns the opening error, or
+// one wrapping context.DeadlineExceeded if the deadline passed first, so
+// Retry sees a timed out attempt. cancel releases the context.
+func (p *timeoutProvider) openContext(parent context.Context) (ctx context.Context, started func(error) error, cancel context.CancelFunc) {
+	ctx, cancel = context.WithCancel(parent)
+	timer := time.AfterFunc(p.timeout, cancel)
+	started = func(err error) error {
+		if !timer.Stop() && parent.Err() == nil {
+			return fmt.Errorf("stream did not start within %s: %w", p.timeout, context.DeadlineExceeded)
+		}
+		return err
+	}
+	return ctx, started, cancel
+}
+
+func (p *timeoutProvider) ValidateKey(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return p.next.ValidateKey(ctx)
+}
+
+// cancelOnClose releases a context when the stream is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// cancelStreamOnClose releases a context when the event stream is closed.
+type cancelStreamOnClose struct {
+	EventStream
+	cancel context.CancelFunc
+}
+
+func (c *cancelStreamOnClose) Close() error {
+	defer c.cancel()
+	return c.EventStream.Close()
+}
+
+// ==================== Retry ====================
+
+// RetryPolicy configures exponential backoff with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first (default 3)
+	BaseDelay   time.Duration // Delay before the first retry (default 500ms)
+	MaxDelay    time.Duration // Upper bound for a single delay (default 10s)
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based).
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	d := rp.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	// Full jitter: uniform in [0, d]
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Retry retries calls that fail with a retryable error (see IsRetryable).
+// Non-retryable errors are returned immediately, as is any error once ctx
+// is done, so only the attempt's own deadline is retried.
+func Retry(policy RetryPolicy) Middleware {
+	def := DefaultRetryPolicy()
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = def.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = def.BaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = def.MaxDelay
+	}
+	return func(next Provider) Provider {
+		return &retryProvider{next: next, policy: policy}
+	}
+}
+
+type retryProvider struct {
+	next   Provider
+	policy RetryPolicy
+}
+
+func (p *retryProvider) Name() string { return p.next.Name() }
+
+func (p *retryProvider) DefaultModel() string { return DefaultModel(p.next) }
+
+// do runs fn until it succeeds, fails permanently or attempts run out.
+func (p *retryProvider) do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= p.policy.MaxAttempts; attempt++ {
+		if err = fn(); err == nil || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt == p.policy.MaxAttempts {
+			break
+		}
+		timer := time.NewTimer(p.policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+func (p *retryProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	var resp *Response
+	err := p.do(ctx, func() error {
+		var err error
+		resp, err = p.next.Generate(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (p *retryProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := p.do(ctx, func() error {
+		var err error
+		rc, err = p.next.GenerateStream(ctx, req)
+		return err
+	})
+	return rc, err
+}
+
+func (p *retryProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	var s EventStream
+	err := p.do(ctx, func() error {
+		var err error
+		s, err = OpenStream(ctx, p.next, req)
+		return err
+	})
+	return s, err
+}
+
+func (p *retryProvider) ValidateKey(ctx context.Context) error {
+	return p.do(ctx, func() error {
+		return p.next.ValidateKey(ctx)
+	})
+}
+
+// ==================== Circuit Breaker ====================
+
+// BreakerConfig configures a circuit breaker.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the circuit (default 5)
+	Cooldown         time.Duration // Time the circuit stays open before a trial call (default 30s)
+}
+
+// breakerState is the state of a circuit breaker.
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // Calls pass through
+	breakerOpen                         // Calls are rejected with ErrCircuitOpen
+	breakerHalfOpen                     // One trial call is allowed
+)
+
+// CircuitBreaker stops calling a provider after repeated failures, giving
+// it time to recover and letting a fallback chain move on immediately.
+func CircuitBreaker(cfg BreakerConfig) Middleware {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	return func(next Provider) Provider {
+		return &breakerProvider{next: next, cfg: cfg, now: time.Now}
+	}
+}
+
+type breakerProvider struct {
+	next Provider
+	cfg  BreakerConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func (p *breakerProvider) Name() string { return p.next.Name() }
+
+func (p *breakerProvider) DefaultModel() string { return DefaultModel(p.next) }
+
+// allow reports whether a call may proceed, moving open -> half-open
+// once the cooldown has elapsed.
+func (p *breakerProvider) allow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.state {
+	case breakerOpen:
+		if p.now().Sub(p.openedAt) < p.cfg.Cooldown {
+			return false
+		}
+		p.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// A trial call is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call.
+// Only provider-side failures count; caller cancellation does not.
+func (p *breakerProvider) record(ctx context.Context, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil || ctx.Err() != nil {
+		if err == nil {
+			p.state = breakerClosed
+			p.failures = 0
+		} else if p.state == breakerHalfOpen {
+			p.state = breakerOpen
+			p.openedAt = p.now()
+		}
+		return
+	}
+
+	p.failures++
+	if p.state == breakerHalfOpen || p.failures >= p.cfg.FailureThreshold {
+		p.state = breakerOpen
+		p.openedAt = p.now()
+	}
+}
+
+func (p *breakerProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	if !p.allow() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := p.next.Generate(ctx, req)
+	p.record(ctx, err)
+	return resp, err
+}
+
+func (p *breakerProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	if !p.allow() {
+		return nil, ErrCircuitOpen
+	}
+	rc, err := p.next.GenerateStream(ctx, req)
+	p.record(ctx, err)
+	return rc, err
+}
+
+func (p *breakerProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	if !p.allow() {
+		return nil, ErrCircuitOpen
+	}
+	s, err := OpenStream(ctx, p.next, req)
+	p.record(ctx, err)
+	return s, err
+}
+
+func (p *breakerProvider) ValidateKey(ctx context.Context) error {
+	if !p.allow() {
+		return ErrCircuitOpen
+	}
+	err := p.next.ValidateKey(ctx)
+	p.record(ctx, err)
+	return err
+}
@@ -0,0 +1,420 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubProvider returns queued errors, then succeeds.
+type stubProvider struct {
+	name  string
+	errs  []error
+	calls int
+	delay time.Duration
+	slow  int // Calls that take delay (0 = all)
+}
+
+func (s *stubProvider) Name() string { return s.name }
+
+func (s *stubProvider) next(ctx context.Context) error {
+	s.calls++
+	if s.delay > 0 && (s.slow == 0 || s.calls <= s.slow) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.delay):
+		}
+	}
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (s *stubProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	if err := s.next(ctx); err != nil {
+		return nil, err
+	}
+	return &Response{Content: s.name + ": " + req.Prompt}, nil
+}
+
+func (s *stubProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	if err := s.next(ctx); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader("data: " + s.name + "\n\n")), nil
+}
+
+func (s *stubProvider) ValidateKey(ctx context.Context) error {
+	return s.next(ctx)
+}
+
+func status(code int) error {
+	return &StatusError{Provider: "stub", StatusCode: code}
+}
+
+func fastRetry(attempts int) Middleware {
+	return Retry(RetryPolicy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond})
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{status(429), true},
+		{status(500), true},
+		{status(503), true},
+		{status(400), false},
+		{status(401), false},
+		{fmt.Errorf("wrapped: %w", status(502)), true},
+		{context.Canceled, false},
+		{&url.Error{Op: "Post", URL: "https://api", Err: context.Canceled}, false},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{&url.Error{Op: "Post", URL: "https://api", Err: io.EOF}, true},
+		{errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetry_RecoversFromTransientErrors(t *testing.T) {
+	stub := &stubProvider{name: "stub", errs: []error{status(429), status(503)}}
+	p := Chain(stub, fastRetry(3))
+
+	resp, err := p.Generate(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if resp.Content != "stub: hi" {
+		t.Errorf("unexpected content: %s", resp.Content)
+	}
+	if stub.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", stub.calls)
+	}
+}
+
+func TestRetry_StopsOnPermanentError(t *testing.T) {
+	stub := &stubProvider{name: "stub", errs: []error{status(401)}}
+	p := Chain(stub, fastRetry(3))
+
+	if _, err := p.Generate(context.Background(), &Request{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if stub.calls != 1 {
+		t.Errorf("expected 1 call, got %d", stub.calls)
+	}
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	stub := &stubProvider{name: "stub", errs: []error{status(500), status(500), status(500), status(500)}}
+	p := Chain(stub, fastRetry(2))
+
+	_, err := p.Generate(context.Background(), &Request{})
+	if !IsRetryable(err) {
+		t.Fatalf("expected last status error, got %v", err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("expected 2 calls, got %d", stub.calls)
+	}
+}
+
+func TestRetry_RetriesAttemptTimeouts(t *testing.T) {
+	// The first call outlives its per-attempt deadline, the second doesn't
+	stub := &stubProvider{name: "stub", delay: time.Second, slow: 1}
+	p := Chain(stub, fastRetry(3), Timeout(20*time.Millisecond))
+
+	resp, err := p.Generate(context.Background(), &Request{Prompt: "hi"})
+	if err != nil || resp.Content != "stub: hi" {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("expected 2 calls, got %d", stub.calls)
+	}
+}
+
+func TestRetry_StopsWhenContextDone(t *testing.T) {
+	stub := &stubProvider{name: "stub", delay: time.Second}
+	p := Chain(stub, fastRetry(3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Generate(ctx, &Request{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+	if stub.calls != 1 {
+		t.Errorf("expected 1 call, got %d", stub.calls)
+	}
+}
+
+func TestRetryPolicy_BackoffBounded(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt <= 10; attempt++ {
+		if d := rp.backoff(attempt); d < 0 || d > time.Second {
+			t.Errorf("backoff(%d) = %v out of range", attempt, d)
+		}
+	}
+}
+
+func TestTimeout_CancelsSlowCalls(t *testing.T) {
+	stub := &stubProvider{name: "slow", delay: time.Second}
+	p := Chain(stub, Timeout(10*time.Millisecond))
+
+	_, err := p.Generate(context.Background(), &Request{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// pacedStreamer streams "a" after first and "b" gap later.
+type pacedStreamer struct {
+	*stubProvider
+	first, gap time.Duration
+}
+
+func (p *pacedStreamer) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	return openPipeStream(ctx, func(ctx context.Context, emit emitFunc) error {
+		for _, step := range []struct {
+			wait time.Duration
+			text string
+		}{{p.first, "a"}, {p.gap, "b"}} {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.wait):
+			}
+			if err := emit(Event{Type: EventText, Text: step.text}); err != nil {
+				return err
+			}
+		}
+		return emit(Event{Type: EventDone, Response: &Response{Content: "ab"}})
+	})
+}
+
+func TestTimeout_OnlyBoundsStreamStart(t *testing.T) {
+	// A stream that starts in time may run past the timeout
+	p := Chain(&pacedStreamer{stubProvider: &stubProvider{name: "paced"}, gap: 50 * time.Millisecond}, Timeout(10*time.Millisecond))
+	s, err := OpenStream(context.Background(), p, &Request{})
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	if resp, err := Collect(s); err != nil || resp.Content != "ab" {
+		t.Fatalf("expected the whole stream, got %+v, %v", resp, err)
+	}
+
+	// One that doesn't start in time is a retryable timeout
+	p = Chain(&pacedStreamer{stubProvider: &stubProvider{name: "late"}, first: time.Second}, Timeout(10*time.Millisecond))
+	_, err = OpenStream(context.Background(), p, &Request{})
+	if !errors.Is(err, context.DeadlineExceeded) || !IsRetryable(err) {
+		t.Errorf("expected a retryable deadline exceeded, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	stub := &stubProvider{name: "stub", errs: []error{status(500), status(500)}}
+	p := CircuitBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})(stub).(*breakerProvider)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	p.Generate(ctx, &Request{})
+	p.Generate(ctx, &Request{})
+
+	if _, err := p.Generate(ctx, &Request{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("open circuit should not call provider, got %d calls", stub.calls)
+	}
+
+	// After the cooldown a trial call is allowed and closes the circuit
+	now = now.Add(2 * time.Minute)
+	if _, err := p.Generate(ctx, &Request{}); err != nil {
+		t.Fatalf("expected trial call to succeed, got %v", err)
+	}
+	if p.state != breakerClosed {
+		t.Errorf("expected closed circuit, got %d", p.state)
+	}
+}
+
+func TestCircuitBreaker_FailedTrialReopens(t *testing.T) {
+	stub := &stubProvider{name: "stub", errs: []error{status(500), status(500)}}
+	p := CircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute})(stub).(*breakerProvider)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	p.Generate(ctx, &Request{})
+	now = now.Add(2 * time.Minute)
+	p.Generate(ctx, &Request{})
+
+	if _, err := p.Generate(ctx, &Request{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected circuit to reopen after failed trial, got %v", err)
+	}
+}
+
+func TestFallback_UsesNextProvider(t *testing.T) {
+	primary := &stubProvider{name: "claude", errs: []error{status(503)}}
+	secondary := &stubProvider{name: "local"}
+	f := NewFallbackProvider(primary, secondary)
+
+	resp, err := f.Generate(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if resp.Content != "local: hi" {
+		t.Errorf("expected fallback response, got %s", resp.Content)
+	}
+	if f.Name() != "fallback(claude,local)" {
+		t.Errorf("unexpected name: %s", f.Name())
+	}
+}
+
+func TestFallback_AllFail(t *testing.T) {
+	f := NewFallbackProvider(
+		&stubProvider{name: "a", errs: []error{status(500)}},
+		&stubProvider{name: "b", errs: []error{ErrCircuitOpen}},
+	)
+
+	_, err := f.Generate(context.Background(), &Request{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !errors.Is(err, ErrCircuitOpen) || !strings.Contains(err.Error(), "a: ") {
+		t.Errorf("expected joined errors, got %v", err)
+	}
+
+	if _, err := NewFallbackProvider().Generate(context.Background(), &Request{}); !errors.Is(err, ErrNoProviders) {
+		t.Errorf("expected ErrNoProviders, got %v", err)
+	}
+}
+
+func TestOpenAIProvider_Generate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer key" {
+			t.Errorf("unexpected auth header: %s", got)
+		}
+		fmt.Fprint(w, `{"model":"m","choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider(WithAPIKey("key"), WithEndpoint(server.URL+"/v1"))
+	resp, err := p.Generate(context.Background(), &Request{Prompt: "hi", System: "sys"})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if resp.Content != "hello" || resp.Usage.TotalTokens != 4 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestOpenAIProvider_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	p := NewLocalProvider(WithEndpoint(server.URL))
+	_, err := p.Generate(context.Background(), &Request{Prompt: "hi"})
+	if !IsRetryable(err) {
+		t.Errorf("expected retryable status error, got %v", err)
+	}
+}
+
+func TestOpenAIProvider_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewLocalProvider(WithEndpoint(server.URL))
+	rc, err := p.GenerateStream(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(data) != "data: Hel\n\ndata: lo\n\n" {
+		t.Errorf("unexpected stream: %q", data)
+	}
+}
+
+func TestOpenAIProvider_Messages(t *testing.T) {
+	var body struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+	}))
+	defer server.Close()
+
+	p := NewLocalProvider(WithEndpoint(server.URL))
+	_, err := p.Generate(context.Background(), &Request{
+		System: "sys",
+		Messages: []Message{
+			{Role: RoleUser, Content: "hi", Attachments: []Attachment{{Name: "a.txt", MediaType: "text/plain", Data: []byte("notes")}}},
+			{Role: RoleAssistant, Content: "hello"},
+			{Role: RoleUser, Content: "look", Attachments: []Attachment{{Name: "x.png", MediaType: "image/png", Data: []byte{1, 2}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	roles := make([]string, len(body.Messages))
+	for i, m := range body.Messages {
+		roles[i] = m.Role
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Errorf("unexpected roles: %v", roles)
+	}
+	if !strings.Contains(string(body.Messages[1].Content), "notes") {
+		t.Errorf("expected inlined text attachment, got %s", body.Messages[1].Content)
+	}
+	if !strings.Contains(string(body.Messages[3].Content), "data:image/png;base64,") {
+		t.Errorf("expected image part, got %s", body.Messages[3].Content)
+	}
+}
+
+func TestRequest_Conversation(t *testing.T) {
+	req := &Request{Prompt: "now", Messages: []Message{{Role: RoleUser, Content: "before"}}}
+	msgs := req.Conversation()
+	if len(msgs) != 2 || msgs[1].Content != "now" || msgs[1].Role != RoleUser {
+		t.Errorf("unexpected conversation: %+v", msgs)
+	}
+	if msgs := (&Request{Prompt: "only"}).Conversation(); len(msgs) != 1 {
+		t.Errorf("expected single message, got %d", len(msgs))
+	}
+}
@@ -0,0 +1,323 @@
+// Package ai provides AI provider implementations.
+// This file implements a provider for OpenAI-compatible chat APIs.
+// The same wire format is served by OpenAI and by local runtimes such as
+// Ollama and LM Studio, so one implementation covers both.
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider implements the Provider interface for OpenAI-compatible
+// chat completion endpoints.
+// Thread-safe: can handle concurrent requests.
+type OpenAIProvider struct {
+	name       string       // Provider identifier ("openai" or "local")
+	config     *Config      // Provider configuration
+	httpClient *http.Client // HTTP client for API requests
+}
+
+// NewOpenAIProvider creates a provider for the OpenAI API.
+// Default configuration:
+//   - Endpoint: https://api.openai.com/v1
+//   - Model: gpt-4
+//   - MaxTokens: 1024
+//   - Temperature: 0.7
+func NewOpenAIProvider(opts ...Option) *OpenAIProvider {
+	cfg := &Config{
+		Endpoint:    "https://api.openai.com/v1",
+		Model:       "gpt-4",
+		MaxTokens:   1024,
+		Temperature: 0.7,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &OpenAIProvider{name: "openai", config: cfg, httpClient: &http.Client{}}
+}
+
+// NewLocalProvider creates a provider for a local OpenAI-compatible server.
+// Default configuration:
+//   - Endpoint: http://localhost:11434/v1 (Ollama)
+//   - Model: llama2
+//
+// Example:
+//
+//	provider := NewLocalProvider(WithModel("llama3"))
+func NewLocalProvider(opts ...Option) *OpenAIProvider {
+	cfg := &Config{
+		Endpoint:    "http://localhost:11434/v1",
+		Model:       "llama2",
+		MaxTokens:   1024,
+		Temperature: 0.7,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &OpenAIProvider{name: "local", config: cfg, httpClient: &http.Client{}}
+}
+
+// Name returns the provider identifier.
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+// DefaultModel returns the configured model.
+func (p *OpenAIProvider) DefaultModel() string {
+	return p.config.Model
+}
+
+// chatMessage is a single message in the chat completion format.
+// Content is a string, or a list of content parts when images are attached.
+type chatMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// chatPart is one element of a multi-part message.
+type chatPart struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	ImageURL map[string]string `json:"image_url,omitempty"`
+}
+
+// openAIMessage converts a conversation turn to the chat format.
+func openAIMessage(m Message) chatMessage {
+	text := m.textWithAttachments()
+	var parts []chatPart
+	for _, a := range m.Attachments {
+		if a.IsImage() {
+			url := "data:" + a.MediaType + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+			parts = append(parts, chatPart{Type: "image_url", ImageURL: map[string]string{"url": url}})
+		}
+	}
+	if len(parts) == 0 {
+		return chatMessage{Role: string(m.Role), Content: text}
+	}
+	parts = append([]chatPart{{Type: "text", Text: text}}, parts...)
+	return chatMessage{Role: string(m.Role), Content: parts}
+}
+
+// deltaMessage is a message as returned by the API (content is always text).
+type deltaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest is the request body for /chat/completions.
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+	Stream      bool          `json:"stream,omitempty"`
+	// StreamOptions asks for a final usage chunk on streamed responses
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+// streamOptions configures a streamed chat completion.
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatResponse is the response body for /chat/completions.
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      deltaMessage `json:"message"`
+		Delta        deltaMessage `json:"delta"`
+		FinishReason string       `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// buildRequest applies config defaults to req.
+func (p *OpenAIProvider) buildRequest(req *Request, stream bool) *chatRequest {
+	model := req.Model
+	if model == "" {
+		model = p.config.Model
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = p.config.MaxTokens
+	}
+	temp := req.Temperature
+	if temp == 0 {
+		temp = p.config.Temperature
+	}
+
+	var messages []chatMessage
+	if req.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Conversation() {
+		messages = append(messages, openAIMessage(m))
+	}
+
+	body := &chatRequest{
+		Model:       model,
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: temp,
+		Stream:      stream,
+	}
+	if stream {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	return body
+}
+
+// post sends a chat completion request and returns the raw HTTP response.
+// Non-2xx responses are converted to *StatusError.
+func (p *OpenAIProvider) post(ctx context.Context, body *chatRequest) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	url := strings.TrimRight(p.config.Endpoint, "/") + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr error
+		if s := strings.TrimSpace(string(msg)); s != "" {
+			apiErr = fmt.Errorf("%s", s)
+		}
+		return nil, &StatusError{Provider: p.name, StatusCode: resp.StatusCode, Err: apiErr}
+	}
+	return resp, nil
+}
+
+// Generate creates a complete response.
+// Blocks until the full response is received.
+func (p *OpenAIProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := p.post(ctx, p.buildRequest(req, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("failed to generate: empty response")
+	}
+
+	result := &Response{
+		Content:      out.Choices[0].Message.Content,
+		Model:        out.Model,
+		FinishReason: out.Choices[0].FinishReason,
+	}
+	if out.Usage != nil {
+		result.Usage = &Usage{
+			InputTokens:  out.Usage.PromptTokens,
+			OutputTokens: out.Usage.CompletionTokens,
+			TotalTokens:  out.Usage.TotalTokens,
+		}
+	}
+	return result, nil
+}
+
+// GenerateStream creates a streaming response.
+// Chunks are re-emitted in the same "data: <text>\n\n" format as the
+// Claude provider so consumers can treat providers interchangeably.
+func (p *OpenAIProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	s, err := p.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return NewSSEReader(s), nil
+}
+
+// StreamEvents streams a response as typed events. Usage is reported
+// when the server includes it in the stream.
+func (p *OpenAIProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	resp, err := p.post(ctx, p.buildRequest(req, true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate: %w", err)
+	}
+
+	return newPipeStream(ctx, func(ctx context.Context, emit emitFunc) error {
+		defer resp.Body.Close()
+		final := &Response{}
+		var content strings.Builder
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			data := strings.TrimPrefix(line, "data: ")
+			if data == "[DONE]" {
+				break
+			}
+			var chunk chatResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return fmt.Errorf("failed to parse stream event: %w", err)
+			}
+			if chunk.Model != "" {
+				final.Model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				final.Usage = &Usage{
+					InputTokens:  chunk.Usage.PromptTokens,
+					OutputTokens: chunk.Usage.CompletionTokens,
+					TotalTokens:  chunk.Usage.TotalTokens,
+				}
+				if err := emit(Event{Type: EventUsage, Usage: final.Usage}); err != nil {
+					return err
+				}
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			if reason := chunk.Choices[0].FinishReason; reason != "" {
+				final.FinishReason = reason
+			}
+			if text := chunk.Choices[0].Delta.Content; text != "" {
+				content.WriteString(text)
+				if err := emit(Event{Type: EventText, Text: text}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		final.Content = content.String()
+		return emit(Event{Type: EventDone, Response: final})
+	}), nil
+}
+
+// ValidateKey checks that the endpoint accepts requests by making a minimal one.
+func (p *OpenAIProvider) ValidateKey(ctx context.Context) error {
+	_, err := p.Generate(ctx, &Request{Prompt: "Hello", MaxTokens: 10})
+	return err
+}
@@ -0,0 +1,64 @@
+// Package ai provides AI provider implementations.
+// This file estimates the cost of provider calls from token usage.
+package ai
+
+import "strings"
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// pricing lists known models by name prefix. Longer prefixes win, so
+// versioned names like "claude-3-5-sonnet-20241022" resolve correctly.
+// Prices are list prices and only used for estimates.
+var pricing = map[string]Price{
+	"claude-opus-4":     {Input: 15, Output: 75},
+	"claude-sonnet-4":   {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"claude-3-sonnet":   {Input: 3, Output: 15},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4-turbo":       {Input: 10, Output: 30},
+	"gpt-4":             {Input: 30, Output: 60},
+	"gpt-3.5-turbo":     {Input: 0.5, Output: 1.5},
+}
+
+// LookupPrice returns the price for model and whether it is known.
+func LookupPrice(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	best := ""
+	for prefix := range pricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return pricing[best], true
+}
+
+// EstimateCost returns the estimated cost in USD of a call.
+// Unknown models (e.g., local ones) cost nothing.
+func EstimateCost(model string, inputTokens, outputTokens int) float64 {
+	price, ok := LookupPrice(model)
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6
+}
+
+// EstimateTokens roughly estimates the token count of text
+// (about four characters per token for English).
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + 3) / 4
+}
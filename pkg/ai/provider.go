@@ -1,11 +1,13 @@
 // Package ai provides interfaces and implementations for AI provider integration.
-// Currently supports Anthropic's Claude API. Designed to be extensible for
-// additional providers (OpenAI, Google, etc.).
+// Supports Anthropic's Claude API and OpenAI-compatible endpoints (OpenAI,
+// Ollama, LM Studio). Designed to be extensible for additional providers.
 package ai
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
 )
 
 // Provider defines the interface for AI model providers.
@@ -28,6 +30,21 @@ type Provider interface {
 	ValidateKey(ctx context.Context) error
 }
 
+// ModelResolver is implemented by providers (and middleware) that know
+// which model serves requests that don't name one.
+type ModelResolver interface {
+	DefaultModel() string
+}
+
+// DefaultModel returns the model p uses when Request.Model is empty,
+// or "" if p doesn't say.
+func DefaultModel(p Provider) string {
+	if r, ok := p.(ModelResolver); ok {
+		return r.DefaultModel()
+	}
+	return ""
+}
+
 // Request represents a request to generate AI content.
 // All fields are optional unless otherwise specified.
 type Request struct {
@@ -53,6 +70,73 @@ type Request struct {
 	// System is the system prompt / instructions.
 	// Default: ""
 	System string
+
+	// Messages is the conversation history, oldest first.
+	// When set, Prompt (if non-empty) is sent as a final user turn.
+	// Default: nil (single-turn request built from Prompt)
+	Messages []Message
+
+	// Tools the model may call while answering (Generate only).
+	// Default: nil (no tools)
+	Tools []Tool
+
+	// MaxToolRounds limits tool-use round trips.
+	// Default: DefaultMaxToolRounds
+	MaxToolRounds int
+}
+
+// Role identifies the author of a conversation message.
+type Role string
+
+const (
+	RoleUser      Role = "user"      // Message written by the user
+	RoleAssistant Role = "assistant" // Message generated by the model
+)
+
+// Message is a single turn in a multi-turn conversation.
+type Message struct {
+	Role        Role         `json:"role"`
+	Content     string       `json:"content"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file sent along with a message.
+// Text attachments are inlined; image attachments are sent as images
+// by providers that support them.
+type Attachment struct {
+	Name      string `json:"name"`       // File name shown to the model
+	MediaType string `json:"media_type"` // MIME type (e.g., "text/plain", "image/png")
+	Data      []byte `json:"data"`       // Raw file content
+}
+
+// IsImage reports whether the attachment is an image.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MediaType, "image/")
+}
+
+// Conversation returns the full list of turns to send: Messages followed
+// by Prompt as a user message when Prompt is set.
+func (r *Request) Conversation() []Message {
+	msgs := make([]Message, 0, len(r.Messages)+1)
+	msgs = append(msgs, r.Messages...)
+	if r.Prompt != "" || len(msgs) == 0 {
+		msgs = append(msgs, Message{Role: RoleUser, Content: r.Prompt})
+	}
+	return msgs
+}
+
+// textWithAttachments returns the message text with text attachments
+// appended in fenced blocks.
+func (m Message) textWithAttachments() string {
+	var sb strings.Builder
+	sb.WriteString(m.Content)
+	for _, a := range m.Attachments {
+		if a.IsImage() {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n\n[%s]\n```\n%s\n```", a.Name, a.Data)
+	}
+	return sb.String()
 }
 
 // Response represents a complete AI generation response.
@@ -69,6 +153,9 @@ type Response struct {
 	// FinishReason explains why generation stopped
 	// (e.g., "stop", "length", "content_filtered")
 	FinishReason string
+
+	// ToolCalls lists the tools run while generating, in order
+	ToolCalls []ToolCall
 }
 
 // Usage represents token consumption information.
@@ -95,6 +182,7 @@ type Config struct {
 	MaxTokens   int    // Max response tokens
 	Temperature float64 // Randomness factor
 	Endpoint    string // Custom API endpoint (optional)
+	MaxRetries  int    // SDK-level retries (-1 leaves the SDK default)
 }
 
 // Option is a functional option for configuring a Provider.
@@ -136,3 +224,11 @@ func WithEndpoint(endpoint string) Option {
 		c.Endpoint = endpoint
 	}
 }
+
+// WithMaxRetries sets how often the underlying client retries on its own.
+// Use 0 when the provider is wrapped in Retry middleware.
+func WithMaxRetries(n int) Option {
+	return func(c *Config) {
+		c.MaxRetries = n
+	}
+}
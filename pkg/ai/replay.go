@@ -0,0 +1,367 @@
+// Package ai provides AI provider implementations.
+// This file implements a cassette-style record/replay provider so that
+// code paths using a Provider can run offline and deterministically.
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReplayMode selects how a ReplayProvider treats its cassette.
+type ReplayMode string
+
+const (
+	// ReplayOnly serves requests from the cassette and fails on a miss.
+	ReplayOnly ReplayMode = "replay"
+	// ReplayRecord always calls the upstream provider and records the result.
+	ReplayRecord ReplayMode = "record"
+	// ReplayAuto replays recorded requests and records new ones.
+	ReplayAuto ReplayMode = "auto"
+)
+
+// ErrCassetteMiss is returned in replay mode when a request was never recorded.
+var ErrCassetteMiss = errors.New("ai: request not found in cassette")
+
+// Interaction is one recorded request/response pair.
+type Interaction struct {
+	Key        string      `json:"key"`                   // Request fingerprint
+	Stream     bool        `json:"stream"`                // Recorded via GenerateStream
+	Request    CassetteReq `json:"request"`               // Request that was sent
+	Response   *Response   `json:"response,omitempty"`    // Full response (Generate)
+	Chunks     []string    `json:"chunks,omitempty"`      // Raw stream chunks (GenerateStream)
+	Error      string      `json:"error,omitempty"`       // Error message, if the call failed
+	StatusCode int         `json:"status_code,omitempty"` // HTTP status of a StatusError
+	RecordedAt time.Time   `json:"recorded_at"`
+}
+
+// CassetteReq is the part of a Request that identifies an interaction.
+type CassetteReq struct {
+	Model       string    `json:"model,omitempty"`
+	System      string    `json:"system,omitempty"`
+	Prompt      string    `json:"prompt"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	Messages    []Message `json:"messages,omitempty"`
+}
+
+// Cassette is the on-disk file format: a list of interactions.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// ReplayProvider records upstream interactions to a cassette file and
+// replays them deterministically. Identical requests recorded several
+// times are replayed in recording order; the last one then repeats.
+// Thread-safe.
+type ReplayProvider struct {
+	path     string
+	mode     ReplayMode
+	upstream Provider
+
+	mu       sync.Mutex
+	cassette Cassette
+	cursor   map[string]int // Next replay index per key
+}
+
+// NewReplayProvider loads the cassette at path. A missing file starts an
+// empty cassette. Upstream is required for record and auto modes.
+//
+// Example:
+//
+//	p, err := NewReplayProvider("testdata/chat.json", ReplayOnly, nil)
+func NewReplayProvider(path string, mode ReplayMode, upstream Provider) (*ReplayProvider, error) {
+	if mode == "" {
+		mode = ReplayOnly
+	}
+	switch mode {
+	case ReplayOnly:
+	case ReplayRecord, ReplayAuto:
+		if upstream == nil {
+			return nil, fmt.Errorf("replay mode %q requires an upstream provider", mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown replay mode: %s", mode)
+	}
+
+	p := &ReplayProvider{
+		path:     path,
+		mode:     mode,
+		upstream: upstream,
+		cassette: Cassette{Version: 1},
+		cursor:   make(map[string]int),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &p.cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+	}
+	if mode == ReplayRecord {
+		// Re-recording replaces the previous tape
+		p.cassette.Interactions = nil
+	}
+	return p, nil
+}
+
+// Name returns the provider identifier.
+func (p *ReplayProvider) Name() string {
+	return "replay"
+}
+
+// Interactions returns the interactions currently on the cassette.
+func (p *ReplayProvider) Interactions() []Interaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Interaction(nil), p.cassette.Interactions...)
+}
+
+// Fingerprint returns the stable key used to match req against recordings.
+func Fingerprint(req *Request, stream bool) string {
+	data, _ := json.Marshal(struct {
+		CassetteReq
+		Stream bool `json:"stream"`
+	}{cassetteReq(req), stream})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func cassetteReq(req *Request) CassetteReq {
+	return CassetteReq{
+		Model:       req.Model,
+		System:      req.System,
+		Prompt:      req.Prompt,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Messages:    req.Messages,
+	}
+}
+
+// lookup returns the next recorded interaction for key.
+func (p *ReplayProvider) lookup(key string) (*Interaction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var matches []int
+	for i := range p.cassette.Interactions {
+		if p.cassette.Interactions[i].Key == key {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, false
+	}
+	n := p.cursor[key]
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	p.cursor[key] = n + 1
+	it := p.cassette.Interactions[matches[n]]
+	return &it, true
+}
+
+// record appends an interaction and persists the cassette.
+func (p *ReplayProvider) record(it Interaction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	it.RecordedAt = time.Now().UTC()
+	p.cassette.Interactions = append(p.cassette.Interactions, it)
+	return p.save()
+}
+
+// save writes the cassette atomically. Caller must hold p.mu.
+func (p *ReplayProvider) save() error {
+	data, err := json.MarshalIndent(p.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// replayError rebuilds a recorded error, keeping its status code so
+// middleware classifies it the same way as the original.
+func replayError(it *Interaction) error {
+	err := errors.New(it.Error)
+	if it.StatusCode != 0 {
+		return &StatusError{Provider: "replay", StatusCode: it.StatusCode, Err: err}
+	}
+	return err
+}
+
+// recordError converts err into interaction fields.
+func recordError(it *Interaction, err error) {
+	it.Error = err.Error()
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		it.StatusCode = statusErr.StatusCode
+	}
+}
+
+// Generate replays or records a complete response.
+func (p *ReplayProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	key := Fingerprint(req, false)
+
+	if p.mode != ReplayRecord {
+		if it, ok := p.lookup(key); ok {
+			if it.Error != "" {
+				return nil, replayError(it)
+			}
+			if it.Response == nil {
+				return nil, fmt.Errorf("cassette %s: interaction %.12s has no response", p.path, key)
+			}
+			resp := *it.Response
+			return &resp, nil
+		}
+		if p.mode == ReplayOnly {
+			return nil, fmt.Errorf("%w: %q", ErrCassetteMiss, truncate(req.Prompt, 60))
+		}
+	}
+
+	resp, err := p.upstream.Generate(ctx, req)
+	it := Interaction{Key: key, Request: cassetteReq(req), Response: resp}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Cancellation is not a property of the request
+			return nil, err
+		}
+		recordError(&it, err)
+	}
+	if saveErr := p.record(it); saveErr != nil {
+		return nil, saveErr
+	}
+	return resp, err
+}
+
+// GenerateStream replays or records a stream chunk by chunk.
+// A recording is saved when the stream reaches EOF or is closed.
+func (p *ReplayProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	key := Fingerprint(req, true)
+
+	if p.mode != ReplayRecord {
+		if it, ok := p.lookup(key); ok {
+			if it.Error != "" {
+				return nil, replayError(it)
+			}
+			return &chunkReader{chunks: it.Chunks}, nil
+		}
+		if p.mode == ReplayOnly {
+			return nil, fmt.Errorf("%w: %q", ErrCassetteMiss, truncate(req.Prompt, 60))
+		}
+	}
+
+	rc, err := p.upstream.GenerateStream(ctx, req)
+	it := Interaction{Key: key, Stream: true, Request: cassetteReq(req)}
+	if err != nil {
+		if ctx.Err() == nil {
+			recordError(&it, err)
+			if saveErr := p.record(it); saveErr != nil {
+				return nil, saveErr
+			}
+		}
+		return nil, err
+	}
+	return &recordingReader{src: rc, owner: p, it: it}, nil
+}
+
+// ValidateKey succeeds in replay mode; otherwise it checks the upstream.
+func (p *ReplayProvider) ValidateKey(ctx context.Context) error {
+	if p.mode == ReplayOnly {
+		return nil
+	}
+	return p.upstream.ValidateKey(ctx)
+}
+
+// chunkReader yields recorded chunks one Read at a time, so consumers see
+// the same chunk boundaries as during recording.
+type chunkReader struct {
+	chunks []string
+	buf    []byte
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		r.buf = []byte(r.chunks[0])
+		r.chunks = r.chunks[1:]
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+// recordingReader tees an upstream stream into an interaction.
+type recordingReader struct {
+	src   io.ReadCloser
+	owner *ReplayProvider
+	it    Interaction
+	done  bool
+}
+
+func (r *recordingReader) Read(b []byte) (int, error) {
+	n, err := r.src.Read(b)
+	if n > 0 {
+		r.it.Chunks = append(r.it.Chunks, string(bytes.Clone(b[:n])))
+	}
+	if err != nil && err != io.EOF {
+		recordError(&r.it, err)
+	}
+	if err == io.EOF {
+		if saveErr := r.finish(); saveErr != nil {
+			return n, saveErr
+		}
+	} else if err != nil {
+		err = errors.Join(err, r.finish())
+	}
+	return n, err
+}
+
+func (r *recordingReader) Close() error {
+	err := r.src.Close()
+	return errors.Join(err, r.finish())
+}
+
+// finish saves the interaction once, returning the save error.
+func (r *recordingReader) finish() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	return r.owner.record(r.it)
+}
+
+// truncate shortens s for error messages.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayProvider_RecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "chat.json")
+	ctx := context.Background()
+	req := &Request{Prompt: "hello", System: "be brief"}
+
+	upstream := NewFakeProvider(FakeStep{Content: "first"}, FakeStep{Content: "second"})
+	rec, err := NewReplayProvider(path, ReplayRecord, upstream)
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+	rec.Generate(ctx, req)
+	rec.Generate(ctx, req)
+
+	// Replay from disk without an upstream
+	play, err := NewReplayProvider(path, ReplayOnly, nil)
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+	for _, want := range []string{"first", "second", "second"} {
+		resp, err := play.Generate(ctx, req)
+		if err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+		if resp.Content != want {
+			t.Errorf("expected %q, got %q", want, resp.Content)
+		}
+	}
+
+	if _, err := play.Generate(ctx, &Request{Prompt: "unknown"}); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("expected cassette miss, got %v", err)
+	}
+}
+
+func TestReplayProvider_StreamChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.json")
+	ctx := context.Background()
+	req := &Request{Prompt: "stream please"}
+
+	upstream := NewFakeProvider(FakeStep{Chunks: []string{"Hel", "lo"}})
+	rec, _ := NewReplayProvider(path, ReplayRecord, upstream)
+	rc, err := rec.GenerateStream(ctx, req)
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	recorded, _ := io.ReadAll(rc)
+	rc.Close()
+
+	play, _ := NewReplayProvider(path, ReplayOnly, nil)
+	rc, err = play.GenerateStream(ctx, req)
+	if err != nil {
+		t.Fatalf("replay stream failed: %v", err)
+	}
+	replayed, _ := io.ReadAll(rc)
+	if string(replayed) != string(recorded) || string(replayed) != "data: Hel\n\ndata: lo\n\n" {
+		t.Errorf("stream mismatch: recorded %q, replayed %q", recorded, replayed)
+	}
+
+	// Streams and blocking calls are recorded separately
+	if _, err := play.Generate(ctx, req); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("expected miss for non-stream request, got %v", err)
+	}
+}
+
+func TestReplayProvider_RecordsErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.json")
+	ctx := context.Background()
+
+	upstream := NewFakeProvider(FakeStep{Err: &StatusError{Provider: "fake", StatusCode: 429}})
+	rec, _ := NewReplayProvider(path, ReplayAuto, upstream)
+	if _, err := rec.Generate(ctx, &Request{Prompt: "x"}); err == nil {
+		t.Fatal("expected upstream error")
+	}
+
+	play, _ := NewReplayProvider(path, ReplayOnly, nil)
+	_, err := play.Generate(ctx, &Request{Prompt: "x"})
+	if !IsRetryable(err) {
+		t.Errorf("expected replayed status error, got %v", err)
+	}
+}
+
+func TestReplayProvider_MissingResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.json")
+	req := &Request{Prompt: "x"}
+	data, _ := json.Marshal(Cassette{Version: 1, Interactions: []Interaction{{Key: Fingerprint(req, false)}}})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	play, _ := NewReplayProvider(path, ReplayOnly, nil)
+	if resp, err := play.Generate(context.Background(), req); err == nil {
+		t.Errorf("expected an error for an interaction without a response, got %+v", resp)
+	}
+}
+
+func TestReplayProvider_StreamSaveError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cassettes")
+	upstream := NewFakeProvider(FakeStep{Chunks: []string{"Hel", "lo"}})
+	rec, err := NewReplayProvider(filepath.Join(dir, "stream.json"), ReplayRecord, upstream)
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+	// A file in the way of the cassette's directory makes saving fail
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := rec.GenerateStream(context.Background(), &Request{Prompt: "x"})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err == nil {
+		t.Error("expected the failed save to be returned at the end of the stream")
+	}
+}
+
+func TestNewReplayProvider_RequiresUpstream(t *testing.T) {
+	if _, err := NewReplayProvider("x.json", ReplayRecord, nil); err == nil {
+		t.Error("expected error without upstream")
+	}
+	if _, err := NewReplayProvider("x.json", "bogus", nil); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestFakeProvider_Script(t *testing.T) {
+	fake := NewFakeProvider(FakeStep{Content: "a"}, FakeStep{Err: errors.New("boom")})
+	ctx := context.Background()
+
+	if resp, err := fake.Generate(ctx, &Request{Prompt: "1"}); err != nil || resp.Content != "a" {
+		t.Errorf("unexpected first step: %v, %v", resp, err)
+	}
+	if _, err := fake.Generate(ctx, &Request{Prompt: "2"}); err == nil {
+		t.Error("expected scripted error")
+	}
+	if reqs := fake.Requests(); len(reqs) != 2 || reqs[1].Prompt != "2" {
+		t.Errorf("unexpected recorded requests: %+v", reqs)
+	}
+
+	if _, err := NewFakeProvider().Generate(ctx, &Request{}); err == nil {
+		t.Error("expected error for empty script")
+	}
+}
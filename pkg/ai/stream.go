@@ -0,0 +1,243 @@
+// Package ai provides AI provider implementations.
+// This file implements the typed streaming event API.
+package ai
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+// EventType identifies a streaming event.
+type EventType string
+
+const (
+	EventText     EventType = "text"      // Text delta
+	EventToolCall EventType = "tool_call" // Complete tool call requested by the model
+	EventUsage    EventType = "usage"     // Token usage so far
+	EventDone     EventType = "done"      // Final message, always the last event of a successful stream
+)
+
+// Event is one typed streaming event.
+type Event struct {
+	Type     EventType
+	Text     string    // EventText: the delta
+	ToolCall *ToolCall // EventToolCall: the call (not run while streaming)
+	Usage    *Usage    // EventUsage: usage reported by the provider
+	Response *Response // EventDone: the full message with stop reason and usage
+}
+
+// EventStream yields typed events until the response is complete.
+// Errors end the stream: Next returns false and Err reports why.
+// Cancelling the context passed to StreamEvents ends the stream too.
+//
+// Example:
+//
+//	s, err := OpenStream(ctx, provider, req)
+//	if err != nil { ... }
+//	defer s.Close()
+//	for s.Next() {
+//	    if e := s.Event(); e.Type == EventText {
+//	        fmt.Print(e.Text)
+//	    }
+//	}
+//	if err := s.Err(); err != nil { ... }
+type EventStream interface {
+	// Next advances to the next event. It returns false at the end of
+	// the stream or on error.
+	Next() bool
+
+	// Event returns the current event.
+	Event() Event
+
+	// Err returns the error that ended the stream, if any.
+	Err() error
+
+	// Close stops the stream and releases its resources.
+	Close() error
+}
+
+// EventStreamer is implemented by providers (and middleware) that stream
+// typed events natively.
+type EventStreamer interface {
+	StreamEvents(ctx context.Context, req *Request) (EventStream, error)
+}
+
+// OpenStream streams req as typed events. Providers that don't implement
+// EventStreamer are adapted from GenerateStream; their streams carry text
+// and a final message, but no usage or stop reason.
+func OpenStream(ctx context.Context, p Provider, req *Request) (EventStream, error) {
+	if s, ok := p.(EventStreamer); ok {
+		return s.StreamEvents(ctx, req)
+	}
+	rc, err := p.GenerateStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return sseEvents(ctx, rc), nil
+}
+
+// Collect reads s to the end and returns the final message.
+// The stream is closed.
+func Collect(s EventStream) (*Response, error) {
+	defer s.Close()
+	var resp *Response
+	for s.Next() {
+		if e := s.Event(); e.Type == EventDone {
+			resp = e.Response
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return resp, nil
+}
+
+// ==================== Implementation ====================
+
+// emitFunc sends an event to the consumer. It fails once the stream's
+// context is done.
+type emitFunc func(Event) error
+
+// pipeStream runs a producer in a goroutine and hands its events to the
+// consumer one at a time.
+type pipeStream struct {
+	cancel context.CancelFunc
+	events chan Event
+	cur     Event
+	pending bool  // cur was read by openPipeStream and not yet returned
+	err     error // Written by the producer before events is closed
+	once    sync.Once
+}
+
+// newPipeStream starts run. run should return when ctx is done.
+func newPipeStream(ctx context.Context, run func(ctx context.Context, emit emitFunc) error) *pipeStream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &pipeStream{cancel: cancel, events: make(chan Event)}
+	emit := func(e Event) error {
+		select {
+		case s.events <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	go func() {
+		defer close(s.events)
+		s.err = run(ctx, emit)
+	}()
+	return s
+}
+
+// openPipeStream is newPipeStream for producers that only learn whether
+// the request was accepted once the response starts. It waits for the
+// first event, so failing to connect or a rejected request is returned
+// here, where retries, circuit breakers and fallbacks see it, rather than
+// from Err.
+func openPipeStream(ctx context.Context, run func(ctx context.Context, emit emitFunc) error) (EventStream, error) {
+	s := newPipeStream(ctx, run)
+	if s.Next() {
+		s.pending = true
+	} else if err := s.Err(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *pipeStream) Next() bool {
+	if s.pending {
+		s.pending = false
+		return true
+	}
+	e, ok := <-s.events
+	if ok {
+		s.cur = e
+	}
+	return ok
+}
+
+func (s *pipeStream) Event() Event { return s.cur }
+
+// Err is valid once Next has returned false.
+func (s *pipeStream) Err() error { return s.err }
+
+func (s *pipeStream) Close() error {
+	s.once.Do(func() {
+		s.cancel()
+		for range s.events {
+			// Drain so the producer can exit
+		}
+	})
+	return nil
+}
+
+// sseEvents adapts a GenerateStream reader ("data: <text>" lines) to
+// typed events.
+func sseEvents(ctx context.Context, rc io.ReadCloser) EventStream {
+	return newPipeStream(ctx, func(ctx context.Context, emit emitFunc) error {
+		defer rc.Close()
+		// Unblock the read below when the stream is cancelled
+		stop := context.AfterFunc(ctx, func() { rc.Close() })
+		defer stop()
+
+		var content strings.Builder
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			text, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok || text == "" {
+				continue
+			}
+			content.WriteString(text)
+			if err := emit(Event{Type: EventText, Text: text}); err != nil {
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return emit(Event{Type: EventDone, Response: &Response{Content: content.String()}})
+	})
+}
+
+// sseReader renders text events in the "data: <text>\n\n" format of
+// GenerateStream.
+type sseReader struct {
+	stream EventStream
+	buf    []byte
+}
+
+// NewSSEReader lets providers and middleware implement GenerateStream on
+// top of an event stream.
+func NewSSEReader(s EventStream) io.ReadCloser {
+	return &sseReader{stream: s}
+}
+
+func (r *sseReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if !r.stream.Next() {
+			if err := r.stream.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if e := r.stream.Event(); e.Type == EventText {
+			r.buf = []byte("data: " + e.Text + "\n\n")
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *sseReader) Close() error {
+	return r.stream.Close()
+}
@@ -0,0 +1,252 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvents reads s to the end and returns its events.
+func readEvents(t *testing.T, s EventStream) []Event {
+	t.Helper()
+	defer s.Close()
+	var events []Event
+	for s.Next() {
+		events = append(events, s.Event())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	return events
+}
+
+func TestFakeProvider_StreamEvents(t *testing.T) {
+	fake := NewFakeProvider(FakeStep{
+		Chunks:    []string{"Hel", "lo"},
+		Usage:     &Usage{InputTokens: 3, OutputTokens: 2},
+		ToolCalls: []ToolCall{{ID: "1", Name: "echo", Input: json.RawMessage(`{}`)}},
+	})
+	s, err := OpenStream(context.Background(), fake, &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+
+	events := readEvents(t, s)
+	var types []string
+	for _, e := range events {
+		types = append(types, string(e.Type))
+	}
+	if got := strings.Join(types, ","); got != "text,text,tool_call,usage,done" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	done := events[len(events)-1].Response
+	if done.Content != "Hello" || done.FinishReason != "tool_use" || done.Usage.OutputTokens != 2 {
+		t.Errorf("unexpected final message: %+v", done)
+	}
+}
+
+func TestOpenStream_AdaptsGenerateStream(t *testing.T) {
+	// stubProvider only implements GenerateStream
+	s, err := OpenStream(context.Background(), &stubProvider{name: "stub"}, &Request{})
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	resp, err := Collect(s)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if resp.Content != "stub" {
+		t.Errorf("unexpected content: %q", resp.Content)
+	}
+}
+
+func TestOpenStream_Cancel(t *testing.T) {
+	// A server that never finishes the stream
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := OpenStream(ctx, NewLocalProvider(WithEndpoint(server.URL)), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	defer s.Close()
+
+	if !s.Next() || s.Event().Text != "Hel" {
+		t.Fatalf("expected first text event, got %+v", s.Event())
+	}
+	cancel()
+
+	finished := make(chan bool)
+	go func() { finished <- s.Next() }()
+	select {
+	case more := <-finished:
+		if more {
+			t.Error("expected stream to end after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not honor cancellation")
+	}
+	if !errors.Is(s.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", s.Err())
+	}
+}
+
+func TestOpenAIProvider_StreamEvents(t *testing.T) {
+	var body struct {
+		StreamOptions struct {
+			IncludeUsage bool `json:"include_usage"`
+		} `json:"stream_options"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, "data: {\"model\":\"m\",\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"length\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":1,\"total_tokens\":5}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewLocalProvider(WithEndpoint(server.URL))
+	s, err := p.StreamEvents(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("StreamEvents failed: %v", err)
+	}
+	resp, err := Collect(s)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if resp.Content != "Hi" || resp.Model != "m" || resp.FinishReason != "length" || resp.Usage == nil || resp.Usage.TotalTokens != 5 {
+		t.Errorf("unexpected final message: %+v", resp)
+	}
+	if !body.StreamOptions.IncludeUsage {
+		t.Error("expected the stream request to ask for usage")
+	}
+}
+
+func TestClaudeProvider_StreamEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range []string{
+			`{"type":"message_start","message":{"id":"m1","type":"message","role":"assistant","model":"claude-test","content":[],"stop_reason":null,"usage":{"input_tokens":7,"output_tokens":0}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu1","name":"echo","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"text\":\"hi\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+			`{"type":"message_stop"}`,
+		} {
+			var typ struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(e), &typ)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, e)
+		}
+	}))
+	defer server.Close()
+
+	p := NewClaudeProvider(WithAPIKey("key"), WithEndpoint(server.URL), WithMaxRetries(0))
+	s, err := p.StreamEvents(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("StreamEvents failed: %v", err)
+	}
+	events := readEvents(t, s)
+
+	var text string
+	var call *ToolCall
+	for _, e := range events {
+		switch e.Type {
+		case EventText:
+			text += e.Text
+		case EventToolCall:
+			call = e.ToolCall
+		}
+	}
+	if text != "Hello" {
+		t.Errorf("unexpected text: %q", text)
+	}
+	if call == nil || call.Name != "echo" || string(call.Input) != `{"text":"hi"}` {
+		t.Errorf("unexpected tool call: %+v", call)
+	}
+	done := events[len(events)-1]
+	if done.Type != EventDone || done.Response.FinishReason != "tool_use" ||
+		done.Response.Usage.InputTokens != 7 || done.Response.Usage.OutputTokens != 9 {
+		t.Errorf("unexpected final event: %+v", done.Response)
+	}
+
+	// GenerateStream keeps its SSE text format
+	rc, err := p.GenerateStream(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "data: Hel\n\ndata: lo\n\n" {
+		t.Errorf("unexpected stream: %q", data)
+	}
+}
+
+func TestClaudeProvider_StreamFailureFallsBack(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"overloaded"}}`)
+	}))
+	defer server.Close()
+
+	claude := NewClaudeProvider(WithAPIKey("key"), WithEndpoint(server.URL), WithMaxRetries(0))
+	if _, err := claude.StreamEvents(context.Background(), &Request{Prompt: "hi"}); !IsRetryable(err) {
+		t.Fatalf("expected StreamEvents to return the retryable 503, got %v", err)
+	}
+
+	local := &stubProvider{name: "local"}
+	p := NewFallbackProvider(Chain(claude, fastRetry(2)), local)
+	s, err := p.StreamEvents(context.Background(), &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("StreamEvents failed: %v", err)
+	}
+	resp, err := Collect(s)
+	if err != nil || resp.Content != "local" {
+		t.Fatalf("expected the fallback's stream, got %+v, %v", resp, err)
+	}
+	if requests != 3 {
+		t.Errorf("expected the stream to be retried once before falling back, got %d requests", requests)
+	}
+}
+
+func TestTrackUsage_StreamEvents(t *testing.T) {
+	ledger := &memLedger{}
+	fake := NewFakeProvider(FakeStep{Content: "ok", Usage: &Usage{InputTokens: 100, OutputTokens: 50}})
+	p := Chain(fake, Timeout(time.Minute), TrackUsage(ledger))
+
+	s, err := OpenStream(context.Background(), p, &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	if _, err := Collect(s); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	if len(ledger.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(ledger.records))
+	}
+	if rec := ledger.records[0]; rec.Estimated || rec.InputTokens != 100 || rec.OutputTokens != 50 {
+		t.Errorf("expected reported usage, got %+v", rec)
+	}
+}
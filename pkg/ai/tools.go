@@ -0,0 +1,89 @@
+// Package ai provides AI provider implementations.
+// This file defines tools the model can call while answering.
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxToolRounds limits how many times a provider sends tool results
+// back to the model before giving up.
+const DefaultMaxToolRounds = 8
+
+// ErrTooManyToolRounds is returned when the model keeps calling tools past
+// Request.MaxToolRounds.
+var ErrTooManyToolRounds = errors.New("ai: too many tool rounds")
+
+// ToolRoundError is returned by a tool-use loop that fails after tools
+// have run. It is never retried, here or by another provider: that would
+// run the tools, which may have side effects, again. Partial holds what
+// the completed rounds produced, so their tokens are still accounted for.
+type ToolRoundError struct {
+	Partial *Response // Model, usage and tool calls of the completed rounds
+	Err     error     // Why the loop stopped
+}
+
+// Error implements the error interface.
+func (e *ToolRoundError) Error() string {
+	return fmt.Sprintf("ai: failed after %d tool calls: %v", len(e.Partial.ToolCalls), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ToolRoundError) Unwrap() error {
+	return e.Err
+}
+
+// Tool is a function the model may call while answering. Providers that
+// support tool use (currently Claude) run the tool-use loop themselves;
+// others ignore Request.Tools.
+type Tool struct {
+	Name        string         // Identifier the model calls the tool by
+	Description string         // What the tool does and when to use it
+	Properties  map[string]any // JSON Schema properties of the input object
+	Required    []string       // Required input properties
+
+	// Run executes the tool with the model's JSON input and returns the
+	// result shown to the model. Errors are reported to the model too.
+	Run func(ctx context.Context, input json.RawMessage) (string, error)
+}
+
+// ToolCall is one tool invocation made while generating a response.
+type ToolCall struct {
+	ID      string          // Provider-assigned call ID
+	Name    string          // Tool name
+	Input   json.RawMessage // Input chosen by the model
+	Output  string          // Result sent back to the model
+	IsError bool            // Whether the tool failed
+}
+
+// RunTool executes call with the matching tool and fills in its output.
+// Unknown tools and tool errors become error results for the model, so
+// the model can recover instead of the whole request failing.
+func RunTool(ctx context.Context, tools []Tool, call *ToolCall) {
+	for _, t := range tools {
+		if t.Name != call.Name {
+			continue
+		}
+		out, err := t.Run(ctx, call.Input)
+		if err != nil {
+			call.Output = err.Error()
+			call.IsError = true
+			return
+		}
+		call.Output = out
+		return
+	}
+	call.Output = fmt.Sprintf("unknown tool: %s", call.Name)
+	call.IsError = true
+}
+
+// maxToolRounds returns the request's tool round limit.
+func (r *Request) maxToolRounds() int {
+	if r.MaxToolRounds > 0 {
+		return r.MaxToolRounds
+	}
+	return DefaultMaxToolRounds
+}
@@ -0,0 +1,177 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func echoTool() Tool {
+	return Tool{
+		Name:       "echo",
+		Properties: map[string]any{"text": map[string]any{"type": "string"}},
+		Required:   []string{"text"},
+		Run: func(ctx context.Context, input json.RawMessage) (string, error) {
+			var in struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(input, &in); err != nil {
+				return "", err
+			}
+			if in.Text == "" {
+				return "", errors.New("text is required")
+			}
+			return "echo: " + in.Text, nil
+		},
+	}
+}
+
+func TestRunTool(t *testing.T) {
+	tools := []Tool{echoTool()}
+
+	call := ToolCall{Name: "echo", Input: json.RawMessage(`{"text":"hi"}`)}
+	RunTool(context.Background(), tools, &call)
+	if call.Output != "echo: hi" || call.IsError {
+		t.Errorf("unexpected result: %+v", call)
+	}
+
+	call = ToolCall{Name: "echo", Input: json.RawMessage(`{}`)}
+	RunTool(context.Background(), tools, &call)
+	if !call.IsError {
+		t.Error("expected tool error to be reported")
+	}
+
+	call = ToolCall{Name: "missing"}
+	RunTool(context.Background(), tools, &call)
+	if !call.IsError {
+		t.Error("expected unknown tool to be reported")
+	}
+}
+
+func TestClaudeProvider_ToolLoop(t *testing.T) {
+	type claudeRequest struct {
+		Tools    []map[string]any `json:"tools"`
+		Messages []struct {
+			Role    string           `json:"role"`
+			Content []map[string]any `json:"content"`
+		} `json:"messages"`
+	}
+	var rounds []claudeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body claudeRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		rounds = append(rounds, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(rounds) == 1 {
+			fmt.Fprint(w, `{"id":"m1","type":"message","role":"assistant","model":"claude-test",
+				"content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"tu1","name":"echo","input":{"text":"hi"}}],
+				"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"m2","type":"message","role":"assistant","model":"claude-test",
+			"content":[{"type":"text","text":"It said hi."}],
+			"stop_reason":"end_turn","usage":{"input_tokens":20,"output_tokens":4}}`)
+	}))
+	defer server.Close()
+
+	p := NewClaudeProvider(WithAPIKey("key"), WithEndpoint(server.URL), WithMaxRetries(0))
+	resp, err := p.Generate(context.Background(), &Request{Prompt: "say hi", Tools: []Tool{echoTool()}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if resp.Content != "It said hi." {
+		t.Errorf("unexpected content: %q", resp.Content)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Output != "echo: hi" {
+		t.Errorf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+	if resp.Usage.InputTokens != 30 || resp.Usage.OutputTokens != 9 {
+		t.Errorf("expected usage summed over rounds, got %+v", resp.Usage)
+	}
+
+	if len(rounds) != 2 {
+		t.Fatalf("expected 2 rounds, got %d", len(rounds))
+	}
+	if len(rounds[0].Tools) != 1 || rounds[0].Tools[0]["name"] != "echo" {
+		t.Errorf("expected tool declaration, got %+v", rounds[0].Tools)
+	}
+	msgs := rounds[1].Messages
+	if len(msgs) != 3 || msgs[1].Role != "assistant" || msgs[2].Role != "user" {
+		t.Fatalf("expected tool_use and tool_result turns, got %+v", msgs)
+	}
+	result := msgs[2].Content[0]
+	if result["type"] != "tool_result" || result["tool_use_id"] != "tu1" {
+		t.Errorf("unexpected tool result block: %+v", result)
+	}
+}
+
+func TestFakeProvider_ToolLoop(t *testing.T) {
+	fake := NewFakeProvider(
+		FakeStep{ToolCalls: []ToolCall{{ID: "1", Name: "echo", Input: json.RawMessage(`{"text":"a"}`)}}},
+		FakeStep{Content: "done"},
+	)
+	resp, err := fake.Generate(context.Background(), &Request{Prompt: "x", Tools: []Tool{echoTool()}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if resp.Content != "done" || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Output != "echo: a" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	// A model that never stops calling tools is cut off
+	loop := NewFakeProvider(FakeStep{ToolCalls: []ToolCall{{ID: "1", Name: "echo", Input: json.RawMessage(`{"text":"a"}`)}}})
+	_, err = loop.Generate(context.Background(), &Request{Prompt: "x", Tools: []Tool{echoTool()}, MaxToolRounds: 3})
+	if !errors.Is(err, ErrTooManyToolRounds) {
+		t.Errorf("expected ErrTooManyToolRounds, got %v", err)
+	}
+}
+
+func TestClaudeProvider_ToolLoopFailureIsNotRetried(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			fmt.Fprint(w, `{"id":"m1","type":"message","role":"assistant","model":"claude-test",
+				"content":[{"type":"tool_use","id":"tu1","name":"write","input":{}}],
+				"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"overloaded"}}`)
+	}))
+	defer server.Close()
+
+	writes := 0
+	write := Tool{Name: "write", Run: func(ctx context.Context, input json.RawMessage) (string, error) {
+		writes++
+		return "written", nil
+	}}
+	ledger := &memLedger{}
+	claude := NewClaudeProvider(WithAPIKey("key"), WithEndpoint(server.URL), WithMaxRetries(0))
+	p := Chain(claude, fastRetry(3), TrackUsage(ledger))
+
+	_, err := p.Generate(context.Background(), &Request{Prompt: "save it", Tools: []Tool{write}})
+	var roundErr *ToolRoundError
+	if !errors.As(err, &roundErr) || IsRetryable(err) {
+		t.Fatalf("expected a non-retryable ToolRoundError, got %v", err)
+	}
+	if requests != 2 || writes != 1 {
+		t.Errorf("expected the loop not to be repeated, got %d requests and %d tool runs", requests, writes)
+	}
+	if len(ledger.records) != 1 {
+		t.Fatalf("expected one usage record, got %d", len(ledger.records))
+	}
+	if rec := ledger.records[0]; rec.InputTokens != 10 || rec.OutputTokens != 5 || rec.Model != "claude-test" || rec.Error == "" {
+		t.Errorf("expected the completed round to be billed, got %+v", rec)
+	}
+}
@@ -0,0 +1,364 @@
+// Package ai provides AI provider implementations.
+// This file implements usage tracking and budget enforcement middleware.
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// UsageLedger stores usage records and answers spend queries.
+// Implemented by the SQLite storage.
+type UsageLedger interface {
+	// RecordUsage stores a usage record.
+	RecordUsage(ctx context.Context, rec *models.UsageRecord) error
+
+	// UsageCostSince returns the total estimated cost of calls since t.
+	UsageCostSince(ctx context.Context, since time.Time) (float64, error)
+}
+
+// spaceKey is the context key for the active space.
+type spaceKey struct{}
+
+// WithSpace returns a context that attributes provider calls to spaceID.
+func WithSpace(ctx context.Context, spaceID string) context.Context {
+	return context.WithValue(ctx, spaceKey{}, spaceID)
+}
+
+// SpaceFromContext returns the space set by WithSpace, or "".
+func SpaceFromContext(ctx context.Context) string {
+	spaceID, _ := ctx.Value(spaceKey{}).(string)
+	return spaceID
+}
+
+// ==================== Usage Tracking ====================
+
+// TrackUsage records every call's tokens, latency and estimated cost.
+// Ledger failures never fail the call itself.
+func TrackUsage(ledger UsageLedger) Middleware {
+	return func(next Provider) Provider {
+		return &usageProvider{next: next, ledger: ledger}
+	}
+}
+
+type usageProvider struct {
+	next   Provider
+	ledger UsageLedger
+}
+
+func (p *usageProvider) Name() string { return p.next.Name() }
+
+func (p *usageProvider) DefaultModel() string { return DefaultModel(p.next) }
+
+func (p *usageProvider) newRecord(ctx context.Context, req *Request, start time.Time) *models.UsageRecord {
+	model := req.Model
+	if model == "" {
+		model = DefaultModel(p.next)
+	}
+	return &models.UsageRecord{
+		Provider:  p.next.Name(),
+		Model:     model,
+		SpaceID:   SpaceFromContext(ctx),
+		Latency:   time.Since(start),
+		CreatedAt: start,
+	}
+}
+
+func (p *usageProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	start := time.Now()
+	resp, err := p.next.Generate(ctx, req)
+
+	rec := p.newRecord(ctx, req, start)
+	// A tool-use loop that failed partway was still billed for the rounds
+	// it completed
+	billed := resp
+	if err != nil {
+		rec.Error = err.Error()
+		billed = nil
+		var roundErr *ToolRoundError
+		if errors.As(err, &roundErr) {
+			billed = roundErr.Partial
+		}
+	}
+	if billed != nil {
+		if billed.Model != "" {
+			rec.Model = billed.Model
+		}
+		if billed.Usage != nil {
+			rec.InputTokens = billed.Usage.InputTokens
+			rec.OutputTokens = billed.Usage.OutputTokens
+		} else {
+			rec.InputTokens = estimateRequestTokens(req)
+			rec.OutputTokens = EstimateTokens(billed.Content)
+			rec.Estimated = true
+		}
+	}
+	rec.Cost = EstimateCost(rec.Model, rec.InputTokens, rec.OutputTokens)
+	_ = p.ledger.RecordUsage(context.WithoutCancel(ctx), rec)
+
+	return resp, err
+}
+
+func (p *usageProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := p.next.GenerateStream(ctx, req)
+	if err != nil {
+		rec := p.newRecord(ctx, req, start)
+		rec.Error = err.Error()
+		_ = p.ledger.RecordUsage(context.WithoutCancel(ctx), rec)
+		return nil, err
+	}
+	return &usageStream{ReadCloser: rc, owner: p, ctx: ctx, req: req, start: start}, nil
+}
+
+func (p *usageProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	start := time.Now()
+	s, err := OpenStream(ctx, p.next, req)
+	if err != nil {
+		rec := p.newRecord(ctx, req, start)
+		rec.Error = err.Error()
+		_ = p.ledger.RecordUsage(context.WithoutCancel(ctx), rec)
+		return nil, err
+	}
+	return &usageEventStream{EventStream: s, owner: p, ctx: ctx, req: req, start: start}, nil
+}
+
+func (p *usageProvider) ValidateKey(ctx context.Context) error {
+	return p.next.ValidateKey(ctx)
+}
+
+// usageStream counts streamed bytes and records an estimate on Close.
+type usageStream struct {
+	io.ReadCloser
+	owner *usageProvider
+	ctx   context.Context
+	req   *Request
+	start time.Time
+	bytes int
+	once  sync.Once
+}
+
+func (s *usageStream) Read(b []byte) (int, error) {
+	n, err := s.ReadCloser.Read(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *usageStream) Close() error {
+	err := s.ReadCloser.Close()
+	s.once.Do(func() {
+		rec := s.owner.newRecord(s.ctx, s.req, s.start)
+		rec.InputTokens = estimateRequestTokens(s.req)
+		rec.OutputTokens = (s.bytes + 3) / 4
+		rec.Estimated = true
+		rec.Cost = EstimateCost(rec.Model, rec.InputTokens, rec.OutputTokens)
+		_ = s.owner.ledger.RecordUsage(context.WithoutCancel(s.ctx), rec)
+	})
+	return err
+}
+
+// usageEventStream records the usage reported by the stream on Close,
+// falling back to an estimate from the streamed text.
+type usageEventStream struct {
+	EventStream
+	owner *usageProvider
+	ctx   context.Context
+	req   *Request
+	start time.Time
+	text  int
+	final *Response
+	usage *Usage
+	once  sync.Once
+}
+
+func (s *usageEventStream) Next() bool {
+	if !s.EventStream.Next() {
+		return false
+	}
+	switch e := s.Event(); e.Type {
+	case EventText:
+		s.text += len(e.Text)
+	case EventUsage:
+		s.usage = e.Usage
+	case EventDone:
+		s.final = e.Response
+	}
+	return true
+}
+
+func (s *usageEventStream) Close() error {
+	err := s.EventStream.Close()
+	s.once.Do(func() {
+		rec := s.owner.newRecord(s.ctx, s.req, s.start)
+		usage := s.usage
+		if s.final != nil {
+			if s.final.Model != "" {
+				rec.Model = s.final.Model
+			}
+			if s.final.Usage != nil {
+				usage = s.final.Usage
+			}
+		}
+		if usage != nil {
+			rec.InputTokens = usage.InputTokens
+			rec.OutputTokens = usage.OutputTokens
+		} else {
+			rec.InputTokens = estimateRequestTokens(s.req)
+			rec.OutputTokens = (s.text + 3) / 4
+			rec.Estimated = true
+		}
+		if streamErr := s.Err(); streamErr != nil && s.final == nil {
+			rec.Error = streamErr.Error()
+		}
+		rec.Cost = EstimateCost(rec.Model, rec.InputTokens, rec.OutputTokens)
+		_ = s.owner.ledger.RecordUsage(context.WithoutCancel(s.ctx), rec)
+	})
+	return err
+}
+
+// estimateRequestTokens estimates the input size of a request.
+func estimateRequestTokens(req *Request) int {
+	n := EstimateTokens(req.System)
+	for _, m := range req.Conversation() {
+		n += EstimateTokens(m.Content)
+	}
+	return n
+}
+
+// ==================== Budgets ====================
+
+// ErrBudgetExceeded is returned when a spending limit has been reached.
+var ErrBudgetExceeded = errors.New("ai: budget exceeded")
+
+// BudgetLimits configures spending limits in USD. Zero disables a limit.
+type BudgetLimits struct {
+	Daily   float64 // Limit per calendar day (local time)
+	Monthly float64 // Limit per calendar month (local time)
+	WarnAt  float64 // Fraction of a limit that triggers a warning (default 0.8)
+}
+
+// BudgetStatus describes spend against one limit.
+type BudgetStatus struct {
+	Period string  // "daily" or "monthly"
+	Spent  float64 // Spent so far in the period
+	Limit  float64 // Configured limit
+}
+
+// BudgetError reports which limit was exceeded.
+type BudgetError struct {
+	BudgetStatus
+}
+
+// Error implements the error interface.
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("ai: %s budget exceeded ($%.2f of $%.2f)", e.Period, e.Spent, e.Limit)
+}
+
+// Unwrap makes errors.Is(err, ErrBudgetExceeded) work.
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// EnforceBudget rejects calls once a daily or monthly limit is reached and
+// calls warn (once per period) when spend passes the warning threshold.
+func EnforceBudget(ledger UsageLedger, limits BudgetLimits, warn func(BudgetStatus)) Middleware {
+	if limits.WarnAt <= 0 || limits.WarnAt > 1 {
+		limits.WarnAt = 0.8
+	}
+	return func(next Provider) Provider {
+		return &budgetProvider{
+			next:   next,
+			ledger: ledger,
+			limits: limits,
+			warn:   warn,
+			now:    time.Now,
+			warned: make(map[string]bool),
+		}
+	}
+}
+
+type budgetProvider struct {
+	next   Provider
+	ledger UsageLedger
+	limits BudgetLimits
+	warn   func(BudgetStatus)
+	now    func() time.Time
+
+	mu     sync.Mutex
+	warned map[string]bool // Periods already warned about, e.g. "daily:2024-05-01"
+}
+
+func (p *budgetProvider) Name() string { return p.next.Name() }
+
+func (p *budgetProvider) DefaultModel() string { return DefaultModel(p.next) }
+
+// check returns a *BudgetError if any limit has been reached.
+func (p *budgetProvider) check(ctx context.Context) error {
+	now := p.now()
+	y, m, d := now.Date()
+	periods := []struct {
+		name  string
+		limit float64
+		start time.Time
+		key   string
+	}{
+		{"daily", p.limits.Daily, time.Date(y, m, d, 0, 0, 0, 0, now.Location()), now.Format("2006-01-02")},
+		{"monthly", p.limits.Monthly, time.Date(y, m, 1, 0, 0, 0, 0, now.Location()), now.Format("2006-01")},
+	}
+
+	for _, period := range periods {
+		if period.limit <= 0 {
+			continue
+		}
+		spent, err := p.ledger.UsageCostSince(ctx, period.start)
+		if err != nil {
+			return fmt.Errorf("failed to check %s budget: %w", period.name, err)
+		}
+		status := BudgetStatus{Period: period.name, Spent: spent, Limit: period.limit}
+		if spent >= period.limit {
+			return &BudgetError{status}
+		}
+		if spent >= period.limit*p.limits.WarnAt && p.warn != nil {
+			p.mu.Lock()
+			key := period.name + ":" + period.key
+			first := !p.warned[key]
+			p.warned[key] = true
+			p.mu.Unlock()
+			if first {
+				p.warn(status)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *budgetProvider) Generate(ctx context.Context, req *Request) (*Response, error) {
+	if err := p.check(ctx); err != nil {
+		return nil, err
+	}
+	return p.next.Generate(ctx, req)
+}
+
+func (p *budgetProvider) GenerateStream(ctx context.Context, req *Request) (io.ReadCloser, error) {
+	if err := p.check(ctx); err != nil {
+		return nil, err
+	}
+	return p.next.GenerateStream(ctx, req)
+}
+
+func (p *budgetProvider) StreamEvents(ctx context.Context, req *Request) (EventStream, error) {
+	if err := p.check(ctx); err != nil {
+		return nil, err
+	}
+	return OpenStream(ctx, p.next, req)
+}
+
+func (p *budgetProvider) ValidateKey(ctx context.Context) error {
+	return p.next.ValidateKey(ctx)
+}
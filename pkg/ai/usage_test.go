@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// memLedger is an in-memory UsageLedger.
+type memLedger struct {
+	mu      sync.Mutex
+	records []*models.UsageRecord
+	spent   float64 // Returned by UsageCostSince
+}
+
+func (l *memLedger) RecordUsage(ctx context.Context, rec *models.UsageRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, rec)
+	return nil
+}
+
+func (l *memLedger) UsageCostSince(ctx context.Context, since time.Time) (float64, error) {
+	return l.spent, nil
+}
+
+func TestTrackUsage_RecordsCall(t *testing.T) {
+	ledger := &memLedger{}
+	fake := NewFakeProvider(FakeStep{Content: "ok", Usage: &Usage{InputTokens: 1000, OutputTokens: 500}})
+	p := Chain(fake, TrackUsage(ledger))
+
+	ctx := WithSpace(context.Background(), "work")
+	if _, err := p.Generate(ctx, &Request{Model: "claude-3-5-sonnet-20241022", Prompt: "hi"}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if len(ledger.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(ledger.records))
+	}
+	rec := ledger.records[0]
+	if rec.Provider != "fake" || rec.SpaceID != "work" || rec.InputTokens != 1000 || rec.Estimated {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	// 1000 * $3/M + 500 * $15/M
+	if want := 0.0105; rec.Cost < want-1e-9 || rec.Cost > want+1e-9 {
+		t.Errorf("expected cost %v, got %v", want, rec.Cost)
+	}
+}
+
+func TestTrackUsage_StreamAndErrors(t *testing.T) {
+	ledger := &memLedger{}
+	fake := NewFakeProvider(FakeStep{Content: "streamed text"}, FakeStep{Err: errors.New("down")})
+	p := Chain(fake, TrackUsage(ledger))
+	ctx := context.Background()
+
+	rc, err := p.GenerateStream(ctx, &Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	io.ReadAll(rc)
+	rc.Close()
+	rc.Close()
+
+	p.Generate(ctx, &Request{Prompt: "hi"})
+
+	if len(ledger.records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(ledger.records))
+	}
+	if !ledger.records[0].Estimated || ledger.records[0].OutputTokens == 0 {
+		t.Errorf("expected estimated stream usage, got %+v", ledger.records[0])
+	}
+	if ledger.records[1].Error != "down" {
+		t.Errorf("expected recorded error, got %+v", ledger.records[1])
+	}
+}
+
+func TestTrackUsage_DefaultModel(t *testing.T) {
+	ledger := &memLedger{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	local := NewLocalProvider(WithEndpoint(server.URL), WithModel("llama3"))
+	p := Chain(local, Timeout(time.Minute), TrackUsage(ledger))
+	if _, err := p.Generate(context.Background(), &Request{Prompt: "hi"}); err == nil {
+		t.Fatal("expected Generate to fail")
+	}
+
+	if len(ledger.records) != 1 || ledger.records[0].Model != "llama3" {
+		t.Fatalf("expected a record for the provider's default model, got %+v", ledger.records)
+	}
+}
+
+func TestEnforceBudget(t *testing.T) {
+	ledger := &memLedger{spent: 4.5}
+	var warnings []BudgetStatus
+	p := Chain(NewFakeProvider(FakeStep{Content: "ok"}), EnforceBudget(ledger, BudgetLimits{Daily: 5}, func(s BudgetStatus) {
+		warnings = append(warnings, s)
+	}))
+	ctx := context.Background()
+
+	// Over the warning threshold: warn once, still allowed
+	p.Generate(ctx, &Request{})
+	if _, err := p.Generate(ctx, &Request{}); err != nil {
+		t.Fatalf("expected call to pass, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Period != "daily" {
+		t.Errorf("expected one daily warning, got %+v", warnings)
+	}
+
+	// Limit reached: hard stop
+	ledger.spent = 5
+	_, err := p.Generate(ctx, &Request{})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || budgetErr.Limit != 5 {
+		t.Errorf("unexpected budget error: %v", err)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	if cost := EstimateCost("llama2", 1000, 1000); cost != 0 {
+		t.Errorf("expected unknown model to be free, got %v", cost)
+	}
+	price, ok := LookupPrice("gpt-4o-mini-2024-07-18")
+	if !ok || price.Input != 0.15 {
+		t.Errorf("expected longest prefix match, got %+v", price)
+	}
+}
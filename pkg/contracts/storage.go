@@ -161,8 +161,22 @@ type ListOptions struct {
 
 // Transaction defines the interface for database transactions.
 // Transactions provide atomicity - either all operations succeed
-// or none are applied.
+// or none are applied. Backends may serialize transactions with other
+// operations, so the storage itself should not be used by the same
+// goroutine until the transaction ends.
 type Transaction interface {
+	// SavePattern creates or updates a pattern within the transaction.
+	SavePattern(ctx context.Context, p *models.Pattern) error
+
+	// DeletePattern removes a pattern within the transaction.
+	DeletePattern(ctx context.Context, id string) error
+
+	// SaveNote creates or updates a note within the transaction.
+	SaveNote(ctx context.Context, note *models.Note) error
+
+	// DeleteNote removes a note within the transaction.
+	DeleteNote(ctx context.Context, id string) error
+
 	// Commit applies all changes made within the transaction.
 	// After Commit returns successfully, the transaction is closed.
 	Commit() error
@@ -0,0 +1,238 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+// ArchiveExt is the file extension of archives.
+const ArchiveExt = ".otrz"
+
+// ArchiveFormatVersion is the version of the archive layout written by
+// WriteArchive. Archives with a newer version are rejected.
+const ArchiveFormatVersion = 1
+
+const (
+	archiveFormat   = "otrz"
+	archiveManifest = "manifest.json"
+)
+
+// Archive holds everything in a database: a .otrz file is a zip with a
+// manifest and one JSON file per kind of item. Note links are kept apart
+// from the notes, so notes in an Archive have no PatternIDs.
+type Archive struct {
+	Manifest        ArchiveManifest
+	Spaces          []*models.Space
+	Patterns        []*models.Pattern
+	Notes           []*models.Note
+	NoteLinks       []NoteLink
+	ThoughtSessions []*models.ThoughtSession
+	ThoughtNodes    []*models.ThoughtNode
+	Events          []*models.Event
+}
+
+// ArchiveManifest describes an archive. Checksums are the SHA-256 of each
+// entry, keyed by entry name.
+type ArchiveManifest struct {
+	Format        string            `json:"format"`
+	FormatVersion int               `json:"format_version"`
+	SchemaVersion int               `json:"schema_version"` // Database schema the data came from
+	CreatedAt     time.Time         `json:"created_at"`
+	Counts        map[string]int    `json:"counts"`
+	Checksums     map[string]string `json:"checksums"`
+}
+
+// NoteLink links a note to a pattern.
+type NoteLink struct {
+	NoteID    string `json:"note_id"`
+	PatternID string `json:"pattern_id"`
+}
+
+// entries lists the archive's data files with the value each one holds.
+func (a *Archive) entries() []struct {
+	name string
+	v    interface{}
+} {
+	return []struct {
+		name string
+		v    interface{}
+	}{
+		{"spaces.json", &a.Spaces},
+		{"patterns.json", &a.Patterns},
+		{"notes.json", &a.Notes},
+		{"note_links.json", &a.NoteLinks},
+		{"thought_sessions.json", &a.ThoughtSessions},
+		{"thought_nodes.json", &a.ThoughtNodes},
+		{"events.json", &a.Events},
+	}
+}
+
+// WriteArchive writes a as a zip to w. The manifest's format, counts and
+// checksums are filled in; SchemaVersion and CreatedAt are kept if set.
+func WriteArchive(w io.Writer, a *Archive) error {
+	m := &a.Manifest
+	m.Format = archiveFormat
+	m.FormatVersion = ArchiveFormatVersion
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	m.Counts = map[string]int{
+		"spaces":           len(a.Spaces),
+		"patterns":         len(a.Patterns),
+		"notes":            len(a.Notes),
+		"note_links":       len(a.NoteLinks),
+		"thought_sessions": len(a.ThoughtSessions),
+		"thought_nodes":    len(a.ThoughtNodes),
+		"events":           len(a.Events),
+	}
+	m.Checksums = make(map[string]string)
+
+	files := make(map[string][]byte)
+	for _, e := range a.entries() {
+		data, err := json.MarshalIndent(e.v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", e.name, err)
+		}
+		files[e.name] = data
+		sum := sha256.Sum256(data)
+		m.Checksums[e.name] = hex.EncodeToString(sum[:])
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	write := func(name string, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: m.CreatedAt})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	if err := write(archiveManifest, manifest); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	for _, e := range a.entries() {
+		if err := write(e.name, files[e.name]); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// ReadArchive reads an archive, checking its format version and the
+// checksum of every entry.
+func ReadArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an archive: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	a := &Archive{}
+	if files[archiveManifest] == nil {
+		return nil, fmt.Errorf("archive has no %s", archiveManifest)
+	}
+	data, err := readZipFile(files[archiveManifest])
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if a.Manifest.Format != archiveFormat {
+		return nil, fmt.Errorf("unknown archive format %q", a.Manifest.Format)
+	}
+	if a.Manifest.FormatVersion > ArchiveFormatVersion {
+		return nil, fmt.Errorf("archive format version %d is newer than supported (%d)",
+			a.Manifest.FormatVersion, ArchiveFormatVersion)
+	}
+
+	for _, e := range a.entries() {
+		f := files[e.name]
+		if f == nil {
+			return nil, fmt.Errorf("archive has no %s", e.name)
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if want := a.Manifest.Checksums[e.name]; want != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("checksum mismatch for %s", e.name)
+		}
+		if err := json.Unmarshal(data, e.v); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", e.name, err)
+		}
+	}
+	return a, nil
+}
+
+// WriteArchiveFile writes a to path, replacing it only once complete.
+func WriteArchiveFile(path string, a *Archive) error {
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, a); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// ReadArchiveFile reads the archive at path.
+func ReadArchiveFile(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return ReadArchive(f, stat.Size())
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return data, nil
+}
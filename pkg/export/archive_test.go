@@ -0,0 +1,115 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArmyClaw/open-think-reflex/pkg/models"
+)
+
+func testArchive() *Archive {
+	p := models.NewPattern("greet", "hello")
+	n := models.NewNote("Plan", "ship it")
+	sess := models.NewThoughtSession("ideas")
+	return &Archive{
+		Manifest:        ArchiveManifest{SchemaVersion: 6},
+		Spaces:          []*models.Space{{ID: "global", Name: "Global"}},
+		Patterns:        []*models.Pattern{p},
+		Notes:           []*models.Note{n},
+		NoteLinks:       []NoteLink{{NoteID: n.ID, PatternID: p.ID}},
+		ThoughtSessions: []*models.ThoughtSession{sess},
+		ThoughtNodes:    []*models.ThoughtNode{models.NewThoughtNode(sess.ID, "", "first")},
+		Events:          []*models.Event{{ID: "e1", Type: "pattern.used", Timestamp: time.Unix(100, 0), PatternID: p.ID}},
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	a := testArchive()
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, a); err != nil {
+		t.Fatalf("WriteArchive failed: %v", err)
+	}
+
+	got, err := ReadArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadArchive failed: %v", err)
+	}
+	if got.Manifest.FormatVersion != ArchiveFormatVersion || got.Manifest.SchemaVersion != 6 {
+		t.Errorf("unexpected manifest: %+v", got.Manifest)
+	}
+	if got.Manifest.Counts["patterns"] != 1 || got.Manifest.Counts["thought_nodes"] != 1 {
+		t.Errorf("unexpected counts: %v", got.Manifest.Counts)
+	}
+	if got.Patterns[0].Response != "hello" || got.Notes[0].Content != "ship it" {
+		t.Errorf("content did not round-trip: %+v %+v", got.Patterns[0], got.Notes[0])
+	}
+	if got.NoteLinks[0] != a.NoteLinks[0] || got.ThoughtNodes[0].Text != "first" || got.Events[0].PatternID != a.Patterns[0].ID {
+		t.Errorf("links, thoughts or events did not round-trip")
+	}
+}
+
+// rewriteArchive copies an archive, passing each entry through edit.
+func rewriteArchive(t *testing.T, data []byte, edit func(name string, body []byte) []byte) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		w, _ := zw.Create(f.Name)
+		w.Write(edit(f.Name, body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadArchive_Rejects(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, testArchive()); err != nil {
+		t.Fatalf("WriteArchive failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(name string, body []byte) []byte
+		want string
+	}{
+		{"tampered entry", func(name string, body []byte) []byte {
+			if name == "patterns.json" {
+				return bytes.Replace(body, []byte("hello"), []byte("HELLO"), 1)
+			}
+			return body
+		}, "checksum mismatch"},
+		{"newer format", func(name string, body []byte) []byte {
+			if name == archiveManifest {
+				return bytes.Replace(body, []byte(`"format_version": 1`), []byte(`"format_version": 99`), 1)
+			}
+			return body
+		}, "newer than supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := rewriteArchive(t, buf.Bytes(), tt.edit)
+			_, err := ReadArchive(bytes.NewReader(data), int64(len(data)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := ReadArchive(strings.NewReader("not a zip"), 9); err == nil {
+		t.Error("expected a non-zip file to be rejected")
+	}
+}
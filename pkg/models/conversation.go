@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Conversation message roles
+const (
+	RoleUser      = "user"      // Message written by the user
+	RoleAssistant = "assistant" // Message generated by the AI
+)
+
+// Conversation is a multi-turn exchange with an AI provider.
+// Each conversation is linked to a thought session so that its turns
+// show up alongside the rest of the user's thinking.
+type Conversation struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"` // Linked thought session
+	Title     string    `json:"title"`
+	SpaceID   string    `json:"space_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConversationMessage is a single turn in a conversation.
+type ConversationMessage struct {
+	ID             string              `json:"id"`
+	ConversationID string              `json:"conversation_id"`
+	Role           string              `json:"role"` // RoleUser or RoleAssistant
+	Content        string              `json:"content"`
+	Attachments    []MessageAttachment `json:"attachments,omitempty"`
+	PatternIDs     []string            `json:"pattern_ids,omitempty"` // Patterns matched for this turn
+	CreatedAt      time.Time           `json:"created_at"`
+}
+
+// MessageAttachment is a file attached to a conversation message.
+type MessageAttachment struct {
+	Name      string `json:"name"`
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"`
+}
+
+// NewConversation creates a conversation linked to a thought session.
+func NewConversation(sessionID, title, spaceID string) *Conversation {
+	now := time.Now()
+	return &Conversation{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Title:     title,
+		SpaceID:   spaceID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// NewConversationMessage creates a message for a conversation.
+func NewConversationMessage(conversationID, role, content string) *ConversationMessage {
+	return &ConversationMessage{
+		ID:             uuid.New().String(),
+		ConversationID: conversationID,
+		Role:           role,
+		Content:        content,
+		CreatedAt:      time.Now(),
+	}
+}
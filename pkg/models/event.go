@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Event is an entry in the event log, kept for auditing.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   string    `json:"payload,omitempty"` // Usually JSON
+	Source    string    `json:"source,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	PatternID string    `json:"pattern_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+}
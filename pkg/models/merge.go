@@ -0,0 +1,10 @@
+package models
+
+// PatternMerge folds duplicate patterns into one.
+// Keep holds the combined pattern; the patterns in Merged are deleted and
+// their triggers (and aliases) become aliases of Keep.
+type PatternMerge struct {
+	Keep    *Pattern `json:"keep"`
+	Merged  []string `json:"merged"`  // IDs of the patterns folded into Keep
+	Aliases []string `json:"aliases"` // Extra triggers that resolve to Keep
+}
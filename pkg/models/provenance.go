@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Provenance sources
+const (
+	ProvenanceAI = "ai" // Pattern content was generated by an AI provider
+)
+
+// PatternProvenance records where a pattern's response came from.
+// A pattern has at most one provenance record, describing its latest response.
+type PatternProvenance struct {
+	PatternID       string    `json:"pattern_id"`
+	Source          string    `json:"source"`                      // e.g., ProvenanceAI
+	Provider        string    `json:"provider,omitempty"`          // Provider that generated the response
+	Model           string    `json:"model,omitempty"`             // Model that generated the response
+	Query           string    `json:"query,omitempty"`             // User input that produced the response
+	ConversationID  string    `json:"conversation_id,omitempty"`   // Conversation the response came from
+	MessageID       string    `json:"message_id,omitempty"`        // Assistant message holding the response
+	SourcePatternID string    `json:"source_pattern_id,omitempty"` // Pattern matched when generating
+	CreatedAt       time.Time `json:"created_at"`
+}
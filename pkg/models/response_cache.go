@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// CachedResponse is a persisted AI response, keyed by a hash of the request.
+type CachedResponse struct {
+	Key          string     `json:"key"`
+	Provider     string     `json:"provider"`
+	Model        string     `json:"model"`
+	Content      string     `json:"content"`
+	InputTokens  int        `json:"input_tokens"`
+	OutputTokens int        `json:"output_tokens"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Hits         int        `json:"hits"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	LastHitAt    *time.Time `json:"last_hit_at,omitempty"`
+}
+
+// Expired reports whether the entry is past its expiry at now.
+func (c *CachedResponse) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// ResponseCacheStats summarizes the persistent response cache.
+type ResponseCacheStats struct {
+	Entries     int        `json:"entries"`      // Stored entries, including expired
+	Expired     int        `json:"expired"`      // Entries past their expiry
+	Hits        int        `json:"hits"`         // Total hits served from storage
+	Bytes       int64      `json:"bytes"`        // Total size of cached content
+	SavedTokens int        `json:"saved_tokens"` // Tokens not re-sent thanks to hits
+	OldestEntry *time.Time `json:"oldest_entry,omitempty"`
+	NewestEntry *time.Time `json:"newest_entry,omitempty"`
+}
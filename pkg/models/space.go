@@ -21,6 +21,9 @@ type Space struct {
 	DefaultSpace bool `json:"default_space" db:"is_default"`
 	PatternLimit int  `json:"pattern_limit" db:"pattern_limit"`
 
+	// Encrypted spaces keep responses and notes encrypted at rest
+	Encrypted bool `json:"encrypted,omitempty" db:"encrypted"`
+
 	// Statistics
 	PatternCount int `json:"pattern_count" db:"pattern_count"`
 }
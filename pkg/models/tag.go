@@ -0,0 +1,54 @@
+package models
+
+import "strings"
+
+// TagSeparator separates the levels of hierarchical tags, e.g. "api/users".
+const TagSeparator = "/"
+
+// Tag is a tag shared by patterns and notes, with usage counts.
+type Tag struct {
+	Name     string `json:"name"`
+	Patterns int    `json:"patterns"` // Patterns carrying the tag
+	Notes    int    `json:"notes"`    // Notes carrying the tag
+}
+
+// Depth returns the tag's level in the hierarchy (0 for top-level tags).
+func (t *Tag) Depth() int {
+	return strings.Count(t.Name, TagSeparator)
+}
+
+// NormalizeTag trims a tag name and each of its levels, dropping empty
+// levels: " api// users/ " becomes "api/users".
+func NormalizeTag(name string) string {
+	var parts []string
+	for _, part := range strings.Split(name, TagSeparator) {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, TagSeparator)
+}
+
+// NormalizeTags normalizes tag names and drops empty and duplicate tags
+// (compared case-insensitively, the first spelling wins).
+func NormalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// TagUnder reports whether tag is root or one of its descendants
+// ("api/users" is under "api"), ignoring case.
+func TagUnder(tag, root string) bool {
+	tag, root = strings.ToLower(tag), strings.ToLower(root)
+	return tag == root || strings.HasPrefix(tag, root+TagSeparator)
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"trims levels", []string{" api// users/ "}, []string{"api/users"}},
+		{"drops empty", []string{"", " ", "/"}, nil},
+		{"dedupes ignoring case", []string{"API", "api", "Ops"}, []string{"API", "Ops"}},
+		{"collapses spaces", []string{"machine   learning"}, []string{"machine learning"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTags(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagUnder(t *testing.T) {
+	tests := []struct {
+		tag, root string
+		want      bool
+	}{
+		{"api", "api", true},
+		{"api/users", "api", true},
+		{"API/Users", "api", true},
+		{"apis", "api", false},
+		{"api", "api/users", false},
+	}
+
+	for _, tt := range tests {
+		if got := TagUnder(tt.tag, tt.root); got != tt.want {
+			t.Errorf("TagUnder(%q, %q) = %v, want %v", tt.tag, tt.root, got, tt.want)
+		}
+	}
+}
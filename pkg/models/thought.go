@@ -8,19 +8,19 @@ import (
 
 // ThoughtSession groups a sequence of thought nodes.
 type ThoughtSession struct {
-	ID        string
-	Title     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // ThoughtNode is a single thought entry in a session.
 type ThoughtNode struct {
-	ID        string
-	SessionID string
-	ParentID  string
-	Text      string
-	CreatedAt time.Time
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 func NewThoughtSession(title string) *ThoughtSession {
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UsageRecord is one AI provider call in the token usage ledger.
+type UsageRecord struct {
+	ID           int64         `json:"id"`
+	Provider     string        `json:"provider"`
+	Model        string        `json:"model"`
+	SpaceID      string        `json:"space_id"`
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+	Latency      time.Duration `json:"latency"`
+	Cost         float64       `json:"cost"`      // Estimated cost in USD
+	Estimated    bool          `json:"estimated"` // Token counts estimated (e.g., streams)
+	Error        string        `json:"error,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// UsageSummary aggregates usage records for one group in a report.
+type UsageSummary struct {
+	Key          string        `json:"key"` // Day, space or model, depending on grouping
+	Calls        int           `json:"calls"`
+	Errors       int           `json:"errors"`
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+	Cost         float64       `json:"cost"`
+	AvgLatency   time.Duration `json:"avg_latency"`
+}